@@ -0,0 +1,735 @@
+package main
+
+import "fmt"
+
+// Amd64 generates code for x86-64 following the System V AMD64 ABI, in AT&T syntax.
+type Amd64 struct {
+	os *OS
+	// Function being emitted.
+	function   *IrFunction
+	allocation *Allocation
+	// Size of the area at the bottom of the frame for the values of calls passed on the stack.
+	outgoing int
+}
+
+var amd64ArgumentRegisters = []string{"%rdi", "%rsi", "%rdx", "%rcx", "%r8", "%r9"}
+
+// The ABI returns at most two words in %rax and %rdx. The compiled functions return more results in the argument registers, which the callers expect.
+var amd64ResultRegisters = []string{"%rax", "%rdx", "%rdi", "%rsi", "%rcx", "%r8", "%r9"}
+
+// Registers for the allocator. The argument registers and %rax are left as scratch, which some instructions use implicitly.
+var amd64Registers = RegisterSet{
+	CalleeSaved: []string{"%rbx", "%r12", "%r13", "%r14", "%r15"},
+	CallerSaved: []string{"%r10", "%r11"},
+}
+
+// Instructions corresponding to the binary operations which x86-64 has as is.
+var amd64BinaryInstructions = map[IrOp]string{
+	IrAdd: "add",
+	IrSub: "sub",
+	IrMul: "imul",
+	IrAnd: "and",
+	IrOr:  "or",
+	IrXor: "xor",
+}
+
+// Suffixes of setcc and jcc corresponding to the comparisons.
+var amd64ConditionCodes = map[IrOp]string{
+	IrEq: "e",
+	IrNe: "ne",
+	IrLt: "l",
+	IrLe: "le",
+	IrGt: "g",
+	IrGe: "ge",
+}
+
+var amd64UnsignedConditionCodes = map[IrOp]string{
+	IrEq: "e",
+	IrNe: "ne",
+	IrLt: "b",
+	IrLe: "be",
+	IrGt: "a",
+	IrGe: "ae",
+}
+
+// Instructions which extend the lowest bits of %rax to the whole of it, for each narrow type.
+var amd64Extensions = map[*IrType]string{
+	&IrI8:  "movsbq %al, %rax",
+	&IrI16: "movswq %ax, %rax",
+	&IrI32: "movslq %eax, %rax",
+	&IrU8:  "movzbl %al, %eax",
+	&IrU16: "movzwl %ax, %eax",
+	// Writing a 32-bit register clears the upper half.
+	&IrU32: "movl %eax, %eax",
+}
+
+// Instructions which load a value of each type from memory into %rax, extending it to the whole register.
+// Writing a 32-bit register clears the upper half.
+var amd64Loads = map[*IrType]string{
+	&IrI8:   "movsbq %s, %%rax",
+	&IrI16:  "movswq %s, %%rax",
+	&IrI32:  "movslq %s, %%rax",
+	&IrU8:   "movzbl %s, %%eax",
+	&IrU16:  "movzwl %s, %%eax",
+	&IrU32:  "movl %s, %%eax",
+	&IrBool: "movzbl %s, %%eax",
+}
+
+// Instructions which store the lowest bytes of %rax to memory, for each size.
+var amd64Stores = map[int]string{
+	1: "movb %%al, %s",
+	2: "movw %%ax, %s",
+	4: "movl %%eax, %s",
+	8: "movq %%rax, %s",
+}
+
+func (amd64 *Amd64) Header() {
+	amd64.os.TextSection()
+}
+
+func (amd64 *Amd64) Footer() {
+	amd64.os.Footer()
+}
+
+func (amd64 *Amd64) CommentPrefix() string {
+	return "# "
+}
+
+func (amd64 *Amd64) OS() *OS {
+	return amd64.os
+}
+
+// Function outputs `function` with its virtual registers in the registers assigned by the allocator.
+// Each instruction moves its operands into scratch registers and the result back to where the destination lives.
+func (amd64 *Amd64) Function(function *IrFunction) {
+	amd64.function = function
+	amd64.allocation = AllocateRegisters(function, &amd64Registers)
+	amd64.outgoing = outgoingSize(function, len(amd64ArgumentRegisters), len(amd64ResultRegisters), false)
+	amd64.os.FunctionLabel(function.Name)
+
+	code("push %%rbp")
+	code("mov %%rsp, %%rbp")
+	if size := frameSize(function, amd64.allocation, amd64.outgoing); size > 0 {
+		code("sub $%d, %%rsp", size)
+	}
+	for i, register := range amd64.allocation.UsedCalleeSaved {
+		code("mov %s, %s", register, amd64.savedSlot(i))
+	}
+	for i, param := range function.Params {
+		if i < len(amd64ArgumentRegisters) {
+			amd64.store(amd64ArgumentRegisters[i], param)
+		}
+	}
+	// The rest of the parameters are on the stack just above the saved frame pointer and the return address.
+	offsets, _ := stackLayout(stackTypes(function.Params, len(amd64ArgumentRegisters)), false)
+	for i, offset := range offsets {
+		param := function.Params[len(amd64ArgumentRegisters)+i]
+		amd64.loadStack(param.Ty, fmt.Sprintf("%d(%%rbp)", 16+offset))
+		amd64.store("%rax", param)
+	}
+
+	for _, block := range function.Blocks {
+		label(blockLabel(function, block))
+		for _, instr := range block.Instrs {
+			comment("%s", instr)
+			amd64.instr(block, instr)
+		}
+	}
+}
+
+// slotAt returns the memory operand of the `i`th slot of 8 bytes, placed just below the saved frame pointer.
+func slotAt(i int) string {
+	return fmt.Sprintf("%d(%%rbp)", -(i+1)*8)
+}
+
+// savedSlot returns the memory operand of the slot for the `i`th used callee-saved register, placed below the spilled ones.
+func (amd64 *Amd64) savedSlot(i int) string {
+	return slotAt(amd64.allocation.NumSlots + i)
+}
+
+// stackArea returns the offset from the frame pointer of the stack area of the function, placed below the saved callee-saved registers.
+func (amd64 *Amd64) stackArea() int {
+	return -(amd64.allocation.NumSlots+len(amd64.allocation.UsedCalleeSaved))*8 - stackAreaSize(amd64.function)
+}
+
+// operand returns the register holding `reg`, or the memory operand of its slot if it is spilled.
+func (amd64 *Amd64) operand(reg *IrReg) string {
+	if register, ok := amd64.allocation.Registers[reg]; ok {
+		return register
+	}
+	return slotAt(amd64.allocation.Slots[reg])
+}
+
+func (amd64 *Amd64) load(register string, reg *IrReg) {
+	if src := amd64.operand(reg); src != register {
+		code("mov %s, %s", src, register)
+	}
+}
+
+func (amd64 *Amd64) store(register string, reg *IrReg) {
+	if dst := amd64.operand(reg); dst != register {
+		code("mov %s, %s", register, dst)
+	}
+}
+
+// loadStack loads a value of `ty` at `address` on the stack into %rax, extending it to the whole register.
+func (amd64 *Amd64) loadStack(ty *IrType, address string) {
+	format, ok := amd64Loads[ty]
+	if !ok {
+		format = "movq %s, %%rax"
+	}
+	code(format, address)
+}
+
+func (amd64 *Amd64) instr(block *IrBlock, instr *IrInstr) {
+	switch op := instr.Op; op {
+	case IrConst:
+		if int64(int32(instr.Imm)) == instr.Imm {
+			code("movq $%d, %s", instr.Imm, amd64.operand(instr.Dst))
+		} else {
+			// Only movabs takes a 64-bit immediate, into a register.
+			code("movabs $%d, %%rax", instr.Imm)
+			amd64.store("%rax", instr.Dst)
+		}
+	case IrAddr:
+		code("lea %s(%%rip), %%rax", amd64.os.Symbol(instr.Symbol))
+		amd64.store("%rax", instr.Dst)
+	case IrStackAddr:
+		code("lea %d(%%rbp), %%rax", amd64.stackArea()+int(instr.Imm))
+		amd64.store("%rax", instr.Dst)
+	case IrLoad:
+		amd64.load("%rdi", instr.Args[0])
+		format, ok := amd64Loads[instr.Dst.Ty]
+		if !ok {
+			format = "movq %s, %%rax"
+		}
+		code(format, fmt.Sprintf("%d(%%rdi)", instr.Imm))
+		amd64.store("%rax", instr.Dst)
+	case IrStore:
+		amd64.load("%rdi", instr.Args[0])
+		amd64.load("%rax", instr.Args[1])
+		code(amd64Stores[instr.Args[1].Ty.Size], fmt.Sprintf("%d(%%rdi)", instr.Imm))
+	case IrCopy:
+		amd64.load("%rax", instr.Args[0])
+		amd64.store("%rax", instr.Dst)
+	case IrAdd, IrSub, IrMul, IrAnd, IrOr, IrXor:
+		amd64.load("%rax", instr.Args[0])
+		amd64.load("%rdi", instr.Args[1])
+		code("%s %%rdi, %%rax", amd64BinaryInstructions[op])
+		amd64.extend(instr.Dst.Ty)
+		amd64.store("%rax", instr.Dst)
+	case IrAndNot:
+		amd64.load("%rax", instr.Args[0])
+		amd64.load("%rdi", instr.Args[1])
+		code("not %%rdi")
+		code("and %%rdi, %%rax")
+		amd64.store("%rax", instr.Dst)
+	case IrDiv, IrRem:
+		amd64.load("%rax", instr.Args[0])
+		amd64.load("%rdi", instr.Args[1])
+		if instr.Dst.Ty.Unsigned {
+			code("xor %%edx, %%edx")
+			code("div %%rdi")
+		} else {
+			// idiv traps on the overflow of the most negative value divided by -1, whose quotient is itself and remainder 0 in Go.
+			code("cmp $-1, %%rdi")
+			code("jne 1f")
+			code("neg %%rax")
+			code("xor %%edx, %%edx")
+			code("jmp 2f")
+			label("1")
+			code("cqo")
+			code("idiv %%rdi")
+			label("2")
+		}
+		if op == IrDiv {
+			amd64.extend(instr.Dst.Ty)
+			amd64.store("%rax", instr.Dst)
+		} else {
+			amd64.store("%rdx", instr.Dst)
+		}
+	case IrShl:
+		amd64.load("%rax", instr.Args[0])
+		amd64.load("%rcx", instr.Args[1])
+		// Unlike shl, which masks the count to 6 bits, shifting by 64 or more yields 0 in Go.
+		code("shl %%cl, %%rax")
+		code("xor %%edx, %%edx")
+		code("cmp $63, %%rcx")
+		code("cmova %%rdx, %%rax")
+		amd64.extend(instr.Dst.Ty)
+		amd64.store("%rax", instr.Dst)
+	case IrShr:
+		amd64.load("%rax", instr.Args[0])
+		amd64.load("%rcx", instr.Args[1])
+		if instr.Dst.Ty.Unsigned {
+			code("shr %%cl, %%rax")
+			code("xor %%edx, %%edx")
+			code("cmp $63, %%rcx")
+			code("cmova %%rdx, %%rax")
+			amd64.store("%rax", instr.Dst)
+			break
+		}
+		// Unlike sar, which masks the count to 6 bits, shifting by 64 or more fills all bits with the sign bit in Go.
+		code("mov $63, %%edx")
+		code("cmp %%rdx, %%rcx")
+		code("cmova %%rdx, %%rcx")
+		code("sar %%cl, %%rax")
+		amd64.store("%rax", instr.Dst)
+	case IrEq, IrNe, IrLt, IrLe, IrGt, IrGe:
+		amd64.load("%rax", instr.Args[0])
+		amd64.load("%rdi", instr.Args[1])
+		code("cmp %%rdi, %%rax")
+		if instr.Args[0].Ty.Unsigned {
+			code("set%s %%al", amd64UnsignedConditionCodes[op])
+		} else {
+			code("set%s %%al", amd64ConditionCodes[op])
+		}
+		code("movzb %%al, %%eax")
+		amd64.store("%rax", instr.Dst)
+	case IrNeg:
+		amd64.load("%rax", instr.Args[0])
+		code("neg %%rax")
+		amd64.extend(instr.Dst.Ty)
+		amd64.store("%rax", instr.Dst)
+	case IrCompl:
+		amd64.load("%rax", instr.Args[0])
+		code("not %%rax")
+		amd64.extend(instr.Dst.Ty)
+		amd64.store("%rax", instr.Dst)
+	case IrNot:
+		amd64.load("%rax", instr.Args[0])
+		code("xor $1, %%rax")
+		amd64.store("%rax", instr.Dst)
+	case IrConv:
+		amd64.load("%rax", instr.Args[0])
+		amd64.extend(instr.Dst.Ty)
+		amd64.store("%rax", instr.Dst)
+	case IrCall:
+		// The arguments which do not fit in the registers are passed at the bottom of the stack.
+		offsets, _ := stackLayout(stackTypes(instr.Args, len(amd64ArgumentRegisters)), false)
+		for i, offset := range offsets {
+			amd64.load("%rax", instr.Args[len(amd64ArgumentRegisters)+i])
+			code("mov %%rax, %d(%%rsp)", offset)
+		}
+		// Allocated registers never overlap the argument registers, so the arguments can be moved in any order.
+		for i, arg := range instr.Args {
+			if i < len(amd64ArgumentRegisters) {
+				amd64.load(amd64ArgumentRegisters[i], arg)
+			}
+		}
+		code("call %s", amd64.os.Symbol(instr.Callee))
+		for i, result := range instr.Results {
+			if i < len(amd64ResultRegisters) {
+				amd64.store(amd64ResultRegisters[i], result)
+			}
+		}
+		// %rax is free after the results in the registers are stored.
+		offsets, _ = stackLayout(stackTypes(instr.Results, len(amd64ResultRegisters)), false)
+		for i, offset := range offsets {
+			result := instr.Results[len(amd64ResultRegisters)+i]
+			amd64.loadStack(result.Ty, fmt.Sprintf("%d(%%rsp)", offset))
+			amd64.store("%rax", result)
+		}
+	case IrBoundsCheck:
+		// The callee never returns, so the registers need not be preserved.
+		amd64.load("%rdi", instr.Args[0])
+		amd64.load("%rsi", instr.Args[1])
+		code("cmp %%rsi, %%rdi")
+		if instr.Imm == 1 {
+			code("jbe 1f")
+		} else {
+			code("jb 1f")
+		}
+		code("call %s", amd64.os.Symbol(instr.Callee))
+		label("1")
+	case IrRet:
+		// The results which do not fit in the registers are returned in the area of the caller for the arguments on the stack.
+		offsets, _ := stackLayout(stackTypes(instr.Args, len(amd64ResultRegisters)), false)
+		for i, offset := range offsets {
+			amd64.load("%rax", instr.Args[len(amd64ResultRegisters)+i])
+			code("mov %%rax, %d(%%rbp)", 16+offset)
+		}
+		for i, arg := range instr.Args {
+			if i < len(amd64ResultRegisters) {
+				amd64.load(amd64ResultRegisters[i], arg)
+			}
+		}
+		for i, register := range amd64.allocation.UsedCalleeSaved {
+			code("mov %s, %s", amd64.savedSlot(i), register)
+		}
+		code("mov %%rbp, %%rsp")
+		code("pop %%rbp")
+		code("ret")
+	case IrJump:
+		amd64.jump(block, instr.Targets[0])
+	case IrBranch:
+		then, els := instr.Targets[0], instr.Targets[1]
+		amd64.load("%rax", instr.Args[0])
+		code("test %%rax, %%rax")
+		if then == nextBlock(amd64.function, block) {
+			code("jz %s", blockLabel(amd64.function, els))
+		} else {
+			code("jnz %s", blockLabel(amd64.function, then))
+			amd64.jump(block, els)
+		}
+	}
+}
+
+// extend sign- or zero-extends the value of narrow type `ty` in %rax to the whole register.
+func (amd64 *Amd64) extend(ty *IrType) {
+	if extension, ok := amd64Extensions[ty]; ok {
+		code("%s", extension)
+	}
+}
+
+// jump jumps from `block` to `target`, or falls through if `target` immediately follows.
+func (amd64 *Amd64) jump(block *IrBlock, target *IrBlock) {
+	if target != nextBlock(amd64.function, block) {
+		code("jmp %s", blockLabel(amd64.function, target))
+	}
+}
+
+// syscall invokes the system call which is named as in Linux.
+// The numbers of Darwin are those of the BSD class, marked by 0x2000000.
+func (amd64 *Amd64) syscall(name string) {
+	numbers := map[string][2]int{
+		"exit":  {60, 0x2000001},
+		"mmap":  {9, 0x20000c5},
+		"write": {1, 0x2000004},
+	}
+	if amd64.os.elf {
+		code("mov $%d, %%eax", numbers[name][0])
+	} else {
+		code("mov $%#x, %%eax", numbers[name][1])
+	}
+	code("syscall")
+}
+
+// Runtime outputs the runtime functions, written by hand as leaf routines or ones calling only each other.
+// They use only the argument and scratch registers, which callers never expect to be preserved.
+func (amd64 *Amd64) Runtime() {
+	symbol := amd64.os.Symbol
+
+	// printstring(ptr, len) writes the bytes to the standard output, or to the standard error once a panic sets runtime.stderr.
+	amd64.os.FunctionLabel("runtime.printstring")
+	code("mov %%rsi, %%rdx")
+	code("mov %%rdi, %%rsi")
+	code("movzbl %s(%%rip), %%edi", symbol("runtime.stderr"))
+	code("inc %%edi")
+	amd64.syscall("write")
+	code("ret")
+
+	// printint(n) writes n in decimal, and printuint(n) writes n as unsigned.
+	// Both pass the absolute value, whether it is negative and the base to printdigits.
+	amd64.os.FunctionLabel("runtime.printint")
+	// The absolute value of the minimum integer is correct as unsigned.
+	code("mov %%rdi, %%rax")
+	code("neg %%rax")
+	code("cmovl %%rdi, %%rax")
+	code("mov %%rdi, %%r8")
+	code("shr $63, %%r8")
+	code("mov $10, %%ecx")
+	code("jmp %s", amd64.os.LocalLabel("runtime.printdigits"))
+	// printpointer(p) writes p in hexadecimal prefixed with 0x.
+	amd64.os.FunctionLabel("runtime.printpointer")
+	code("push %%rdi")
+	code("lea %s(%%rip), %%rdi", amd64.os.LocalLabel("runtime.hexprefix"))
+	code("mov $2, %%esi")
+	code("call %s", symbol("runtime.printstring"))
+	code("pop %%rax")
+	code("xor %%r8d, %%r8d")
+	code("mov $16, %%ecx")
+	code("jmp %s", amd64.os.LocalLabel("runtime.printdigits"))
+	amd64.os.FunctionLabel("runtime.printuint")
+	code("mov %%rdi, %%rax")
+	code("xor %%r8d, %%r8d")
+	code("mov $10, %%ecx")
+	// Converts the digits from the last one into a buffer on the stack.
+	label(amd64.os.LocalLabel("runtime.printdigits"))
+	code("push %%rbp")
+	code("mov %%rsp, %%rbp")
+	code("sub $32, %%rsp")
+	code("mov %%rbp, %%rsi")
+	code("lea %s(%%rip), %%r9", amd64.os.LocalLabel("runtime.digits"))
+	label("1")
+	code("xor %%edx, %%edx")
+	code("div %%rcx")
+	code("movzbl (%%r9,%%rdx), %%edx")
+	code("dec %%rsi")
+	code("mov %%dl, (%%rsi)")
+	code("test %%rax, %%rax")
+	code("jnz 1b")
+	code("test %%r8, %%r8")
+	code("jz 2f")
+	code("dec %%rsi")
+	code("movb $'-', (%%rsi)")
+	label("2")
+	code("mov %%rsi, %%rdi")
+	code("mov %%rbp, %%rsi")
+	code("sub %%rdi, %%rsi")
+	code("call %s", symbol("runtime.printstring"))
+	code("leave")
+	code("ret")
+
+	// printbool(b) writes true or false.
+	amd64.os.FunctionLabel("runtime.printbool")
+	code("test %%rdi, %%rdi")
+	code("jz 1f")
+	code("lea %s(%%rip), %%rdi", amd64.os.LocalLabel("runtime.true"))
+	code("mov $4, %%esi")
+	code("jmp %s", symbol("runtime.printstring"))
+	label("1")
+	code("lea %s(%%rip), %%rdi", amd64.os.LocalLabel("runtime.false"))
+	code("mov $5, %%esi")
+	code("jmp %s", symbol("runtime.printstring"))
+	label(amd64.os.LocalLabel("runtime.true"))
+	code(".ascii \"true\"")
+	label(amd64.os.LocalLabel("runtime.false"))
+	code(".ascii \"false\"")
+	label(amd64.os.LocalLabel("runtime.digits"))
+	code(".ascii \"0123456789abcdef\"")
+	label(amd64.os.LocalLabel("runtime.hexprefix"))
+	code(".ascii \"0x\"")
+
+	// alloc(size) returns memory of size bytes aligned to 8 bytes from the arena. When the arena runs out, it maps a new one
+	// of heapSize bytes, or of the size if it is larger, and dies of a fatal error if the memory cannot be mapped.
+	// An arena is never mapped at address 0, so the memory of even 0 bytes is not nil.
+	amd64.os.FunctionLabel("runtime.alloc")
+	code("mov %s(%%rip), %%rax", symbol("runtime.heapptr"))
+	code("test %%rax, %%rax")
+	code("jz 1f")
+	code("lea 7(%%rax,%%rdi), %%rdx")
+	code("and $-8, %%rdx")
+	code("cmp %s(%%rip), %%rdx", symbol("runtime.heapend"))
+	code("ja 1f")
+	code("mov %%rdx, %s(%%rip)", symbol("runtime.heapptr"))
+	code("ret")
+	label("1")
+	code("push %%rdi")
+	code("lea 7(%%rdi), %%rsi")
+	code("and $-8, %%rsi")
+	code("mov $%d, %%eax", heapSize)
+	code("cmp %%rax, %%rsi")
+	code("cmovb %%rax, %%rsi")
+	code("push %%rsi")
+	// mmap(nil, size, PROT_READ|PROT_WRITE, MAP_PRIVATE|MAP_ANONYMOUS, -1, 0)
+	code("xor %%edi, %%edi")
+	code("mov $3, %%edx")
+	if amd64.os.elf {
+		code("mov $0x22, %%r10d")
+	} else {
+		code("mov $0x1002, %%r10d")
+	}
+	code("mov $-1, %%r8")
+	code("xor %%r9d, %%r9d")
+	amd64.syscall("mmap")
+	code("pop %%rsi")
+	code("pop %%rdi")
+	// Linux returns a negative errno, and macOS sets the carry flag.
+	if amd64.os.elf {
+		code("cmp $-4096, %%rax")
+		code("ja %s", symbol("runtime.outOfMemory"))
+	} else {
+		code("jc %s", symbol("runtime.outOfMemory"))
+	}
+	code("mov %%rax, %s(%%rip)", symbol("runtime.heapptr"))
+	code("add %%rax, %%rsi")
+	code("mov %%rsi, %s(%%rip)", symbol("runtime.heapend"))
+	code("jmp %s", symbol("runtime.alloc"))
+
+	// concatstring(ptr1, len1, ptr2, len2) returns a new string of the two strings.
+	amd64.os.FunctionLabel("runtime.concatstring")
+	code("push %%rbp")
+	code("mov %%rsp, %%rbp")
+	code("push %%rdi")
+	code("push %%rsi")
+	code("push %%rdx")
+	code("push %%rcx")
+	code("lea (%%rsi,%%rcx), %%rdi")
+	code("call %s", symbol("runtime.alloc"))
+	code("mov %%rax, %%rdi")
+	code("mov -8(%%rbp), %%rsi")
+	code("mov -16(%%rbp), %%rcx")
+	code("rep movsb")
+	code("mov -24(%%rbp), %%rsi")
+	code("mov -32(%%rbp), %%rcx")
+	code("rep movsb")
+	code("mov -16(%%rbp), %%rdx")
+	code("add -32(%%rbp), %%rdx")
+	code("leave")
+	code("ret")
+
+	// cmpstring(ptr1, len1, ptr2, len2) returns -1, 0 or 1 comparing the strings bytewise.
+	amd64.os.FunctionLabel("runtime.cmpstring")
+	code("mov %%rsi, %%r8")
+	code("cmp %%rcx, %%r8")
+	code("cmova %%rcx, %%r8")
+	code("xor %%r9d, %%r9d")
+	label("1")
+	code("cmp %%r8, %%r9")
+	code("je 2f")
+	code("movzbl (%%rdi,%%r9), %%eax")
+	code("movzbl (%%rdx,%%r9), %%r10d")
+	code("cmp %%r10d, %%eax")
+	code("jne 3f")
+	code("inc %%r9")
+	code("jmp 1b")
+	label("2")
+	// The common prefix is the same, so the shorter string is less.
+	code("cmp %%rcx, %%rsi")
+	label("3")
+	code("seta %%al")
+	code("setb %%cl")
+	code("sub %%cl, %%al")
+	code("movsbq %%al, %%rax")
+	code("ret")
+
+	// memmove(dst, src, n) copies n bytes, backward if the destination is above the source, where they may overlap.
+	amd64.os.FunctionLabel("runtime.memmove")
+	code("mov %%rdx, %%rcx")
+	code("cmp %%rsi, %%rdi")
+	code("jbe 1f")
+	code("lea -1(%%rdi,%%rcx), %%rdi")
+	code("lea -1(%%rsi,%%rcx), %%rsi")
+	code("std")
+	code("rep movsb")
+	code("cld")
+	code("ret")
+	label("1")
+	code("rep movsb")
+	code("ret")
+
+	// memclr(ptr, n) clears n bytes.
+	amd64.os.FunctionLabel("runtime.memclr")
+	code("mov %%rsi, %%rcx")
+	code("xor %%eax, %%eax")
+	code("rep stosb")
+	code("ret")
+
+	// makeslice(len, cap, size) allocates the underlying array of a slice, panicking if the length or the capacity is out of range.
+	amd64.os.FunctionLabel("runtime.makeslice")
+	code("test %%rdi, %%rdi")
+	code("jns 1f")
+	code("jmp %s", symbol("runtime.panicmakeslicelen"))
+	label("1")
+	code("cmp %%rdi, %%rsi")
+	code("jge 2f")
+	code("jmp %s", symbol("runtime.panicmakeslicecap"))
+	label("2")
+	code("mov %%rsi, %%rdi")
+	code("imul %%rdx, %%rdi")
+	code("jmp %s", symbol("runtime.alloc"))
+
+	// growslice(ptr, len, cap, newlen, size) copies a slice to a new underlying array for at least newlen elements, and returns it and its capacity.
+	// The capacity is doubled, or grows by a quarter for a large slice, and is rounded up to the size class as Go does.
+	amd64.os.FunctionLabel("runtime.growslice")
+	code("push %%rbp")
+	code("mov %%rsp, %%rbp")
+	code("sub $32, %%rsp")
+	code("mov %%rdi, -8(%%rbp)")
+	code("mov %%rsi, -16(%%rbp)")
+	code("mov %%r8, -24(%%rbp)")
+	code("mov %%rdx, %%rax")
+	code("lea (%%rdx,%%rdx), %%r9")
+	code("cmp %%r9, %%rcx")
+	code("jle 1f")
+	code("mov %%rcx, %%rax")
+	code("jmp 3f")
+	label("1")
+	code("cmp $256, %%rdx")
+	code("jge 2f")
+	code("mov %%r9, %%rax")
+	code("jmp 3f")
+	label("2")
+	code("lea 768(%%rax), %%r9")
+	code("shr $2, %%r9")
+	code("add %%r9, %%rax")
+	code("cmp %%rcx, %%rax")
+	code("jb 2b")
+	label("3")
+	// An element of size 0 takes no memory.
+	code("xor %%edi, %%edi")
+	code("test %%r8, %%r8")
+	code("jz 6f")
+	code("imul %%r8, %%rax")
+	code("cmp $%d, %%rax", maxSmallSize)
+	code("ja 5f")
+	code("lea %s(%%rip), %%r9", amd64.os.LocalLabel("runtime.sizeclasses"))
+	label("4")
+	code("movzwl (%%r9), %%r10d")
+	code("add $2, %%r9")
+	code("cmp %%rax, %%r10")
+	code("jb 4b")
+	code("mov %%r10, %%rax")
+	code("jmp 7f")
+	label("5")
+	code("add $%d, %%rax", pageSize-1)
+	code("and $%d, %%rax", -pageSize)
+	label("7")
+	code("mov %%rax, %%rdi")
+	code("xor %%edx, %%edx")
+	code("div %%r8")
+	label("6")
+	code("mov %%rax, -32(%%rbp)")
+	code("call %s", symbol("runtime.alloc"))
+	code("mov -8(%%rbp), %%rsi")
+	code("mov %%rax, -8(%%rbp)")
+	code("mov %%rax, %%rdi")
+	code("mov -16(%%rbp), %%rdx")
+	code("imul -24(%%rbp), %%rdx")
+	code("call %s", symbol("runtime.memmove"))
+	code("mov -8(%%rbp), %%rax")
+	code("mov -32(%%rbp), %%rdx")
+	code("leave")
+	code("ret")
+	label(amd64.os.LocalLabel("runtime.sizeclasses"))
+	for _, size := range sizeClasses {
+		code(".short %d", size)
+	}
+
+	for _, runtimeError := range runtimeErrors {
+		amd64.runtimeError(runtimeError.name, runtimeError.format, runtimeError.negative)
+	}
+}
+
+// runtimeError outputs routine `name`, which prints the message of `format` to the standard error and exits with status 2.
+// A negative first argument is formatted with `negative` instead, unless it is empty.
+func (amd64 *Amd64) runtimeError(name string, format string, negative string) {
+	amd64.os.FunctionLabel(name)
+	code("push %%rdi")
+	code("push %%rsi")
+	code("movb $1, %s(%%rip)", amd64.os.Symbol("runtime.stderr"))
+	var messages []string
+	printMessage := func(format string) {
+		for _, piece := range messagePieces(format) {
+			switch piece {
+			case "%x":
+				code("mov 8(%%rsp), %%rdi")
+				code("call %s", amd64.os.Symbol("runtime.printint"))
+			case "%y":
+				code("mov (%%rsp), %%rdi")
+				code("call %s", amd64.os.Symbol("runtime.printint"))
+			default:
+				code("lea %s(%%rip), %%rdi", amd64.os.LocalLabel(fmt.Sprintf("%s.%d", name, len(messages))))
+				code("mov $%d, %%esi", len(piece))
+				code("call %s", amd64.os.Symbol("runtime.printstring"))
+				messages = append(messages, piece)
+			}
+		}
+		code("mov $2, %%edi")
+		amd64.syscall("exit")
+	}
+	if negative != "" {
+		code("cmpq $0, 8(%%rsp)")
+		code("jl 1f")
+	}
+	printMessage(format)
+	if negative != "" {
+		label("1")
+		printMessage(negative)
+	}
+	for i, message := range messages {
+		label(amd64.os.LocalLabel(fmt.Sprintf("%s.%d", name, i)))
+		code(".ascii %q", message)
+	}
+}
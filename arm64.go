@@ -0,0 +1,869 @@
+package main
+
+import "fmt"
+
+// Arm64 generates code for AArch64 following the AAPCS64 calling convention.
+type Arm64 struct {
+	os *OS
+	// Function being emitted.
+	function   *IrFunction
+	allocation *Allocation
+	// Size of the area at the bottom of the frame for the values of calls passed on the stack.
+	outgoing int
+}
+
+const fp = "x29"
+
+var argumentRegisters = []string{"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7"}
+
+// Registers for the allocator. x9 to x11 are left as scratch for spilled values, and x16 to x18 are reserved by linkers and platforms.
+var arm64Registers = RegisterSet{
+	CalleeSaved: []string{"x19", "x20", "x21", "x22", "x23", "x24", "x25", "x26", "x27", "x28"},
+	CallerSaved: []string{"x12", "x13", "x14", "x15"},
+}
+
+// Instructions corresponding to the binary operations which arm64 has as is.
+var arm64BinaryInstructions = map[IrOp]string{
+	IrAdd:    "add",
+	IrSub:    "sub",
+	IrMul:    "mul",
+	IrDiv:    "sdiv",
+	IrAnd:    "and",
+	IrOr:     "orr",
+	IrXor:    "eor",
+	IrAndNot: "bic",
+}
+
+// Condition codes of arm64 corresponding to the comparisons.
+var conditionCodes = map[IrOp]string{
+	IrEq: "eq",
+	IrNe: "ne",
+	IrLt: "lt",
+	IrLe: "le",
+	IrGt: "gt",
+	IrGe: "ge",
+}
+
+var unsignedConditionCodes = map[IrOp]string{
+	IrEq: "eq",
+	IrNe: "ne",
+	IrLt: "lo",
+	IrLe: "ls",
+	IrGt: "hi",
+	IrGe: "hs",
+}
+
+// Instructions which extend the lowest bits of a register to the whole of it, for each narrow type.
+var arm64Extensions = map[*IrType]string{
+	&IrI8:  "sxtb %s, %s",
+	&IrI16: "sxth %s, %s",
+	&IrI32: "sxtw %s, %s",
+	&IrU8:  "uxtb %[2]s, %[2]s",
+	&IrU16: "uxth %[2]s, %[2]s",
+	// Writing a 32-bit register clears the upper half.
+	&IrU32: "mov %[2]s, %[2]s",
+}
+
+// Instructions which load a value of each type from memory, extending it to the whole register.
+// The ones taking the 32-bit view of the register clear the upper half.
+var arm64Loads = map[*IrType]string{
+	&IrI8:   "ldrsb %[1]s",
+	&IrI16:  "ldrsh %[1]s",
+	&IrI32:  "ldrsw %[1]s",
+	&IrU8:   "ldrb %[2]s",
+	&IrU16:  "ldrh %[2]s",
+	&IrU32:  "ldr %[2]s",
+	&IrBool: "ldrb %[2]s",
+}
+
+// Instructions which store the lowest bytes of a register to memory, for each size.
+var arm64Stores = map[int]string{
+	1: "strb %[2]s",
+	2: "strh %[2]s",
+	4: "str %[2]s",
+	8: "str %[1]s",
+}
+
+func (arm64 *Arm64) Header() {
+	fmt.Fprintln(out, ".arch armv8-a")
+	arm64.os.TextSection()
+	fmt.Fprintln(out, ".p2align 2")
+}
+
+func (arm64 *Arm64) Footer() {
+	arm64.os.Footer()
+}
+
+func (arm64 *Arm64) CommentPrefix() string {
+	// `;` separates statements in GNU assembler for AArch64.
+	if arm64.os.elf {
+		return "// "
+	}
+	return "; "
+}
+
+func (arm64 *Arm64) OS() *OS {
+	return arm64.os
+}
+
+// Function outputs `function` with its virtual registers in the registers assigned by the allocator.
+// Spilled ones are loaded into scratch registers when used and stored back to their slots when defined.
+func (arm64 *Arm64) Function(function *IrFunction) {
+	arm64.function = function
+	arm64.allocation = AllocateRegisters(function, &arm64Registers)
+	arm64.outgoing = outgoingSize(function, len(argumentRegisters), len(argumentRegisters), arm64.packed())
+	arm64.os.FunctionLabel(function.Name)
+
+	// Save frame pointer and link register.
+	code("stp %s, x30, [sp, #-16]!", fp)
+	code("mov %s, sp", fp)
+	arm64.subSp(frameSize(function, arm64.allocation, arm64.outgoing))
+	for i, register := range arm64.allocation.UsedCalleeSaved {
+		code("str %s, %s", register, arm64.savedSlot(i))
+	}
+	for i, param := range function.Params {
+		if i >= len(argumentRegisters) {
+			break
+		}
+		dst := arm64.def(param, argumentRegisters[i])
+		if dst != argumentRegisters[i] {
+			code("mov %s, %s", dst, argumentRegisters[i])
+		}
+		arm64.spill(param, dst)
+	}
+	// The rest of the parameters are on the stack just above the saved frame pointer and link register.
+	offsets, _ := stackLayout(stackTypes(function.Params, len(argumentRegisters)), arm64.packed())
+	for i, offset := range offsets {
+		param := function.Params[len(argumentRegisters)+i]
+		dst := arm64.def(param, "x9")
+		arm64.loadStack(dst, param.Ty, fmt.Sprintf("[%s, #%d]", fp, 16+offset))
+		arm64.spill(param, dst)
+	}
+
+	for _, block := range function.Blocks {
+		label(blockLabel(function, block))
+		for _, instr := range block.Instrs {
+			comment("%s", instr)
+			arm64.instr(block, instr)
+		}
+	}
+}
+
+// subSp allocates `size` bytes on the stack, which may not fit in an immediate of 12 bits.
+func (arm64 *Arm64) subSp(size int) {
+	if high := size >> 12; high > 0 {
+		code("sub sp, sp, #%d, lsl #12", high)
+	}
+	if low := size & 0xfff; low > 0 {
+		code("sub sp, sp, #%d", low)
+	}
+}
+
+// slot returns the memory operand of the slot for spilled `reg`, placed above the area for the values passed on the stack.
+func (arm64 *Arm64) slot(reg *IrReg) string {
+	return fmt.Sprintf("[sp, #%d]", arm64.outgoing+arm64.allocation.Slots[reg]*8)
+}
+
+// savedSlot returns the memory operand of the slot for the `i`th used callee-saved register, placed above the spilled ones.
+func (arm64 *Arm64) savedSlot(i int) string {
+	return fmt.Sprintf("[sp, #%d]", arm64.outgoing+(arm64.allocation.NumSlots+i)*8)
+}
+
+// stackArea returns the offset from the stack pointer of the stack area of the function, placed above the saved callee-saved registers.
+func (arm64 *Arm64) stackArea() int {
+	return arm64.outgoing + (arm64.allocation.NumSlots+len(arm64.allocation.UsedCalleeSaved))*8
+}
+
+// packed reports whether the values on the stack are packed by their sizes, as Apple's ABI does instead of using slots of 8 bytes.
+func (arm64 *Arm64) packed() bool {
+	return !arm64.os.elf
+}
+
+// storeStack stores `register` holding a value of `ty` to `address` on the stack.
+func (arm64 *Arm64) storeStack(register string, ty *IrType, address string) {
+	format := arm64Stores[8]
+	if arm64.packed() {
+		format = arm64Stores[ty.Size]
+	}
+	code("%s, %s", fmt.Sprintf(format, register, "w"+register[1:]), address)
+}
+
+// loadStack loads a value of `ty` at `address` on the stack into `register`, extending it to the whole register.
+func (arm64 *Arm64) loadStack(register string, ty *IrType, address string) {
+	format, ok := arm64Loads[ty]
+	if !ok || !arm64.packed() {
+		format = "ldr %[1]s"
+	}
+	code("%s, %s", fmt.Sprintf(format, register, "w"+register[1:]), address)
+}
+
+// use returns the register holding `reg`, loading it into `scratch` if it is spilled.
+func (arm64 *Arm64) use(reg *IrReg, scratch string) string {
+	if register, ok := arm64.allocation.Registers[reg]; ok {
+		return register
+	}
+	code("ldr %s, %s", scratch, arm64.slot(reg))
+	return scratch
+}
+
+// def returns the register to write `reg` to, which is `scratch` if it is spilled.
+// The written value has to be passed to `spill` afterwards.
+func (arm64 *Arm64) def(reg *IrReg, scratch string) string {
+	if register, ok := arm64.allocation.Registers[reg]; ok {
+		return register
+	}
+	return scratch
+}
+
+// spill stores `register` to the slot for `reg` if it is spilled.
+func (arm64 *Arm64) spill(reg *IrReg, register string) {
+	if _, ok := arm64.allocation.Registers[reg]; !ok {
+		code("str %s, %s", register, arm64.slot(reg))
+	}
+}
+
+// move copies the value of `reg` to `register`.
+func (arm64 *Arm64) move(register string, reg *IrReg) {
+	if src := arm64.use(reg, register); src != register {
+		code("mov %s, %s", register, src)
+	}
+}
+
+func (arm64 *Arm64) instr(block *IrBlock, instr *IrInstr) {
+	switch op := instr.Op; op {
+	case IrConst:
+		dst := arm64.def(instr.Dst, "x9")
+		loadImmediate(dst, instr.Imm)
+		arm64.spill(instr.Dst, dst)
+	case IrAddr:
+		dst := arm64.def(instr.Dst, "x9")
+		arm64.address(dst, instr.Symbol)
+		arm64.spill(instr.Dst, dst)
+	case IrStackAddr:
+		dst := arm64.def(instr.Dst, "x9")
+		offset := arm64.stackArea() + int(instr.Imm)
+		if offset < 1<<12 {
+			code("add %s, sp, #%d", dst, offset)
+		} else {
+			loadImmediate("x10", int64(offset))
+			code("add %s, sp, x10", dst)
+		}
+		arm64.spill(instr.Dst, dst)
+	case IrLoad:
+		address := arm64.use(instr.Args[0], "x9")
+		dst := arm64.def(instr.Dst, "x9")
+		format, ok := arm64Loads[instr.Dst.Ty]
+		if !ok {
+			format = "ldr %[1]s"
+		}
+		code("%s, %s", fmt.Sprintf(format, dst, "w"+dst[1:]), memoryOperand(address, instr.Imm, instr.Dst.Ty.Size))
+		arm64.spill(instr.Dst, dst)
+	case IrStore:
+		address := arm64.use(instr.Args[0], "x9")
+		src := arm64.use(instr.Args[1], "x10")
+		code("%s, %s", fmt.Sprintf(arm64Stores[instr.Args[1].Ty.Size], src, "w"+src[1:]), memoryOperand(address, instr.Imm, instr.Args[1].Ty.Size))
+	case IrCopy:
+		src := arm64.use(instr.Args[0], "x9")
+		dst := arm64.def(instr.Dst, src)
+		if dst != src {
+			code("mov %s, %s", dst, src)
+		}
+		arm64.spill(instr.Dst, dst)
+	case IrAdd, IrSub, IrMul, IrDiv, IrAnd, IrOr, IrXor, IrAndNot:
+		lhs := arm64.use(instr.Args[0], "x9")
+		rhs := arm64.use(instr.Args[1], "x10")
+		dst := arm64.def(instr.Dst, "x9")
+		mnemonic := arm64BinaryInstructions[op]
+		if op == IrDiv && instr.Dst.Ty.Unsigned {
+			mnemonic = "udiv"
+		}
+		code("%s %s, %s, %s", mnemonic, dst, lhs, rhs)
+		extend(dst, instr.Dst.Ty)
+		arm64.spill(instr.Dst, dst)
+	case IrRem:
+		lhs := arm64.use(instr.Args[0], "x9")
+		rhs := arm64.use(instr.Args[1], "x10")
+		dst := arm64.def(instr.Dst, "x9")
+		if instr.Dst.Ty.Unsigned {
+			code("udiv x11, %s, %s", lhs, rhs)
+		} else {
+			code("sdiv x11, %s, %s", lhs, rhs)
+		}
+		code("msub %s, x11, %s, %s", dst, rhs, lhs)
+		arm64.spill(instr.Dst, dst)
+	case IrShl:
+		lhs := arm64.use(instr.Args[0], "x9")
+		rhs := arm64.use(instr.Args[1], "x10")
+		dst := arm64.def(instr.Dst, "x9")
+		// Unlike lsl, shifting by 64 or more yields 0 in Go.
+		code("lsl x11, %s, %s", lhs, rhs)
+		code("cmp %s, #63", rhs)
+		code("csel %s, xzr, x11, hi", dst)
+		extend(dst, instr.Dst.Ty)
+		arm64.spill(instr.Dst, dst)
+	case IrShr:
+		lhs := arm64.use(instr.Args[0], "x9")
+		rhs := arm64.use(instr.Args[1], "x10")
+		dst := arm64.def(instr.Dst, "x9")
+		if instr.Dst.Ty.Unsigned {
+			code("lsr x11, %s, %s", lhs, rhs)
+			code("cmp %s, #63", rhs)
+			code("csel %s, xzr, x11, hi", dst)
+			arm64.spill(instr.Dst, dst)
+			break
+		}
+		// Unlike asr, shifting by 64 or more fills all bits with the sign bit in Go.
+		code("cmp %s, #63", rhs)
+		code("mov x11, #63")
+		code("csel x11, x11, %s, hi", rhs)
+		code("asr %s, %s, x11", dst, lhs)
+		arm64.spill(instr.Dst, dst)
+	case IrEq, IrNe, IrLt, IrLe, IrGt, IrGe:
+		lhs := arm64.use(instr.Args[0], "x9")
+		rhs := arm64.use(instr.Args[1], "x10")
+		dst := arm64.def(instr.Dst, "x9")
+		code("cmp %s, %s", lhs, rhs)
+		if instr.Args[0].Ty.Unsigned {
+			code("cset %s, %s", dst, unsignedConditionCodes[op])
+		} else {
+			code("cset %s, %s", dst, conditionCodes[op])
+		}
+		arm64.spill(instr.Dst, dst)
+	case IrNeg, IrCompl, IrNot:
+		src := arm64.use(instr.Args[0], "x9")
+		dst := arm64.def(instr.Dst, "x9")
+		switch op {
+		case IrNeg:
+			code("neg %s, %s", dst, src)
+		case IrCompl:
+			code("mvn %s, %s", dst, src)
+		case IrNot:
+			code("eor %s, %s, #1", dst, src)
+		}
+		extend(dst, instr.Dst.Ty)
+		arm64.spill(instr.Dst, dst)
+	case IrConv:
+		src := arm64.use(instr.Args[0], "x9")
+		dst := arm64.def(instr.Dst, "x9")
+		if dst != src {
+			code("mov %s, %s", dst, src)
+		}
+		extend(dst, instr.Dst.Ty)
+		arm64.spill(instr.Dst, dst)
+	case IrCall:
+		// The arguments which do not fit in the registers are passed at the bottom of the stack.
+		offsets, _ := stackLayout(stackTypes(instr.Args, len(argumentRegisters)), arm64.packed())
+		for i, offset := range offsets {
+			arg := instr.Args[len(argumentRegisters)+i]
+			arm64.storeStack(arm64.use(arg, "x9"), arg.Ty, fmt.Sprintf("[sp, #%d]", offset))
+		}
+		// Allocated registers never overlap the argument registers, so the arguments can be moved in any order.
+		for i, arg := range instr.Args {
+			if i < len(argumentRegisters) {
+				arm64.move(argumentRegisters[i], arg)
+			}
+		}
+		code("bl %s", arm64.os.Symbol(instr.Callee))
+		for i, result := range instr.Results {
+			if i >= len(argumentRegisters) {
+				break
+			}
+			dst := arm64.def(result, argumentRegisters[i])
+			if dst != argumentRegisters[i] {
+				code("mov %s, %s", dst, argumentRegisters[i])
+			}
+			arm64.spill(result, dst)
+		}
+		offsets, _ = stackLayout(stackTypes(instr.Results, len(argumentRegisters)), arm64.packed())
+		for i, offset := range offsets {
+			result := instr.Results[len(argumentRegisters)+i]
+			dst := arm64.def(result, "x9")
+			arm64.loadStack(dst, result.Ty, fmt.Sprintf("[sp, #%d]", offset))
+			arm64.spill(result, dst)
+		}
+	case IrBoundsCheck:
+		// The callee never returns, so the registers need not be preserved.
+		x := arm64.use(instr.Args[0], "x9")
+		y := arm64.use(instr.Args[1], "x10")
+		code("cmp %s, %s", x, y)
+		if instr.Imm == 1 {
+			code("b.ls 1f")
+		} else {
+			code("b.lo 1f")
+		}
+		code("mov x0, %s", x)
+		code("mov x1, %s", y)
+		code("bl %s", arm64.os.Symbol(instr.Callee))
+		label("1")
+	case IrRet:
+		// Results are returned in the same registers as arguments, and the rest of them in the area of the caller for the arguments on the stack.
+		offsets, _ := stackLayout(stackTypes(instr.Args, len(argumentRegisters)), arm64.packed())
+		for i, offset := range offsets {
+			arg := instr.Args[len(argumentRegisters)+i]
+			arm64.storeStack(arm64.use(arg, "x9"), arg.Ty, fmt.Sprintf("[%s, #%d]", fp, 16+offset))
+		}
+		for i, arg := range instr.Args {
+			if i < len(argumentRegisters) {
+				arm64.move(argumentRegisters[i], arg)
+			}
+		}
+		for i, register := range arm64.allocation.UsedCalleeSaved {
+			code("ldr %s, %s", register, arm64.savedSlot(i))
+		}
+		code("mov sp, %s", fp)
+		// Restore frame pointer and link register.
+		code("ldp %s, x30, [sp], #16", fp)
+		code("ret")
+	case IrJump:
+		arm64.jump(block, instr.Targets[0])
+	case IrBranch:
+		then, els := instr.Targets[0], instr.Targets[1]
+		cond := arm64.use(instr.Args[0], "x9")
+		if then == nextBlock(arm64.function, block) {
+			code("cbz %s, %s", cond, blockLabel(arm64.function, els))
+		} else {
+			code("cbnz %s, %s", cond, blockLabel(arm64.function, then))
+			arm64.jump(block, els)
+		}
+	}
+}
+
+// memoryOperand returns the operand accessing `size` bytes at `base` + `offset`. An offset which fits in neither the scaled
+// unsigned immediate nor the unscaled signed one is added to the base in x11.
+func memoryOperand(base string, offset int64, size int) string {
+	if -256 <= offset && offset < 256 || 0 <= offset && offset%int64(size) == 0 && offset < 4096*int64(size) {
+		return fmt.Sprintf("[%s, #%d]", base, offset)
+	}
+	loadImmediate("x11", offset)
+	code("add x11, %s, x11", base)
+	return "[x11]"
+}
+
+// loadImmediate materializes any 64-bit `value` in `register`, which a single mov cannot in general.
+// It starts from zeros with movz or from ones with movn, whichever leaves fewer 16-bit chunks to be patched by movk.
+func loadImmediate(register string, value int64) {
+	var chunks [4]uint16
+	zeros, ones := 0, 0
+	for i := range chunks {
+		chunks[i] = uint16(value >> (16 * i))
+		if chunks[i] == 0 {
+			zeros++
+		} else if chunks[i] == 0xffff {
+			ones++
+		}
+	}
+	var filler uint16
+	if ones > zeros {
+		filler = 0xffff
+	}
+	first := true
+	for i, chunk := range chunks {
+		if chunk == filler {
+			continue
+		}
+		switch {
+		case !first:
+			code("movk %s, #%#x, lsl #%d", register, chunk, 16*i)
+		case filler == 0:
+			code("movz %s, #%#x, lsl #%d", register, chunk, 16*i)
+		default:
+			code("movn %s, #%#x, lsl #%d", register, ^chunk, 16*i)
+		}
+		first = false
+	}
+	if first {
+		// All chunks are the filler.
+		if filler == 0 {
+			code("movz %s, #0", register)
+		} else {
+			code("movn %s, #0", register)
+		}
+	}
+}
+
+// extend sign- or zero-extends the value of narrow type `ty` in `register` to the whole register.
+func extend(register string, ty *IrType) {
+	if format, ok := arm64Extensions[ty]; ok {
+		code(format, register, "w"+register[1:])
+	}
+}
+
+// address loads the address of the symbol `name` into `register` relative to the program counter.
+func (arm64 *Arm64) address(register string, name string) {
+	symbol := arm64.os.Symbol(name)
+	if arm64.os.elf {
+		code("adrp %s, %s", register, symbol)
+		code("add %s, %s, :lo12:%s", register, register, symbol)
+	} else {
+		code("adrp %s, %s@PAGE", register, symbol)
+		code("add %s, %s, %s@PAGEOFF", register, register, symbol)
+	}
+}
+
+// jump jumps from `block` to `target`, or falls through if `target` immediately follows.
+func (arm64 *Arm64) jump(block *IrBlock, target *IrBlock) {
+	if target != nextBlock(arm64.function, block) {
+		code("b %s", blockLabel(arm64.function, target))
+	}
+}
+
+// syscall invokes the system call which is named as in Linux.
+// The numbers of Darwin are those of the BSD class.
+func (arm64 *Arm64) syscall(name string) {
+	numbers := map[string][2]int{
+		"exit":  {93, 1},
+		"mmap":  {222, 197},
+		"write": {64, 4},
+	}
+	if arm64.os.elf {
+		code("mov x8, #%d", numbers[name][0])
+		code("svc #0")
+	} else {
+		code("mov x16, #%d", numbers[name][1])
+		code("svc #0x80")
+	}
+}
+
+// Runtime outputs the runtime functions, written by hand as leaf routines or ones calling only each other.
+// They use only the argument and scratch registers, which callers never expect to be preserved.
+func (arm64 *Arm64) Runtime() {
+	symbol := arm64.os.Symbol
+
+	// printstring(ptr, len) writes the bytes to the standard output, or to the standard error once a panic sets runtime.stderr.
+	arm64.os.FunctionLabel("runtime.printstring")
+	code("mov x2, x1")
+	code("mov x1, x0")
+	arm64.address("x0", "runtime.stderr")
+	code("ldrb w0, [x0]")
+	code("add x0, x0, #1")
+	arm64.syscall("write")
+	code("ret")
+
+	// printint(n) writes n in decimal, and printuint(n) writes n as unsigned.
+	// Both pass the absolute value, whether it is negative and the base to printdigits.
+	arm64.os.FunctionLabel("runtime.printint")
+	// The absolute value of the minimum integer is correct as unsigned.
+	code("cmp x0, #0")
+	code("cneg x2, x0, lt")
+	code("cset x6, lt")
+	code("mov x3, #10")
+	code("b %s", arm64.os.LocalLabel("runtime.printdigits"))
+	// printpointer(p) writes p in hexadecimal prefixed with 0x.
+	arm64.os.FunctionLabel("runtime.printpointer")
+	code("stp %s, x30, [sp, #-16]!", fp)
+	code("mov x7, x0")
+	code("adr x0, %s", arm64.os.LocalLabel("runtime.hexprefix"))
+	code("mov x1, #2")
+	code("bl %s", symbol("runtime.printstring"))
+	code("ldp %s, x30, [sp], #16", fp)
+	code("mov x2, x7")
+	code("mov x6, #0")
+	code("mov x3, #16")
+	code("b %s", arm64.os.LocalLabel("runtime.printdigits"))
+	arm64.os.FunctionLabel("runtime.printuint")
+	code("mov x2, x0")
+	code("mov x6, #0")
+	code("mov x3, #10")
+	// Converts the digits from the last one into a buffer on the stack.
+	label(arm64.os.LocalLabel("runtime.printdigits"))
+	code("stp %s, x30, [sp, #-48]!", fp)
+	code("mov %s, sp", fp)
+	code("add x1, sp, #48")
+	code("adr x7, %s", arm64.os.LocalLabel("runtime.digits"))
+	label("1")
+	code("udiv x4, x2, x3")
+	code("msub x5, x4, x3, x2")
+	code("ldrb w5, [x7, x5]")
+	code("strb w5, [x1, #-1]!")
+	code("mov x2, x4")
+	code("cbnz x2, 1b")
+	code("cbz x6, 2f")
+	code("mov x5, #'-'")
+	code("strb w5, [x1, #-1]!")
+	label("2")
+	code("mov x0, x1")
+	code("add x2, sp, #48")
+	code("sub x1, x2, x1")
+	code("bl %s", symbol("runtime.printstring"))
+	code("ldp %s, x30, [sp], #48", fp)
+	code("ret")
+
+	// printbool(b) writes true or false.
+	arm64.os.FunctionLabel("runtime.printbool")
+	code("cbz x0, 1f")
+	code("adr x0, %s", arm64.os.LocalLabel("runtime.true"))
+	code("mov x1, #4")
+	code("b %s", symbol("runtime.printstring"))
+	label("1")
+	code("adr x0, %s", arm64.os.LocalLabel("runtime.false"))
+	code("mov x1, #5")
+	code("b %s", symbol("runtime.printstring"))
+	label(arm64.os.LocalLabel("runtime.true"))
+	code(".ascii \"true\"")
+	label(arm64.os.LocalLabel("runtime.false"))
+	code(".ascii \"false\"")
+	label(arm64.os.LocalLabel("runtime.digits"))
+	code(".ascii \"0123456789abcdef\"")
+	label(arm64.os.LocalLabel("runtime.hexprefix"))
+	code(".ascii \"0x\"")
+	code(".p2align 2")
+
+	// alloc(size) returns memory of size bytes aligned to 8 bytes from the arena. When the arena runs out, it maps a new one
+	// of heapSize bytes, or of the size if it is larger, and dies of a fatal error if the memory cannot be mapped.
+	// An arena is never mapped at address 0, so the memory of even 0 bytes is not nil.
+	arm64.os.FunctionLabel("runtime.alloc")
+	arm64.address("x1", "runtime.heapptr")
+	code("ldr x2, [x1]")
+	arm64.address("x3", "runtime.heapend")
+	code("ldr x3, [x3]")
+	code("cbz x2, 1f")
+	code("add x4, x2, x0")
+	code("add x4, x4, #7")
+	code("and x4, x4, #-8")
+	code("cmp x4, x3")
+	code("b.hi 1f")
+	code("str x4, [x1]")
+	code("mov x0, x2")
+	code("ret")
+	label("1")
+	code("add x1, x0, #7")
+	code("and x1, x1, #-8")
+	code("mov x2, #%d", heapSize)
+	code("cmp x1, x2")
+	code("csel x1, x1, x2, hi")
+	code("stp x0, x1, [sp, #-16]!")
+	// mmap(nil, size, PROT_READ|PROT_WRITE, MAP_PRIVATE|MAP_ANONYMOUS, -1, 0)
+	code("mov x0, #0")
+	code("mov x2, #3")
+	if arm64.os.elf {
+		code("mov x3, #0x22")
+	} else {
+		code("mov x3, #0x1002")
+	}
+	code("mov x4, #-1")
+	code("mov x5, #0")
+	arm64.syscall("mmap")
+	// Linux returns a negative errno, and macOS sets the carry flag.
+	if arm64.os.elf {
+		code("cmn x0, #4096")
+		code("b.hi 2f")
+	} else {
+		code("b.cs 2f")
+	}
+	code("ldp x2, x1, [sp], #16")
+	arm64.address("x3", "runtime.heapptr")
+	code("str x0, [x3]")
+	code("add x1, x0, x1")
+	arm64.address("x3", "runtime.heapend")
+	code("str x1, [x3]")
+	code("mov x0, x2")
+	code("b %s", symbol("runtime.alloc"))
+	label("2")
+	code("b %s", symbol("runtime.outOfMemory"))
+
+	// concatstring(ptr1, len1, ptr2, len2) returns a new string of the two strings.
+	arm64.os.FunctionLabel("runtime.concatstring")
+	code("stp %s, x30, [sp, #-48]!", fp)
+	code("mov %s, sp", fp)
+	code("stp x0, x1, [sp, #16]")
+	code("stp x2, x3, [sp, #32]")
+	code("add x0, x1, x3")
+	code("bl %s", symbol("runtime.alloc"))
+	code("mov x4, x0")
+	code("ldp x2, x3, [sp, #16]")
+	label("1")
+	code("cbz x3, 2f")
+	code("ldrb w5, [x2], #1")
+	code("strb w5, [x4], #1")
+	code("sub x3, x3, #1")
+	code("b 1b")
+	label("2")
+	code("ldp x2, x3, [sp, #32]")
+	label("3")
+	code("cbz x3, 4f")
+	code("ldrb w5, [x2], #1")
+	code("strb w5, [x4], #1")
+	code("sub x3, x3, #1")
+	code("b 3b")
+	label("4")
+	code("ldr x1, [sp, #24]")
+	code("ldr x3, [sp, #40]")
+	code("add x1, x1, x3")
+	code("ldp %s, x30, [sp], #48", fp)
+	code("ret")
+
+	// cmpstring(ptr1, len1, ptr2, len2) returns -1, 0 or 1 comparing the strings bytewise.
+	arm64.os.FunctionLabel("runtime.cmpstring")
+	code("cmp x1, x3")
+	code("csel x4, x1, x3, lo")
+	label("1")
+	code("cbz x4, 2f")
+	code("ldrb w5, [x0], #1")
+	code("ldrb w6, [x2], #1")
+	code("cmp w5, w6")
+	code("b.ne 3f")
+	code("sub x4, x4, #1")
+	code("b 1b")
+	label("2")
+	// The common prefix is the same, so the shorter string is less.
+	code("cmp x1, x3")
+	label("3")
+	code("cset x0, ne")
+	code("cneg x0, x0, lo")
+	code("ret")
+
+	// memmove(dst, src, n) copies n bytes, backward if the destination is above the source, where they may overlap.
+	arm64.os.FunctionLabel("runtime.memmove")
+	code("cmp x0, x1")
+	code("b.ls 2f")
+	code("add x0, x0, x2")
+	code("add x1, x1, x2")
+	label("1")
+	code("cbz x2, 3f")
+	code("ldrb w3, [x1, #-1]!")
+	code("strb w3, [x0, #-1]!")
+	code("sub x2, x2, #1")
+	code("b 1b")
+	label("2")
+	code("cbz x2, 3f")
+	code("ldrb w3, [x1], #1")
+	code("strb w3, [x0], #1")
+	code("sub x2, x2, #1")
+	code("b 2b")
+	label("3")
+	code("ret")
+
+	// memclr(ptr, n) clears n bytes.
+	arm64.os.FunctionLabel("runtime.memclr")
+	label("1")
+	code("cbz x1, 2f")
+	code("strb wzr, [x0], #1")
+	code("sub x1, x1, #1")
+	code("b 1b")
+	label("2")
+	code("ret")
+
+	// makeslice(len, cap, size) allocates the underlying array of a slice, panicking if the length or the capacity is out of range.
+	arm64.os.FunctionLabel("runtime.makeslice")
+	code("cmp x0, #0")
+	code("b.ge 1f")
+	code("b %s", symbol("runtime.panicmakeslicelen"))
+	label("1")
+	code("cmp x1, x0")
+	code("b.ge 2f")
+	code("b %s", symbol("runtime.panicmakeslicecap"))
+	label("2")
+	code("mul x0, x1, x2")
+	code("b %s", symbol("runtime.alloc"))
+
+	// growslice(ptr, len, cap, newlen, size) copies a slice to a new underlying array for at least newlen elements, and returns it and its capacity.
+	// The capacity is doubled, or grows by a quarter for a large slice, and is rounded up to the size class as Go does.
+	arm64.os.FunctionLabel("runtime.growslice")
+	code("stp %s, x30, [sp, #-48]!", fp)
+	code("mov %s, sp", fp)
+	code("stp x0, x1, [sp, #16]")
+	code("str x4, [sp, #32]")
+	code("add x5, x2, x2")
+	code("cmp x3, x5")
+	code("b.le 1f")
+	code("mov x6, x3")
+	code("b 3f")
+	label("1")
+	code("cmp x2, #256")
+	code("b.ge 2f")
+	code("mov x6, x5")
+	code("b 3f")
+	label("2")
+	code("mov x6, x2")
+	label("8")
+	code("add x7, x6, #768")
+	code("add x6, x6, x7, lsr #2")
+	code("cmp x6, x3")
+	code("b.lo 8b")
+	label("3")
+	// An element of size 0 takes no memory.
+	code("mov x0, #0")
+	code("cbz x4, 6f")
+	code("mul x0, x6, x4")
+	code("mov x7, #%d", maxSmallSize)
+	code("cmp x0, x7")
+	code("b.hi 5f")
+	code("adr x7, %s", arm64.os.LocalLabel("runtime.sizeclasses"))
+	label("4")
+	code("ldrh w8, [x7], #2")
+	code("cmp x8, x0")
+	code("b.lo 4b")
+	code("mov x0, x8")
+	code("b 7f")
+	label("5")
+	code("mov x7, #%d", pageSize-1)
+	code("add x0, x0, x7")
+	code("and x0, x0, #%d", -pageSize)
+	label("7")
+	code("udiv x6, x0, x4")
+	label("6")
+	code("str x6, [sp, #40]")
+	code("bl %s", symbol("runtime.alloc"))
+	code("ldp x1, x2, [sp, #16]")
+	code("ldr x4, [sp, #32]")
+	code("mul x2, x2, x4")
+	code("str x0, [sp, #16]")
+	code("bl %s", symbol("runtime.memmove"))
+	code("ldr x0, [sp, #16]")
+	code("ldr x1, [sp, #40]")
+	code("ldp %s, x30, [sp], #48", fp)
+	code("ret")
+	label(arm64.os.LocalLabel("runtime.sizeclasses"))
+	for _, size := range sizeClasses {
+		code(".short %d", size)
+	}
+	code(".p2align 2")
+
+	for _, runtimeError := range runtimeErrors {
+		arm64.runtimeError(runtimeError.name, runtimeError.format, runtimeError.negative)
+	}
+}
+
+// runtimeError outputs routine `name`, which prints the message of `format` to the standard error and exits with status 2.
+// A negative first argument is formatted with `negative` instead, unless it is empty.
+func (arm64 *Arm64) runtimeError(name string, format string, negative string) {
+	arm64.os.FunctionLabel(name)
+	code("stp x0, x1, [sp, #-16]!")
+	arm64.address("x2", "runtime.stderr")
+	code("mov w3, #1")
+	code("strb w3, [x2]")
+	var messages []string
+	printMessage := func(format string) {
+		for _, piece := range messagePieces(format) {
+			switch piece {
+			case "%x":
+				code("ldr x0, [sp]")
+				code("bl %s", arm64.os.Symbol("runtime.printint"))
+			case "%y":
+				code("ldr x0, [sp, #8]")
+				code("bl %s", arm64.os.Symbol("runtime.printint"))
+			default:
+				code("adr x0, %s", arm64.os.LocalLabel(fmt.Sprintf("%s.%d", name, len(messages))))
+				code("mov x1, #%d", len(piece))
+				code("bl %s", arm64.os.Symbol("runtime.printstring"))
+				messages = append(messages, piece)
+			}
+		}
+		code("mov x0, #2")
+		arm64.syscall("exit")
+	}
+	if negative != "" {
+		code("ldr x2, [sp]")
+		code("tbnz x2, #63, 1f")
+	}
+	printMessage(format)
+	if negative != "" {
+		label("1")
+		printMessage(negative)
+	}
+	for i, message := range messages {
+		label(arm64.os.LocalLabel(fmt.Sprintf("%s.%d", name, i)))
+		code(".ascii %q", message)
+	}
+	code(".p2align 2")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// ConstantValue is the value of a constant expression, evaluated by the type checker.
+// Integers have arbitrary precision, so that untyped constants can exceed the range of any type until they are given one.
+type ConstantValue struct {
+	// Type of the constant, which is one of the untyped types until the constant is converted to a typed one.
+	Ty *Type
+	// Value of an integer constant.
+	Int    *big.Int
+	Bool   bool
+	String string
+}
+
+// withType returns a copy of the constant which has type `ty`.
+func (value *ConstantValue) withType(ty *Type) *ConstantValue {
+	converted := *value
+	converted.Ty = ty
+	return &converted
+}
+
+func (value *ConstantValue) format() string {
+	switch {
+	case value.Int != nil:
+		return value.Int.String()
+	case value.Ty.isString():
+		return strconv.Quote(value.String)
+	default:
+		return strconv.FormatBool(value.Bool)
+	}
+}
+
+// isZero reports whether the constant is the integer 0, which is an invalid divisor.
+func (value *ConstantValue) isZero() bool {
+	return value.Int != nil && value.Int.Sign() == 0
+}
+
+// bits returns the bits of an integer constant as a 64-bit integer, to which the type checker has ensured it fits.
+func (value *ConstantValue) bits() int64 {
+	if value.Int.Sign() > 0 {
+		return int64(value.Int.Uint64())
+	}
+	return value.Int.Int64()
+}
+
+// Limit of the count of a constant shift, beyond which the value would be too large to compute.
+const maxShiftCount = 10000
+
+// foldBinary evaluates the binary operation `op` on constants `lhs` and `rhs`, whose types have been matched.
+// The result has the type of the operands, or untyped bool for a comparison.
+func foldBinary(op TokenKind, lhs *ConstantValue, rhs *ConstantValue) *ConstantValue {
+	if isComparisonOperator(op) {
+		return &ConstantValue{Ty: &TypeUntypedBool, Bool: compareConstants(op, lhs, rhs)}
+	}
+	switch op {
+	case TOKEN_ANDAND:
+		return &ConstantValue{Ty: lhs.Ty, Bool: lhs.Bool && rhs.Bool}
+	case TOKEN_OROR:
+		return &ConstantValue{Ty: lhs.Ty, Bool: lhs.Bool || rhs.Bool}
+	}
+	if lhs.Ty.isString() {
+		return &ConstantValue{Ty: lhs.Ty, String: lhs.String + rhs.String}
+	}
+
+	x, y := lhs.Int, rhs.Int
+	z := new(big.Int)
+	switch op {
+	case TOKEN_PLUS:
+		z.Add(x, y)
+	case TOKEN_MINUS:
+		z.Sub(x, y)
+	case TOKEN_STAR:
+		z.Mul(x, y)
+	case TOKEN_SLASH:
+		// Quo truncates toward zero as Go does, unlike Div.
+		z.Quo(x, y)
+	case TOKEN_PERCENT:
+		z.Rem(x, y)
+	case TOKEN_AMP:
+		z.And(x, y)
+	case TOKEN_PIPE:
+		z.Or(x, y)
+	case TOKEN_CARET:
+		z.Xor(x, y)
+	case TOKEN_AMPCARET:
+		z.AndNot(x, y)
+	case TOKEN_SHL:
+		z.Lsh(x, uint(y.Uint64()))
+	case TOKEN_SHR:
+		z.Rsh(x, uint(y.Uint64()))
+	default:
+		panic(fmt.Sprintf("unexpected operator on constants: %d", op))
+	}
+	return &ConstantValue{Ty: lhs.Ty, Int: z}
+}
+
+func compareConstants(op TokenKind, lhs *ConstantValue, rhs *ConstantValue) bool {
+	var cmp int
+	switch {
+	case lhs.Int != nil:
+		cmp = lhs.Int.Cmp(rhs.Int)
+	case lhs.Ty.isString():
+		switch {
+		case lhs.String < rhs.String:
+			cmp = -1
+		case lhs.String > rhs.String:
+			cmp = 1
+		}
+	default:
+		// Booleans can only be compared for equality.
+		if lhs.Bool != rhs.Bool {
+			cmp = 1
+		}
+	}
+	switch op {
+	case TOKEN_EQ:
+		return cmp == 0
+	case TOKEN_NE:
+		return cmp != 0
+	case TOKEN_LT:
+		return cmp < 0
+	case TOKEN_LE:
+		return cmp <= 0
+	case TOKEN_GT:
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// foldUnary evaluates the unary operation `op` on constant `operand`.
+func foldUnary(op TokenKind, operand *ConstantValue) *ConstantValue {
+	switch op {
+	case TOKEN_NOT:
+		return &ConstantValue{Ty: operand.Ty, Bool: !operand.Bool}
+	case TOKEN_MINUS:
+		return &ConstantValue{Ty: operand.Ty, Int: new(big.Int).Neg(operand.Int)}
+	case TOKEN_CARET:
+		// The complement of an unsigned value flips only the bits of its size, and otherwise ^x is -x-1.
+		if operand.Ty.isUnsigned() {
+			return &ConstantValue{Ty: operand.Ty, Int: new(big.Int).Xor(operand.Int, operand.Ty.maxValue())}
+		}
+		return &ConstantValue{Ty: operand.Ty, Int: new(big.Int).Not(operand.Int)}
+	default:
+		return operand
+	}
+}
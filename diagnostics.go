@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	// Information about the compilation, such as the decisions of the escape analysis, which is not a problem.
+	SeverityInfo
+)
+
+// Diagnostic is a problem in the source code spanning from `Start` to just before `End` in `File`.
+type Diagnostic struct {
+	File     *SourceFile
+	Start    Position
+	End      Position
+	Severity Severity
+	Message  string
+}
+
+// errorAt returns an error diagnostic spanning `token`.
+func errorAt(token *Token, format string, a ...any) *Diagnostic {
+	end := token.pos
+	end.Column += len(token.Value)
+	return &Diagnostic{
+		File:     token.file,
+		Start:    token.pos,
+		End:      end,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, a...),
+	}
+}
+
+// noteAt returns an informational diagnostic spanning `token`.
+func noteAt(token *Token, format string, a ...any) *Diagnostic {
+	diagnostic := errorAt(token, format, a...)
+	diagnostic.Severity = SeverityInfo
+	return diagnostic
+}
+
+// Error formats the diagnostic in the same way as gc: `file.go:3:5: message`.
+// The file name is omitted if the source does not come from a file.
+func (diagnostic *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", formatLocation(diagnostic.File, diagnostic.Start), diagnostic.Message)
+}
+
+// location formats the position of `token` in the same way as the prefix of an error message, such as `file.go:3:5`.
+func location(token *Token) string {
+	return formatLocation(token.file, token.pos)
+}
+
+func formatLocation(file *SourceFile, position Position) string {
+	if file == nil || file.Name == "" {
+		return position.toString()
+	}
+	return fmt.Sprintf("%s:%s", file.Name, position.toString())
+}
+
+// Render formats the diagnostic followed by the line of the source where it is found, and a caret line underlining the span.
+func (diagnostic *Diagnostic) Render() string {
+	rendered := diagnostic.Error() + "\n"
+	if diagnostic.File == nil {
+		return rendered
+	}
+	line := diagnostic.File.Line(diagnostic.Start.Line)
+	rendered += line + "\n"
+
+	// Columns count bytes, but the underline is padded with one character per rune, keeping tabs,
+	// so that the caret lines up with the source line.
+	start := clampColumn(line, diagnostic.Start.Column)
+	var underline strings.Builder
+	for _, r := range line[:start] {
+		if r == '\t' {
+			underline.WriteByte('\t')
+		} else {
+			underline.WriteByte(' ')
+		}
+	}
+	underline.WriteByte('^')
+	if diagnostic.End.Line == diagnostic.Start.Line {
+		end := clampColumn(line, diagnostic.End.Column)
+		for i := 1; i < utf8.RuneCountInString(line[start:end]); i++ {
+			underline.WriteByte('~')
+		}
+	}
+	return rendered + underline.String() + "\n"
+}
+
+// clampColumn returns the byte offset in `line` of the 1-based `column`, limited to the end of the line.
+func clampColumn(line string, column int) int {
+	if column-1 > len(line) {
+		return len(line)
+	}
+	return column - 1
+}
+
+// Diagnostics collects problems found during compilation, so that all of them are reported at once instead of only the first one.
+type Diagnostics struct {
+	diagnostics []*Diagnostic
+}
+
+// Add records `err`, which must be a `*Diagnostic`.
+func (diagnostics *Diagnostics) Add(err error) {
+	diagnostic := err.(*Diagnostic)
+	// The same error can be reported again while recovering from it at each enclosing block.
+	for _, recorded := range diagnostics.diagnostics {
+		if *recorded == *diagnostic {
+			return
+		}
+	}
+	diagnostics.diagnostics = append(diagnostics.diagnostics, diagnostic)
+}
+
+// Merge records all the diagnostics in `other`.
+func (diagnostics *Diagnostics) Merge(other *Diagnostics) {
+	for _, diagnostic := range other.diagnostics {
+		diagnostics.Add(diagnostic)
+	}
+}
+
+func (diagnostics *Diagnostics) HasErrors() bool {
+	for _, diagnostic := range diagnostics.diagnostics {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Sorted returns the recorded diagnostics sorted by their file and position.
+func (diagnostics *Diagnostics) Sorted() []*Diagnostic {
+	sorted := append([]*Diagnostic{}, diagnostics.diagnostics...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		lhs, rhs := sorted[i], sorted[j]
+		if lhs.File != rhs.File && lhs.File != nil && rhs.File != nil {
+			return lhs.File.Name < rhs.File.Name
+		}
+		if lhs.Start.Line != rhs.Start.Line {
+			return lhs.Start.Line < rhs.Start.Line
+		}
+		return lhs.Start.Column < rhs.Start.Column
+	})
+	return sorted
+}
+
+// Err returns nil if no error is recorded, otherwise the diagnostics themselves as an error.
+func (diagnostics *Diagnostics) Err() error {
+	if !diagnostics.HasErrors() {
+		return nil
+	}
+	return diagnostics
+}
+
+// Error lists the diagnostics one per line.
+func (diagnostics *Diagnostics) Error() string {
+	var messages []string
+	for _, diagnostic := range diagnostics.Sorted() {
+		messages = append(messages, diagnostic.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Render lists the diagnostics with their source lines.
+func (diagnostics *Diagnostics) Render() string {
+	rendered := ""
+	for _, diagnostic := range diagnostics.Sorted() {
+		rendered += diagnostic.Render()
+	}
+	return rendered
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderDiagnosticWithSourceLine(t *testing.T) {
+	file := &SourceFile{Name: "main.go", Source: "package main\nfunc main() {\n\tx := 1\n\tx := abc\n}\n"}
+	tokenStream, err := Tokenize(NewFileByteStream(file))
+	assert.NoError(t, err)
+	_, err = Parse(tokenStream)
+	assert.EqualError(t, err, "main.go:4:4: no new variables on left side of :=")
+	assert.Equal(t, "main.go:4:4: no new variables on left side of :=\n\tx := abc\n\t  ^~\n", err.(*Diagnostics).Render())
+}
+
+func TestRenderDiagnosticsSortedByPosition(t *testing.T) {
+	file := &SourceFile{Name: "main.go", Source: "package main\nfunc main() bool {\nreturn x || y\n}\n"}
+	tokenStream, err := Tokenize(NewFileByteStream(file))
+	assert.NoError(t, err)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.Equal(t, `main.go:3:8: undefined: x
+return x || y
+       ^
+main.go:3:13: undefined: y
+return x || y
+            ^
+`, err.(*Diagnostics).Render())
+}
+
+func TestNoteIsNotError(t *testing.T) {
+	var diagnostics Diagnostics
+	token := &Token{Kind: TOKEN_IDENTIFIER, Value: "x", pos: Position{Line: 1, Column: 1}}
+	diagnostics.Add(noteAt(token, "moved to heap: x"))
+	assert.NoError(t, diagnostics.Err())
+	assert.Equal(t, "1:1: moved to heap: x", diagnostics.Error())
+}
+
+// The column in the message counts bytes as gc does, while the caret is placed after the characters before it.
+func TestRenderDiagnosticAfterMultibyteCharacters(t *testing.T) {
+	file := &SourceFile{Name: "main.go", Source: "package main\nfunc main() {\n\ts := \"é\\t\\x41\" + 1\n\t_ = s\n}\n"}
+	tokenStream, err := Tokenize(NewFileByteStream(file))
+	assert.NoError(t, err)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.Equal(t, `main.go:3:18: invalid operation: adding different types
+	s := "é\t\x41" + 1
+	               ^
+`, err.(*Diagnostics).Render())
+}
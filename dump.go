@@ -7,6 +7,15 @@ import (
 
 func (ast *Ast) Dump() string {
 	dumped := ""
+	for _, decl := range ast.types {
+		dumped += dumpExpr(0, decl)
+	}
+	for _, decl := range ast.consts {
+		dumped += dumpExpr(0, decl)
+	}
+	for _, decl := range ast.vars {
+		dumped += dumpExpr(0, decl)
+	}
 	for _, function := range ast.funcs {
 		dumped += dumpExpr(0, function)
 	}
@@ -24,7 +33,11 @@ func dumpExpr(level int, expr Expr) string {
 			dumped += dumpExpr(level+2, parameter)
 		}
 		dumped += dln(level+1, "]")
-		dumped += dln(level+1, "returnType: %s", dumpType(expr.ReturnType))
+		dumped += dln(level+1, "results: [")
+		for _, result := range expr.Results {
+			dumped += dumpExpr(level+2, result)
+		}
+		dumped += dln(level+1, "]")
 		dumped += dln(level+1, "body: \n%s", dumpExpr(level+2, expr.Body))
 		dumped += dln(level, "}")
 	case *Block:
@@ -35,29 +48,191 @@ func dumpExpr(level int, expr Expr) string {
 		dumped += dln(level, "}")
 	case *Return:
 		dumped += dln(level, "Return: {")
-		dumped += dumpExpr(level+1, expr.Node)
+		for _, value := range expr.Values {
+			dumped += dumpExpr(level+1, value)
+		}
 		dumped += dln(level, "}")
+	case *If:
+		dumped += dln(level, "If: {")
+		dumped += d(level+1, "cond:\n%s", dumpExpr(level+2, expr.Cond))
+		dumped += d(level+1, "then:\n%s", dumpExpr(level+2, expr.Then))
+		if expr.Else != nil {
+			dumped += d(level+1, "else:\n%s", dumpExpr(level+2, expr.Else))
+		}
+		dumped += dln(level, "}")
+	case *For:
+		dumped += dln(level, "For: {")
+		if expr.Label != "" {
+			dumped += dln(level+1, "label: %s", expr.Label)
+		}
+		if expr.Init != nil {
+			dumped += d(level+1, "init:\n%s", dumpExpr(level+2, expr.Init))
+		}
+		if expr.Cond != nil {
+			dumped += d(level+1, "cond:\n%s", dumpExpr(level+2, expr.Cond))
+		}
+		if expr.Post != nil {
+			dumped += d(level+1, "post:\n%s", dumpExpr(level+2, expr.Post))
+		}
+		if expr.Key != nil {
+			dumped += d(level+1, "key:\n%s", dumpExpr(level+2, expr.Key))
+		}
+		if expr.Value != nil {
+			dumped += d(level+1, "value:\n%s", dumpExpr(level+2, expr.Value))
+		}
+		if expr.Range != nil {
+			dumped += d(level+1, "range:\n%s", dumpExpr(level+2, expr.Range))
+		}
+		dumped += d(level+1, "body:\n%s", dumpExpr(level+2, expr.Body))
+		dumped += dln(level, "}")
+	case *Break:
+		dumped += dln(level, "Break: { label: %s }", expr.Label)
+	case *Continue:
+		dumped += dln(level, "Continue: { label: %s }", expr.Label)
 	case *Assign:
 		dumped += dln(level, "Assign: {")
-		dumped += d(level+1, "lhs:\n%s", dumpExpr(level+2, expr.Lhs))
-		dumped += d(level+1, "rhs:\n%s", dumpExpr(level+2, expr.Rhs))
+		dumped += dln(level+1, "lhs: [")
+		for _, lhs := range expr.Lhs {
+			dumped += dumpExpr(level+2, lhs)
+		}
+		dumped += dln(level+1, "]")
+		dumped += dln(level+1, "rhs: [")
+		for _, rhs := range expr.Rhs {
+			dumped += dumpExpr(level+2, rhs)
+		}
+		dumped += dln(level+1, "]")
 		dumped += dln(level, "}")
-	case *AddOp:
-		dumped += dln(level, "AddOp: {")
+	case *AssignStmt:
+		dumped += dln(level, "AssignStmt: {")
+		dumped += dln(level+1, "op: %s", expr.token().Value)
+		dumped += dln(level+1, "lhs: [")
+		for _, lhs := range expr.Lhs {
+			dumped += dumpExpr(level+2, lhs)
+		}
+		dumped += dln(level+1, "]")
+		dumped += dln(level+1, "rhs: [")
+		for _, rhs := range expr.Rhs {
+			dumped += dumpExpr(level+2, rhs)
+		}
+		dumped += dln(level+1, "]")
+		dumped += dln(level, "}")
+	case *IncDec:
+		dumped += dln(level, "IncDec: {")
+		dumped += dln(level+1, "op: %s", expr.token().Value)
+		dumped += d(level+1, "operand:\n%s", dumpExpr(level+2, expr.Operand))
+		dumped += dln(level, "}")
+	case *TypeDecl:
+		dumped += dln(level, "TypeDecl: {")
+		for _, spec := range expr.Specs {
+			dumped += dln(level+1, "TypeSpec: { name: %s, type: %s }", spec.Name, dumpType(spec.Ty.Underlying))
+		}
+		dumped += dln(level, "}")
+	case *ConstDecl:
+		dumped += dln(level, "ConstDecl: {")
+		for _, spec := range expr.Specs {
+			dumped += dln(level+1, "ConstSpec: {")
+			dumped += dln(level+2, "iota: %d", spec.Iota)
+			for _, constant := range spec.Names {
+				dumped += dumpExpr(level+2, constant)
+			}
+			dumped += dln(level+2, "values: [")
+			for _, value := range spec.Values {
+				dumped += dumpExpr(level+3, value)
+			}
+			dumped += dln(level+2, "]")
+			dumped += dln(level+1, "}")
+		}
+		dumped += dln(level, "}")
+	case *VarDecl:
+		dumped += dln(level, "VarDecl: {")
+		for _, spec := range expr.Specs {
+			dumped += dln(level+1, "VarSpec: {")
+			for _, variable := range spec.Names {
+				dumped += dumpExpr(level+2, variable)
+			}
+			dumped += dln(level+2, "values: [")
+			for _, value := range spec.Values {
+				dumped += dumpExpr(level+3, value)
+			}
+			dumped += dln(level+2, "]")
+			dumped += dln(level+1, "}")
+		}
+		dumped += dln(level, "}")
+	case *Constant:
+		if expr.Value != nil {
+			dumped += dln(level, "Constant: { name: %s, type: %s, value: %s }", expr.Name, dumpType(expr.Ty), expr.Value.format())
+		} else {
+			dumped += dln(level, "Constant: { name: %s, type: %s }", expr.Name, dumpType(expr.Ty))
+		}
+	case *BinaryOp:
+		dumped += dln(level, "BinaryOp: {")
+		dumped += dln(level+1, "op: %s", expr.token().Value)
 		dumped += d(level+1, "lhs\n%s", dumpExpr(level+2, expr.Lhs))
 		dumped += d(level+1, "rhs\n%s", dumpExpr(level+2, expr.Rhs))
 		dumped += dln(level, "}")
+	case *UnaryOp:
+		dumped += dln(level, "UnaryOp: {")
+		dumped += dln(level+1, "op: %s", expr.token().Value)
+		dumped += d(level+1, "operand\n%s", dumpExpr(level+2, expr.Operand))
+		dumped += dln(level, "}")
 	case *Variable:
 		dumped += dln(level, "Variable: { name: %s, type: %s }", expr.Name, dumpType(expr.Ty))
 	case *Identifier:
-		dumped += dln(level, "Identifier: { name: %s, type: %s }", expr.Name, dumpType(expr.Variable.Ty))
+		if expr.Variable != nil {
+			dumped += dln(level, "Identifier: { name: %s, type: %s }", expr.Name, dumpType(expr.Variable.Ty))
+		} else if expr.Constant != nil {
+			dumped += dln(level, "Identifier: { name: %s, type: %s }", expr.Name, dumpType(expr.Constant.Ty))
+		} else {
+			dumped += dln(level, "Identifier: { name: %s }", expr.Name)
+		}
+	case *Iota:
+		dumped += dln(level, "Iota: %d", expr.Value)
 	case *IntLiteral:
 		dumped += dln(level, "IntLiteral: %s", expr.token().Value)
 	case *BoolLiteral:
 		dumped += dln(level, "BoolLiteral: %t", expr.Value)
+	case *StringLiteral:
+		dumped += dln(level, "StringLiteral: %s", expr.token().Value)
+	case *Selector:
+		dumped += dln(level, "Selector: {")
+		dumped += dln(level+1, "field: %s", expr.Sel.Value)
+		dumped += d(level+1, "operand\n%s", dumpExpr(level+2, expr.X))
+		dumped += dln(level, "}")
+	case *Index:
+		dumped += dln(level, "Index: {")
+		dumped += d(level+1, "operand\n%s", dumpExpr(level+2, expr.X))
+		dumped += d(level+1, "index\n%s", dumpExpr(level+2, expr.Index))
+		dumped += dln(level, "}")
+	case *SliceExpr:
+		dumped += dln(level, "SliceExpr: {")
+		dumped += d(level+1, "operand\n%s", dumpExpr(level+2, expr.X))
+		if expr.Low != nil {
+			dumped += d(level+1, "low\n%s", dumpExpr(level+2, expr.Low))
+		}
+		if expr.High != nil {
+			dumped += d(level+1, "high\n%s", dumpExpr(level+2, expr.High))
+		}
+		if expr.Max != nil {
+			dumped += d(level+1, "max\n%s", dumpExpr(level+2, expr.Max))
+		}
+		dumped += dln(level, "}")
+	case *CompositeLit:
+		dumped += dln(level, "CompositeLit: {")
+		if expr.Type != nil {
+			dumped += dln(level+1, "type: %s", dumpType(expr.Type))
+		}
+		dumped += dln(level+1, "elements: [")
+		for _, element := range expr.Elements {
+			if element.Key != nil {
+				dumped += d(level+2, "key:\n%s", dumpExpr(level+3, element.Key))
+			}
+			dumped += dumpExpr(level+2, element.Value)
+		}
+		dumped += dln(level+1, "]")
+		dumped += dln(level, "}")
 	case *FunctionCall:
 		dumped += dln(level, "FunctionCall: {")
-		dumped += dln(level+1, "name: %s", expr.Function.Name)
+		dumped += dln(level+1, "name: %s", expr.Name())
 		dumped += dln(level+1, "arguments: [")
 		for _, argument := range expr.Arguments {
 			dumped += dumpExpr(level+2, argument)
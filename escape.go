@@ -0,0 +1,781 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The escape analysis decides whether the variables whose addresses are taken, the ones allocated by new and `&T{}`,
+// and the underlying arrays of slices allocated by make and slice literals, can live on the stack of the function,
+// or must be allocated on the heap because they outlive its call.
+// It follows the design of gc: the values flowing between the locations which hold them form a graph,
+// whose edges count how many times a value is dereferenced (or -1 if its address is taken) on the way.
+// A location escapes if its address flows to another location which outlives it, such as the heap, a result of the function,
+// or a variable declared outside the loop the location is declared in.
+// Refer to cmd/compile/internal/escape of Go for the original.
+
+// Largest underlying array of a slice allocated on the stack by make or a slice literal, as in gc. A larger one is allocated on the heap.
+const maxStackAllocationSize = 64 * 1024
+
+// Largest variable declared explicitly which is allocated on the stack, as in gc. A larger one is allocated on the heap,
+// so that the frame fits in the stack of the thread.
+const maxStackVarSize = 128 * 1024
+
+// Leaks records how the value of a parameter leaks out of a call of its function, as the number of dereferences of the value
+// which flow to the heap and to each result. -1 means that nothing flows there.
+type Leaks struct {
+	Heap    int
+	Results []int
+}
+
+func newLeaks(results int) *Leaks {
+	leaks := &Leaks{Heap: -1, Results: make([]int, results)}
+	for i := range leaks.Results {
+		leaks.Results[i] = -1
+	}
+	return leaks
+}
+
+// addHeap and addResult record that the value dereferenced `derefs` times flows to the heap or the `i`th result.
+// Only the fewest dereferences are kept, since they leak the most.
+func (leaks *Leaks) addHeap(derefs int) {
+	if leaks.Heap < 0 || derefs < leaks.Heap {
+		leaks.Heap = derefs
+	}
+}
+
+func (leaks *Leaks) addResult(i int, derefs int) {
+	if leaks.Results[i] < 0 || derefs < leaks.Results[i] {
+		leaks.Results[i] = derefs
+	}
+}
+
+// optimize drops the leaks to the results which are implied by the leak to the heap.
+func (leaks *Leaks) optimize() {
+	if leaks.Heap < 0 {
+		return
+	}
+	for i, derefs := range leaks.Results {
+		if derefs >= leaks.Heap {
+			leaks.Results[i] = -1
+		}
+	}
+}
+
+// escapeLocation is where values are held in the analysis: a local variable, an allocation, or the heap.
+type escapeLocation struct {
+	// Variable or allocation of the location, which is a call of new or make, a composite literal whose address is taken, or a slice literal.
+	// Both are nil for the heap and temporary locations.
+	variable *Variable
+	alloc    Expr
+	// Where the allocation is reported.
+	tok *Token
+	// Function which the location belongs to, and the depth of the loops around its declaration there.
+	function  *FunctionDecl
+	loopDepth int
+	// Values flowing into the location.
+	edges []edge
+	// Whether the location outlives all the others. The heap does, and so does a location whose address flows to it.
+	escapes bool
+	// Index of the result of the function held by the location, or -1.
+	result int
+	// Where the value of a parameter leaks. Nil unless the location is a parameter.
+	leaks *Leaks
+	// Number of the walk which last reached the location, and the fewest dereferences from the root on the way.
+	walked int
+	derefs int
+}
+
+// edge is the flow of the value of `src` dereferenced `derefs` times into a location.
+type edge struct {
+	src    *escapeLocation
+	derefs int
+}
+
+// hole is the destination of a value being evaluated, which flows into `dst` dereferenced `derefs` times.
+// The hole without `dst` discards the value.
+type hole struct {
+	dst    *escapeLocation
+	derefs int
+}
+
+// shift returns the hole receiving a value dereferenced `n` more times, or whose address is taken for -1.
+func (k hole) shift(n int) hole {
+	if k.dst == nil {
+		return k
+	}
+	return hole{dst: k.dst, derefs: k.derefs + n}
+}
+
+// escapeAnalysis analyzes a batch of functions which call each other recursively, so that the values flow between their parameters directly.
+type escapeAnalysis struct {
+	heap      *escapeLocation
+	locations []*escapeLocation
+	variables map[*Variable]*escapeLocation
+	// Functions in the batch and the locations of their results.
+	batch   map[*FunctionDecl]bool
+	results map[*FunctionDecl][]*escapeLocation
+	// Function being analyzed and the depth of the loops around the statement being analyzed.
+	function  *FunctionDecl
+	loopDepth int
+	walks     int
+}
+
+// AnalyzeEscapes decides where the variables of the package are allocated, and returns the decisions as notes in the same way as `gc -m`.
+// The functions of the imported packages have to be analyzed beforehand, since the analysis relies on how they leak their parameters.
+func (ast *Ast) AnalyzeEscapes() *Diagnostics {
+	var notes Diagnostics
+	for _, batch := range callGraphComponents(ast.funcs) {
+		analysis := newEscapeAnalysis(batch)
+		for _, function := range batch {
+			analysis.function = function
+			analysis.stmt(function.Body)
+		}
+		analysis.walkAll()
+		analysis.finish(batch, &notes)
+	}
+	// The values of the package-level variables are stored in memory which lives throughout the program.
+	analysis := newEscapeAnalysis(nil)
+	for _, decl := range ast.vars {
+		for _, spec := range decl.Specs {
+			holes := make([]hole, len(spec.Names))
+			for i := range holes {
+				holes[i] = analysis.heapHole()
+			}
+			analysis.assign(holes, spec.Values)
+		}
+	}
+	analysis.walkAll()
+	analysis.finish(nil, &notes)
+	return &notes
+}
+
+// callGraphComponents returns the strongly connected components of the call graph of `functions`, each of whose members calls the others
+// directly or indirectly. A component comes after the ones it calls, so that the callees are analyzed before the callers.
+func callGraphComponents(functions []*FunctionDecl) [][]*FunctionDecl {
+	inPackage := map[*FunctionDecl]bool{}
+	for _, function := range functions {
+		inPackage[function] = true
+	}
+	// Tarjan's algorithm, which finds the components in the reverse topological order.
+	index := map[*FunctionDecl]int{}
+	lowLink := map[*FunctionDecl]int{}
+	onStack := map[*FunctionDecl]bool{}
+	var stack []*FunctionDecl
+	var components [][]*FunctionDecl
+	var visit func(function *FunctionDecl)
+	visit = func(function *FunctionDecl) {
+		index[function] = len(index)
+		lowLink[function] = index[function]
+		stack = append(stack, function)
+		onStack[function] = true
+		walk(function.Body, func(node Expr) {
+			call, ok := node.(*FunctionCall)
+			if !ok || !inPackage[call.Function] {
+				return
+			}
+			callee := call.Function
+			if _, visited := index[callee]; !visited {
+				visit(callee)
+				if lowLink[callee] < lowLink[function] {
+					lowLink[function] = lowLink[callee]
+				}
+			} else if onStack[callee] && index[callee] < lowLink[function] {
+				lowLink[function] = index[callee]
+			}
+		})
+		if lowLink[function] != index[function] {
+			return
+		}
+		var component []*FunctionDecl
+		for {
+			member := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[member] = false
+			component = append([]*FunctionDecl{member}, component...)
+			if member == function {
+				break
+			}
+		}
+		components = append(components, component)
+	}
+	for _, function := range functions {
+		if _, visited := index[function]; !visited {
+			visit(function)
+		}
+	}
+	return components
+}
+
+// newEscapeAnalysis creates the analysis of `batch`, with the locations of the parameters and the results of the functions.
+func newEscapeAnalysis(batch []*FunctionDecl) *escapeAnalysis {
+	analysis := &escapeAnalysis{
+		variables: map[*Variable]*escapeLocation{},
+		batch:     map[*FunctionDecl]bool{},
+		results:   map[*FunctionDecl][]*escapeLocation{},
+	}
+	analysis.heap = &escapeLocation{escapes: true, result: -1, loopDepth: -1}
+	for _, function := range batch {
+		analysis.function = function
+		analysis.batch[function] = true
+		for _, parameter := range function.Parameters {
+			analysis.declare(parameter).leaks = newLeaks(len(function.Results))
+		}
+		for i, result := range function.Results {
+			// Unnamed results are not in the scope, but they are distinct locations as well.
+			location := analysis.declare(result)
+			location.result = i
+			analysis.results[function] = append(analysis.results[function], location)
+		}
+	}
+	analysis.function = nil
+	return analysis
+}
+
+func (analysis *escapeAnalysis) newLocation() *escapeLocation {
+	location := &escapeLocation{function: analysis.function, loopDepth: analysis.loopDepth, result: -1}
+	analysis.locations = append(analysis.locations, location)
+	return location
+}
+
+// declare creates the location of local `variable` declared at the current loop depth.
+func (analysis *escapeAnalysis) declare(variable *Variable) *escapeLocation {
+	location := analysis.newLocation()
+	location.variable = variable
+	location.tok = variable.token()
+	analysis.variables[variable] = location
+	return location
+}
+
+// declareLocal creates the location of `variable` declared by a statement, which is moved to the heap if it is too large for the stack.
+func (analysis *escapeAnalysis) declareLocal(variable *Variable) *escapeLocation {
+	location := analysis.declare(variable)
+	if variable.Ty.Size > maxStackVarSize && variable.Name != "_" {
+		// It lives in memory even if its address is not taken, rather than in registers spilled to the stack.
+		variable.Addressed = true
+		location.escapes = true
+	}
+	return location
+}
+
+func (analysis *escapeAnalysis) heapHole() hole {
+	return hole{dst: analysis.heap}
+}
+
+// variableHole returns the hole assigning to `variable`. A package-level variable lives on the heap.
+func (analysis *escapeAnalysis) variableHole(variable *Variable) hole {
+	if variable.Global {
+		return analysis.heapHole()
+	}
+	return hole{dst: analysis.variables[variable]}
+}
+
+// flow records that the value of `src` flows into `k`.
+func (analysis *escapeAnalysis) flow(k hole, src *escapeLocation) {
+	if k.dst == nil || k.dst == src && k.derefs >= 0 {
+		return
+	}
+	k.dst.edges = append(k.dst.edges, edge{src: src, derefs: k.derefs})
+}
+
+// allocate creates the location of allocation `alloc` reported at `tok`, whose address flows into `k`.
+// Returns the hole for the values stored in the allocated variable.
+func (analysis *escapeAnalysis) allocate(k hole, alloc Expr, tok *Token) hole {
+	location := analysis.newLocation()
+	location.alloc = alloc
+	location.tok = tok
+	analysis.flow(k.shift(-1), location)
+	return hole{dst: location}
+}
+
+// tee returns the hole from which a value flows into all of `holes`.
+func (analysis *escapeAnalysis) tee(holes []hole) hole {
+	switch len(holes) {
+	case 0:
+		return hole{}
+	case 1:
+		return holes[0]
+	}
+	location := analysis.newLocation()
+	for _, k := range holes {
+		analysis.flow(k, location)
+	}
+	return hole{dst: location}
+}
+
+func (analysis *escapeAnalysis) stmt(stmt Expr) {
+	switch stmt := stmt.(type) {
+	case *Block:
+		for _, node := range stmt.Body {
+			analysis.stmt(node)
+		}
+	case *Return:
+		if len(stmt.Values) == 0 {
+			// A bare return returns the named results, which are the locations of the results themselves.
+			return
+		}
+		results := analysis.results[analysis.function]
+		holes := make([]hole, len(results))
+		for i, result := range results {
+			holes[i] = pointerHole(hole{dst: result}, result.variable.Ty)
+		}
+		analysis.assign(holes, stmt.Values)
+	case *If:
+		analysis.discard(stmt.Cond)
+		analysis.stmt(stmt.Then)
+		if stmt.Else != nil {
+			analysis.stmt(stmt.Else)
+		}
+	case *For:
+		if stmt.Init != nil {
+			analysis.stmt(stmt.Init)
+		}
+		if stmt.Range != nil {
+			analysis.rangeClause(stmt)
+		}
+		analysis.loopDepth++
+		for _, variable := range stmt.declared() {
+			// Each iteration has its own variables declared by the clauses, although they are evaluated outside the loop.
+			analysis.variables[variable].loopDepth = analysis.loopDepth
+		}
+		analysis.discard(stmt.Cond)
+		if stmt.Post != nil {
+			analysis.stmt(stmt.Post)
+		}
+		analysis.stmt(stmt.Body)
+		analysis.loopDepth--
+	case *Assign:
+		holes := make([]hole, len(stmt.Lhs))
+		for i, lhs := range stmt.Lhs {
+			if variable, ok := lhs.(*Variable); ok {
+				holes[i] = pointerHole(hole{dst: analysis.declareLocal(variable)}, variable.Ty)
+			} else {
+				holes[i] = analysis.addressHole(lhs)
+			}
+		}
+		analysis.assign(holes, stmt.Rhs)
+	case *AssignStmt:
+		if stmt.Op != 0 {
+			// Only numbers and strings are operated on, and the result holds no pointer to anything else. The operation contains `Lhs`.
+			analysis.discard(stmt.Rhs[0])
+			return
+		}
+		holes := make([]hole, len(stmt.Lhs))
+		for i, lhs := range stmt.Lhs {
+			holes[i] = analysis.addressHole(lhs)
+		}
+		analysis.assign(holes, stmt.Rhs)
+	case *IncDec:
+		analysis.discard(stmt.Operand)
+	case *VarDecl:
+		for _, spec := range stmt.Specs {
+			holes := make([]hole, len(spec.Names))
+			for i, variable := range spec.Names {
+				holes[i] = pointerHole(hole{dst: analysis.declareLocal(variable)}, variable.Ty)
+			}
+			analysis.assign(holes, spec.Values)
+		}
+	case *ConstDecl, *Break, *Continue:
+	default:
+		// Expression statement, which discards all the results of a call.
+		if call, ok := stmt.(*FunctionCall); ok && call.Function != nil {
+			analysis.call(nil, call)
+		} else {
+			analysis.discard(stmt)
+		}
+	}
+}
+
+// rangeClause evaluates the range clause of `loop`. The elements of a slice are reached through its pointer, unlike the ones of an array.
+// The indices hold no pointers.
+func (analysis *escapeAnalysis) rangeClause(loop *For) {
+	var holes [2]hole
+	for i, operand := range []Expr{loop.Key, loop.Value} {
+		if variable, ok := operand.(*Variable); ok {
+			holes[i] = pointerHole(hole{dst: analysis.declareLocal(variable)}, variable.Ty)
+		} else if operand != nil {
+			holes[i] = analysis.addressHole(operand)
+		}
+	}
+	if loop.RangeType.isArray() {
+		analysis.expr(holes[1], loop.Range)
+	} else {
+		analysis.expr(holes[1].shift(1), loop.Range)
+	}
+}
+
+// assign evaluates `values` into `holes` respectively. A single call assigned to multiple holes flows its results into them.
+func (analysis *escapeAnalysis) assign(holes []hole, values []Expr) {
+	if len(values) == 1 && len(holes) > 1 {
+		analysis.call(holes, values[0].(*FunctionCall))
+		return
+	}
+	for i, value := range values {
+		analysis.expr(holes[i], value)
+	}
+}
+
+// addressHole returns the hole assigning to addressable `expr`. A value stored through a pointer may be anywhere, so it flows to the heap.
+// The pointer is evaluated as well, since it may contain allocations.
+func (analysis *escapeAnalysis) addressHole(expr Expr) hole {
+	var k hole
+	var ty *Type
+	switch expr := expr.(type) {
+	case *Identifier:
+		if isBlank(expr) {
+			return hole{}
+		}
+		k, ty = analysis.variableHole(expr.Variable), expr.Variable.Ty
+	case *Selector:
+		if expr.Indirect {
+			analysis.discard(expr.X)
+			k = analysis.heapHole()
+		} else {
+			k = analysis.addressHole(expr.X)
+		}
+		ty = expr.Field.Ty
+	case *UnaryOp:
+		analysis.discard(expr.Operand)
+		k, ty = analysis.heapHole(), expr.OperandType.Elem
+	case *Index:
+		analysis.discard(expr.Index)
+		if expr.OperandType.isArray() {
+			k = analysis.addressHole(expr.X)
+		} else {
+			// The element of a slice, or of an array a pointer points to, is stored through the pointer.
+			analysis.discard(expr.X)
+			k = analysis.heapHole()
+		}
+		ty = expr.OperandType.Elem
+		if expr.OperandType.isPointer() {
+			ty = ty.Elem
+		}
+	}
+	return pointerHole(k, ty)
+}
+
+// pointerHole returns `k` receiving a value of `ty`, or the hole discarding the value if it has no pointers, which cannot refer to any location.
+func pointerHole(k hole, ty *Type) hole {
+	if !ty.hasPointers() {
+		return hole{}
+	}
+	return k
+}
+
+func (analysis *escapeAnalysis) discard(expr Expr) {
+	analysis.expr(hole{}, expr)
+}
+
+// expr evaluates `expr` into `k`, which records the flows of the values which `expr` refers to.
+func (analysis *escapeAnalysis) expr(k hole, expr Expr) {
+	if expr == nil || constantOf(expr) != nil {
+		return
+	}
+	switch expr := expr.(type) {
+	case *Identifier:
+		if location := analysis.variables[expr.Variable]; location != nil {
+			analysis.flow(k, location)
+		}
+	case *BinaryOp:
+		// The results of the operators hold no pointers which the operands have.
+		analysis.discard(expr.Lhs)
+		analysis.discard(expr.Rhs)
+	case *UnaryOp:
+		switch expr.Op {
+		case TOKEN_AMP:
+			if literal, ok := expr.Operand.(*CompositeLit); ok {
+				analysis.expr(analysis.allocate(k, literal, expr.token()), literal)
+			} else {
+				analysis.expr(k.shift(-1), expr.Operand)
+			}
+		case TOKEN_STAR:
+			analysis.expr(k.shift(1), expr.Operand)
+		default:
+			analysis.discard(expr.Operand)
+		}
+	case *Selector:
+		// Fields are not told apart, and a field holds what the whole struct does.
+		if expr.Indirect {
+			analysis.expr(k.shift(1), expr.X)
+		} else {
+			analysis.expr(k, expr.X)
+		}
+	case *Index:
+		analysis.discard(expr.Index)
+		if expr.OperandType.isArray() {
+			analysis.expr(k, expr.X)
+		} else if expr.OperandType.isString() {
+			analysis.discard(expr.X)
+		} else {
+			analysis.expr(k.shift(1), expr.X)
+		}
+	case *SliceExpr:
+		analysis.discard(expr.Low)
+		analysis.discard(expr.High)
+		analysis.discard(expr.Max)
+		// A slice of an array refers to the array itself.
+		if expr.OperandType.isArray() {
+			analysis.expr(k.shift(-1), expr.X)
+		} else {
+			analysis.expr(k, expr.X)
+		}
+	case *CompositeLit:
+		// A slice literal allocates its underlying array, which holds the elements.
+		if expr.Type.isSlice() {
+			k = analysis.allocate(k, expr, expr.lbrace)
+			if expr.Type.Elem.Size*expr.Len > maxStackAllocationSize {
+				k.dst.escapes = true
+			}
+		}
+		for _, element := range expr.Elements {
+			analysis.expr(k, element.Value)
+		}
+	case *FunctionCall:
+		switch {
+		case expr.Conversion != nil:
+			analysis.expr(k, expr.Arguments[0])
+		case expr.Builtin != nil && expr.Builtin.Name == "new":
+			analysis.allocate(k, expr, expr.lparen)
+		case expr.Builtin != nil && expr.Builtin.Name == "make":
+			location := analysis.allocate(k, expr, expr.lparen).dst
+			// The underlying array is allocated on the stack only if its size is known and small.
+			if size := makeSize(expr); size < 0 || size > maxStackAllocationSize {
+				location.escapes = true
+			}
+			for _, argument := range expr.Arguments {
+				analysis.discard(argument)
+			}
+		case expr.Builtin != nil && expr.Builtin.Name == "append":
+			analysis.appendCall(k, expr)
+		case expr.Builtin != nil && expr.Builtin.Name == "copy":
+			// The elements copied to the destination may be anywhere.
+			analysis.discard(expr.Arguments[0])
+			analysis.expr(pointerHole(analysis.heapHole().shift(1), expr.OperandType.Elem), expr.Arguments[1])
+		case expr.Builtin != nil:
+			// len, cap and print do not keep their arguments.
+			for _, argument := range expr.Arguments {
+				analysis.discard(argument)
+			}
+		default:
+			analysis.call([]hole{k}, expr)
+		}
+	}
+}
+
+// makeSize returns the size of the underlying array allocated by `call` of make, or -1 if its capacity is not constant or too large.
+func makeSize(call *FunctionCall) int {
+	capacity := constantOf(call.Arguments[len(call.Arguments)-1])
+	if capacity == nil || !capacity.Int.IsInt64() || capacity.Int.Int64() > maxStackAllocationSize {
+		return -1
+	}
+	return int(capacity.Int.Int64()) * call.TypeArgument.Elem.Size
+}
+
+// appendCall evaluates `call` of append. The slice flows to the result, which may share its underlying array.
+// Since append may copy the elements to a new array allocated on the heap, the elements of the slice and the appended ones flow to the heap.
+func (analysis *escapeAnalysis) appendCall(k hole, call *FunctionCall) {
+	slice := call.Arguments[0]
+	elem := call.OperandType.Elem
+	analysis.expr(analysis.tee([]hole{k, pointerHole(analysis.heapHole().shift(1), elem)}), slice)
+	if call.Ellipsis {
+		analysis.expr(pointerHole(analysis.heapHole().shift(1), elem), call.Arguments[1])
+		return
+	}
+	for _, argument := range call.Arguments[1:] {
+		analysis.expr(pointerHole(analysis.heapHole(), elem), argument)
+	}
+}
+
+// call evaluates `call` of a function whose results flow into `holes` respectively, or are discarded if `holes` is nil.
+// The arguments flow into the parameters of a function in the batch, and into the holes a previously analyzed function leaks them to otherwise.
+func (analysis *escapeAnalysis) call(holes []hole, call *FunctionCall) {
+	function := call.Function
+	inBatch := analysis.batch[function]
+	if inBatch {
+		for i, result := range analysis.results[function] {
+			if i < len(holes) {
+				analysis.flow(holes[i], result)
+			}
+		}
+	}
+	parameterHoles := make([]hole, len(function.Parameters))
+	for i, parameter := range function.Parameters {
+		switch {
+		case inBatch:
+			parameterHoles[i] = hole{dst: analysis.variables[parameter]}
+		case function.Leaks == nil:
+			// The function has not been analyzed, which should not happen. Everything may leak.
+			parameterHoles[i] = analysis.heapHole()
+		default:
+			parameterHoles[i] = analysis.leakHole(holes, function.Leaks[i])
+		}
+	}
+	analysis.assign(parameterHoles, call.Arguments)
+}
+
+// leakHole returns the hole for an argument of a call, which flows to the heap and into `holes` of the results as the parameter leaks.
+func (analysis *escapeAnalysis) leakHole(holes []hole, leaks *Leaks) hole {
+	var leakHoles []hole
+	if leaks.Heap >= 0 {
+		leakHoles = append(leakHoles, analysis.heapHole().shift(leaks.Heap))
+	}
+	for i, derefs := range leaks.Results {
+		if derefs >= 0 && i < len(holes) {
+			leakHoles = append(leakHoles, holes[i].shift(derefs))
+		}
+	}
+	return analysis.tee(leakHoles)
+}
+
+// walkAll finds every location whose address flows to a location outliving it, walking the graph backwards from each location as the root.
+// A location found escaping becomes a root again, since the locations flowing into it outlive everything too.
+func (analysis *escapeAnalysis) walkAll() {
+	todo := append([]*escapeLocation{analysis.heap}, analysis.locations...)
+	for len(todo) > 0 {
+		root := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		analysis.walkOne(root, func(escaped *escapeLocation) { todo = append(todo, escaped) })
+	}
+}
+
+// walkOne finds the fewest dereferences with which the value of each location flows to `root`, and records the parameters leaking to it.
+// `escaped` is called with the locations found escaping.
+func (analysis *escapeAnalysis) walkOne(root *escapeLocation, escaped func(*escapeLocation)) {
+	analysis.walks++
+	root.walked, root.derefs = analysis.walks, 0
+	todo := []*escapeLocation{root}
+	for len(todo) > 0 {
+		l := todo[0]
+		todo = todo[1:]
+		derefs := l.derefs
+		// The address of `l` flows to the root. For a flow like `root = &l; l = x`, the address of `x` does not,
+		// so the dereferences from `l` on count from 0.
+		addressOf := derefs < 0
+		if addressOf {
+			derefs = 0
+		}
+		if outlives(root, l) {
+			if l.leaks != nil {
+				l.leakTo(root, derefs)
+			}
+			if addressOf && !l.escapes {
+				l.escapes = true
+				escaped(l)
+				continue
+			}
+		}
+		for _, edge := range l.edges {
+			if edge.src.escapes {
+				continue
+			}
+			derefs := derefs + edge.derefs
+			if edge.src.walked != analysis.walks || edge.src.derefs > derefs {
+				edge.src.walked, edge.src.derefs = analysis.walks, derefs
+				todo = append(todo, edge.src)
+			}
+		}
+	}
+}
+
+// outlives reports whether a value held by `l` may be used after `other` is gone.
+// The heap and the locations escaping to it outlive everything, and the results are used by the callers after the function returns.
+// A location outlives the ones declared in a loop it is outside of, which are different in each iteration.
+func outlives(l *escapeLocation, other *escapeLocation) bool {
+	switch {
+	case l.escapes, l.result >= 0:
+		return true
+	}
+	return l.function == other.function && l.loopDepth < other.loopDepth
+}
+
+// leakTo records that the value of parameter `l` dereferenced `derefs` times flows to `sink`.
+func (l *escapeLocation) leakTo(sink *escapeLocation, derefs int) {
+	if !sink.escapes && sink.result >= 0 && sink.function == l.function {
+		l.leaks.addResult(sink.result, derefs)
+		return
+	}
+	l.leaks.addHeap(derefs)
+}
+
+// finish records the decisions on the variables, the allocations and the parameters of `batch`, and reports them to `notes`.
+func (analysis *escapeAnalysis) finish(batch []*FunctionDecl, notes *Diagnostics) {
+	for _, l := range analysis.locations {
+		switch {
+		case l.variable != nil:
+			l.variable.Escapes = l.escapes
+			if l.escapes {
+				notes.Add(noteAt(l.tok, "moved to heap: %s", l.variable.Name))
+			}
+		case l.alloc != nil:
+			verdict := "does not escape"
+			if l.escapes {
+				verdict = "escapes to heap"
+			}
+			notes.Add(noteAt(l.tok, "%s %s", allocationString(l.alloc), verdict))
+			switch alloc := l.alloc.(type) {
+			case *FunctionCall:
+				alloc.Escapes = l.escapes
+			case *CompositeLit:
+				alloc.Escapes = l.escapes
+			}
+		}
+	}
+	for _, function := range batch {
+		function.Leaks = make([]*Leaks, len(function.Parameters))
+		for i, parameter := range function.Parameters {
+			location := analysis.variables[parameter]
+			leaks := location.leaks
+			leaks.optimize()
+			if !parameter.Ty.hasPointers() {
+				leaks = newLeaks(len(function.Results))
+			}
+			function.Leaks[i] = leaks
+			if parameter.Name == "" || parameter.Name == "_" || !parameter.Ty.hasPointers() || location.escapes {
+				continue
+			}
+			reportLeaks(parameter, leaks, function, notes)
+		}
+	}
+}
+
+// reportLeaks reports where `parameter` of `function` leaks as gc does.
+func reportLeaks(parameter *Variable, leaks *Leaks, function *FunctionDecl, notes *Diagnostics) {
+	leaked := false
+	if leaks.Heap == 0 {
+		notes.Add(noteAt(parameter.token(), "leaking param: %s", parameter.Name))
+		leaked = true
+	} else if leaks.Heap > 0 {
+		notes.Add(noteAt(parameter.token(), "leaking param content: %s", parameter.Name))
+		leaked = true
+	}
+	for i, derefs := range leaks.Results {
+		if derefs < 0 {
+			continue
+		}
+		// gc names the unnamed results after their indices.
+		name := function.Results[i].Name
+		if name == "" {
+			name = fmt.Sprintf("~r%d", i)
+		}
+		notes.Add(noteAt(parameter.token(), "leaking param: %s to result %s level=%d", parameter.Name, name, derefs))
+		leaked = true
+	}
+	if !leaked {
+		notes.Add(noteAt(parameter.token(), "%s does not escape", parameter.Name))
+	}
+}
+
+// allocationString formats an allocation as gc does in its notes, such as `new(int)`, `&T{...}` or `[]int{...}`.
+func allocationString(alloc Expr) string {
+	if literal, ok := alloc.(*CompositeLit); ok {
+		name := "&" + literal.Type.Name
+		if literal.Type.isSlice() {
+			name = literal.Type.Name
+		}
+		if len(literal.Elements) == 0 {
+			return name + "{}"
+		}
+		return name + "{...}"
+	}
+	return strings.Replace(exprString(alloc), "…", "...", -1)
+}
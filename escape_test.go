@@ -0,0 +1,273 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func analyzeEscapes(t *testing.T, source string) (*Ast, *Diagnostics) {
+	stream := NewByteStream(source)
+	tokenStream, err := Tokenize(stream)
+	assert.NoError(t, err)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+	return ast, ast.AnalyzeEscapes()
+}
+
+// The notes are the same as the ones of `go build -gcflags='-m -l'`.
+func TestEscapeAnalysis(t *testing.T) {
+	_, notes := analyzeEscapes(t, `package main
+type T struct {
+	x    int
+	next *T
+}
+var g = new(int)
+func link(p *T) {
+	p.next = &T{}
+}
+func store(pp **int, q *int) {
+	*pp = q
+}
+func named(p *int) (r *int, n int) {
+	r = p
+	return
+}
+func two(p, q *int) (*int, *int) {
+	return q, p
+}
+func addrParam(n int) *int {
+	return &n
+}
+func swap(a, b *int) {
+	*a, *b = *b, *a
+}
+func local() int {
+	var t T
+	t.next = &T{x: 2}
+	u := T{next: new(T)}
+	return t.next.x + u.next.x
+}
+func loops() int {
+	var p *int
+	for i := 0; i < 2; i++ {
+		y := i
+		p = &y
+	}
+	x := 0
+	q := &x
+	for i := 0; i < 2; i++ {
+		q = &x
+	}
+	return *p + *q
+}
+func multi() int {
+	a, b := two(new(int), new(int))
+	return *a + *b
+}
+func main() {
+	x := 1
+	var p *int
+	store(&p, &x)
+}
+`)
+	assert.Equal(t, `6:12: new(int) escapes to heap
+7:11: p does not escape
+8:11: &T{} escapes to heap
+10:12: pp does not escape
+10:22: leaking param: q
+13:12: leaking param: p to result r level=0
+17:10: leaking param: p to result ~r1 level=0
+17:13: leaking param: q to result ~r0 level=0
+20:16: moved to heap: n
+23:11: a does not escape
+23:14: b does not escape
+28:11: &T{...} does not escape
+29:18: new(T) does not escape
+35:3: moved to heap: y
+46:17: new(int) does not escape
+46:27: new(int) does not escape
+50:2: moved to heap: x`, notes.Error())
+	assert.False(t, notes.HasErrors())
+}
+
+// Each iteration has its own variables declared by the clauses of the loop, so that their addresses outlive the ones of the other iterations.
+func TestEscapeAnalysisOfLoopVariables(t *testing.T) {
+	_, notes := analyzeEscapes(t, `package main
+func main() {
+	var ps []*int
+	for i := 0; i < 3; i++ {
+		ps = append(ps, &i)
+	}
+	var qs []*int
+	for _, v := range [2]int{1, 2} {
+		qs = append(qs, &v)
+	}
+	for j := 0; j < 3; j++ {
+		q := &j
+		_ = q
+	}
+	_, _ = ps, qs
+}
+`)
+	assert.Equal(t, `4:6: moved to heap: i
+8:9: moved to heap: v`, notes.Error())
+}
+
+// A declared variable too large for the stack is moved to the heap even if its address is not taken.
+func TestEscapeAnalysisOfLargeVariables(t *testing.T) {
+	ast, notes := analyzeEscapes(t, `package main
+func main() {
+	var big [1100000]int
+	small := [4]int{}
+	var limit [16384]int
+	big[1] = small[0] + limit[0]
+}
+`)
+	assert.Equal(t, `3:6: moved to heap: big`, notes.Error())
+	big := ast.funcs[0].Body.Body[0].(*VarDecl).Specs[0].Names[0]
+	assert.True(t, big.Addressed)
+	assert.True(t, big.Escapes)
+}
+
+func TestEscapeDecisions(t *testing.T) {
+	ast, _ := analyzeEscapes(t, "package main\ntype T struct {\nx int\n}\nvar g *T\nfunc main() {\na, b := 1, 2\np := &a\ng = &T{}\nq := &T{x: b}\n_, _ = p, q\n}\n")
+	body := ast.funcs[0].Body.Body
+	a := body[0].(*Assign).Lhs[0].(*Variable)
+	assert.True(t, a.Addressed)
+	assert.False(t, a.Escapes)
+	assert.True(t, body[2].(*AssignStmt).Rhs[0].(*UnaryOp).Operand.(*CompositeLit).Escapes)
+	assert.False(t, body[3].(*Assign).Rhs[0].(*UnaryOp).Operand.(*CompositeLit).Escapes)
+	assert.Empty(t, ast.funcs[0].Leaks)
+}
+
+// A call of a function in another package relies on how it leaks its parameters, which is found when the package is analyzed.
+func TestEscapeAnalysisAcrossPackages(t *testing.T) {
+	writeModule(t, map[string]string{
+		"main.go": "package main\nimport \"example.com/m/a\"\nvar g *int\nfunc main() {\nx := 1\na.Keep(&x)\ny := 2\n_ = a.Id(&y)\nz := 3\ng = a.Id(&z)\n}\n",
+		"a/a.go":  "package a\nvar sink *int\nfunc Keep(p *int) {\nsink = p\n}\nfunc Id(p *int) *int {\nreturn p\n}\n",
+	})
+	packages, err := Load([]string{"."})
+	assert.NoError(t, err)
+	var messages []string
+	for _, pkg := range packages {
+		for _, note := range pkg.Ast.AnalyzeEscapes().Sorted() {
+			messages = append(messages, note.Error())
+		}
+	}
+	assert.Equal(t, []string{
+		"a/a.go:3:11: leaking param: p",
+		"a/a.go:6:9: leaking param: p to result ~r0 level=0",
+		"main.go:5:1: moved to heap: x",
+		"main.go:9:1: moved to heap: z",
+	}, messages)
+	assert.Equal(t, &Leaks{Heap: -1, Results: []int{0}}, packages[0].Ast.funcs[1].Leaks[0])
+}
+
+// The notes are the same as the ones of gc, except that gc also reports whether the result of append escapes.
+func TestEscapeAnalysisOfSlices(t *testing.T) {
+	_, notes := analyzeEscapes(t, `package main
+
+var global []int
+var sink []*int
+var gp *[3]int
+
+func keep(s []int) []int {
+	return s[1:]
+}
+func fill(s []*int, p *int) {
+	s[0] = p
+}
+func first(s []*int) *int {
+	return s[0]
+}
+func arr(a [3]*int) *int {
+	return a[1]
+}
+func local() int {
+	s := make([]int, 3)
+	t := []int{1, 2, 3}
+	var d [4]int
+	u := d[:]
+	return s[0] + t[1] + u[2]
+}
+func escaping(n int) {
+	s := make([]int, n)
+	global = s
+	var d [4]int
+	global = d[:]
+	x := 1
+	sink = []*int{&x}
+	big := make([]int, 100000)
+	_ = big
+}
+func appends(p *int) []*int {
+	var s []*int
+	s = append(s, p)
+	return s
+}
+func appendLocal() int {
+	s := []int{}
+	s = append(s, 1, 2)
+	t := make([]int, 0, 4)
+	t = append(t, s...)
+	return len(t)
+}
+func copies(dst []*int, src []*int) int {
+	return copy(dst, src)
+}
+func ranges(s []*int) *int {
+	var last *int
+	for _, p := range s {
+		last = p
+	}
+	return last
+}
+func rangeArr(a *[3]int) int {
+	n := 0
+	for i, v := range a {
+		n += i + v
+	}
+	return n
+}
+func ptrArr() {
+	var a [3]int
+	gp = &a
+	b := new([2]int)
+	_ = b[1]
+}
+func main() int {
+	x := 0
+	fill([]*int{nil}, &x)
+	return local() + len(keep([]int{1, 2})) + appendLocal() + rangeArr(&[3]int{})
+}
+`)
+	assert.Equal(t, `7:11: leaking param: s to result ~r0 level=0
+10:11: s does not escape
+10:21: leaking param: p
+13:12: leaking param: s to result ~r0 level=1
+16:10: leaking param: a to result ~r0 level=0
+20:11: make([]int, 3) does not escape
+21:12: []int{...} does not escape
+27:11: make([]int, n) escapes to heap
+29:6: moved to heap: d
+31:2: moved to heap: x
+32:15: []*int{...} escapes to heap
+33:13: make([]int, 100000) escapes to heap
+36:14: leaking param: p
+42:12: []int{} does not escape
+44:11: make([]int, 0, 4) does not escape
+48:13: dst does not escape
+48:25: leaking param content: src
+51:13: leaking param: s to result ~r0 level=1
+58:15: a does not escape
+66:6: moved to heap: a
+68:10: new([2]int) does not escape
+72:2: moved to heap: x
+73:13: []*int{...} does not escape
+74:33: []int{...} does not escape
+74:69: &[3]int{} does not escape`, notes.Error())
+	assert.False(t, notes.HasErrors())
+}
@@ -2,149 +2,231 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"math/bits"
+	"strconv"
+	"strings"
 )
 
-const fp = "x29"
+// Target of the code generation and the writer which the assembly is output to. Set by `Generate` and `GenerateRuntime`.
+var target Target
+var out io.Writer
+
+// Generate outputs the assembly of a package to `w`, which is assembled into an object file of its own.
+func Generate(program *IrProgram, t Target, w io.Writer) {
+	target, out = t, w
+	target.Header()
+	for _, function := range program.Functions {
+		fmt.Fprintln(out)
+		target.Function(function)
+	}
+	fmt.Fprintln(out)
+	data(program)
+	target.Footer()
+}
+
+// GenerateRuntime outputs the assembly of the runtime to `w`, which is linked with the packages of every program.
+func GenerateRuntime(t Target, w io.Writer) {
+	target, out = t, w
+	target.Header()
+	fmt.Fprintln(out)
+	target.Runtime()
+	fmt.Fprintln(out)
+	os := target.OS()
+	os.Zerofill("runtime.heapptr", 8, 3)
+	os.Zerofill("runtime.heapend", 8, 3)
+	os.Zerofill("runtime.stderr", 1, 0)
+	target.Footer()
+}
+
+// Size of the arenas which `runtime.alloc` maps to allocate memory from, unless an allocation needs a larger one. They are never freed.
+const heapSize = 64 << 20
+
+// Sizes of the classes which the allocator of Go rounds a small allocation up to, from runtime/sizeclasses.go.
+// `runtime.growslice` rounds the capacity up as Go does, so that a slice grows in the same way. A larger allocation is rounded up to pages.
+var sizeClasses = []int{
+	0, 8, 16, 24, 32, 48, 64, 80, 96, 112, 128, 144, 160, 176, 192, 208, 224, 240, 256, 288, 320, 352, 384, 416, 448, 480, 512,
+	576, 640, 704, 768, 896, 1024, 1152, 1280, 1408, 1536, 1792, 2048, 2304, 2688, 3072, 3200, 3456, 4096, 4864, 5376, 6144,
+	6528, 6784, 6912, 8192, 9472, 9728, 10240, 10880, 12288, 13568, 14336, 16384, 18432, 19072, 20480, 21760, 24576, 27264,
+	28672, 32768,
+}
+
+const maxSmallSize = 32768
+const pageSize = 8192
+
+// runtimeErrors are the routines which the generated code and the runtime call to die of an error, and the messages they print,
+// which are the ones of runtime/error.go of Go for the runtime errors. `%x` and `%y` are the first and the second arguments.
+// A negative first argument is formatted with `negative` instead.
+var runtimeErrors = []struct {
+	name     string
+	format   string
+	negative string
+}{
+	{"runtime.panicIndex", panicMessage("index out of range [%x] with length %y"), panicMessage("index out of range [%x]")},
+	{"runtime.panicSliceAlen", panicMessage("slice bounds out of range [:%x] with length %y"), panicMessage("slice bounds out of range [:%x]")},
+	{"runtime.panicSliceAcap", panicMessage("slice bounds out of range [:%x] with capacity %y"), panicMessage("slice bounds out of range [:%x]")},
+	{"runtime.panicSliceB", panicMessage("slice bounds out of range [%x:%y]"), panicMessage("slice bounds out of range [%x:]")},
+	{"runtime.panicSlice3Alen", panicMessage("slice bounds out of range [::%x] with length %y"), panicMessage("slice bounds out of range [::%x]")},
+	{"runtime.panicSlice3Acap", panicMessage("slice bounds out of range [::%x] with capacity %y"), panicMessage("slice bounds out of range [::%x]")},
+	{"runtime.panicSlice3B", panicMessage("slice bounds out of range [:%x:%y]"), panicMessage("slice bounds out of range [:%x:]")},
+	{"runtime.panicSlice3C", panicMessage("slice bounds out of range [%x:%y:]"), panicMessage("slice bounds out of range [%x::]")},
+	{"runtime.panicmakeslicelen", panicMessage("makeslice: len out of range"), ""},
+	{"runtime.panicmakeslicecap", panicMessage("makeslice: cap out of range"), ""},
+	// Running out of memory is a fatal error, which is not a panic.
+	{"runtime.outOfMemory", "fatal error: runtime: out of memory\n", ""},
+}
+
+// panicMessage returns the message of a runtime error of `format`, which is printed as an unrecovered panic is.
+func panicMessage(format string) string {
+	return "panic: runtime error: " + format + "\n"
+}
+
+// messagePieces splits `message` into the strings and the verbs `%x` and `%y` between them.
+func messagePieces(message string) []string {
+	var pieces []string
+	for {
+		i := strings.Index(message, "%")
+		if i < 0 {
+			return append(pieces, message)
+		}
+		if i > 0 {
+			pieces = append(pieces, message[:i])
+		}
+		pieces = append(pieces, message[i:i+2])
+		message = message[i+2:]
+	}
+}
 
-var argumentRegisters = []string{"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7"}
+// Directives to output a word of each size in the data.
+var dataDirectives = map[int]string{1: ".byte", 2: ".short", 4: ".long", 8: ".quad"}
 
-func Generate(ast *Ast) {
-	fmt.Println(".arch armv8-a")
-	fmt.Println(".text")
-	fmt.Println(".align 2")
-	for _, node := range ast.funcs {
-		fmt.Println()
-		node.emit()
+// data outputs the bytes of the string literals and the package-level variables, which other packages can refer to.
+func data(program *IrProgram) {
+	os := target.OS()
+	os.ReadOnlyDataSection()
+	for i, value := range program.Strings {
+		label(os.Symbol(program.stringLabel(i)))
+		if len(value) == 0 {
+			continue
+		}
+		bytes := make([]string, len(value))
+		for j := 0; j < len(value); j++ {
+			bytes[j] = strconv.Itoa(int(value[j]))
+		}
+		code(".byte %s", strings.Join(bytes, ", "))
+	}
+	for _, global := range program.Globals {
+		offsets, size, align := global.Layout()
+		os.Global(global.Name)
+		if global.Data == nil {
+			os.Zerofill(global.Name, size, bits.TrailingZeros(uint(align)))
+			continue
+		}
+		os.DataSection()
+		fmt.Fprintf(out, ".p2align %d\n", bits.TrailingZeros(uint(align)))
+		label(os.Symbol(global.Name))
+		end := 0
+		for i, data := range global.Data {
+			if padding := offsets[i] - end; padding > 0 {
+				code(".zero %d", padding)
+			}
+			value := strconv.FormatInt(data.Imm, 10)
+			if data.Symbol != "" {
+				value = os.Symbol(data.Symbol)
+			}
+			code("%s %s", dataDirectives[global.Types[i].Size], value)
+			end = offsets[i] + global.Types[i].Size
+		}
+		if padding := size - end; padding > 0 {
+			code(".zero %d", padding)
+		}
 	}
 }
 
 func code(format string, a ...any) {
 	s := fmt.Sprintf(format, a...)
-	fmt.Printf("\t%s\n", s)
+	fmt.Fprintf(out, "\t%s\n", s)
 }
 
 func comment(msg string, a ...any) {
 	s := fmt.Sprintf(msg, a...)
-	fmt.Printf("\t;%s\n", s)
+	fmt.Fprintf(out, "\t%s%s\n", target.CommentPrefix(), s)
 }
 
-func (expr *FunctionDecl) emit() {
-	var functionName string
-	if expr.Name == "main" {
-		functionName = "_main"
-	} else {
-		functionName = expr.Name
-	}
-	fmt.Printf(".globl %s\n", functionName)
-	fmt.Printf("%s:\n", functionName)
-
-	save_frame_pointer_and_link_register()
-
-	totalOffset := 0
-	for name, expr := range expr.Scope.exprs {
-		if variable, ok := expr.(*Variable); ok {
-			variable.Offset = totalOffset
-			comment("offset of %s: %d", name, variable.Offset)
-			totalOffset += variable.Ty.GetSize()
-		}
-	}
-
-	code("sub sp, sp, #%d", totalOffset)
-	code("mov %s, sp", fp)
-
-	for i, parameter := range expr.Parameters {
-		code("str %s, [%s, #%d]", argumentRegisters[i], fp, parameter.Offset)
-	}
-	expr.Body.emit()
-
-	code("add sp, sp, #%d", totalOffset)
-	restore_frame_pointer_and_link_register()
-	code("ret")
+func label(name string) {
+	fmt.Fprintf(out, "%s:\n", name)
 }
 
-func save_frame_pointer_and_link_register() {
-	code("stp %s, x30, [sp, -32]!", fp)
+// blockLabel returns the assembler-local label of `block` in `function`.
+func blockLabel(function *IrFunction, block *IrBlock) string {
+	return target.OS().LocalLabel(fmt.Sprintf("%s.%s", function.Name, block))
 }
 
-func restore_frame_pointer_and_link_register() {
-	code("ldp %s, x30, [sp], 32", fp)
-}
-
-func (expr *Block) emit() {
-	for _, stmt := range expr.Body {
-		stmt.emit()
+// nextBlock returns the block laid out just after `block`, or nil if it is the last one.
+func nextBlock(function *IrFunction, block *IrBlock) *IrBlock {
+	if block.Id+1 < len(function.Blocks) {
+		return function.Blocks[block.Id+1]
 	}
+	return nil
 }
 
-func (expr *Return) emit() {
-	expr.Node.emit()
-	generatePop("x0")
+// frameSize returns the size of the frame which holds the spilled virtual registers and the saved callee-saved registers in slots of 8 bytes,
+// and then the stack area of `function`, above the area of `outgoing` bytes for the values of calls passed on the stack.
+// It is aligned to 16 bytes as both ABIs require for the stack pointer.
+func frameSize(function *IrFunction, allocation *Allocation, outgoing int) int {
+	return alignTo(outgoing+(allocation.NumSlots+len(allocation.UsedCalleeSaved))*8+stackAreaSize(function), 16)
 }
 
-func (expr *Assign) emit() {
-	expr.Lhs.emit()
-	expr.Rhs.emit()
-	comment("assign")
-	generatePop("x1")
-	generatePop("x2")
-	code("str x1, [x2]")
+// stackAreaSize returns the size of the stack area of `function`, which is aligned to 8 bytes as the slots are.
+func stackAreaSize(function *IrFunction) int {
+	return alignTo(function.StackSize, 8)
 }
 
-func (expr *AddOp) emit() {
-	expr.Lhs.emit()
-	expr.Rhs.emit()
-	comment("add")
-	generatePop("x2")
-	generatePop("x1")
-	code("add x0, x1, x2")
-	generatePush("x0")
-}
-
-func (expr *Variable) emit() {
-	comment("variable: %s", expr.Name)
-	code("add x0, %s, #%d", fp, expr.Offset)
-	generatePush("x0")
-}
-
-func (expr *Identifier) emit() {
-	comment("identifier: %s", expr.Name)
-	code("add x1, %s, #%d", fp, expr.Variable.Offset)
-	code("ldr x0, [x1]")
-	generatePush("x0")
-}
-
-func (expr *IntLiteral) emit() {
-	comment("int literal")
-	code("mov x0, #%s", expr.tok.Value)
-	generatePush("x0")
-}
-
-func (expr *BoolLiteral) emit() {
-	comment("bool literal")
-	if expr.Value {
-		code("mov x0, #1")
-	} else {
-		code("mov x0, #0")
+// stackLayout returns the offsets of the values of `types` passed on the stack, and the size of the area for them.
+// Each value takes a slot of 8 bytes, unless `packed`, in which case it is only aligned to its size as Apple's arm64 ABI does.
+// The size is aligned to 16 bytes, so that the stack pointer stays aligned.
+func stackLayout(types []*IrType, packed bool) ([]int, int) {
+	if packed {
+		offsets, size, _ := wordLayout(types)
+		return offsets, alignTo(size, 16)
 	}
-	generatePush("x0")
-}
-
-func (expr *FunctionCall) emit() {
-	comment("function call")
-	for i := len(expr.Arguments) - 1; i >= 0; i-- {
-		expr.Arguments[i].emit()
-		generatePop("x0")
-		code("mov x%d, x0", i)
+	offsets := make([]int, len(types))
+	for i := range types {
+		offsets[i] = i * 8
 	}
-	code("bl %s", expr.Function.Name)
-	generatePush("x0")
-	comment("function call end")
+	return offsets, alignTo(len(types)*8, 16)
 }
 
-func generatePush(register string) {
-	code("str %s, [sp, #-16]!", register)
+// stackTypes returns the types of `regs` except the first `n` passed in registers, which are passed on the stack.
+func stackTypes(regs []*IrReg, n int) []*IrType {
+	var types []*IrType
+	for i := n; i < len(regs); i++ {
+		types = append(types, regs[i].Ty)
+	}
+	return types
+}
+
+// outgoingSize returns the size of the area for the arguments and the results of the calls in `function` passed on the stack.
+// The first `arguments` arguments and the first `results` results of a call are passed in registers.
+// A callee returns the results on the stack in the same area as the arguments, which it has read by then.
+func outgoingSize(function *IrFunction, arguments int, results int, packed bool) int {
+	size := 0
+	for _, block := range function.Blocks {
+		for _, instr := range block.Instrs {
+			if instr.Op != IrCall {
+				continue
+			}
+			if _, n := stackLayout(stackTypes(instr.Args, arguments), packed); n > size {
+				size = n
+			}
+			if _, n := stackLayout(stackTypes(instr.Results, results), packed); n > size {
+				size = n
+			}
+		}
+	}
+	return size
 }
 
-func generatePop(register string) {
-	code("ldr %s, [sp], #16", register)
+func alignTo(n int, align int) int {
+	return (n + align - 1) / align * align
 }
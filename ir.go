@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IrProgram is a three-address intermediate representation of a package, which is compiled into an object file of its own.
+// Each function is a control-flow graph of basic blocks, whose instructions operate on an unlimited number of virtual registers.
+type IrProgram struct {
+	// Qualifier of the symbols of the package.
+	Qualifier string
+	Functions []*IrFunction
+	// Contents of the string literals. The `i`th one is labeled `stringLabel(i)`.
+	Strings []string
+	Globals []*IrGlobal
+	// Symbol of the function which initializes the package, or empty if there is nothing to initialize.
+	Init string
+}
+
+// IrGlobal is a package-level variable in memory, whose words are laid out at `Offsets` as the fields of a struct are.
+type IrGlobal struct {
+	Name    string
+	Types   []*IrType
+	Offsets []int
+	// Size and alignment of the variable in bytes.
+	Size  int
+	Align int
+	// Initial values of the words computed at compile time, or nil if the variable starts with zeros.
+	Data []IrData
+}
+
+// IrData is the initial value of a word in memory, which is the address of `Symbol` if it is set, otherwise `Imm`.
+type IrData struct {
+	Imm    int64
+	Symbol string
+}
+
+type IrFunction struct {
+	Name   string
+	Params []*IrReg
+	// Types of the returned values. A value of a source type consisting of multiple words, such as string, is returned in multiple registers.
+	Results []*IrType
+	// Basic blocks in layout order. The first one is the entry.
+	Blocks []*IrBlock
+	// All virtual registers used in the function, indexed by their `Id`.
+	Regs []*IrReg
+	// Size in bytes of the area in the frame for the variables which live on the stack, such as the addressed local variables.
+	StackSize int
+}
+
+// IrType is the type of a value held by a virtual register.
+// An integer narrower than a register is kept sign- or zero-extended to the full width, so that operations on the whole register yield the right value.
+type IrType struct {
+	Name     string
+	Size     int // Size on a memory in bytes.
+	Unsigned bool
+}
+
+var IrI8 = IrType{Name: "i8", Size: 1}
+var IrI16 = IrType{Name: "i16", Size: 2}
+var IrI32 = IrType{Name: "i32", Size: 4}
+var IrI64 = IrType{Name: "i64", Size: 8}
+var IrU8 = IrType{Name: "u8", Size: 1, Unsigned: true}
+var IrU16 = IrType{Name: "u16", Size: 2, Unsigned: true}
+var IrU32 = IrType{Name: "u32", Size: 4, Unsigned: true}
+var IrU64 = IrType{Name: "u64", Size: 8, Unsigned: true}
+var IrBool = IrType{Name: "bool", Size: 1, Unsigned: true}
+var IrPtr = IrType{Name: "ptr", Size: 8, Unsigned: true}
+
+// isNarrow reports whether a value of `ty` has to be extended after an operation which may carry into the upper bits.
+func (ty *IrType) isNarrow() bool {
+	return ty != &IrBool && ty.Size < 8
+}
+
+// IrReg is a virtual register. Unlike SSA form, a register holding a variable may be assigned more than once.
+type IrReg struct {
+	Id int
+	Ty *IrType
+	// Name of the variable held by this register, if any. Used only for readability of the dump.
+	Name string
+}
+
+// IrBlock is a basic block: a sequence of instructions which ends with exactly one terminator.
+type IrBlock struct {
+	Id     int
+	Instrs []*IrInstr
+	Succs  []*IrBlock
+	Preds  []*IrBlock
+}
+
+type IrOp int
+
+const (
+	IrConst       IrOp = iota // Dst = Imm
+	IrCopy                    // Dst = Args[0]
+	IrAdd                     // Dst = Args[0] + Args[1]
+	IrSub                     // Dst = Args[0] - Args[1]
+	IrMul                     // Dst = Args[0] * Args[1]
+	IrDiv                     // Dst = Args[0] / Args[1]
+	IrRem                     // Dst = Args[0] % Args[1]
+	IrAnd                     // Dst = Args[0] & Args[1]
+	IrOr                      // Dst = Args[0] | Args[1]
+	IrXor                     // Dst = Args[0] ^ Args[1]
+	IrAndNot                  // Dst = Args[0] &^ Args[1]
+	IrShl                     // Dst = Args[0] << Args[1]
+	IrShr                     // Dst = Args[0] >> Args[1]
+	IrEq                      // Dst = Args[0] == Args[1]
+	IrNe                      // Dst = Args[0] != Args[1]
+	IrLt                      // Dst = Args[0] < Args[1]
+	IrLe                      // Dst = Args[0] <= Args[1]
+	IrGt                      // Dst = Args[0] > Args[1]
+	IrGe                      // Dst = Args[0] >= Args[1]
+	IrNeg                     // Dst = -Args[0]
+	IrCompl                   // Dst = ^Args[0]
+	IrNot                     // Dst = !Args[0]
+	IrConv                    // Dst = Args[0] converted to the type of Dst
+	IrAddr                    // Dst = address of Symbol
+	IrStackAddr               // Dst = address of the variable at offset Imm in the stack area of the frame
+	IrLoad                    // Dst = value at address Args[0] + Imm
+	IrStore                   // value at address Args[0] + Imm = Args[1]
+	IrCall                    // Results... = Callee(Args...)
+	IrBoundsCheck             // Callee(Args[0], Args[1]) unless Args[0] < Args[1] as unsigned, or Args[0] <= Args[1] if Imm is 1. The callee panics.
+	// Terminators
+	IrRet    // return Args...
+	IrJump   // jump to Targets[0]
+	IrBranch // jump to Targets[0] if Args[0] is true, otherwise to Targets[1]
+)
+
+var irOpNames = map[IrOp]string{
+	IrConst:       "const",
+	IrCopy:        "copy",
+	IrAdd:         "add",
+	IrSub:         "sub",
+	IrMul:         "mul",
+	IrDiv:         "div",
+	IrRem:         "rem",
+	IrAnd:         "and",
+	IrOr:          "or",
+	IrXor:         "xor",
+	IrAndNot:      "andnot",
+	IrShl:         "shl",
+	IrShr:         "shr",
+	IrEq:          "eq",
+	IrNe:          "ne",
+	IrLt:          "lt",
+	IrLe:          "le",
+	IrGt:          "gt",
+	IrGe:          "ge",
+	IrNeg:         "neg",
+	IrCompl:       "compl",
+	IrNot:         "not",
+	IrConv:        "conv",
+	IrAddr:        "addr",
+	IrStackAddr:   "stackaddr",
+	IrLoad:        "load",
+	IrStore:       "store",
+	IrCall:        "call",
+	IrBoundsCheck: "boundscheck",
+	IrRet:         "ret",
+	IrJump:        "jump",
+	IrBranch:      "branch",
+}
+
+type IrInstr struct {
+	Op  IrOp
+	Dst *IrReg
+	// Destinations of IrCall, which may return multiple values.
+	Results []*IrReg
+	Args    []*IrReg
+	Imm     int64
+	Callee  string
+	Symbol  string
+	Targets []*IrBlock
+}
+
+// Defs returns the registers defined by the instruction.
+func (instr *IrInstr) Defs() []*IrReg {
+	if instr.Dst != nil {
+		return []*IrReg{instr.Dst}
+	}
+	return instr.Results
+}
+
+func (op IrOp) isTerminator() bool {
+	return op == IrRet || op == IrJump || op == IrBranch
+}
+
+func (op IrOp) isComparison() bool {
+	return IrEq <= op && op <= IrGe
+}
+
+func (reg *IrReg) String() string {
+	if reg.Name != "" {
+		return fmt.Sprintf("%%%s.%d", reg.Name, reg.Id)
+	}
+	return fmt.Sprintf("%%%d", reg.Id)
+}
+
+func (block *IrBlock) String() string {
+	return fmt.Sprintf("b%d", block.Id)
+}
+
+// Terminator returns the last instruction of the block.
+func (block *IrBlock) Terminator() *IrInstr {
+	if len(block.Instrs) == 0 {
+		return nil
+	}
+	return block.Instrs[len(block.Instrs)-1]
+}
+
+func (program *IrProgram) Dump() string {
+	dumped := ""
+	for _, global := range program.Globals {
+		dumped += global.Dump()
+	}
+	for i, function := range program.Functions {
+		if i > 0 || len(program.Globals) > 0 {
+			dumped += "\n"
+		}
+		dumped += function.Dump()
+	}
+	return dumped
+}
+
+func (global *IrGlobal) Dump() string {
+	dumped := fmt.Sprintf("var %s %s", global.Name, typeList(global.Types))
+	if global.Data != nil {
+		values := make([]string, len(global.Data))
+		for i, data := range global.Data {
+			if data.Symbol != "" {
+				values[i] = data.Symbol
+			} else {
+				values[i] = fmt.Sprintf("%d", data.Imm)
+			}
+		}
+		dumped += " = " + strings.Join(values, ", ")
+	}
+	return dumped + "\n"
+}
+
+// Layout returns the offsets of the words of the global, and its size and alignment in bytes.
+func (global *IrGlobal) Layout() ([]int, int, int) {
+	return global.Offsets, global.Size, global.Align
+}
+
+// wordLayout places words of `types` in order, each aligned to its size.
+// Returns their offsets, and the size and the alignment of the whole.
+func wordLayout(types []*IrType) ([]int, int, int) {
+	offsets := make([]int, len(types))
+	size, align := 0, 1
+	for i, ty := range types {
+		offsets[i] = alignTo(size, ty.Size)
+		size = offsets[i] + ty.Size
+		if ty.Size > align {
+			align = ty.Size
+		}
+	}
+	return offsets, alignTo(size, align), align
+}
+
+func (function *IrFunction) Dump() string {
+	params := make([]string, len(function.Params))
+	for i, param := range function.Params {
+		params[i] = fmt.Sprintf("%s %s", param, param.Ty.Name)
+	}
+	result := ""
+	if len(function.Results) > 0 {
+		result = " " + typeList(function.Results)
+	}
+	dumped := fmt.Sprintf("func %s(%s)%s {\n", function.Name, strings.Join(params, ", "), result)
+	for _, block := range function.Blocks {
+		preds := make([]string, len(block.Preds))
+		for i, pred := range block.Preds {
+			preds[i] = pred.String()
+		}
+		if len(preds) == 0 {
+			dumped += fmt.Sprintf("%s:\n", block)
+		} else {
+			dumped += fmt.Sprintf("%s: ; preds: %s\n", block, strings.Join(preds, ", "))
+		}
+		for _, instr := range block.Instrs {
+			dumped += fmt.Sprintf("\t%s\n", instr)
+		}
+	}
+	dumped += "}\n"
+	return dumped
+}
+
+func (instr *IrInstr) String() string {
+	var operands []string
+	if instr.Op == IrCall || instr.Op == IrBoundsCheck {
+		operands = append(operands, instr.Callee)
+	}
+	if instr.Op == IrConst || instr.Op == IrStackAddr || instr.Op == IrBoundsCheck {
+		operands = append(operands, fmt.Sprintf("%d", instr.Imm))
+	}
+	if instr.Op == IrAddr {
+		operands = append(operands, instr.Symbol)
+	}
+	for _, arg := range instr.Args {
+		operands = append(operands, arg.String())
+	}
+	if (instr.Op == IrLoad || instr.Op == IrStore) && instr.Imm != 0 {
+		// The offset follows the address.
+		operands[0] += fmt.Sprintf("+%d", instr.Imm)
+	}
+	for _, target := range instr.Targets {
+		operands = append(operands, target.String())
+	}
+
+	s := irOpNames[instr.Op]
+	if defs := instr.Defs(); len(defs) > 0 {
+		names := make([]string, len(defs))
+		types := make([]*IrType, len(defs))
+		for i, def := range defs {
+			names[i] = def.String()
+			types[i] = def.Ty
+		}
+		s = fmt.Sprintf("%s = %s %s", strings.Join(names, ", "), s, typeList(types))
+	}
+	if len(operands) > 0 {
+		s += " " + strings.Join(operands, ", ")
+	}
+	return s
+}
+
+// typeList formats `types` as a single type, or a parenthesized list of multiple types.
+func typeList(types []*IrType) string {
+	names := make([]string, len(types))
+	for i, ty := range types {
+		names[i] = ty.Name
+	}
+	if len(types) == 1 {
+		return names[0]
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func (program *IrProgram) stringLabel(i int) string {
+	return fmt.Sprintf("%s.string.%d", program.Qualifier, i)
+}
+
+// globalLabel returns the label of package-level `variable`, qualified with its package as Go does.
+func globalLabel(variable *Variable) string {
+	return variable.Spec.Scope.qualifier + "." + variable.Name
+}
+
+// functionSymbol returns the symbol of `function`, qualified with its package.
+// The main function of the main package is the entry of the program, which is called by the C runtime.
+func functionSymbol(function *FunctionDecl) string {
+	qualifier := function.Scope.outer.qualifier
+	if qualifier == mainQualifier && function.Name == "main" {
+		return "main"
+	}
+	return qualifier + "." + function.Name
+}
+
+// initSymbol returns the symbol of the function which initializes the package qualified with `qualifier`. It initializes the package-level
+// variables whose values are not known at compile time, and calls the functions named init, which are never given this symbol.
+func initSymbol(qualifier string) string {
+	return qualifier + ".init"
+}
+
+// initFunctionSymbol returns the symbol of the `i`th function named init in the package qualified with `qualifier`, as gc names it.
+func initFunctionSymbol(qualifier string, i int) string {
+	return fmt.Sprintf("%s.init.%d", qualifier, i)
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildIrFromSource(t *testing.T, source string) *IrProgram {
+	stream := NewByteStream(source)
+	tokenStream, err := Tokenize(stream)
+	assert.NoError(t, err)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+	ast.AnalyzeEscapes()
+	return BuildIr(ast, nil)
+}
+
+func TestIrFunctionCall(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc main() int {\nx := 1\nreturn f(x, 2) + x\n}\nfunc f(a int, b int) int {\nreturn a * b\n}\n")
+	assert.Equal(t, `func main() i64 {
+b0:
+	%0 = const i64 1
+	%x.1 = copy i64 %0
+	%2 = const i64 2
+	%3 = call i64 main.f, %x.1, %2
+	%4 = add i64 %3, %x.1
+	ret %4
+}
+
+func main.f(%a.0 i64, %b.1 i64) i64 {
+b0:
+	%2 = mul i64 %a.0, %b.1
+	ret %2
+}
+`, program.Dump())
+}
+
+func TestIrIfElse(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc f(b bool) int {\nif b {\nreturn 1\n} else {\nreturn 2\n}\n}\n")
+	assert.Equal(t, `func main.f(%b.0 bool) i64 {
+b0:
+	branch %b.0, b1, b2
+b1: ; preds: b0
+	%1 = const i64 1
+	ret %1
+b2: ; preds: b0
+	%2 = const i64 2
+	ret %2
+}
+`, program.Dump())
+}
+
+func TestIrForWithBreakAndContinue(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc f(b bool) {\nfor i := 0; b; g() {\nif b {\ncontinue\n}\nbreak\n}\n}\nfunc g() {\n}\n")
+	assert.Equal(t, `func main.f(%b.0 bool) {
+b0:
+	%1 = const i64 0
+	%i.2 = copy i64 %1
+	jump b1
+b1: ; preds: b0, b5
+	branch %b.0, b2, b6
+b2: ; preds: b1
+	branch %b.0, b3, b4
+b3: ; preds: b2
+	jump b5
+b4: ; preds: b2
+	jump b6
+b5: ; preds: b3
+	call main.g
+	jump b1
+b6: ; preds: b1, b4
+	ret
+}
+
+func main.g() {
+b0:
+	ret
+}
+`, program.Dump())
+}
+
+func TestIrShortCircuit(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc f(a bool, b bool) bool {\nreturn a && b\n}\n")
+	assert.Equal(t, `func main.f(%a.0 bool, %b.1 bool) bool {
+b0:
+	%2 = copy bool %a.0
+	branch %2, b1, b2
+b1: ; preds: b0
+	%2 = copy bool %b.1
+	jump b2
+b2: ; preds: b0, b1
+	ret %2
+}
+`, program.Dump())
+}
+
+func TestIrString(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc f(s string) string {\nprintln(s, len(s))\nreturn s + \"!\"\n}\n")
+	assert.Equal(t, `func main.f(%s.0 ptr, %s.1 i64) (ptr, i64) {
+b0:
+	call runtime.printstring, %s.0, %s.1
+	%2 = addr ptr main.string.0
+	%3 = const i64 1
+	call runtime.printstring, %2, %3
+	call runtime.printint, %s.1
+	%4 = addr ptr main.string.1
+	%5 = const i64 1
+	call runtime.printstring, %4, %5
+	%6 = addr ptr main.string.2
+	%7 = const i64 1
+	%8, %9 = call (ptr, i64) runtime.concatstring, %s.0, %s.1, %6, %7
+	ret %8, %9
+}
+`, program.Dump())
+	assert.Equal(t, []string{" ", "\n", "!"}, program.Strings)
+}
+
+func TestIrIntegerConversion(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc f(a int8) uint64 {\nreturn uint64(a) + uint64(18446744073709551615)\n}\n")
+	assert.Equal(t, `func main.f(%a.0 i8) u64 {
+b0:
+	%1 = conv u64 %a.0
+	%2 = const u64 -1
+	%3 = add u64 %1, %2
+	ret %3
+}
+`, program.Dump())
+}
+
+func TestIrConstants(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nconst mask uint8 = 1<<8 - 1\nconst greeting = \"hello, \" + \"world\"\nfunc f(a uint8) uint8 {\nprintln(len(greeting), greeting)\nreturn a&mask + 1<<2\n}\n")
+	assert.Equal(t, `func main.f(%a.0 u8) u8 {
+b0:
+	%1 = const i64 12
+	call runtime.printint, %1
+	%2 = addr ptr main.string.0
+	%3 = const i64 1
+	call runtime.printstring, %2, %3
+	%4 = addr ptr main.string.1
+	%5 = const i64 12
+	call runtime.printstring, %4, %5
+	%6 = addr ptr main.string.2
+	%7 = const i64 1
+	call runtime.printstring, %6, %7
+	%8 = const u8 255
+	%9 = and u8 %a.0, %8
+	%10 = const u8 4
+	%11 = add u8 %9, %10
+	ret %11
+}
+`, program.Dump())
+	assert.Equal(t, []string{" ", "hello, world", "\n"}, program.Strings)
+}
+
+func TestIrGlobals(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nvar s = \"s\"\nvar n int16 = -1\nvar m = f()\nvar z string\nfunc f() int {\nreturn int(n)\n}\nfunc main() {\nvar x int\nz := s\nprintln(x, z)\n}\n")
+	assert.Equal(t, `var main.s (ptr, i64) = main.string.0, 1
+var main.n i16 = -1
+var main.m i64
+var main.z (ptr, i64)
+
+func main.init() {
+b0:
+	%0 = call i64 main.f
+	%1 = addr ptr main.m
+	store %1, %0
+	ret
+}
+
+func main.f() i64 {
+b0:
+	%0 = addr ptr main.n
+	%1 = load i16 %0
+	%2 = conv i64 %1
+	ret %2
+}
+
+func main() {
+b0:
+	call main.init
+	%0 = const i64 0
+	%x.1 = copy i64 %0
+	%2 = addr ptr main.s
+	%3 = load ptr %2
+	%4 = load i64 %2+8
+	%z.5 = copy ptr %3
+	%z.6 = copy i64 %4
+	call runtime.printint, %x.1
+	%7 = addr ptr main.string.1
+	%8 = const i64 1
+	call runtime.printstring, %7, %8
+	call runtime.printstring, %z.5, %z.6
+	%9 = addr ptr main.string.2
+	%10 = const i64 1
+	call runtime.printstring, %9, %10
+	ret
+}
+`, program.Dump())
+}
+
+// The functions named init are numbered, and called after the package-level variables are initialized.
+func TestIrInitFunctions(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nvar g int\nfunc init() {\ng = 1\n}\nfunc init() {\n}\nfunc main() {\n}\n")
+	assert.Equal(t, `var main.g i64
+
+func main.init() {
+b0:
+	call main.init.0
+	call main.init.1
+	ret
+}
+
+func main.init.0() {
+b0:
+	%0 = const i64 1
+	%1 = addr ptr main.g
+	store %1, %0
+	ret
+}
+
+func main.init.1() {
+b0:
+	ret
+}
+
+func main() {
+b0:
+	call main.init
+	ret
+}
+`, program.Dump())
+}
+
+func TestIrAssignments(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nvar g int\nfunc main() {\na := 1\nb := 2\na, b = b, a\ng += a\nb++\n_ = b\n}\n")
+	assert.Equal(t, `var main.g i64
+
+func main() {
+b0:
+	%0 = const i64 1
+	%a.1 = copy i64 %0
+	%2 = const i64 2
+	%b.3 = copy i64 %2
+	%4 = copy i64 %b.3
+	%5 = copy i64 %a.1
+	%a.1 = copy i64 %4
+	%b.3 = copy i64 %5
+	%6 = addr ptr main.g
+	%7 = load i64 %6
+	%8 = add i64 %7, %a.1
+	%9 = addr ptr main.g
+	store %9, %8
+	%10 = const i64 1
+	%11 = add i64 %b.3, %10
+	%b.3 = copy i64 %11
+	ret
+}
+`, program.Dump())
+}
+
+func TestIrMultipleResults(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc f() (int, string) {\nreturn 1, \"s\"\n}\nfunc g() (n int8, ok bool) {\nn++\nreturn\n}\nfunc main() {\na, s := f()\n_, ok := g()\n}\n")
+	assert.Equal(t, `func main.f() (i64, ptr, i64) {
+b0:
+	%0 = const i64 1
+	%1 = addr ptr main.string.0
+	%2 = const i64 1
+	ret %0, %1, %2
+}
+
+func main.g() (i8, bool) {
+b0:
+	%0 = const i8 0
+	%n.1 = copy i8 %0
+	%2 = const bool 0
+	%ok.3 = copy bool %2
+	%4 = const i8 1
+	%5 = add i8 %n.1, %4
+	%n.1 = copy i8 %5
+	ret %n.1, %ok.3
+}
+
+func main() {
+b0:
+	%0, %1, %2 = call (i64, ptr, i64) main.f
+	%a.3 = copy i64 %0
+	%s.4 = copy ptr %1
+	%s.5 = copy i64 %2
+	%6, %7 = call (i8, bool) main.g
+	%ok.8 = copy bool %7
+	ret
+}
+`, program.Dump())
+}
+
+func TestIrNestedCalls(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc main() int {\nreturn f(1, f(2, 3))\n}\nfunc f(a int, b int) int {\nreturn a - b\n}\n")
+	assert.Equal(t, `func main() i64 {
+b0:
+	%0 = const i64 1
+	%1 = const i64 2
+	%2 = const i64 3
+	%3 = call i64 main.f, %1, %2
+	%4 = call i64 main.f, %0, %3
+	ret %4
+}
+
+func main.f(%a.0 i64, %b.1 i64) i64 {
+b0:
+	%2 = sub i64 %a.0, %b.1
+	ret %2
+}
+`, program.Dump())
+}
+
+func TestIrStructs(t *testing.T) {
+	program := buildIrFromSource(t, "package main\ntype P struct {\na int8\nb int\ns string\n}\nvar g P\nfunc main() {\np := P{b: 1}\ng.b = p.b\np.a = 2\nprintln(p == g)\n}\n")
+	assert.Equal(t, `var main.g (i8, i64, ptr, i64)
+
+func main() {
+b0:
+	%0 = const i64 1
+	%1 = const i8 0
+	%2 = const ptr 0
+	%3 = const i64 0
+	%p.4 = copy i8 %1
+	%p.5 = copy i64 %0
+	%p.6 = copy ptr %2
+	%p.7 = copy i64 %3
+	%8 = addr ptr main.g
+	store %8+8, %p.5
+	%9 = const i8 2
+	%p.4 = copy i8 %9
+	%10 = addr ptr main.g
+	%11 = load i8 %10
+	%12 = load i64 %10+8
+	%13 = load ptr %10+16
+	%14 = load i64 %10+24
+	%15 = const bool 1
+	%16 = eq bool %p.4, %11
+	%17 = and bool %15, %16
+	%18 = eq bool %p.5, %12
+	%19 = and bool %17, %18
+	%20 = call i64 runtime.cmpstring, %p.6, %p.7, %13, %14
+	%22 = const i64 0
+	%21 = eq bool %20, %22
+	%23 = and bool %19, %21
+	call runtime.printbool, %23
+	%24 = addr ptr main.string.0
+	%25 = const i64 1
+	call runtime.printstring, %24, %25
+	ret
+}
+`, program.Dump())
+}
+
+func TestIrPointers(t *testing.T) {
+	program := buildIrFromSource(t, "package main\ntype P struct {\nx int8\ny int\n}\nfunc main() {\na := 1\np := &a\n*p += 2\nq := &P{y: a}\nq.y++\nprintln(f(), q.x, &q.y == nil)\n}\nfunc f() *int {\nreturn new(int)\n}\n")
+	assert.Equal(t, `func main() {
+b0:
+	%0 = const i64 1
+	%a.1 = stackaddr ptr 0
+	store %a.1, %0
+	%p.2 = copy ptr %a.1
+	%3 = load i64 %p.2
+	%4 = const i64 2
+	%5 = add i64 %3, %4
+	store %p.2, %5
+	%6 = load i64 %a.1
+	%7 = const i8 0
+	%8 = stackaddr ptr 8
+	store %8, %7
+	store %8+8, %6
+	%q.9 = copy ptr %8
+	%10 = load i64 %q.9+8
+	%11 = const i64 1
+	%12 = add i64 %10, %11
+	store %q.9+8, %12
+	%13 = call ptr main.f
+	call runtime.printpointer, %13
+	%14 = addr ptr main.string.0
+	%15 = const i64 1
+	call runtime.printstring, %14, %15
+	%16 = load i8 %q.9
+	call runtime.printint, %16
+	%17 = addr ptr main.string.0
+	%18 = const i64 1
+	call runtime.printstring, %17, %18
+	%20 = const i64 8
+	%19 = add ptr %q.9, %20
+	%21 = const ptr 0
+	%22 = eq bool %19, %21
+	call runtime.printbool, %22
+	%23 = addr ptr main.string.1
+	%24 = const i64 1
+	call runtime.printstring, %23, %24
+	ret
+}
+
+func main.f() ptr {
+b0:
+	%1 = const i64 8
+	%0 = call ptr runtime.alloc, %1
+	ret %0
+}
+`, program.Dump())
+}
+
+func TestIrSlices(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc main() {\na := [2]int{1}\ns := a[:1]\ni := 1\ns = append(s, a[i])\nfor _, v := range s {\nprintln(v)\n}\n}\n")
+	assert.Equal(t, `func main() {
+b0:
+	%0 = const i64 1
+	%1 = const i64 0
+	%a.2 = stackaddr ptr 0
+	store %a.2, %0
+	store %a.2+8, %1
+	%3 = const i64 2
+	%4 = const i64 0
+	%5 = const i64 1
+	boundscheck runtime.panicSliceAlen, 1, %5, %3
+	boundscheck runtime.panicSliceB, 1, %4, %5
+	%6 = sub i64 %5, %4
+	%7 = sub i64 %3, %4
+	%s.8 = copy ptr %a.2
+	%s.9 = copy i64 %6
+	%s.10 = copy i64 %7
+	%11 = const i64 1
+	%i.12 = copy i64 %11
+	%13 = const i64 2
+	boundscheck runtime.panicIndex, 0, %i.12, %13
+	%15 = const i64 8
+	%14 = mul i64 %i.12, %15
+	%16 = add ptr %a.2, %14
+	%17 = load i64 %16
+	%18 = const i64 1
+	%19 = copy ptr %s.8
+	%20 = copy i64 %s.10
+	%21 = add i64 %s.9, %18
+	%22 = gt bool %21, %20
+	branch %22, b1, b2
+b1: ; preds: b0
+	%23 = const i64 8
+	%19, %20 = call (ptr, i64) runtime.growslice, %19, %s.9, %20, %21, %23
+	jump b2
+b2: ; preds: b0, b1
+	%25 = const i64 8
+	%24 = mul i64 %s.9, %25
+	%26 = add ptr %19, %24
+	store %26, %17
+	%s.8 = copy ptr %19
+	%s.9 = copy i64 %21
+	%s.10 = copy i64 %20
+	%27 = copy ptr %s.8
+	%28 = copy i64 %s.9
+	%29 = copy i64 %s.10
+	%31 = const i64 0
+	%30 = copy i64 %31
+	jump b3
+b3: ; preds: b2, b5
+	%32 = lt bool %30, %28
+	branch %32, b4, b6
+b4: ; preds: b3
+	%34 = const i64 8
+	%33 = mul i64 %30, %34
+	%35 = add ptr %27, %33
+	%36 = load i64 %35
+	%v.37 = copy i64 %36
+	call runtime.printint, %v.37
+	%38 = addr ptr main.string.0
+	%39 = const i64 1
+	call runtime.printstring, %38, %39
+	jump b5
+b5: ; preds: b4
+	%41 = const i64 1
+	%40 = add i64 %30, %41
+	%30 = copy i64 %40
+	jump b3
+b6: ; preds: b3
+	ret
+}
+`, program.Dump())
+}
@@ -0,0 +1,1427 @@
+package main
+
+// BuildIr translates a type-checked package into IR. `inits` are the symbols of the initializations of the packages which the package
+// depends on, in the order of their dependencies, and the initialization of the package calls them first. They are empty except for the main package.
+func BuildIr(ast *Ast, inits []string) *IrProgram {
+	program := &IrProgram{Qualifier: ast.scope.qualifier}
+	strings := map[string]int{}
+	for _, decl := range ast.vars {
+		for _, spec := range decl.Specs {
+			for _, variable := range spec.Names {
+				if variable.Name != "_" {
+					program.Globals = append(program.Globals, buildGlobal(program, strings, variable))
+				}
+			}
+		}
+	}
+	// The functions named init, which can be declared many times, are numbered in the order of the source.
+	symbols := make([]string, len(ast.funcs))
+	var initFunctions []string
+	for i, function := range ast.funcs {
+		symbols[i] = functionSymbol(function)
+		if function.Name == "init" {
+			symbols[i] = initFunctionSymbol(program.Qualifier, len(initFunctions))
+			initFunctions = append(initFunctions, symbols[i])
+		}
+	}
+	init := buildInit(program, strings, ast.initOrder, inits, initFunctions)
+	if init != nil {
+		program.Functions = append(program.Functions, init)
+		program.Init = init.Name
+	}
+	for i, function := range ast.funcs {
+		program.Functions = append(program.Functions, buildFunction(program, strings, function, symbols[i], init != nil))
+	}
+	return program
+}
+
+// buildGlobal lays out package-level `variable`. Its initial value is placed in the data if it is a constant.
+func buildGlobal(program *IrProgram, strings map[string]int, variable *Variable) *IrGlobal {
+	types, offsets := memoryLayout(variable.Ty)
+	global := &IrGlobal{Name: globalLabel(variable), Types: types, Offsets: offsets, Size: variable.Ty.Size, Align: variable.Ty.align()}
+	value := constantOf(variable.Spec.value(variable))
+	switch {
+	case value == nil:
+	case value.Ty.isString():
+		index := internString(program, strings, value.String)
+		global.Data = []IrData{{Symbol: program.stringLabel(index)}, {Imm: int64(len(value.String))}}
+	case value.Ty.isBoolean():
+		var bits int64
+		if value.Bool {
+			bits = 1
+		}
+		global.Data = []IrData{{Imm: bits}}
+	default:
+		global.Data = []IrData{{Imm: value.bits()}}
+	}
+	return global
+}
+
+// buildInit builds the function which calls `inits`, then initializes the package-level variables in `order` whose values are not constants,
+// and finally calls `initFunctions`, the functions named init declared in the package. Returns nil if there is nothing to do at run time.
+func buildInit(program *IrProgram, strings map[string]int, order []*Variable, inits []string, initFunctions []string) *IrFunction {
+	builder := newIrBuilder(program, strings, initSymbol(program.Qualifier))
+	builder.startBlock(builder.newBlock())
+	for _, init := range inits {
+		builder.call(init, nil)
+	}
+	initialized := map[*VarSpec]bool{}
+	for _, variable := range order {
+		spec := variable.Spec
+		value := spec.value(variable)
+		if value == nil || constantOf(value) != nil || initialized[spec] {
+			continue
+		}
+		if spec.multiValued() {
+			// The variables initialized by a single call are initialized together.
+			initialized[spec] = true
+			for i, regs := range builder.values(spec.Values, len(spec.Names)) {
+				if spec.Names[i].Name != "_" {
+					builder.storeGlobal(spec.Names[i], regs)
+				}
+			}
+			continue
+		}
+		regs := builder.value(value)
+		if variable.Name != "_" {
+			builder.storeGlobal(variable, regs)
+		}
+	}
+	for _, init := range initFunctions {
+		builder.call(init, nil)
+	}
+	if len(builder.function.Regs) == 0 && len(inits) == 0 && len(initFunctions) == 0 {
+		return nil
+	}
+	builder.emit(&IrInstr{Op: IrRet})
+	return builder.function
+}
+
+type irBuilder struct {
+	program *IrProgram
+	// Indices of the string literals in `program.Strings`, used to share the same contents.
+	strings  map[string]int
+	function *IrFunction
+	// Block which instructions are appended to. Nil after a terminator.
+	block *IrBlock
+	// Registers holding local variables.
+	variables map[*Variable][]*IrReg
+	// Addresses of the local variables which live in memory because their addresses are taken, either on the stack or on the heap.
+	addresses map[*Variable]*IrReg
+	// Result parameters of the function. A bare return returns them if they are named.
+	results []*Variable
+	// Destinations of break and continue statements of each loop.
+	breakBlocks    map[*For]*IrBlock
+	continueBlocks map[*For]*IrBlock
+}
+
+func newIrBuilder(program *IrProgram, strings map[string]int, name string) *irBuilder {
+	return &irBuilder{
+		program:        program,
+		strings:        strings,
+		function:       &IrFunction{Name: name},
+		variables:      map[*Variable][]*IrReg{},
+		addresses:      map[*Variable]*IrReg{},
+		breakBlocks:    map[*For]*IrBlock{},
+		continueBlocks: map[*For]*IrBlock{},
+	}
+}
+
+// buildFunction translates `function` into the function of `symbol`. If `hasInit` is true, main calls the initialization of the package first.
+func buildFunction(program *IrProgram, strings map[string]int, function *FunctionDecl, symbol string, hasInit bool) *IrFunction {
+	builder := newIrBuilder(program, strings, symbol)
+	for _, ty := range function.ReturnType.elements() {
+		builder.function.Results = append(builder.function.Results, irTypes(ty)...)
+	}
+	builder.startBlock(builder.newBlock())
+	for _, parameter := range function.Parameters {
+		if !parameter.Addressed {
+			builder.function.Params = append(builder.function.Params, builder.variable(parameter)...)
+			continue
+		}
+		// The value is passed in registers, and stored to the memory of the parameter.
+		regs := builder.newRegs(parameter.Ty, parameter.Name)
+		builder.function.Params = append(builder.function.Params, regs...)
+		builder.declare(parameter, regs)
+	}
+	builder.results = function.Results
+	if len(function.Results) > 0 && function.Results[0].Name != "" {
+		for _, result := range function.Results {
+			builder.declare(result, builder.zero(result.Ty))
+		}
+	}
+	if builder.function.Name == "main" && hasInit {
+		builder.call(initSymbol(program.Qualifier), nil)
+	}
+
+	builder.stmt(function.Body)
+	if builder.block != nil {
+		builder.emit(&IrInstr{Op: IrRet})
+	}
+	builder.function.removeUnreachableBlocks()
+	return builder.function
+}
+
+// irTypes returns the types of the registers holding a value of `ty`.
+// A string is held in two registers: the pointer to its bytes and its length. A slice is held in three registers: the pointer to
+// its underlying array, its length and its capacity. A struct is held in the registers of its fields in order, and an array in the ones of its elements.
+func irTypes(ty *Type) []*IrType {
+	switch {
+	case ty.isStruct():
+		var types []*IrType
+		for _, field := range ty.Fields {
+			types = append(types, irTypes(field.Ty)...)
+		}
+		return types
+	case ty.isArray():
+		var types []*IrType
+		for i := 0; i < ty.Len; i++ {
+			types = append(types, irTypes(ty.Elem)...)
+		}
+		return types
+	case ty.Id == TypeIdBool:
+		return []*IrType{&IrBool}
+	case ty.Id == TypeIdString:
+		return []*IrType{&IrPtr, &IrI64}
+	case ty.isSlice():
+		return []*IrType{&IrPtr, &IrI64, &IrI64}
+	case ty.isPointer():
+		return []*IrType{&IrPtr}
+	default:
+		return []*IrType{irIntegerType(ty)}
+	}
+}
+
+// memoryLayout returns the types of the registers holding a value of `ty`, and the offsets where they are stored in memory.
+// The words of a struct are placed at the offsets of their fields, and the ones of an array at the offsets of its elements.
+func memoryLayout(ty *Type) ([]*IrType, []int) {
+	if ty.isArray() {
+		var types []*IrType
+		var offsets []int
+		elemTypes, elemOffsets := memoryLayout(ty.Elem)
+		for i := 0; i < ty.Len; i++ {
+			types = append(types, elemTypes...)
+			for _, offset := range elemOffsets {
+				offsets = append(offsets, i*ty.Elem.Size+offset)
+			}
+		}
+		return types, offsets
+	}
+	if !ty.isStruct() {
+		types := irTypes(ty)
+		offsets, _, _ := wordLayout(types)
+		return types, offsets
+	}
+	var types []*IrType
+	var offsets []int
+	for _, field := range ty.Fields {
+		fieldTypes, fieldOffsets := memoryLayout(field.Ty)
+		types = append(types, fieldTypes...)
+		for _, offset := range fieldOffsets {
+			offsets = append(offsets, field.Offset+offset)
+		}
+	}
+	return types, offsets
+}
+
+// fieldStart returns the index of the first register holding `field` among the ones holding a value of struct `ty`.
+func fieldStart(ty *Type, field *Field) int {
+	start := 0
+	for _, other := range ty.Fields {
+		if other == field {
+			break
+		}
+		start += len(irTypes(other.Ty))
+	}
+	return start
+}
+
+// irIntegerType returns the type of the register holding a value of integer type `ty`.
+func irIntegerType(ty *Type) *IrType {
+	signed := map[int]*IrType{1: &IrI8, 2: &IrI16, 4: &IrI32, 8: &IrI64}
+	unsigned := map[int]*IrType{1: &IrU8, 2: &IrU16, 4: &IrU32, 8: &IrU64}
+	if ty.isUnsigned() {
+		return unsigned[ty.Size]
+	}
+	return signed[ty.Size]
+}
+
+func (builder *irBuilder) newReg(ty *IrType, name string) *IrReg {
+	reg := &IrReg{Id: len(builder.function.Regs), Ty: ty, Name: name}
+	builder.function.Regs = append(builder.function.Regs, reg)
+	return reg
+}
+
+func (builder *irBuilder) newRegs(ty *Type, name string) []*IrReg {
+	var regs []*IrReg
+	for _, irType := range irTypes(ty) {
+		regs = append(regs, builder.newReg(irType, name))
+	}
+	return regs
+}
+
+// variable returns the registers holding `variable`, allocating them for the first time.
+func (builder *irBuilder) variable(variable *Variable) []*IrReg {
+	if regs, ok := builder.variables[variable]; ok {
+		return regs
+	}
+	regs := builder.newRegs(variable.Ty, variable.Name)
+	builder.variables[variable] = regs
+	return regs
+}
+
+// zero returns the registers holding the zero value of `ty`. The zero value of a string has a null pointer and length 0.
+func (builder *irBuilder) zero(ty *Type) []*IrReg {
+	var regs []*IrReg
+	for _, irType := range irTypes(ty) {
+		regs = append(regs, builder.constant(irType, 0))
+	}
+	return regs
+}
+
+// declare initializes local `variable` with the value in `regs`, or with the zero value if `regs` is nil.
+// A variable whose address is taken is allocated in memory, which is done each time the declaration is executed,
+// so that a variable declared in a loop is a new one in each iteration if it escapes.
+func (builder *irBuilder) declare(variable *Variable, regs []*IrReg) {
+	if !variable.Addressed {
+		if regs == nil {
+			regs = builder.zero(variable.Ty)
+		}
+		builder.copy(builder.variable(variable), regs)
+		return
+	}
+	address := builder.allocate(variable.Ty, variable.Escapes, variable.Name)
+	builder.addresses[variable] = address
+	if regs == nil {
+		if variable.Escapes {
+			// The heap starts with zeros, which are not stored element by element into a large variable.
+			return
+		}
+		regs = builder.zero(variable.Ty)
+	}
+	builder.store(address, 0, variable.Ty, regs)
+}
+
+// allocate returns the register holding the address of a new variable of `ty`. It is allocated on the heap if it `escapes`,
+// where it starts with zeros, otherwise in the stack area of the frame, which has to be initialized.
+func (builder *irBuilder) allocate(ty *Type, escapes bool, name string) *IrReg {
+	address := builder.newReg(&IrPtr, name)
+	if escapes {
+		builder.call("runtime.alloc", []*IrReg{address}, builder.constant(&IrI64, int64(ty.Size)))
+		return address
+	}
+	offset := alignTo(builder.function.StackSize, ty.align())
+	builder.function.StackSize = offset + ty.Size
+	builder.emit(&IrInstr{Op: IrStackAddr, Dst: address, Imm: int64(offset)})
+	return address
+}
+
+// load returns the registers holding the value of `ty` loaded from the memory at `address` + `offset`.
+func (builder *irBuilder) load(address *IrReg, offset int, ty *Type) []*IrReg {
+	types, offsets := memoryLayout(ty)
+	regs := make([]*IrReg, len(types))
+	for i, irType := range types {
+		regs[i] = builder.newReg(irType, "")
+		builder.emit(&IrInstr{Op: IrLoad, Dst: regs[i], Args: []*IrReg{address}, Imm: int64(offset + offsets[i])})
+	}
+	return regs
+}
+
+// store stores the value of `ty` in `regs` to the memory at `address` + `offset`.
+func (builder *irBuilder) store(address *IrReg, offset int, ty *Type, regs []*IrReg) {
+	_, offsets := memoryLayout(ty)
+	for i, reg := range regs {
+		builder.emit(&IrInstr{Op: IrStore, Args: []*IrReg{address, reg}, Imm: int64(offset + offsets[i])})
+	}
+}
+
+// globalAddress returns the register holding the address of package-level `variable`.
+func (builder *irBuilder) globalAddress(variable *Variable) *IrReg {
+	address := builder.newReg(&IrPtr, "")
+	builder.emit(&IrInstr{Op: IrAddr, Dst: address, Symbol: globalLabel(variable)})
+	return address
+}
+
+// loadGlobal returns the registers holding the value of package-level `variable` loaded from the memory.
+func (builder *irBuilder) loadGlobal(variable *Variable) []*IrReg {
+	return builder.load(builder.globalAddress(variable), 0, variable.Ty)
+}
+
+// storeGlobal stores the value in `regs` to package-level `variable`.
+func (builder *irBuilder) storeGlobal(variable *Variable, regs []*IrReg) {
+	builder.store(builder.globalAddress(variable), 0, variable.Ty, regs)
+}
+
+// inMemory reports whether `expr` lives in memory rather than in registers, which is the case for package-level variables,
+// variables whose addresses are taken, what pointers point to, and the elements of strings and slices.
+// Values which are not addressable, such as the results of calls, are in registers.
+func inMemory(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *Identifier:
+		return expr.Variable.Global || expr.Variable.Addressed
+	case *Selector:
+		return expr.Indirect || inMemory(expr.X)
+	case *Index:
+		return !expr.OperandType.isArray() || inMemory(expr.X)
+	case *UnaryOp:
+		// `*p`
+		return expr.Op == TOKEN_STAR
+	}
+	return false
+}
+
+// address returns the register holding the address of the struct or the variable which addressable `expr` is a part of,
+// and the offset of `expr` from it. `expr` has to live in memory.
+func (builder *irBuilder) address(expr Expr) (*IrReg, int) {
+	switch expr := expr.(type) {
+	case *Identifier:
+		if expr.Variable.Global {
+			return builder.globalAddress(expr.Variable), 0
+		}
+		return builder.addresses[expr.Variable], 0
+	case *Selector:
+		if expr.Indirect {
+			return builder.expr(expr.X), expr.Field.Offset
+		}
+		address, offset := builder.address(expr.X)
+		return address, offset + expr.Field.Offset
+	case *Index:
+		return builder.elementAddress(expr)
+	}
+	return builder.expr(expr.(*UnaryOp).Operand), 0
+}
+
+// destination is where an assignment stores a value of `ty`: the memory at `address` + `offset`,
+// or else the registers of local `variable` from the `start`th one, or the memory of package-level `variable` at `offset`.
+type destination struct {
+	ty       *Type
+	address  *IrReg
+	offset   int
+	variable *Variable
+	start    int
+}
+
+// destination evaluates the pointers which addressable `expr` is reached through, and returns where a value assigned to it is stored.
+// The address of a package-level variable is computed only when the value is stored.
+func (builder *irBuilder) destination(expr Expr) *destination {
+	switch expr := expr.(type) {
+	case *Identifier:
+		if expr.Variable.Addressed && !expr.Variable.Global {
+			return &destination{ty: expr.Variable.Ty, address: builder.addresses[expr.Variable]}
+		}
+		return &destination{ty: expr.Variable.Ty, variable: expr.Variable}
+	case *Selector:
+		if expr.Indirect {
+			return &destination{ty: expr.Field.Ty, address: builder.expr(expr.X), offset: expr.Field.Offset}
+		}
+		dst := builder.destination(expr.X)
+		dst.ty = expr.Field.Ty
+		dst.offset += expr.Field.Offset
+		dst.start += fieldStart(expr.Struct, expr.Field)
+		return dst
+	case *Index:
+		elem := indexedType(expr.OperandType)
+		value := constantOf(expr.Index)
+		if !expr.OperandType.isArray() || value == nil {
+			// An array indexed with a variable lives in memory.
+			address, offset := builder.elementAddress(expr)
+			return &destination{ty: elem, address: address, offset: offset}
+		}
+		i := int(value.Int.Int64())
+		dst := builder.destination(expr.X)
+		dst.ty = elem
+		dst.offset += i * elem.Size
+		dst.start += i * len(irTypes(elem))
+		return dst
+	}
+	operand := expr.(*UnaryOp)
+	return &destination{ty: operand.OperandType.Elem, address: builder.expr(operand.Operand)}
+}
+
+// destinations returns the destinations of the assignment to `lhs`, whose pointers are evaluated before the values are.
+// A blank identifier or nil has no destination.
+func (builder *irBuilder) destinations(lhs []Expr) []*destination {
+	dsts := make([]*destination, len(lhs))
+	for i, expr := range lhs {
+		if expr == nil || isBlank(expr) {
+			continue
+		}
+		dsts[i] = builder.destination(expr)
+		if dsts[i].address != nil && len(lhs) > 1 {
+			// The pointer may be a variable assigned before the value is stored through it.
+			dsts[i].address = builder.temporary([]*IrReg{dsts[i].address})[0]
+		}
+	}
+	return dsts
+}
+
+// loadDestination returns the registers holding the current value at `dst`.
+func (builder *irBuilder) loadDestination(dst *destination) []*IrReg {
+	switch {
+	case dst.address != nil:
+		return builder.load(dst.address, dst.offset, dst.ty)
+	case dst.variable.Global:
+		return builder.load(builder.globalAddress(dst.variable), dst.offset, dst.ty)
+	}
+	return builder.variable(dst.variable)[dst.start : dst.start+len(irTypes(dst.ty))]
+}
+
+// assign stores the value in `regs` to `dst`. A value assigned to the blank identifier, which has no destination, is discarded.
+func (builder *irBuilder) assign(dst *destination, regs []*IrReg) {
+	switch {
+	case dst == nil:
+	case dst.address != nil:
+		builder.store(dst.address, dst.offset, dst.ty, regs)
+	case dst.variable.Global:
+		builder.store(builder.globalAddress(dst.variable), dst.offset, dst.ty, regs)
+	default:
+		builder.copy(builder.variable(dst.variable)[dst.start:dst.start+len(regs)], regs)
+	}
+}
+
+// values returns the registers holding each of `exprs` assigned to `n` operands.
+// A single call assigned to multiple operands is split into its results.
+// All the values are evaluated before they are assigned, so that `a, b = b, a` swaps the variables.
+func (builder *irBuilder) values(exprs []Expr, n int) [][]*IrReg {
+	if len(exprs) == 1 && n > 1 {
+		call := exprs[0].(*FunctionCall)
+		regs := builder.value(call)
+		values := make([][]*IrReg, n)
+		for i, ty := range call.Function.ReturnType.elements() {
+			size := len(irTypes(ty))
+			values[i], regs = regs[:size], regs[size:]
+		}
+		return values
+	}
+	values := make([][]*IrReg, len(exprs))
+	for i, expr := range exprs {
+		values[i] = builder.value(expr)
+		if len(exprs) > 1 {
+			// The value of a variable is held in its own registers, which may be assigned before they are read.
+			values[i] = builder.temporary(values[i])
+		}
+	}
+	return values
+}
+
+// temporary copies the value in `regs` to new registers.
+func (builder *irBuilder) temporary(regs []*IrReg) []*IrReg {
+	temporaries := make([]*IrReg, len(regs))
+	for i, reg := range regs {
+		temporaries[i] = builder.newReg(reg.Ty, "")
+	}
+	builder.copy(temporaries, regs)
+	return temporaries
+}
+
+// copy emits copies of the registers holding a value from `src` to `dst`.
+func (builder *irBuilder) copy(dst []*IrReg, src []*IrReg) {
+	for i := range dst {
+		builder.emit(&IrInstr{Op: IrCopy, Dst: dst[i], Args: []*IrReg{src[i]}})
+	}
+}
+
+func (builder *irBuilder) call(callee string, results []*IrReg, args ...*IrReg) {
+	builder.emit(&IrInstr{Op: IrCall, Results: results, Args: args, Callee: callee})
+}
+
+// newBlock creates a block, which is laid out when it is started.
+func (builder *irBuilder) newBlock() *IrBlock {
+	return &IrBlock{Id: -1}
+}
+
+func (builder *irBuilder) startBlock(block *IrBlock) {
+	block.Id = len(builder.function.Blocks)
+	builder.function.Blocks = append(builder.function.Blocks, block)
+	builder.block = block
+}
+
+// emit appends `instr` to the current block.
+// Instructions following a terminator are unreachable, and they are put in a new block without predecessors.
+func (builder *irBuilder) emit(instr *IrInstr) {
+	if builder.block == nil {
+		builder.startBlock(builder.newBlock())
+	}
+	block := builder.block
+	block.Instrs = append(block.Instrs, instr)
+	if instr.Op.isTerminator() {
+		for _, target := range instr.Targets {
+			block.Succs = append(block.Succs, target)
+			target.Preds = append(target.Preds, block)
+		}
+		builder.block = nil
+	}
+}
+
+func (builder *irBuilder) jump(target *IrBlock) {
+	builder.emit(&IrInstr{Op: IrJump, Targets: []*IrBlock{target}})
+}
+
+func (builder *irBuilder) branch(cond *IrReg, then *IrBlock, els *IrBlock) {
+	builder.emit(&IrInstr{Op: IrBranch, Args: []*IrReg{cond}, Targets: []*IrBlock{then, els}})
+}
+
+func (builder *irBuilder) stmt(stmt Expr) {
+	switch stmt := stmt.(type) {
+	case *Block:
+		for _, node := range stmt.Body {
+			builder.stmt(node)
+		}
+	case *Assign:
+		// Only the redeclared variables have destinations, and the declared ones are not yet in scope of the values.
+		redeclared := make([]Expr, len(stmt.Lhs))
+		for i, lhs := range stmt.Lhs {
+			if _, ok := lhs.(*Variable); !ok {
+				redeclared[i] = lhs
+			}
+		}
+		dsts := builder.destinations(redeclared)
+		values := builder.values(stmt.Rhs, len(stmt.Lhs))
+		for i, lhs := range stmt.Lhs {
+			if variable, ok := lhs.(*Variable); ok {
+				builder.declare(variable, values[i])
+			} else {
+				builder.assign(dsts[i], values[i])
+			}
+		}
+	case *AssignStmt:
+		dsts := builder.destinations(stmt.Lhs)
+		if stmt.Op != 0 {
+			// The operand is evaluated only once, since it may be reached through a pointer returned by a call.
+			operation := stmt.Rhs[0].(*BinaryOp)
+			lhs := builder.loadDestination(dsts[0])
+			builder.assign(dsts[0], builder.binary(operation, lhs, builder.value(operation.Rhs)))
+			break
+		}
+		values := builder.values(stmt.Rhs, len(stmt.Lhs))
+		for i := range stmt.Lhs {
+			builder.assign(dsts[i], values[i])
+		}
+	case *IncDec:
+		dst := builder.destination(stmt.Operand)
+		operand := builder.loadDestination(dst)[0]
+		op := IrAdd
+		if stmt.Op == TOKEN_MINUSMINUS {
+			op = IrSub
+		}
+		one := builder.constant(operand.Ty, 1)
+		result := builder.newReg(operand.Ty, "")
+		builder.emit(&IrInstr{Op: op, Dst: result, Args: []*IrReg{operand, one}})
+		builder.assign(dst, []*IrReg{result})
+	case *Return:
+		var args []*IrReg
+		if len(stmt.Values) == 0 {
+			for _, result := range builder.results {
+				if result.Addressed {
+					args = append(args, builder.load(builder.addresses[result], 0, result.Ty)...)
+				} else {
+					args = append(args, builder.variable(result)...)
+				}
+			}
+		} else {
+			// A call of a function with multiple results returns all of them.
+			for _, value := range stmt.Values {
+				args = append(args, builder.value(value)...)
+			}
+		}
+		builder.emit(&IrInstr{Op: IrRet, Args: args})
+	case *If:
+		then := builder.newBlock()
+		end := builder.newBlock()
+		els := end
+		if stmt.Else != nil {
+			els = builder.newBlock()
+		}
+		builder.branch(builder.expr(stmt.Cond), then, els)
+
+		builder.startBlock(then)
+		builder.stmt(stmt.Then)
+		builder.jump(end)
+		if stmt.Else != nil {
+			builder.startBlock(els)
+			builder.stmt(stmt.Else)
+			builder.jump(end)
+		}
+		builder.startBlock(end)
+	case *For:
+		if stmt.Init != nil {
+			builder.stmt(stmt.Init)
+		}
+		if stmt.Range != nil {
+			builder.rangeLoop(stmt)
+			break
+		}
+		head := builder.newBlock()
+		body := builder.newBlock()
+		post := builder.newBlock()
+		end := builder.newBlock()
+		builder.breakBlocks[stmt] = end
+		builder.continueBlocks[stmt] = post
+
+		builder.jump(head)
+		builder.startBlock(head)
+		if stmt.Cond != nil {
+			builder.branch(builder.expr(stmt.Cond), body, end)
+		} else {
+			builder.jump(body)
+		}
+		builder.startBlock(body)
+		builder.stmt(stmt.Body)
+		builder.jump(post)
+		builder.startBlock(post)
+		for _, variable := range stmt.declared() {
+			if variable.Addressed {
+				// The next iteration has a new variable starting with the value of the current one, to which Post applies.
+				address := builder.allocate(variable.Ty, variable.Escapes, variable.Name)
+				builder.store(address, 0, variable.Ty, builder.load(builder.addresses[variable], 0, variable.Ty))
+				builder.copy([]*IrReg{builder.addresses[variable]}, []*IrReg{address})
+			}
+		}
+		if stmt.Post != nil {
+			builder.stmt(stmt.Post)
+		}
+		builder.jump(head)
+		builder.startBlock(end)
+	case *Break:
+		builder.jump(builder.breakBlocks[stmt.loop])
+	case *Continue:
+		builder.jump(builder.continueBlocks[stmt.loop])
+	case *VarDecl:
+		for _, spec := range stmt.Specs {
+			values := make([][]*IrReg, len(spec.Names))
+			if len(spec.Values) > 0 {
+				values = builder.values(spec.Values, len(spec.Names))
+			}
+			for i, variable := range spec.Names {
+				if variable.Name != "_" {
+					builder.declare(variable, values[i])
+				}
+			}
+		}
+	case *ConstDecl:
+		// Constants have no storage, and their uses have been replaced with the values.
+	default:
+		// Expression statement. Its value is discarded.
+		builder.value(stmt)
+	}
+}
+
+// Operations corresponding to the binary and unary operators.
+var binaryIrOps = map[TokenKind]IrOp{
+	TOKEN_PLUS:     IrAdd,
+	TOKEN_MINUS:    IrSub,
+	TOKEN_STAR:     IrMul,
+	TOKEN_SLASH:    IrDiv,
+	TOKEN_PERCENT:  IrRem,
+	TOKEN_AMP:      IrAnd,
+	TOKEN_PIPE:     IrOr,
+	TOKEN_CARET:    IrXor,
+	TOKEN_AMPCARET: IrAndNot,
+	TOKEN_SHL:      IrShl,
+	TOKEN_SHR:      IrShr,
+	TOKEN_EQ:       IrEq,
+	TOKEN_NE:       IrNe,
+	TOKEN_LT:       IrLt,
+	TOKEN_LE:       IrLe,
+	TOKEN_GT:       IrGt,
+	TOKEN_GE:       IrGe,
+}
+
+var unaryIrOps = map[TokenKind]IrOp{
+	TOKEN_MINUS: IrNeg,
+	TOKEN_CARET: IrCompl,
+	TOKEN_NOT:   IrNot,
+}
+
+// expr returns the register holding the value of `expr`, which must fit in a single register.
+func (builder *irBuilder) expr(expr Expr) *IrReg {
+	return builder.value(expr)[0]
+}
+
+// value returns the registers holding the value of `expr`, which are empty if it has no value.
+func (builder *irBuilder) value(expr Expr) []*IrReg {
+	// Constant expressions have been evaluated by the type checker, including literals.
+	if value := constantOf(expr); value != nil {
+		return builder.constantValue(value)
+	}
+	switch expr := expr.(type) {
+	case *Identifier:
+		if expr.Variable.Global {
+			return builder.loadGlobal(expr.Variable)
+		}
+		if expr.Variable.Addressed {
+			return builder.load(builder.addresses[expr.Variable], 0, expr.Variable.Ty)
+		}
+		return builder.variable(expr.Variable)
+	case *NilLiteral:
+		if expr.Ty != nil {
+			return builder.zero(expr.Ty)
+		}
+		return []*IrReg{builder.constant(&IrPtr, 0)}
+	case *BinaryOp:
+		if expr.Op == TOKEN_ANDAND || expr.Op == TOKEN_OROR {
+			return []*IrReg{builder.logical(expr)}
+		}
+		lhs := builder.value(expr.Lhs)
+		return builder.binary(expr, lhs, builder.value(expr.Rhs))
+	case *UnaryOp:
+		switch expr.Op {
+		case TOKEN_AMP:
+			return []*IrReg{builder.addressOf(expr.Operand)}
+		case TOKEN_STAR:
+			return builder.load(builder.expr(expr.Operand), 0, expr.OperandType.Elem)
+		}
+		operand := builder.expr(expr.Operand)
+		if expr.Op == TOKEN_PLUS {
+			return []*IrReg{operand}
+		}
+		dst := builder.newReg(operand.Ty, "")
+		builder.emit(&IrInstr{Op: unaryIrOps[expr.Op], Dst: dst, Args: []*IrReg{operand}})
+		return []*IrReg{dst}
+	case *Selector:
+		if inMemory(expr) {
+			// Only the field is loaded.
+			address, offset := builder.address(expr)
+			return builder.load(address, offset, expr.Field.Ty)
+		}
+		value := builder.value(expr.X)
+		start := fieldStart(expr.Struct, expr.Field)
+		return value[start : start+len(irTypes(expr.Field.Ty))]
+	case *Index:
+		elem := indexedType(expr.OperandType)
+		if value := constantOf(expr.Index); value != nil && expr.OperandType.isArray() && !inMemory(expr) {
+			i, n := int(value.Int.Int64()), len(irTypes(elem))
+			return builder.value(expr.X)[i*n : (i+1)*n]
+		}
+		address, offset := builder.elementAddress(expr)
+		return builder.load(address, offset, elem)
+	case *SliceExpr:
+		return builder.slice(expr)
+	case *CompositeLit:
+		switch {
+		case expr.Type.isArray():
+			return builder.arrayLiteral(expr.Type, expr.Elements)
+		case expr.Type.isSlice():
+			// The elements are stored to a new underlying array.
+			ty := newArray(expr.Type.Elem, expr.Len)
+			value := builder.arrayLiteral(ty, expr.Elements)
+			address := builder.allocate(ty, expr.Escapes, "")
+			builder.store(address, 0, ty, value)
+			return []*IrReg{address, builder.constant(&IrI64, int64(expr.Len)), builder.constant(&IrI64, int64(expr.Len))}
+		}
+		// The elements are evaluated in the order they appear, and the omitted fields are zero.
+		values := map[*Field][]*IrReg{}
+		for _, element := range expr.Elements {
+			values[element.Field] = builder.value(element.Value)
+		}
+		var regs []*IrReg
+		for _, field := range expr.Type.Fields {
+			value, ok := values[field]
+			if !ok {
+				value = builder.zero(field.Ty)
+			}
+			regs = append(regs, value...)
+		}
+		return regs
+	case *FunctionCall:
+		if expr.Builtin != nil {
+			return builder.builtinCall(expr)
+		}
+		if expr.Conversion != nil {
+			return builder.conversion(expr.Conversion, expr.Arguments[0])
+		}
+		// The arguments are evaluated from left to right into virtual registers before the call,
+		// and the code generator moves them to the argument registers only at the call, so a call in an argument cannot clobber them.
+		var args []*IrReg
+		for _, argument := range expr.Arguments {
+			args = append(args, builder.value(argument)...)
+		}
+		var results []*IrReg
+		for _, ty := range expr.Function.ReturnType.elements() {
+			results = append(results, builder.newRegs(ty, "")...)
+		}
+		builder.call(functionSymbol(expr.Function), results, args...)
+		return results
+	}
+	return nil
+}
+
+// binary returns the registers holding the result of binary operation `expr` on the values in `lhs` and `rhs`.
+func (builder *irBuilder) binary(expr *BinaryOp, lhs []*IrReg, rhs []*IrReg) []*IrReg {
+	if expr.OperandType.isStruct() || expr.OperandType.isArray() {
+		equal := builder.equal(expr.OperandType, lhs, rhs)
+		if expr.Op == TOKEN_EQ {
+			return []*IrReg{equal}
+		}
+		dst := builder.newReg(&IrBool, "")
+		builder.emit(&IrInstr{Op: IrNot, Dst: dst, Args: []*IrReg{equal}})
+		return []*IrReg{dst}
+	}
+	if expr.OperandType.isString() {
+		return builder.stringOp(expr.Op, lhs, rhs)
+	}
+	op := binaryIrOps[expr.Op]
+	ty := lhs[0].Ty
+	if op.isComparison() {
+		ty = &IrBool
+	}
+	dst := builder.newReg(ty, "")
+	builder.emit(&IrInstr{Op: op, Dst: dst, Args: []*IrReg{lhs[0], rhs[0]}})
+	return []*IrReg{dst}
+}
+
+// addressOf returns the register holding the address of addressable `expr`,
+// or of a new variable initialized with `expr` if it is a composite literal.
+func (builder *irBuilder) addressOf(expr Expr) *IrReg {
+	if literal, ok := expr.(*CompositeLit); ok {
+		value := builder.value(literal)
+		address := builder.allocate(literal.Type, literal.Escapes, "")
+		builder.store(address, 0, literal.Type, value)
+		return address
+	}
+	address, offset := builder.address(expr)
+	if offset == 0 {
+		return address
+	}
+	dst := builder.newReg(&IrPtr, "")
+	builder.emit(&IrInstr{Op: IrAdd, Dst: dst, Args: []*IrReg{address, builder.constant(&IrI64, int64(offset))}})
+	return dst
+}
+
+func (builder *irBuilder) constant(ty *IrType, value int64) *IrReg {
+	dst := builder.newReg(ty, "")
+	builder.emit(&IrInstr{Op: IrConst, Dst: dst, Imm: value})
+	return dst
+}
+
+// constantValue returns the registers holding constant `value`. An untyped constant has its default type.
+func (builder *irBuilder) constantValue(value *ConstantValue) []*IrReg {
+	ty := defaultType(value.Ty)
+	switch {
+	case ty.isString():
+		return builder.stringLiteral(value.String)
+	case ty.isBoolean():
+		var bits int64
+		if value.Bool {
+			bits = 1
+		}
+		return []*IrReg{builder.constant(&IrBool, bits)}
+	default:
+		// The type checker has ensured that the value fits in `ty`.
+		return []*IrReg{builder.constant(irIntegerType(ty), value.bits())}
+	}
+}
+
+// conversion translates the conversion of `argument` to `ty`, which keeps the value if the types are the same.
+// A struct converted to another struct type with the same fields keeps its value as well.
+func (builder *irBuilder) conversion(ty *Type, argument Expr) []*IrReg {
+	src := builder.value(argument)
+	if ty.isStruct() {
+		return src
+	}
+	dstType := irTypes(ty)[0]
+	if src[0].Ty == dstType {
+		return src
+	}
+	dst := builder.newReg(dstType, "")
+	builder.emit(&IrInstr{Op: IrConv, Dst: dst, Args: src})
+	return []*IrReg{dst}
+}
+
+// internString returns the index of `value` in `program.Strings`, adding it if the same contents are not there yet.
+func internString(program *IrProgram, strings map[string]int, value string) int {
+	index, ok := strings[value]
+	if !ok {
+		index = len(program.Strings)
+		program.Strings = append(program.Strings, value)
+		strings[value] = index
+	}
+	return index
+}
+
+// stringLiteral returns the registers holding a string of `value`, whose bytes are placed in the read-only data.
+func (builder *irBuilder) stringLiteral(value string) []*IrReg {
+	index := internString(builder.program, builder.strings, value)
+	ptr := builder.newReg(&IrPtr, "")
+	builder.emit(&IrInstr{Op: IrAddr, Dst: ptr, Symbol: builder.program.stringLabel(index)})
+	return []*IrReg{ptr, builder.constant(&IrI64, int64(len(value)))}
+}
+
+// equal returns the register holding whether `lhs` and `rhs` holding values of `ty` are equal.
+// Structs are equal if all their fields except blank ones are equal, and arrays are equal if all their elements are equal.
+func (builder *irBuilder) equal(ty *Type, lhs []*IrReg, rhs []*IrReg) *IrReg {
+	switch {
+	case ty.isStruct():
+		result := builder.constant(&IrBool, 1)
+		for _, field := range ty.Fields {
+			if field.Name == "_" {
+				continue
+			}
+			start, end := fieldStart(ty, field), fieldStart(ty, field)+len(irTypes(field.Ty))
+			equal := builder.equal(field.Ty, lhs[start:end], rhs[start:end])
+			dst := builder.newReg(&IrBool, "")
+			builder.emit(&IrInstr{Op: IrAnd, Dst: dst, Args: []*IrReg{result, equal}})
+			result = dst
+		}
+		return result
+	case ty.isArray():
+		result := builder.constant(&IrBool, 1)
+		n := len(irTypes(ty.Elem))
+		for i := 0; i < ty.Len; i++ {
+			equal := builder.equal(ty.Elem, lhs[i*n:(i+1)*n], rhs[i*n:(i+1)*n])
+			dst := builder.newReg(&IrBool, "")
+			builder.emit(&IrInstr{Op: IrAnd, Dst: dst, Args: []*IrReg{result, equal}})
+			result = dst
+		}
+		return result
+	case ty.isString():
+		return builder.stringOp(TOKEN_EQ, lhs, rhs)[0]
+	}
+	dst := builder.newReg(&IrBool, "")
+	builder.emit(&IrInstr{Op: IrEq, Dst: dst, Args: []*IrReg{lhs[0], rhs[0]}})
+	return dst
+}
+
+// stringOp translates a binary operation on strings into a call of the runtime.
+// Comparisons are done on the result of `runtime.cmpstring`, which is negative, zero or positive as strcmp.
+func (builder *irBuilder) stringOp(op TokenKind, lhs []*IrReg, rhs []*IrReg) []*IrReg {
+	if op == TOKEN_PLUS {
+		results := builder.newRegs(&TypeString, "")
+		builder.call("runtime.concatstring", results, lhs[0], lhs[1], rhs[0], rhs[1])
+		return results
+	}
+	cmp := builder.newReg(&IrI64, "")
+	builder.call("runtime.cmpstring", []*IrReg{cmp}, lhs[0], lhs[1], rhs[0], rhs[1])
+	dst := builder.newReg(&IrBool, "")
+	builder.emit(&IrInstr{Op: binaryIrOps[op], Dst: dst, Args: []*IrReg{cmp, builder.constant(&IrI64, 0)}})
+	return []*IrReg{dst}
+}
+
+// builtinCall translates a call of a builtin function.
+// print and println write their arguments to the standard output, and new allocates a zeroed variable.
+func (builder *irBuilder) builtinCall(call *FunctionCall) []*IrReg {
+	switch call.Builtin.Name {
+	case "new":
+		address := builder.allocate(call.TypeArgument, call.Escapes, "")
+		if !call.Escapes {
+			// The stack area is reused, such as in each iteration of a loop, while the heap is zeroed only once.
+			builder.store(address, 0, call.TypeArgument, builder.zero(call.TypeArgument))
+		}
+		return []*IrReg{address}
+	case "make":
+		return builder.makeSlice(call)
+	case "len", "cap":
+		// The length of an array is known, but the argument is evaluated for the calls in it.
+		value := builder.value(call.Arguments[0])
+		switch ty := call.OperandType; {
+		case ty.isArray():
+			return []*IrReg{builder.constant(&IrI64, int64(ty.Len))}
+		case ty.isPointer():
+			return []*IrReg{builder.constant(&IrI64, int64(ty.Elem.Len))}
+		case call.Builtin.Name == "cap":
+			return []*IrReg{value[2]}
+		}
+		return []*IrReg{value[1]}
+	case "append":
+		return builder.appendCall(call)
+	case "copy":
+		return builder.copyCall(call)
+	case "print", "println":
+		for i, argument := range call.Arguments {
+			if call.Builtin.Name == "println" && i > 0 {
+				builder.call("runtime.printstring", nil, builder.stringLiteral(" ")...)
+			}
+			value := builder.value(argument)
+			switch ty := value[0].Ty; {
+			case ty == &IrPtr && len(value) == 3:
+				// A slice is printed as `[len/cap]0xptr`.
+				builder.call("runtime.printstring", nil, builder.stringLiteral("[")...)
+				builder.call("runtime.printint", nil, value[1])
+				builder.call("runtime.printstring", nil, builder.stringLiteral("/")...)
+				builder.call("runtime.printint", nil, value[2])
+				builder.call("runtime.printstring", nil, builder.stringLiteral("]")...)
+				builder.call("runtime.printpointer", nil, value[0])
+			case ty == &IrPtr && len(value) == 2:
+				builder.call("runtime.printstring", nil, value...)
+			case ty == &IrPtr:
+				builder.call("runtime.printpointer", nil, value...)
+			case ty == &IrBool:
+				builder.call("runtime.printbool", nil, value...)
+			case ty.Unsigned:
+				builder.call("runtime.printuint", nil, value...)
+			default:
+				builder.call("runtime.printint", nil, value...)
+			}
+		}
+		if call.Builtin.Name == "println" {
+			builder.call("runtime.printstring", nil, builder.stringLiteral("\n")...)
+		}
+	}
+	return nil
+}
+
+// index returns the register holding the value of index `expr` as a 64-bit integer, which is compared with lengths as unsigned,
+// so that a negative index is out of range as well.
+func (builder *irBuilder) index(expr Expr) *IrReg {
+	index := builder.expr(expr)
+	if index.Ty.Size == 8 {
+		return index
+	}
+	dst := builder.newReg(&IrI64, "")
+	builder.emit(&IrInstr{Op: IrConv, Dst: dst, Args: []*IrReg{index}})
+	return dst
+}
+
+// boundsCheck panics by calling `callee` with `x` and `y` unless `x` < `y`, or `x` <= `y` if `inclusive`.
+func (builder *irBuilder) boundsCheck(callee string, x *IrReg, y *IrReg, inclusive bool) {
+	var imm int64
+	if inclusive {
+		imm = 1
+	}
+	builder.emit(&IrInstr{Op: IrBoundsCheck, Args: []*IrReg{x, y}, Imm: imm, Callee: callee})
+}
+
+// elementAt returns the register holding the address of the element at `index` of the array at `base`, whose elements are of `size` bytes.
+func (builder *irBuilder) elementAt(base *IrReg, index *IrReg, size int) *IrReg {
+	offset := index
+	if size != 1 {
+		offset = builder.newReg(&IrI64, "")
+		builder.emit(&IrInstr{Op: IrMul, Dst: offset, Args: []*IrReg{index, builder.constant(&IrI64, int64(size))}})
+	}
+	dst := builder.newReg(&IrPtr, "")
+	builder.emit(&IrInstr{Op: IrAdd, Dst: dst, Args: []*IrReg{base, offset}})
+	return dst
+}
+
+// elementAddress returns the register holding the address of the element which `expr` indexes, and the offset of the element from it.
+// The index is checked against the length unless it is a constant index of an array, which the type checker has checked.
+// An array which does not live in memory, such as the result of a call, is stored to the stack to be indexed.
+func (builder *irBuilder) elementAddress(expr *Index) (*IrReg, int) {
+	ty := expr.OperandType
+	elem := indexedType(ty)
+	var base, length *IrReg
+	offset := 0
+	switch {
+	case ty.isString(), ty.isSlice():
+		value := builder.value(expr.X)
+		base, length = value[0], value[1]
+	case ty.isPointer():
+		base = builder.expr(expr.X)
+	case inMemory(expr.X):
+		base, offset = builder.address(expr.X)
+	default:
+		value := builder.value(expr.X)
+		base = builder.allocate(ty, false, "")
+		builder.store(base, 0, ty, value)
+	}
+	if value := constantOf(expr.Index); value != nil && length == nil {
+		return base, offset + int(value.Int.Int64())*elem.Size
+	}
+	index := builder.index(expr.Index)
+	if length == nil {
+		length = builder.constant(&IrI64, int64(lengthOf(expr.X, ty)))
+	}
+	builder.boundsCheck("runtime.panicIndex", index, length, false)
+	return builder.elementAt(base, index, elem.Size), offset
+}
+
+// slice translates slice expression `expr`. The indices are evaluated before they are checked from the last one,
+// so that each of them is in the range up to the next one, and the last one is in the range up to the capacity.
+func (builder *irBuilder) slice(expr *SliceExpr) []*IrReg {
+	ty := expr.OperandType
+	elem := indexedType(ty)
+	var base, length, capacity *IrReg
+	// Slices are checked against their capacities, and the others against their lengths.
+	bound := "len"
+	switch {
+	case ty.isString():
+		value := builder.value(expr.X)
+		base, length, capacity = value[0], value[1], value[1]
+	case ty.isSlice():
+		value := builder.value(expr.X)
+		base, length, capacity = value[0], value[1], value[2]
+		bound = "cap"
+	case ty.isPointer():
+		base = builder.expr(expr.X)
+	default:
+		base = builder.addressOf(expr.X)
+	}
+	if length == nil {
+		length = builder.constant(&IrI64, int64(lengthOf(expr.X, ty)))
+		capacity = length
+	}
+
+	low, high := builder.constant(&IrI64, 0), length
+	if expr.Low != nil {
+		low = builder.index(expr.Low)
+	}
+	if expr.High != nil {
+		high = builder.index(expr.High)
+	}
+	if expr.Max != nil {
+		max := builder.index(expr.Max)
+		builder.boundsCheck("runtime.panicSlice3A"+bound, max, capacity, true)
+		builder.boundsCheck("runtime.panicSlice3B", high, max, true)
+		builder.boundsCheck("runtime.panicSlice3C", low, high, true)
+		capacity = max
+	} else {
+		if expr.High != nil {
+			builder.boundsCheck("runtime.panicSliceA"+bound, high, capacity, true)
+		}
+		builder.boundsCheck("runtime.panicSliceB", low, high, true)
+	}
+
+	ptr := base
+	if expr.Low != nil {
+		ptr = builder.elementAt(base, low, elem.Size)
+	}
+	newLength := builder.newReg(&IrI64, "")
+	builder.emit(&IrInstr{Op: IrSub, Dst: newLength, Args: []*IrReg{high, low}})
+	if ty.isString() {
+		return []*IrReg{ptr, newLength}
+	}
+	newCapacity := builder.newReg(&IrI64, "")
+	builder.emit(&IrInstr{Op: IrSub, Dst: newCapacity, Args: []*IrReg{capacity, low}})
+	return []*IrReg{ptr, newLength, newCapacity}
+}
+
+// arrayLiteral returns the registers holding array `ty` of `elements`, which are evaluated in the order they appear.
+// The omitted elements are zero.
+func (builder *irBuilder) arrayLiteral(ty *Type, elements []*Element) []*IrReg {
+	values := map[int][]*IrReg{}
+	for _, element := range elements {
+		values[element.Index] = builder.value(element.Value)
+	}
+	var regs []*IrReg
+	for i := 0; i < ty.Len; i++ {
+		value, ok := values[i]
+		if !ok {
+			value = builder.zero(ty.Elem)
+		}
+		regs = append(regs, value...)
+	}
+	return regs
+}
+
+// makeSlice translates `call` of make, which allocates a zeroed underlying array. `runtime.makeslice` allocates it on the heap
+// after checking the length and the capacity. Otherwise the capacity is a constant, and the array is allocated on the stack.
+func (builder *irBuilder) makeSlice(call *FunctionCall) []*IrReg {
+	elem := call.TypeArgument.Elem
+	length := builder.index(call.Arguments[0])
+	capacity := length
+	if len(call.Arguments) == 2 {
+		capacity = builder.index(call.Arguments[1])
+	}
+	if call.Escapes {
+		address := builder.newReg(&IrPtr, "")
+		builder.call("runtime.makeslice", []*IrReg{address}, length, capacity, builder.constant(&IrI64, int64(elem.Size)))
+		return []*IrReg{address, length, capacity}
+	}
+	if constantOf(call.Arguments[0]) == nil {
+		builder.boundsCheck("runtime.panicmakeslicelen", length, capacity, true)
+	}
+	ty := newArray(elem, int(constantOf(call.Arguments[len(call.Arguments)-1]).Int.Int64()))
+	address := builder.allocate(ty, false, "")
+	builder.call("runtime.memclr", nil, address, builder.constant(&IrI64, int64(ty.Size)))
+	return []*IrReg{address, length, capacity}
+}
+
+// appendCall translates `call` of append. If the elements do not fit in the capacity, `runtime.growslice` copies the slice
+// to a new underlying array with enough capacity. The appended elements are stored after the elements of the slice.
+func (builder *irBuilder) appendCall(call *FunctionCall) []*IrReg {
+	elem := call.OperandType.Elem
+	slice := builder.value(call.Arguments[0])
+	var values [][]*IrReg
+	var count *IrReg
+	if call.Ellipsis {
+		// The elements of a slice, or the bytes of a string.
+		values = [][]*IrReg{builder.value(call.Arguments[1])}
+		count = values[0][1]
+	} else {
+		for _, argument := range call.Arguments[1:] {
+			values = append(values, builder.value(argument))
+		}
+		if len(values) == 0 {
+			return slice
+		}
+		count = builder.constant(&IrI64, int64(len(values)))
+	}
+
+	ptr, length, capacity := builder.newReg(&IrPtr, ""), slice[1], builder.newReg(&IrI64, "")
+	builder.copy([]*IrReg{ptr, capacity}, []*IrReg{slice[0], slice[2]})
+	newLength := builder.newReg(&IrI64, "")
+	builder.emit(&IrInstr{Op: IrAdd, Dst: newLength, Args: []*IrReg{length, count}})
+	grow := builder.newBlock()
+	end := builder.newBlock()
+	exceeds := builder.newReg(&IrBool, "")
+	builder.emit(&IrInstr{Op: IrGt, Dst: exceeds, Args: []*IrReg{newLength, capacity}})
+	builder.branch(exceeds, grow, end)
+
+	builder.startBlock(grow)
+	builder.call("runtime.growslice", []*IrReg{ptr, capacity}, ptr, length, capacity, newLength, builder.constant(&IrI64, int64(elem.Size)))
+	builder.jump(end)
+
+	builder.startBlock(end)
+	dst := builder.elementAt(ptr, length, elem.Size)
+	if call.Ellipsis {
+		size := builder.newReg(&IrI64, "")
+		builder.emit(&IrInstr{Op: IrMul, Dst: size, Args: []*IrReg{count, builder.constant(&IrI64, int64(elem.Size))}})
+		builder.call("runtime.memmove", nil, dst, values[0][0], size)
+	} else {
+		for i, value := range values {
+			builder.store(dst, i*elem.Size, elem, value)
+		}
+	}
+	return []*IrReg{ptr, newLength, capacity}
+}
+
+// copyCall translates `call` of copy, which copies as many elements as the shorter of the slices has, and returns the number of them.
+// The source may be a string, whose bytes are copied.
+func (builder *irBuilder) copyCall(call *FunctionCall) []*IrReg {
+	dst := builder.value(call.Arguments[0])
+	src := builder.value(call.Arguments[1])
+	count := builder.newReg(&IrI64, "")
+	builder.copy([]*IrReg{count}, []*IrReg{dst[1]})
+	shorter := builder.newBlock()
+	end := builder.newBlock()
+	less := builder.newReg(&IrBool, "")
+	builder.emit(&IrInstr{Op: IrLt, Dst: less, Args: []*IrReg{src[1], count}})
+	builder.branch(less, shorter, end)
+
+	builder.startBlock(shorter)
+	builder.copy([]*IrReg{count}, []*IrReg{src[1]})
+	builder.jump(end)
+
+	builder.startBlock(end)
+	size := builder.newReg(&IrI64, "")
+	builder.emit(&IrInstr{Op: IrMul, Dst: size, Args: []*IrReg{count, builder.constant(&IrI64, int64(call.OperandType.Elem.Size))}})
+	builder.call("runtime.memmove", nil, dst[0], src[0], size)
+	return []*IrReg{count}
+}
+
+// rangeLoop translates for statement `loop` with a range clause, which iterates over the indices of the elements.
+// The range expression is evaluated once before the loop, except an array whose elements are not used and whose length is constant.
+// An array is copied if its elements are used, so that the iterations see the elements before the loop even if the body assigns to them.
+func (builder *irBuilder) rangeLoop(loop *For) {
+	ty := loop.RangeType
+	elem := indexedType(ty)
+	var base, length *IrReg
+	switch {
+	case ty.isSlice():
+		value := builder.temporary(builder.value(loop.Range))
+		base, length = value[0], value[1]
+	case loop.Value == nil && !callsFunction(loop.Range):
+	case ty.isPointer():
+		base = builder.temporary([]*IrReg{builder.expr(loop.Range)})[0]
+	default:
+		value := builder.value(loop.Range)
+		if loop.Value != nil {
+			base = builder.allocate(ty, false, "")
+			builder.store(base, 0, ty, value)
+		}
+	}
+	if length == nil {
+		length = builder.constant(&IrI64, int64(lengthOf(loop.Range, ty)))
+	}
+	index := builder.newReg(&IrI64, "")
+	builder.copy([]*IrReg{index}, []*IrReg{builder.constant(&IrI64, 0)})
+
+	head := builder.newBlock()
+	body := builder.newBlock()
+	post := builder.newBlock()
+	end := builder.newBlock()
+	builder.breakBlocks[loop] = end
+	builder.continueBlocks[loop] = post
+
+	builder.jump(head)
+	builder.startBlock(head)
+	cond := builder.newReg(&IrBool, "")
+	builder.emit(&IrInstr{Op: IrLt, Dst: cond, Args: []*IrReg{index, length}})
+	builder.branch(cond, body, end)
+
+	builder.startBlock(body)
+	// The iteration variables are assigned as in an assignment, or declared anew in each iteration.
+	operands := []Expr{loop.Key, loop.Value}
+	dsts := make([]*destination, 2)
+	for i, operand := range operands {
+		if _, ok := operand.(*Variable); !ok && operand != nil && !isBlank(operand) {
+			dsts[i] = builder.destination(operand)
+		}
+	}
+	values := [][]*IrReg{{index}, nil}
+	if loop.Value != nil && !isBlank(loop.Value) {
+		values[1] = builder.load(builder.elementAt(base, index, elem.Size), 0, elem)
+	}
+	for i, operand := range operands {
+		if variable, ok := operand.(*Variable); ok {
+			builder.declare(variable, values[i])
+		} else {
+			builder.assign(dsts[i], values[i])
+		}
+	}
+	builder.stmt(loop.Body)
+	builder.jump(post)
+
+	builder.startBlock(post)
+	next := builder.newReg(&IrI64, "")
+	builder.emit(&IrInstr{Op: IrAdd, Dst: next, Args: []*IrReg{index, builder.constant(&IrI64, 1)}})
+	builder.copy([]*IrReg{index}, []*IrReg{next})
+	builder.jump(head)
+	builder.startBlock(end)
+}
+
+// logical translates && and || with short-circuit evaluation: the right operand is evaluated only if the left one does not determine the result.
+func (builder *irBuilder) logical(expr *BinaryOp) *IrReg {
+	dst := builder.newReg(&IrBool, "")
+	rhsBlock := builder.newBlock()
+	end := builder.newBlock()
+
+	lhs := builder.expr(expr.Lhs)
+	builder.emit(&IrInstr{Op: IrCopy, Dst: dst, Args: []*IrReg{lhs}})
+	if expr.Op == TOKEN_ANDAND {
+		builder.branch(dst, rhsBlock, end)
+	} else {
+		builder.branch(dst, end, rhsBlock)
+	}
+
+	builder.startBlock(rhsBlock)
+	rhs := builder.expr(expr.Rhs)
+	builder.emit(&IrInstr{Op: IrCopy, Dst: dst, Args: []*IrReg{rhs}})
+	builder.jump(end)
+
+	builder.startBlock(end)
+	return dst
+}
+
+// removeUnreachableBlocks removes blocks which cannot be reached from the entry and renumbers the rest.
+func (function *IrFunction) removeUnreachableBlocks() {
+	reachable := map[*IrBlock]bool{}
+	var visit func(block *IrBlock)
+	visit = func(block *IrBlock) {
+		if reachable[block] {
+			return
+		}
+		reachable[block] = true
+		for _, succ := range block.Succs {
+			visit(succ)
+		}
+	}
+	visit(function.Blocks[0])
+
+	var blocks []*IrBlock
+	for _, block := range function.Blocks {
+		if !reachable[block] {
+			continue
+		}
+		var preds []*IrBlock
+		for _, pred := range block.Preds {
+			if reachable[pred] {
+				preds = append(preds, pred)
+			}
+		}
+		block.Preds = preds
+		block.Id = len(blocks)
+		blocks = append(blocks, block)
+	}
+	function.Blocks = blocks
+}
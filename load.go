@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Qualifier of the symbols of the main package, as Go names it regardless of its import path.
+const mainQualifier = "main"
+
+// Package is a package compiled by the loader.
+type Package struct {
+	// Import path of the package.
+	Path string
+	Name string
+	// Directory of the source files.
+	Dir string
+	Ast *Ast
+}
+
+// loader compiles the main package and the packages which it imports directly or indirectly, each of them once.
+// An import path is resolved against the module the main package belongs to, which is declared by the nearest go.mod above it.
+type loader struct {
+	// Path of the module and the directory where its go.mod is, or empty if there is no go.mod.
+	modulePath string
+	moduleRoot string
+	// Compiled packages by their import paths. A package with errors is nil.
+	packages map[string]*Package
+	// Import paths of the packages being loaded, starting from the main package, each of which imports the next one.
+	loading []string
+	// Compiled packages in the order of their dependencies, so that a package comes after all the ones it imports.
+	order       []*Package
+	diagnostics Diagnostics
+}
+
+// Load compiles the main package consisting of the source files specified by `args`, each of which is a source file or a directory,
+// and the packages it imports. The packages are returned in the order of their dependencies, which ends with the main package.
+// The errors in all the packages are returned together.
+func Load(args []string) ([]*Package, error) {
+	fileNames, err := sourceFileNames(args)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(filepath.Dir(fileNames[0]))
+	if err != nil {
+		return nil, err
+	}
+	loader := &loader{packages: map[string]*Package{}}
+	if err := loader.findModule(dir); err != nil {
+		return nil, err
+	}
+	importPath := mainQualifier
+	if loader.moduleRoot != "" {
+		relative, err := filepath.Rel(loader.moduleRoot, dir)
+		if err != nil {
+			return nil, err
+		}
+		importPath = path.Join(loader.modulePath, filepath.ToSlash(relative))
+	}
+
+	loader.loading = []string{importPath}
+	main, err := loader.compile(importPath, dir, fileNames, mainQualifier)
+	if err != nil {
+		return nil, err
+	}
+	if main != nil && main.Name != "main" {
+		file := main.Ast.files[0]
+		loader.diagnostics.Add(errorAt(file.Package, "package %s is not a main package", main.Name))
+	} else if main != nil && !declaresMain(main.Ast) {
+		// gc reports it when linking without a position, so it is reported at the package clause of the first file.
+		file := main.Ast.files[0]
+		loader.diagnostics.Add(errorAt(file.Package, "function main is undeclared in the main package"))
+	}
+	if err := loader.diagnostics.Err(); err != nil {
+		return nil, err
+	}
+	return loader.order, nil
+}
+
+// declaresMain returns whether `ast` declares the function main, which the program starts with.
+func declaresMain(ast *Ast) bool {
+	for _, function := range ast.funcs {
+		if function.Name == "main" {
+			return true
+		}
+	}
+	return false
+}
+
+// findModule finds the go.mod in `dir` or the nearest directory above it, and reads the path of the module.
+func (loader *loader) findModule(dir string) error {
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			loader.moduleRoot = dir
+			loader.modulePath, err = modulePath(string(data))
+			if err != nil {
+				return fmt.Errorf("%s: %s", filepath.Join(dir, "go.mod"), err.Error())
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("Cannot read go.mod: %s", err.Error())
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// modulePath returns the path in the module directive of go.mod, whose content is `data`.
+func modulePath(data string) (string, error) {
+	for _, line := range strings.Split(data, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(fields[1]); err == nil {
+			return unquoted, nil
+		}
+		return fields[1], nil
+	}
+	return "", fmt.Errorf("no module declaration in go.mod")
+}
+
+// importPackage is the `Importer` of all the packages, which compiles the package imported by `spec` unless it has been compiled.
+func (loader *loader) importPackage(spec *ImportSpec) (*Package, error) {
+	for i, importPath := range loader.loading {
+		if importPath == spec.Path {
+			return nil, importCycle(spec, loader.loading[i:])
+		}
+	}
+	if imported, ok := loader.packages[spec.Path]; ok {
+		return imported, nil
+	}
+
+	dir, err := loader.packageDir(spec)
+	if err != nil {
+		return nil, err
+	}
+	fileNames, err := sourceFileNames([]string{dir})
+	if err != nil {
+		return nil, errorAt(spec.token(), "%s", err.Error())
+	}
+	loader.loading = append(loader.loading, spec.Path)
+	imported, err := loader.compile(spec.Path, dir, fileNames, symbolQualifier(spec.Path))
+	loader.loading = loader.loading[:len(loader.loading)-1]
+	if err != nil {
+		return nil, errorAt(spec.token(), "%s", err.Error())
+	}
+	if imported == nil {
+		// The errors in the package have been reported.
+		return nil, nil
+	}
+	if imported.Name == "main" {
+		return nil, errorAt(spec.token(), "import %s is a program, not an importable package", strconv.Quote(spec.Path))
+	}
+	return imported, nil
+}
+
+// packageDir returns the directory of the package imported by `spec`, which must be in the module.
+func (loader *loader) packageDir(spec *ImportSpec) (string, error) {
+	if loader.moduleRoot == "" {
+		return "", errorAt(spec.token(), "could not import %s (no go.mod found)", strconv.Quote(spec.Path))
+	}
+	if spec.Path != loader.modulePath && !strings.HasPrefix(spec.Path, loader.modulePath+"/") {
+		return "", errorAt(spec.token(), "package %s is not in module %s", spec.Path, loader.modulePath)
+	}
+	relative := strings.TrimPrefix(spec.Path, loader.modulePath)
+	dir := filepath.Join(loader.moduleRoot, filepath.FromSlash(relative))
+	// The files are named relative to the working directory in the errors, as the ones of the main package usually are.
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, dir); err == nil {
+			dir = rel
+		}
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", errorAt(spec.token(), "package %s is not in module %s (%s)", spec.Path, loader.modulePath, dir)
+	}
+	return dir, nil
+}
+
+// importCycle returns the error of `spec`, which closes the cycle of the imports through the packages of `cycle` back to the first one.
+func importCycle(spec *ImportSpec, cycle []string) error {
+	message := "import cycle not allowed"
+	for i, importPath := range cycle {
+		next := spec.Path
+		if i+1 < len(cycle) {
+			next = cycle[i+1]
+		}
+		message += fmt.Sprintf("\n\t%s imports %s", importPath, next)
+	}
+	return errorAt(spec.token(), "%s", message)
+}
+
+// compile compiles the package at `importPath` consisting of the files, whose symbols are qualified with `qualifier`.
+// The errors in the package are recorded, and nil is returned for it. An error is returned only if the files cannot be read.
+func (loader *loader) compile(importPath string, dir string, fileNames []string, qualifier string) (*Package, error) {
+	var tokenStreams []*TokenStream
+	var diagnostics Diagnostics
+	for _, fileName := range fileNames {
+		source, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read the source file: %s", err.Error())
+		}
+		file := &SourceFile{Name: fileName, Source: string(source)}
+		tokenStream, err := Tokenize(NewFileByteStream(file))
+		if err != nil {
+			diagnostics.Merge(err.(*Diagnostics))
+		}
+		tokenStreams = append(tokenStreams, tokenStream)
+	}
+	if diagnostics.HasErrors() {
+		loader.diagnostics.Merge(&diagnostics)
+		loader.packages[importPath] = nil
+		return nil, nil
+	}
+
+	ast, err := ParsePackage(tokenStreams, qualifier, loader.importPackage)
+	if err == nil {
+		err = ast.InferType()
+	}
+	if err != nil {
+		loader.diagnostics.Merge(err.(*Diagnostics))
+		loader.packages[importPath] = nil
+		return nil, nil
+	}
+	compiled := &Package{Path: importPath, Name: ast.packageName, Dir: dir, Ast: ast}
+	loader.packages[importPath] = compiled
+	loader.order = append(loader.order, compiled)
+	return compiled, nil
+}
+
+// symbolQualifier returns the qualifier of the symbols of the package at `importPath`, in which every byte other than letters and digits
+// is escaped as `_` followed by its two hex digits, so that distinct paths never share a qualifier and the qualifier has no `.` that
+// could be confused with the separator of the names qualified with it.
+func symbolQualifier(importPath string) string {
+	var qualifier strings.Builder
+	for i := 0; i < len(importPath); i++ {
+		c := importPath[i]
+		if '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' {
+			qualifier.WriteByte(c)
+		} else {
+			fmt.Fprintf(&qualifier, "_%02x", c)
+		}
+	}
+	return qualifier.String()
+}
+
+// sourceFileNames returns the names of the source files of the package specified by `args`, each of which is a source file or a directory.
+// The files in a directory are the ones named *.go except tests, in the order of their names.
+func sourceFileNames(args []string) ([]string, error) {
+	var fileNames []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot open the source file: %s", err.Error())
+		}
+		if !info.IsDir() {
+			fileNames = append(fileNames, arg)
+			continue
+		}
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read the directory: %s", err.Error())
+		}
+		found := false
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			fileNames = append(fileNames, filepath.Join(arg, name))
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("no Go files in %s", arg)
+		}
+	}
+	return fileNames, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeModule writes `files` by their paths in a temporary directory with the go.mod of module example.com/m, and makes it the working directory.
+func writeModule(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	files["go.mod"] = "module example.com/m\n\ngo 1.19\n"
+	for name, source := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(source), 0o644))
+	}
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestLoadDependencyOrder(t *testing.T) {
+	writeModule(t, map[string]string{
+		"main.go":     "package main\nimport (\n\"example.com/m/a\"\n\"example.com/m/b\"\n)\nfunc main() int {\nreturn a.F() + b.G\n}\n",
+		"a/a.go":      "package a\nimport \"example.com/m/b\"\nfunc F() int {\nreturn b.G + helper()\n}\n",
+		"a/a2.go":     "package a\nfunc helper() int {\nreturn 1\n}\n",
+		"b/b.go":      "package b\nvar G = 2\n",
+		"b/b_test.go": "package b\nthis is not compiled\n",
+	})
+	packages, err := Load([]string{"."})
+	assert.NoError(t, err)
+	var paths []string
+	for _, pkg := range packages {
+		paths = append(paths, pkg.Path)
+	}
+	assert.Equal(t, []string{"example.com/m/b", "example.com/m/a", "example.com/m"}, paths)
+	assert.Equal(t, []string{"b", "a", "main"}, []string{packages[0].Name, packages[1].Name, packages[2].Name})
+
+	// The package b imported by both main and a is compiled once.
+	for _, pkg := range packages[1:] {
+		for _, file := range pkg.Ast.files {
+			for _, spec := range file.Imports {
+				if spec.Path == "example.com/m/b" {
+					assert.Same(t, packages[0], spec.Package)
+				}
+			}
+		}
+	}
+
+	program := BuildIr(packages[1].Ast, nil)
+	assert.Equal(t, []string{"example_2ecom_2fm_2fa.F", "example_2ecom_2fm_2fa.helper"}, []string{program.Functions[0].Name, program.Functions[1].Name})
+}
+
+func TestLoadSimilarPaths(t *testing.T) {
+	writeModule(t, map[string]string{
+		"main.go":  "package main\nimport (\n\"example.com/m/a/b\"\nb2 \"example.com/m/a_b\"\nb3 \"example.com/m/a-b\"\n)\nfunc main() int {\nreturn b.F() + b2.F() + b3.F()\n}\n",
+		"a/b/b.go": "package b\nfunc F() int {\nreturn 1\n}\n",
+		"a_b/b.go": "package b\nfunc F() int {\nreturn 2\n}\n",
+		"a-b/b.go": "package b\nfunc F() int {\nreturn 3\n}\n",
+	})
+	packages, err := Load([]string{"."})
+	assert.NoError(t, err)
+	var names []string
+	for _, pkg := range packages[:3] {
+		names = append(names, BuildIr(pkg.Ast, nil).Functions[0].Name)
+	}
+	assert.ElementsMatch(t, []string{"example_2ecom_2fm_2fa_2fb.F", "example_2ecom_2fm_2fa_5fb.F", "example_2ecom_2fm_2fa_2db.F"}, names)
+}
+
+func TestLoadImportCycle(t *testing.T) {
+	writeModule(t, map[string]string{
+		"main.go": "package main\nimport \"example.com/m/a\"\nfunc main() {\na.F()\n}\n",
+		"a/a.go":  "package a\nimport \"example.com/m/b\"\nfunc F() {\nb.G()\n}\n",
+		"b/b.go":  "package b\nimport \"example.com/m/a\"\nfunc G() {\na.F()\n}\n",
+	})
+	_, err := Load([]string{"."})
+	assert.EqualError(t, err, `b/b.go:2:8: import cycle not allowed
+	example.com/m/a imports example.com/m/b
+	example.com/m/b imports example.com/m/a`)
+}
+
+func TestInvalidImports(t *testing.T) {
+	writeModule(t, map[string]string{
+		"main.go":      "package main\nimport (\n\"example.com/m/util\"\n\"example.com/m/missing\"\n\"example.com/m/cmd\"\n\"fmt\"\n)\nvar h util.hidden\nfunc main() {\n}\n",
+		"util/util.go": "package util\ntype hidden int\n",
+		"cmd/main.go":  "package main\nfunc main() {\n}\n",
+	})
+	_, err := Load([]string{"."})
+	assert.EqualError(t, err, `main.go:4:1: package example.com/m/missing is not in module example.com/m (missing)
+main.go:5:1: import "example.com/m/cmd" is a program, not an importable package
+main.go:6:1: package fmt is not in module example.com/m
+main.go:8:12: name hidden not exported by package util`)
+}
+
+func TestMissingMainFunction(t *testing.T) {
+	writeModule(t, map[string]string{
+		"main.go": "package main\n\nfunc f() int {\n\treturn 0\n}\n",
+	})
+	_, err := Load([]string{"."})
+	assert.EqualError(t, err, "main.go:1:9: function main is undeclared in the main package")
+}
+
+func TestInvalidQualifiedIdentifiers(t *testing.T) {
+	writeModule(t, map[string]string{
+		"main.go": `package main
+import "example.com/m/util"
+func main() {
+var c util.Celsius = util.Boiling
+println(util.Max(1, 2), util.helper(), util.Min(1, 2), util.Celsius, c)
+util.Max("a", 2)
+}
+`,
+		"util/util.go": "package util\ntype Celsius int\nconst Boiling Celsius = 100\nfunc Max(a, b int) int {\nreturn a\n}\nfunc helper() int {\nreturn 1\n}\n",
+	})
+	_, err := Load([]string{"."})
+	assert.EqualError(t, err, `main.go:5:30: name helper not exported by package util
+main.go:5:45: undefined: util.Min
+main.go:5:61: util.Celsius (type) is not an expression
+main.go:6:10: cannot use "a" (untyped string constant) as int value in argument to util.Max`)
+}
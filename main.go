@@ -1,49 +1,141 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 )
 
 func main() {
-	args := os.Args[1:]
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Expected source file name")
+	archName := flag.String("target", runtime.GOARCH, "architecture of the generated assembly: amd64 or arm64")
+	osName := flag.String("os", runtime.GOOS, "operating system the generated assembly runs on: linux or darwin")
+	dumpIr := flag.Bool("dump-ir", false, "print the intermediate representation instead of assembly")
+	outputName := flag.String("o", "", "write the executable linked with $CC to the file instead of printing the assembly")
+	printEscapes := flag.Bool("m", false, "print the decisions of the escape analysis")
+	flag.Parse()
+
+	targetOS, err := NewOS(*osName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 		os.Exit(1)
 	}
-
-	fileName := args[0]
-	file, err := os.Open(fileName)
+	target, err := NewTarget(*archName, targetOS)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Cannot open the source file: %s\n", err.Error())
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 		os.Exit(1)
 	}
 
-	fileData := make([]byte, 1024*1024)
-	count, err := file.Read(fileData)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Cannot read the source file: %s\n", err.Error())
+	args := flag.Args()
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Expected source files or a directory of a package")
 		os.Exit(1)
 	}
 
-	source := string(fileData[:count])
-	stream := NewByteStream(source)
-	tokenStream, err := Tokenize(stream)
+	packages, err := Load(args)
 	if err != nil {
+		reportError(err)
+	}
+
+	// The main package initializes all the packages it depends on in the order of their dependencies, and then itself.
+	programs := make([]*IrProgram, len(packages))
+	var inits []string
+	for i, pkg := range packages {
+		// The packages are in the order of their dependencies, so the functions called from another package have been analyzed.
+		notes := pkg.Ast.AnalyzeEscapes()
+		if *printEscapes {
+			for _, note := range notes.Sorted() {
+				fmt.Fprintln(os.Stderr, note.Error())
+			}
+		}
+		if i < len(packages)-1 {
+			programs[i] = BuildIr(pkg.Ast, nil)
+			if programs[i].Init != "" {
+				inits = append(inits, programs[i].Init)
+			}
+		} else {
+			programs[i] = BuildIr(pkg.Ast, inits)
+		}
+	}
+	if *dumpIr {
+		for _, program := range programs {
+			fmt.Print(program.Dump())
+		}
+		return
+	}
+	if *outputName == "" {
+		for _, program := range programs {
+			Generate(program, target, os.Stdout)
+		}
+		GenerateRuntime(target, os.Stdout)
+		return
+	}
+	if err := link(programs, target, *outputName); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 		os.Exit(1)
 	}
+}
 
-	ast, err := Parse(tokenStream)
+// link assembles each of the packages and the runtime into an object file, and links them into the executable `outputName`
+// with the C compiler named by $CC, or cc by default.
+func link(programs []*IrProgram, target Target, outputName string) error {
+	dir, err := os.MkdirTemp("", "indigo")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
+	defer os.RemoveAll(dir)
 
-	if err := ast.InferType(); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+	var objects []string
+	// assemble outputs a unit of the assembly with `generate` and assembles it into an object file.
+	assemble := func(name string, generate func(w io.Writer)) error {
+		var assembly bytes.Buffer
+		generate(&assembly)
+		source := filepath.Join(dir, fmt.Sprintf("%d.%s.s", len(objects), name))
+		object := strings.TrimSuffix(source, ".s") + ".o"
+		if err := os.WriteFile(source, assembly.Bytes(), 0o644); err != nil {
+			return err
+		}
+		objects = append(objects, object)
+		return runCompiler("-c", "-o", object, source)
 	}
+	for _, program := range programs {
+		program := program
+		if err := assemble(program.Qualifier, func(w io.Writer) { Generate(program, target, w) }); err != nil {
+			return err
+		}
+	}
+	if err := assemble("runtime", func(w io.Writer) { GenerateRuntime(target, w) }); err != nil {
+		return err
+	}
+	return runCompiler(append([]string{"-o", outputName}, objects...)...)
+}
 
-	Generate(ast)
+// runCompiler runs the C compiler with `args`, which assembles or links the files.
+func runCompiler(args ...string) error {
+	cc := os.Getenv("CC")
+	if cc == "" {
+		cc = "cc"
+	}
+	command := exec.Command(cc, args...)
+	command.Stdout = os.Stderr
+	command.Stderr = os.Stderr
+	if err := command.Run(); err != nil {
+		return fmt.Errorf("%s failed: %s", cc, err.Error())
+	}
+	return nil
+}
+
+// reportError prints `err` with the source lines if it consists of diagnostics, and exits.
+func reportError(err error) {
+	if diagnostics, ok := err.(*Diagnostics); ok {
+		fmt.Fprint(os.Stderr, diagnostics.Render())
+	} else {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+	}
+	os.Exit(1)
 }
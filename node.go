@@ -1,41 +1,228 @@
 package main
 
+import (
+	"math/big"
+	"path"
+	"strings"
+)
+
 type Expr interface {
 	// Returns the corresponding token to this node.
 	token() *Token
-	// Output assembly corresponding to this node.
-	emit()
 }
 
 type FunctionDecl struct {
 	tok        *Token
 	Name       string
 	Parameters []*Variable
+	// Result parameters. Unnamed ones have the empty name, and they are not declared in the scope.
+	Results []*Variable
+	// Nil if the function has no results, the type of the only result, or a tuple of the results.
 	ReturnType *Type
 	Body       *Block
 	Scope      *Scope
+	// How the value of each parameter leaks out of a call, which the escape analysis of the callers relies on. Set by the escape analysis.
+	Leaks []*Leaks
 }
 
 type Block struct {
-	tok  *Token
-	Body []Expr
+	tok   *Token
+	Body  []Expr
+	Scope *Scope
+	// The closing }, where a missing return of a function body is reported.
+	rbrace *Token
 }
 
+// Return represents a return statement. A bare return without `Values` returns the current values of the named results.
 type Return struct {
+	tok    *Token
+	Values []Expr
+}
+
+// If represents an if statement.
+// `Else` is nil, a `*Block` or an `*If` for `else if`.
+type If struct {
 	tok  *Token
-	Node Expr
+	Cond Expr
+	Then *Block
+	Else Expr
+}
+
+// For represents all forms of a for statement.
+// `Cond` is nil for an infinite loop, and `Init` and `Post` are nil unless the loop has a for clause.
+// A loop with a range clause has `Range` instead, whose indices and elements are assigned to `Key` and `Value` in each iteration.
+// They are `*Variable`s declared by the clause if `Define` is true, and operands to assign to otherwise. Either or both may be nil.
+type For struct {
+	tok    *Token
+	Label  string
+	Init   Expr
+	Cond   Expr
+	Post   Expr
+	Key    Expr
+	Value  Expr
+	Range  Expr
+	Define bool
+	// Type of `Range` set by the type checker, which is an array, a pointer to an array or a slice.
+	RangeType *Type
+	Body      *Block
+	// Scope of the variables declared in `Init`.
+	Scope *Scope
+	// Whether any break statement targets this loop. Used for terminating statement analysis.
+	hasBreak bool
+	// Whether any break or continue statement refers to `Label`.
+	labelUsed bool
+}
+
+// Break represents a break statement, with an optional label.
+type Break struct {
+	tok   *Token
+	Label string
+	loop  *For
+}
+
+// Continue represents a continue statement, with an optional label.
+type Continue struct {
+	tok   *Token
+	Label string
+	loop  *For
 }
 
+// Assign represents a short variable declaration `Lhs := Rhs`.
+// Each of `Lhs` is a `*Variable` declared by it, or an `*Identifier` of a variable redeclared in the same scope or the blank identifier, which is just assigned.
 type Assign struct {
 	tok *Token
-	Lhs Expr
-	Rhs Expr
+	Lhs []Expr
+	Rhs []Expr
+}
+
+// AssignStmt represents an assignment of `Rhs` to `Lhs` respectively.
+// For a compound assignment such as `x += y`, `Op` is the kind of the binary operator, and `Rhs` is the operation `x + y`.
+// `Op` is 0 for a simple assignment.
+type AssignStmt struct {
+	tok *Token
+	Op  TokenKind
+	Lhs []Expr
+	Rhs []Expr
+}
+
+// IncDec represents `Operand++` or `Operand--`. `Op` is TOKEN_PLUSPLUS or TOKEN_MINUSMINUS.
+type IncDec struct {
+	tok     *Token
+	Op      TokenKind
+	Operand Expr
+}
+
+// ConstDecl represents a const declaration, which has one spec or a parenthesized group of them.
+type ConstDecl struct {
+	tok   *Token
+	Specs []*ConstSpec
+}
+
+// ConstSpec declares `Names` initialized with `Values` respectively.
+// A spec which omits the type and the values in a group has those of the last one which has them, parsed again from the same tokens.
+type ConstSpec struct {
+	tok    *Token
+	Names  []*Constant
+	Type   *Type
+	Values []Expr
+	// Index of the spec in its group, which is the value of `iota` in it.
+	Iota int
+	// Scope where the spec is declared, in which the values are evaluated.
+	Scope *Scope
+}
+
+// Constant is a named constant declared by a `ConstSpec`.
+type Constant struct {
+	tok  *Token
+	Name string
+	// TypeUnresolved until the type checker evaluates the value.
+	Ty    *Type
+	Value *ConstantValue
+	Spec  *ConstSpec
+	// Whether the value is being evaluated, which detects a constant depending on itself.
+	checking bool
+}
+
+// File is a source file of a package, which begins with the package clause naming the package, followed by the imports used in the file.
+type File struct {
+	tok     *Token
+	Package *Token
+	Imports []*ImportSpec
+}
+
+// ImportSpec imports the package at `Path`. `Name` is the name given to the package in the file, or nil if it is omitted.
+type ImportSpec struct {
+	tok  *Token
+	Name *Token
+	Path string
+	// Set by the importer. Nil if the package cannot be imported, which has been reported.
+	Package *Package
+}
+
+// name returns the name which refers to the imported package in the file.
+func (spec *ImportSpec) name() string {
+	switch {
+	case spec.Name != nil:
+		return spec.Name.Value
+	case spec.Package != nil:
+		return spec.Package.Name
+	}
+	return path.Base(spec.Path)
+}
+
+// TypeDecl represents a type declaration, which has one spec or a parenthesized group of them.
+type TypeDecl struct {
+	tok   *Token
+	Specs []*TypeSpec
 }
 
-type AddOp struct {
+// TypeSpec defines the type `Ty` named `Name`. The type in the declaration is `Ty.Underlying`.
+type TypeSpec struct {
+	tok  *Token
+	Name string
+	Ty   *Type
+}
+
+// VarDecl represents a var declaration, which has one spec or a parenthesized group of them.
+type VarDecl struct {
+	tok   *Token
+	Specs []*VarSpec
+}
+
+// VarSpec declares `Names` of `Type` initialized with `Values` respectively, or with the zero values if there are no values.
+// Either `Type` or `Values` may be omitted.
+type VarSpec struct {
+	tok    *Token
+	Names  []*Variable
+	Type   *Type
+	Values []Expr
+	// Scope where the spec is declared, in which the values are evaluated.
+	Scope *Scope
+	// Whether the values are being checked, which detects a package-level variable depending on itself.
+	checking bool
+}
+
+// BinaryOp represents a binary operation. `Op` is the kind of the operator token.
+type BinaryOp struct {
 	tok *Token
+	Op  TokenKind
 	Lhs Expr
 	Rhs Expr
+	// Set by the type checker if the operation is a constant expression.
+	Constant *ConstantValue
+	// Type of the operands set by the type checker, which determines how they are compared.
+	OperandType *Type
+}
+
+// UnaryOp represents a unary operation. `Op` is the kind of the operator token.
+// `&x` takes the address of `x`, and `*p` is the variable which `p` points to.
+type UnaryOp struct {
+	tok      *Token
+	Op       TokenKind
+	Operand  Expr
+	Constant *ConstantValue
+	// Type of the operand set by the type checker, which is a pointer for `*`.
+	OperandType *Type
 }
 
 // Variable is considered a tag for a memory region with type information.
@@ -46,41 +233,438 @@ type Variable struct {
 	// Offset from stack pointer after function's prelude.
 	Offset int
 	Ty     *Type
+	// Spec declaring the variable. Nil for parameters and variables declared by `:=`.
+	Spec *VarSpec
+	// Whether the variable is declared at the package level, which lives in memory rather than in registers.
+	Global bool
+	// Whether the address of the variable or its field is taken, so that a local variable lives in memory as well. Set by the type checker,
+	// and by the escape analysis for a variable too large for the stack.
+	Addressed bool
+	// Whether the address of the local variable outlives the call of the function, so that it is allocated on the heap
+	// rather than on the stack. Set by the escape analysis.
+	Escapes bool
 }
 
+// Identifier refers to either a variable or a constant, whose value is set to `Constant`.
 type Identifier struct {
 	tok      *Token
 	Name     string
 	Variable *Variable
+	Constant *ConstantValue
+	// Set if the identifier is qualified with an imported package, as in `util.Max`. `tok` is the name after the dot.
+	Import *ImportSpec
+}
+
+// Iota is the predeclared identifier `iota` in a const declaration, which is the index of the spec.
+type Iota struct {
+	tok      *Token
+	Value    int
+	Constant *ConstantValue
 }
 
 type IntLiteral struct {
-	tok   *Token
-	Value string
+	tok      *Token
+	Value    string
+	Constant *ConstantValue
 }
 
 type BoolLiteral struct {
-	tok   *Token
-	Value bool
+	tok      *Token
+	Value    bool
+	Constant *ConstantValue
+}
+
+// NilLiteral is the predeclared identifier `nil`, which is the zero value of pointers and slices.
+type NilLiteral struct {
+	tok *Token
+	// Type which nil is converted to, set by the type checker. Nil if it is compared as untyped.
+	Ty *Type
+}
+
+type StringLiteral struct {
+	tok *Token
+	// Value with the escape sequences decoded.
+	Value    string
+	Constant *ConstantValue
+}
+
+// Builtin is a function predeclared in the universe, such as `len`.
+type Builtin struct {
+	Name string
 }
 
 type FunctionCall struct {
-	tok       *Token
-	Function  *FunctionDecl
-	Arguments []Expr
-}
-
-func (node *FunctionDecl) token() *Token { return node.tok }
-func (node *Block) token() *Token        { return node.tok }
-func (node *Return) token() *Token       { return node.tok }
-func (node *Assign) token() *Token       { return node.tok }
-func (node *AddOp) token() *Token        { return node.tok }
-func (node *Variable) token() *Token     { return node.tok }
-func (node *Identifier) token() *Token   { return node.tok }
-func (node *IntLiteral) token() *Token   { return node.tok }
-func (node *BoolLiteral) token() *Token  { return node.tok }
-func (node *FunctionCall) token() *Token { return node.tok }
+	tok      *Token
+	Function *FunctionDecl
+	// Set instead of `Function` if the callee is a builtin function.
+	Builtin *Builtin
+	// Set instead of `Function` if the call is a conversion to the type.
+	Conversion *Type
+	Arguments  []Expr
+	// Set if the callee is qualified with an imported package, as in `util.Max(x, y)`. `tok` is the name after the dot.
+	Import *ImportSpec
+	// Set by the type checker if the call is a constant expression, such as a conversion of a constant.
+	Constant *ConstantValue
+	// Type given to the builtins new and make, which take a type as the first argument.
+	TypeArgument *Type
+	// Type of the first argument of the builtins len, cap, append and copy set by the type checker, which determines how they are translated.
+	OperandType *Type
+	// Whether the last argument is followed by `...`, which passes the elements of a slice to append.
+	Ellipsis bool
+	// Whether the variable allocated by new, or the underlying array allocated by make, outlives the call of the function,
+	// so that it is allocated on the heap. Set by the escape analysis.
+	Escapes bool
+	lparen  *Token
+	// Beginning of `TypeArgument`.
+	typeTok *Token
+}
+
+// Selector selects the field named `Sel` of the struct `X`, as in `p.x`. `tok` is the beginning of `X`.
+type Selector struct {
+	tok *Token
+	X   Expr
+	Sel *Token
+	// Set by the type checker to the selected field of `Struct`, which is the type of `X` or the type `X` points to.
+	Field  *Field
+	Struct *Type
+	// Whether `X` is a pointer to the struct, which is dereferenced implicitly as in `(*p).x`.
+	Indirect bool
+}
+
+// CompositeLit constructs a value of `Type` from `Elements`. The elements of a struct are either all keyed with the names of the fields
+// or all in the order of the fields. The elements of an array or a slice follow each other, unless keyed with constant indices.
+// The fields and the elements without values are zero. `tok` is the beginning of the type.
+// The type of a literal in the elements of another may be elided, in which case the type checker sets the element type to `Type`.
+// So does it the array with the length determined by the elements for `[...]T`.
+type CompositeLit struct {
+	tok      *Token
+	Type     *Type
+	Elements []*Element
+	lbrace   *Token
+	rbrace   *Token
+	elided   bool
+	// Whether the length of the array is `...` in the source.
+	ellipsis bool
+	// Length of a slice literal set by the type checker, which is the largest index plus one.
+	Len int
+	// Whether the literal whose address is taken as in `&T{}`, or the underlying array of a slice literal, outlives the call of the function,
+	// so that it is allocated on the heap. Set by the escape analysis.
+	Escapes bool
+}
+
+// Element is the value of a field or an element in a composite literal, with the name of the field or the index if it is keyed.
+type Element struct {
+	Key   Expr
+	Value Expr
+	// Set by the type checker to the field which the value is for, or the index of the element in an array or a slice.
+	Field *Field
+	Index int
+}
+
+// Index is the element of `X` at `Index`, as in `a[i]`. `tok` is the beginning of `X`.
+type Index struct {
+	tok   *Token
+	X     Expr
+	Index Expr
+	// Type of `X` set by the type checker, which is a string, an array, a pointer to an array or a slice.
+	OperandType *Type
+	lbrack      *Token
+}
+
+// SliceExpr is the slice of `X` from `Low` to `High`, whose capacity is up to `Max`, as in `a[low:high:max]`.
+// The omitted indices are nil. `tok` is the beginning of `X`.
+type SliceExpr struct {
+	tok  *Token
+	X    Expr
+	Low  Expr
+	High Expr
+	Max  Expr
+	// Type of `X` set by the type checker, which is a string, an array, a pointer to an array or a slice.
+	OperandType *Type
+	lbrack      *Token
+}
+
+func (node *FunctionDecl) token() *Token  { return node.tok }
+func (node *Block) token() *Token         { return node.tok }
+func (node *Return) token() *Token        { return node.tok }
+func (node *If) token() *Token            { return node.tok }
+func (node *For) token() *Token           { return node.tok }
+func (node *Break) token() *Token         { return node.tok }
+func (node *Continue) token() *Token      { return node.tok }
+func (node *Assign) token() *Token        { return node.tok }
+func (node *AssignStmt) token() *Token    { return node.tok }
+func (node *IncDec) token() *Token        { return node.tok }
+func (node *ConstDecl) token() *Token     { return node.tok }
+func (node *TypeDecl) token() *Token      { return node.tok }
+func (node *File) token() *Token          { return node.tok }
+func (node *ImportSpec) token() *Token    { return node.tok }
+func (node *VarDecl) token() *Token       { return node.tok }
+func (node *Constant) token() *Token      { return node.tok }
+func (node *BinaryOp) token() *Token      { return node.tok }
+func (node *UnaryOp) token() *Token       { return node.tok }
+func (node *Variable) token() *Token      { return node.tok }
+func (node *Identifier) token() *Token    { return node.tok }
+func (node *Iota) token() *Token          { return node.tok }
+func (node *IntLiteral) token() *Token    { return node.tok }
+func (node *BoolLiteral) token() *Token   { return node.tok }
+func (node *StringLiteral) token() *Token { return node.tok }
+func (node *NilLiteral) token() *Token    { return node.tok }
+func (node *Builtin) token() *Token       { return nil }
+func (node *FunctionCall) token() *Token  { return node.tok }
+func (node *Selector) token() *Token      { return node.tok }
+func (node *CompositeLit) token() *Token  { return node.tok }
+func (node *Index) token() *Token         { return node.tok }
+func (node *SliceExpr) token() *Token     { return node.tok }
+
+// value returns the value of the literal, which the tokenizer has checked to be well-formed.
+func (node *IntLiteral) value() *big.Int {
+	value, _ := new(big.Int).SetString(node.Value, 0)
+	return value
+}
 
 func (node *FunctionCall) Name() string {
 	return node.token().Value
 }
+
+// value returns the initial value of `variable` declared by the spec, or nil if it is initialized to the zero value.
+// If all the names are initialized by a single call of a function with multiple results, the value is the call.
+func (spec *VarSpec) value(variable *Variable) Expr {
+	if spec.multiValued() {
+		return spec.Values[0]
+	}
+	for i, name := range spec.Names {
+		if name == variable && i < len(spec.Values) {
+			return spec.Values[i]
+		}
+	}
+	return nil
+}
+
+// multiValued reports whether the names are initialized by the results of a single call.
+func (spec *VarSpec) multiValued() bool {
+	return len(spec.Values) == 1 && len(spec.Names) > 1
+}
+
+// declared returns the variables declared by the for clause or the range clause of the loop, each iteration of which has its own ones.
+func (node *For) declared() []*Variable {
+	var operands []Expr
+	if assign, ok := node.Init.(*Assign); ok {
+		operands = assign.Lhs
+	} else if node.Define {
+		operands = []Expr{node.Key, node.Value}
+	}
+	var variables []*Variable
+	for _, operand := range operands {
+		if variable, ok := operand.(*Variable); ok {
+			variables = append(variables, variable)
+		}
+	}
+	return variables
+}
+
+// walk calls `visit` for `expr` and the nodes in it in depth-first order.
+// Constant declarations are not visited, since their values are evaluated at compile time.
+func walk(expr Expr, visit func(Expr)) {
+	if expr == nil {
+		return
+	}
+	visit(expr)
+	switch expr := expr.(type) {
+	case *FunctionDecl:
+		walk(expr.Body, visit)
+	case *Block:
+		for _, stmt := range expr.Body {
+			walk(stmt, visit)
+		}
+	case *Return:
+		for _, value := range expr.Values {
+			walk(value, visit)
+		}
+	case *If:
+		walk(expr.Cond, visit)
+		walk(expr.Then, visit)
+		walk(expr.Else, visit)
+	case *For:
+		walk(expr.Init, visit)
+		walk(expr.Cond, visit)
+		walk(expr.Post, visit)
+		walk(expr.Key, visit)
+		walk(expr.Value, visit)
+		walk(expr.Range, visit)
+		walk(expr.Body, visit)
+	case *Assign:
+		for _, lhs := range expr.Lhs {
+			walk(lhs, visit)
+		}
+		for _, rhs := range expr.Rhs {
+			walk(rhs, visit)
+		}
+	case *AssignStmt:
+		for _, lhs := range expr.Lhs {
+			walk(lhs, visit)
+		}
+		for _, rhs := range expr.Rhs {
+			walk(rhs, visit)
+		}
+	case *IncDec:
+		walk(expr.Operand, visit)
+	case *VarDecl:
+		for _, spec := range expr.Specs {
+			for _, value := range spec.Values {
+				walk(value, visit)
+			}
+		}
+	case *BinaryOp:
+		walk(expr.Lhs, visit)
+		walk(expr.Rhs, visit)
+	case *UnaryOp:
+		walk(expr.Operand, visit)
+	case *FunctionCall:
+		for _, argument := range expr.Arguments {
+			walk(argument, visit)
+		}
+	case *Selector:
+		walk(expr.X, visit)
+	case *CompositeLit:
+		for _, element := range expr.Elements {
+			walk(element.Value, visit)
+		}
+	case *Index:
+		walk(expr.X, visit)
+		walk(expr.Index, visit)
+	case *SliceExpr:
+		walk(expr.X, visit)
+		walk(expr.Low, visit)
+		walk(expr.High, visit)
+		walk(expr.Max, visit)
+	}
+}
+
+// constantOf returns the value of `expr` if the type checker has found it a constant expression, otherwise nil.
+func constantOf(expr Expr) *ConstantValue {
+	switch expr := expr.(type) {
+	case *BinaryOp:
+		return expr.Constant
+	case *UnaryOp:
+		return expr.Constant
+	case *Identifier:
+		return expr.Constant
+	case *Iota:
+		return expr.Constant
+	case *IntLiteral:
+		return expr.Constant
+	case *BoolLiteral:
+		return expr.Constant
+	case *StringLiteral:
+		return expr.Constant
+	case *FunctionCall:
+		return expr.Constant
+	}
+	return nil
+}
+
+// setConstant records that `expr` is a constant expression of `value`.
+func setConstant(expr Expr, value *ConstantValue) {
+	switch expr := expr.(type) {
+	case *BinaryOp:
+		expr.Constant = value
+	case *UnaryOp:
+		expr.Constant = value
+	case *Identifier:
+		expr.Constant = value
+	case *Iota:
+		expr.Constant = value
+	case *IntLiteral:
+		expr.Constant = value
+	case *BoolLiteral:
+		expr.Constant = value
+	case *StringLiteral:
+		expr.Constant = value
+	case *FunctionCall:
+		expr.Constant = value
+	}
+}
+
+// exprString formats `expr` as it is written in the source for error messages.
+// Parentheses are added only where the precedence of the operators requires them.
+func exprString(expr Expr) string {
+	switch expr := expr.(type) {
+	case *BinaryOp:
+		precedence := binaryPrecedence(expr.Op)
+		lhs, rhs := exprString(expr.Lhs), exprString(expr.Rhs)
+		if operand, ok := expr.Lhs.(*BinaryOp); ok && binaryPrecedence(operand.Op) < precedence {
+			lhs = "(" + lhs + ")"
+		}
+		if operand, ok := expr.Rhs.(*BinaryOp); ok && binaryPrecedence(operand.Op) <= precedence {
+			rhs = "(" + rhs + ")"
+		}
+		return lhs + " " + expr.token().Value + " " + rhs
+	case *UnaryOp:
+		operand := exprString(expr.Operand)
+		if _, ok := expr.Operand.(*BinaryOp); ok {
+			operand = "(" + operand + ")"
+		}
+		return expr.token().Value + operand
+	case *FunctionCall:
+		arguments := make([]string, len(expr.Arguments))
+		for i, argument := range expr.Arguments {
+			arguments[i] = exprString(argument)
+		}
+		if expr.TypeArgument != nil {
+			arguments = append([]string{expr.TypeArgument.Name}, arguments...)
+		}
+		if expr.Ellipsis {
+			arguments[len(arguments)-1] += "..."
+		}
+		return qualifiedName(expr.Import, expr.Name()) + "(" + strings.Join(arguments, ", ") + ")"
+	case *Identifier:
+		return qualifiedName(expr.Import, expr.Name)
+	case *Selector:
+		return operandString(expr.X) + "." + expr.Sel.Value
+	case *Index:
+		return operandString(expr.X) + "[" + exprString(expr.Index) + "]"
+	case *SliceExpr:
+		indices := []Expr{expr.Low, expr.High}
+		if expr.Max != nil {
+			indices = append(indices, expr.Max)
+		}
+		texts := make([]string, len(indices))
+		for i, index := range indices {
+			if index != nil {
+				texts[i] = exprString(index)
+			}
+		}
+		return operandString(expr.X) + "[" + strings.Join(texts, ":") + "]"
+	case *CompositeLit:
+		// The elements are elided as gc does, and so is the type if it is elided in the source.
+		name := expr.Type.Name
+		if expr.elided {
+			name = ""
+		} else if expr.ellipsis {
+			name = "[...]" + expr.Type.Elem.Name
+		}
+		if len(expr.Elements) == 0 {
+			return name + "{}"
+		}
+		return name + "{…}"
+	}
+	return expr.token().Value
+}
+
+// operandString formats `expr` followed by a selector or an index, which is parenthesized if it is an operation.
+func operandString(expr Expr) string {
+	switch expr.(type) {
+	case *BinaryOp, *UnaryOp:
+		return "(" + exprString(expr) + ")"
+	}
+	return exprString(expr)
+}
+
+// qualifiedName returns `name` qualified with the package imported by `spec` as written in the source, such as `util.Max`.
+// It is just `name` if `spec` is nil.
+func qualifiedName(spec *ImportSpec, name string) string {
+	if spec == nil {
+		return name
+	}
+	return spec.name() + "." + name
+}
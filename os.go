@@ -0,0 +1,104 @@
+package main
+
+import "fmt"
+
+// OS describes the conventions of the assembler and the object file format on an operating system.
+type OS struct {
+	Name string
+	// Prepended to the name of a function to make its symbol, e.g. "_" for C symbols in Mach-O.
+	symbolPrefix string
+	// Prefix of labels which are not put in the symbol table.
+	localLabelPrefix string
+	// Whether the object file format is ELF. Otherwise it is Mach-O.
+	elf bool
+}
+
+var Linux = OS{Name: "linux", symbolPrefix: "", localLabelPrefix: ".L", elf: true}
+var Darwin = OS{Name: "darwin", symbolPrefix: "_", localLabelPrefix: "L", elf: false}
+
+// NewOS returns the `OS` named as GOOS.
+func NewOS(name string) (*OS, error) {
+	switch name {
+	case "linux":
+		return &Linux, nil
+	case "darwin":
+		return &Darwin, nil
+	default:
+		return nil, fmt.Errorf("unsupported os: %s", name)
+	}
+}
+
+// Symbol returns the symbol of a function or data named `name`.
+// The program starts from the symbol of `main`, which is called by the C runtime.
+func (os *OS) Symbol(name string) string {
+	return os.symbolPrefix + name
+}
+
+func (os *OS) LocalLabel(name string) string {
+	return os.localLabelPrefix + name
+}
+
+// TextSection outputs the directive to start the section of code.
+func (os *OS) TextSection() {
+	if os.elf {
+		fmt.Fprintln(out, ".text")
+	} else {
+		fmt.Fprintln(out, ".section __TEXT,__text,regular,pure_instructions")
+	}
+}
+
+// ReadOnlyDataSection outputs the directive to start the section of constant data such as string literals.
+func (os *OS) ReadOnlyDataSection() {
+	if os.elf {
+		fmt.Fprintln(out, ".section .rodata")
+	} else {
+		fmt.Fprintln(out, ".section __TEXT,__const")
+	}
+}
+
+// DataSection outputs the directive to start the section of initialized writable data.
+func (os *OS) DataSection() {
+	if os.elf {
+		fmt.Fprintln(out, ".data")
+	} else {
+		fmt.Fprintln(out, ".section __DATA,__data")
+	}
+}
+
+// Zerofill outputs a block of `size` zero bytes labelled `name` in the section of uninitialized data, aligned to 2^`align` bytes.
+func (os *OS) Zerofill(name string, size int, align int) {
+	symbol := os.Symbol(name)
+	if os.elf {
+		fmt.Fprintln(out, ".bss")
+		fmt.Fprintf(out, ".p2align %d\n", align)
+		fmt.Fprintf(out, "%s:\n", symbol)
+		fmt.Fprintf(out, "\t.zero %d\n", size)
+	} else {
+		fmt.Fprintf(out, ".zerofill __DATA,__bss,%s,%d,%d\n", symbol, size, align)
+	}
+}
+
+// Global outputs the directive to make the symbol of `name` visible from other object files.
+func (os *OS) Global(name string) {
+	fmt.Fprintf(out, ".globl %s\n", os.Symbol(name))
+}
+
+// FunctionLabel outputs the label of a function visible from other object files.
+func (os *OS) FunctionLabel(name string) {
+	symbol := os.Symbol(name)
+	os.Global(name)
+	if os.elf {
+		fmt.Fprintf(out, ".type %s, @function\n", symbol)
+	}
+	fmt.Fprintf(out, "%s:\n", symbol)
+}
+
+func (os *OS) Footer() {
+	if os.elf {
+		// Mark the stack as non-executable.
+		fmt.Fprintln(out, `.section .note.GNU-stack,"",@progbits`)
+	} else {
+		// Allow the linker to strip unused functions.
+		fmt.Fprintln(out, ".subsections_via_symbols")
+	}
+}
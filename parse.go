@@ -1,18 +1,54 @@
 package main
 
 import (
-	"errors"
 	"fmt"
+	"strconv"
 )
 
 type Ast struct {
-	funcs []*FunctionDecl
+	// Name of the package, which all the files declare in their package clauses.
+	packageName string
+	files       []*File
+	types       []*TypeDecl
+	consts      []*ConstDecl
+	vars        []*VarDecl
+	funcs       []*FunctionDecl
+	// Package-level variables in the order of their initialization, which the type checker determines.
+	initOrder []*Variable
+	// Scope of the package, where the top-level declarations are.
+	scope *Scope
 }
 
+// Importer returns the package imported by `spec`, which has been compiled. If the package cannot be imported, it returns nil,
+// with an error unless the problem has been reported elsewhere, such as in the package itself.
+type Importer func(spec *ImportSpec) (*Package, error)
+
+// Parse parses the main package consisting of the single source file.
 func Parse(tokenStream *TokenStream) (*Ast, error) {
-	parser := makeParser(tokenStream)
-	ast, err := parser.parse()
-	if err != nil {
+	return ParseFiles([]*TokenStream{tokenStream})
+}
+
+// ParseFiles parses the main package consisting of the source files, which cannot import any package.
+func ParseFiles(tokenStreams []*TokenStream) (*Ast, error) {
+	return ParsePackage(tokenStreams, mainQualifier, nil)
+}
+
+// ParsePackage parses the source files of a package, whose declarations are merged into the same package scope.
+// `qualifier` qualifies the symbols of the package, and `importer` resolves the imports, which all fail if it is nil.
+// When they have syntax errors, parsing recovers at the next statement or declaration and all the errors found are returned together.
+// Parsing is the collection pass, which declares all the package-level names, and it is followed by the resolution pass of the types,
+// so that a declaration can refer to the ones after it, even in another file.
+func ParsePackage(tokenStreams []*TokenStream, qualifier string, importer Importer) (*Ast, error) {
+	parser := makeParser()
+	parser.globalScope.qualifier = qualifier
+	parser.importer = importer
+	ast := &Ast{scope: parser.globalScope}
+	for _, tokenStream := range tokenStreams {
+		parser.tokenStream = tokenStream
+		parser.parse(ast)
+	}
+	parser.resolveTypes(ast)
+	if err := parser.diagnostics.Err(); err != nil {
 		return nil, err
 	}
 	return ast, nil
@@ -22,13 +58,35 @@ type parser struct {
 	tokenStream *TokenStream
 	localScope  *Scope
 	globalScope *Scope
+	// Enclosing loops of the statement being parsed, innermost last.
+	loops []*For
+	// Value of `iota` in the const spec being parsed, or -1 outside const declarations.
+	iota int
+	// Type names referred to before their declarations, with the first references, which are undefined unless declared later.
+	forwardTypes map[string]*Token
+	// Type literals parsed in order, whose names are spelled out again after the lengths of the arrays are evaluated.
+	// The layouts of structs and arrays are determined after the types of their elements are resolved, and whether each has been laid out.
+	literals []*Type
+	laidOut  map[*Type]bool
+	// Lengths of the arrays parsed which are evaluated when the arrays are laid out.
+	lengths map[*Type]*arrayLength
+	// Whether the header of an if or for statement is being parsed, where `T {` begins the block rather than a composite literal
+	// unless it is in parentheses.
+	inHeader bool
+	importer Importer
+	// Imports of the file being parsed by the names of the packages.
+	imports     map[string]*ImportSpec
+	diagnostics Diagnostics
 }
 
-func makeParser(tokenStream *TokenStream) *parser {
+func makeParser() *parser {
 	return &parser{
-		tokenStream: tokenStream,
-		localScope:  nil,
-		globalScope: NewGlobalScope(),
+		localScope:   nil,
+		globalScope:  NewGlobalScope(),
+		iota:         -1,
+		forwardTypes: map[string]*Token{},
+		laidOut:      map[*Type]bool{},
+		lengths:      map[*Type]*arrayLength{},
 	}
 }
 
@@ -37,6 +95,15 @@ func (parser *parser) peek() *Token {
 	return &parser.tokenStream.tokens[current]
 }
 
+// peekNext returns the token following the current one, which exists unless the current one is the end.
+func (parser *parser) peekNext() *Token {
+	current := parser.tokenStream.index
+	if parser.tokenStream.IsEnd() {
+		return &parser.tokenStream.tokens[current]
+	}
+	return &parser.tokenStream.tokens[current+1]
+}
+
 func (parser *parser) skip() {
 	if !parser.tokenStream.IsEnd() {
 		parser.tokenStream.index += 1
@@ -46,7 +113,7 @@ func (parser *parser) skip() {
 func (parser *parser) expectString(expected string) (*Token, error) {
 	token := parser.peek()
 	if token.Value != expected {
-		return nil, fmt.Errorf("%s: unexpected %s, expecting %s", token.pos.toString(), token.Value, expected)
+		return nil, errorAt(token, "syntax error: unexpected %s, expecting %s", token.String(), expected)
 	}
 	parser.skip()
 	return token, nil
@@ -57,57 +124,324 @@ func (parser *parser) consumeString(expected string) error {
 	return err
 }
 
-func (parser *parser) parse() (*Ast, error) {
-	var functions []*FunctionDecl
+// parse parses a source file, adding its declarations to `ast`.
+func (parser *parser) parse(ast *Ast) {
+	file, err := parser.packageClause()
+	if err != nil {
+		// The declarations are not parsed, since the file may not be a Go source at all.
+		parser.diagnostics.Add(err)
+		return
+	}
+	if ast.packageName == "" {
+		ast.packageName = file.Package.Value
+	} else if file.Package.Value != ast.packageName {
+		parser.diagnostics.Add(errorAt(file.Package, "package %s; expected package %s", file.Package.Value, ast.packageName))
+	}
+	ast.files = append(ast.files, file)
+
+	parser.imports = map[string]*ImportSpec{}
+	for parser.peek().Kind == TOKEN_IMPORT {
+		specs, err := parser.importDecl()
+		if err == nil {
+			err = parser.consumeString(";")
+		}
+		if err != nil {
+			parser.diagnostics.Add(err)
+			parser.synchronize()
+			continue
+		}
+		for _, spec := range specs {
+			parser.importPackage(spec)
+		}
+		file.Imports = append(file.Imports, specs...)
+	}
+
 	for {
 		if parser.peek().Kind == TOKEN_EOF {
 			break
 		}
 
-		function, err := parser.topLevelDecl()
+		decl, err := parser.topLevelDecl()
+		if err == nil {
+			// The declaration is kept even if the separator after it is missing, since its names are already declared.
+			switch decl := decl.(type) {
+			case *TypeDecl:
+				ast.types = append(ast.types, decl)
+			case *ConstDecl:
+				ast.consts = append(ast.consts, decl)
+			case *VarDecl:
+				ast.vars = append(ast.vars, decl)
+			case *FunctionDecl:
+				ast.funcs = append(ast.funcs, decl)
+			}
+			err = parser.consumeString(";")
+		}
 		if err != nil {
-			return nil, err
+			parser.diagnostics.Add(err)
+			parser.synchronize()
+			// The `}` where a declaration broken inside braces stops closes nothing at the top level, so it is skipped with the `;` after it.
+			if parser.peek().Kind == TOKEN_RBRACE {
+				parser.skip()
+				if parser.peek().Kind == TOKEN_SEMICOLON {
+					parser.skip()
+				}
+			}
 		}
-		if err := parser.consumeString(";"); err != nil {
+	}
+}
+
+// packageClause parses the package clause at the beginning of a file.
+func (parser *parser) packageClause() (*File, error) {
+	tokenPackage := parser.peek()
+	if tokenPackage.Kind != TOKEN_PACKAGE {
+		return nil, errorAt(tokenPackage, "syntax error: package statement must be first")
+	}
+	parser.skip()
+	name := parser.peek()
+	if name.Kind != TOKEN_IDENTIFIER {
+		return nil, errorAt(name, "syntax error: unexpected %s, expecting name", name.String())
+	}
+	if name.Value == "_" {
+		return nil, errorAt(name, "invalid package name _")
+	}
+	parser.skip()
+	if err := parser.consumeString(";"); err != nil {
+		return nil, err
+	}
+	return &File{tok: tokenPackage, Package: name}, nil
+}
+
+// importDecl parses an import declaration, which is either a single spec or a group of specs in parentheses.
+func (parser *parser) importDecl() ([]*ImportSpec, error) {
+	if err := parser.consumeString("import"); err != nil {
+		return nil, err
+	}
+	if parser.peek().Kind != TOKEN_LPAREN {
+		spec, err := parser.importSpec()
+		if err != nil {
 			return nil, err
 		}
-		functions = append(functions, function)
+		return []*ImportSpec{spec}, nil
+	}
+
+	parser.skip()
+	var specs []*ImportSpec
+	for parser.peek().Kind != TOKEN_RPAREN {
+		if parser.peek().Kind == TOKEN_EOF {
+			return nil, errorAt(parser.peek(), "syntax error: unexpected EOF, expecting )")
+		}
+		spec, err := parser.importSpec()
+		if err == nil && parser.peek().Kind != TOKEN_RPAREN {
+			err = parser.consumeString(";")
+		}
+		if err != nil {
+			parser.diagnostics.Add(err)
+			parser.synchronizeSpec()
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	parser.skip()
+	return specs, nil
+}
+
+// importSpec parses an import spec, which is the path of the package optionally preceded by its name.
+func (parser *parser) importSpec() (*ImportSpec, error) {
+	spec := &ImportSpec{}
+	if parser.peek().Kind == TOKEN_IDENTIFIER {
+		spec.Name = parser.peek()
+		parser.skip()
+	}
+	path := parser.peek()
+	if path.Kind != TOKEN_STRING {
+		return nil, errorAt(path, "syntax error: missing import path; require quoted string")
+	}
+	parser.skip()
+	// The tokenizer has checked the literal to be well-formed.
+	spec.Path, _ = strconv.Unquote(path.Value)
+	if spec.Path == "" {
+		return nil, errorAt(path, "invalid import path (empty string)")
+	}
+	spec.tok = path
+	return spec, nil
+}
+
+// synchronize skips the rest of the statement or declaration where a syntax error is found, so that parsing can resume at the next one.
+// Braces nested in it are skipped as a whole. The `;` ending it is consumed, but the `}` closing the enclosing block is not.
+func (parser *parser) synchronize() {
+	depth := 0
+	for {
+		switch parser.peek().Kind {
+		case TOKEN_EOF:
+			return
+		case TOKEN_LBRACE:
+			depth++
+		case TOKEN_RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case TOKEN_SEMICOLON:
+			if depth == 0 {
+				parser.skip()
+				return
+			}
+		}
+		parser.skip()
 	}
-	return &Ast{functions}, nil
 }
 
-func (parser *parser) topLevelDecl() (*FunctionDecl, error) {
+func (parser *parser) topLevelDecl() (Expr, error) {
 	token := parser.peek()
-	if token.Kind == TOKEN_FUNC {
+	switch token.Kind {
+	case TOKEN_FUNC:
 		return parser.functionDecl()
-	} else {
-		return nil, fmt.Errorf("%s: syntax error: non-declaration statement outside function body: %s", token.pos.toString(), token.Value)
+	case TOKEN_CONST:
+		return parser.constDecl()
+	case TOKEN_VAR:
+		return parser.varDecl()
+	case TOKEN_TYPE:
+		return parser.typeDecl()
+	case TOKEN_IMPORT:
+		return nil, errorAt(token, "syntax error: imports must appear before other declarations")
+	case TOKEN_PACKAGE:
+		return nil, errorAt(token, "syntax error: package statement must be first")
+	default:
+		return nil, errorAt(token, "syntax error: non-declaration statement outside function body: %s", token.Value)
 	}
 }
 
+// currentScope returns the scope where a declaration being parsed belongs.
+func (parser *parser) currentScope() *Scope {
+	if parser.localScope != nil {
+		return parser.localScope
+	}
+	return parser.globalScope
+}
+
 func (parser *parser) stmt() (Expr, error) {
 	token := parser.peek()
-	if token.Kind == TOKEN_RETURN {
+	switch token.Kind {
+	case TOKEN_RETURN:
 		parser.skip()
-		node, err := parser.addOp()
+		if kind := parser.peek().Kind; kind == TOKEN_SEMICOLON || kind == TOKEN_RBRACE {
+			return &Return{tok: token}, nil
+		}
+		values, err := parser.exprList()
 		if err != nil {
 			return nil, err
 		}
-		return &Return{tok: token, Node: node}, nil
+		return &Return{tok: token, Values: values}, nil
+	case TOKEN_IF:
+		return parser.ifStmt()
+	case TOKEN_FOR:
+		return parser.forStmt(nil)
+	case TOKEN_BREAK, TOKEN_CONTINUE:
+		return parser.branchStmt()
+	case TOKEN_LBRACE:
+		return parser.innerBlock()
+	case TOKEN_CONST:
+		return parser.constDecl()
+	case TOKEN_VAR:
+		return parser.varDecl()
 	}
 
-	node, err := parser.addOp()
+	node, err := parser.expr()
 	if err != nil {
 		return nil, err
 	}
+	if _, ok := node.(*Identifier); ok && parser.peek().Kind == TOKEN_COLON {
+		return parser.labeledStmt(node.token())
+	}
+	return parser.simpleStmt(node)
+}
 
-	token = parser.peek()
+// simpleStmt parses the rest of a simple statement whose leading expression `lhs` has already been parsed.
+func (parser *parser) simpleStmt(lhs Expr) (Expr, error) {
+	token := parser.peek()
 	switch token.Kind {
 	case TOKEN_COLONEQUAL:
-		return parser.shortVarDecl(node)
-	default:
-		return node, nil
+		return parser.shortVarDecl([]Expr{lhs})
+	case TOKEN_ASSIGN:
+		return parser.assignment([]Expr{lhs})
+	case TOKEN_COMMA:
+		list, err := parser.exprListAfter(lhs)
+		if err != nil {
+			return nil, err
+		}
+		if parser.peek().Kind == TOKEN_COLONEQUAL {
+			return parser.shortVarDecl(list)
+		}
+		return parser.assignment(list)
+	case TOKEN_PLUSPLUS, TOKEN_MINUSMINUS:
+		parser.skip()
+		return &IncDec{tok: token, Op: token.Kind, Operand: lhs}, nil
+	}
+	if op, ok := compoundAssignmentOperators[token.Kind]; ok {
+		parser.skip()
+		rhs, err := parser.expr()
+		if err != nil {
+			return nil, err
+		}
+		// The operator of the operation is the assignment operator without `=`.
+		opToken := *token
+		opToken.Kind = op
+		opToken.Value = token.Value[:len(token.Value)-1]
+		operation := &BinaryOp{tok: &opToken, Op: op, Lhs: lhs, Rhs: rhs}
+		return &AssignStmt{tok: token, Op: op, Lhs: []Expr{lhs}, Rhs: []Expr{operation}}, nil
+	}
+	return lhs, nil
+}
+
+// Binary operators corresponding to the assignment operators such as `+=`.
+var compoundAssignmentOperators = map[TokenKind]TokenKind{
+	TOKEN_PLUSEQUAL:     TOKEN_PLUS,
+	TOKEN_MINUSEQUAL:    TOKEN_MINUS,
+	TOKEN_STAREQUAL:     TOKEN_STAR,
+	TOKEN_SLASHEQUAL:    TOKEN_SLASH,
+	TOKEN_PERCENTEQUAL:  TOKEN_PERCENT,
+	TOKEN_AMPEQUAL:      TOKEN_AMP,
+	TOKEN_PIPEEQUAL:     TOKEN_PIPE,
+	TOKEN_CARETEQUAL:    TOKEN_CARET,
+	TOKEN_AMPCARETEQUAL: TOKEN_AMPCARET,
+	TOKEN_SHLEQUAL:      TOKEN_SHL,
+	TOKEN_SHREQUAL:      TOKEN_SHR,
+}
+
+// assignment parses the rest of an assignment whose operands on the left `lhs` have already been parsed.
+func (parser *parser) assignment(lhs []Expr) (Expr, error) {
+	token, err := parser.expectString("=")
+	if err != nil {
+		return nil, err
 	}
+	rhs, err := parser.exprList()
+	if err != nil {
+		return nil, err
+	}
+	return &AssignStmt{tok: token, Lhs: lhs, Rhs: rhs}, nil
+}
+
+// exprList parses a list of expressions separated by commas.
+func (parser *parser) exprList() ([]Expr, error) {
+	first, err := parser.expr()
+	if err != nil {
+		return nil, err
+	}
+	return parser.exprListAfter(first)
+}
+
+// exprListAfter parses the rest of a list of expressions whose first one `first` has already been parsed.
+func (parser *parser) exprListAfter(first Expr) ([]Expr, error) {
+	list := []Expr{first}
+	for parser.peek().Kind == TOKEN_COMMA {
+		parser.skip()
+		expr, err := parser.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+	}
+	return list, nil
 }
 
 func (parser *parser) functionDecl() (*FunctionDecl, error) {
@@ -115,15 +449,15 @@ func (parser *parser) functionDecl() (*FunctionDecl, error) {
 
 	tokenFunc, _ := parser.expectString("func")
 
-	token := parser.peek()
-	if token.Kind != TOKEN_IDENTIFIER {
-		err := fmt.Errorf("%s: unexpected %s, expecting name", token.pos.toString(), token.Value)
+	nameToken := parser.peek()
+	if nameToken.Kind != TOKEN_IDENTIFIER {
+		err := errorAt(nameToken, "syntax error: unexpected %s, expecting name", nameToken.String())
 		return nil, err
 	}
-	name := token.Value
+	name := nameToken.Value
 	parser.skip()
 
-	parameters, returnType, err := parser.signiture()
+	parameters, results, err := parser.signiture()
 	if err != nil {
 		return nil, err
 	}
@@ -137,72 +471,145 @@ func (parser *parser) functionDecl() (*FunctionDecl, error) {
 		tok:        tokenFunc,
 		Name:       name,
 		Parameters: parameters,
-		ReturnType: returnType,
+		Results:    results,
+		ReturnType: resultType(results),
 		Body:       body,
 		Scope:      parser.localScope,
 	}
-	parser.globalScope.InsertExpr(name, function)
+	function.Scope.function = function
+	parser.localScope = nil
+	parser.declare(nameToken, function)
 	return function, nil
 }
 
-func (parser *parser) signiture() ([]*Variable, *Type, error) {
-	if err := parser.consumeString("("); err != nil {
+// signiture parses the parameters and the results of a function, and declares the named ones in the scope of the function.
+func (parser *parser) signiture() ([]*Variable, []*Variable, error) {
+	parameters, err := parser.parameterList()
+	if err != nil {
 		return nil, nil, err
 	}
+	for _, parameter := range parameters {
+		if parameter.Name != "" {
+			parser.declare(parameter.token(), parameter)
+		}
+	}
 
-	parameters := []*Variable{}
-	if parser.peek().Kind != TOKEN_RPAREN {
-		if parameter, err := parser.parameterDecl(); err != nil {
+	var results []*Variable
+	if parser.peek().Kind == TOKEN_LPAREN {
+		list, err := parser.parameterList()
+		if err != nil {
 			return nil, nil, err
-		} else {
-			parameters = append(parameters, parameter)
 		}
-		for {
-			if parser.peek().Kind == TOKEN_RPAREN {
-				break
-			}
-			if err := parser.consumeString(","); err != nil {
-				return nil, nil, err
-			}
-			if parameter, err := parser.parameterDecl(); err != nil {
-				return nil, nil, err
-			} else {
-				parameters = append(parameters, parameter)
+		for _, result := range list {
+			if result.Name != "" {
+				parser.declare(result.token(), result)
 			}
 		}
+		results = list
+	} else {
+		typeToken := parser.peek()
+		returnType, err := parser.parseType()
+		if err != nil {
+			return nil, nil, err
+		}
+		if returnType != nil {
+			results = []*Variable{{tok: typeToken, Ty: returnType}}
+		}
 	}
+	return parameters, results, nil
+}
 
-	if err := parser.consumeString(")"); err != nil {
-		return nil, nil, err
-	}
-
-	returnType, err := parser.parseType()
-	if err != nil {
-		return nil, nil, err
+// resultType returns the type of the values which a function with `results` returns.
+func resultType(results []*Variable) *Type {
+	switch len(results) {
+	case 0:
+		return nil
+	case 1:
+		return results[0].Ty
 	}
-	if returnType != nil && !parser.globalScope.ExistsType(returnType.Name) {
-		return nil, nil, fmt.Errorf("undefined: %s", returnType.Name)
+	types := make([]*Type, len(results))
+	for i, result := range results {
+		types[i] = result.Ty
 	}
-	return parameters, returnType, nil
+	return newTuple(types)
 }
 
-func (parser *parser) parameterDecl() (*Variable, error) {
-	parameterToken := parser.peek()
-	if parameterToken.Kind == TOKEN_IDENTIFIER {
-		parser.skip()
-		ty, err := parser.parseType()
-		if err != nil {
+// parameterList parses a parenthesized list of parameters, which are either all named or all unnamed.
+// Consecutive named parameters of the same type can be grouped like `(a, b int)`. Unnamed parameters have the empty name.
+func (parser *parser) parameterList() ([]*Variable, error) {
+	if err := parser.consumeString("("); err != nil {
+		return nil, err
+	}
+	// Each entry is a name followed by a type, or either of them alone, which are told apart after the whole list is parsed.
+	type entry struct {
+		// `tok` begins the entry. `name` is nil if the entry is a type other than a name, such as a pointer or a slice.
+		tok  *Token
+		name *Token
+		ty   *Type
+	}
+	var entries []entry
+	named := false
+	for parser.peek().Kind != TOKEN_RPAREN {
+		token := parser.peek()
+		current := entry{tok: token, name: token}
+		switch token.Kind {
+		case TOKEN_IDENTIFIER:
+			parser.skip()
+			if kind := parser.peek().Kind; kind == TOKEN_IDENTIFIER || kind == TOKEN_STAR || kind == TOKEN_LBRACK {
+				ty, err := parser.parseType()
+				if err != nil {
+					return nil, err
+				}
+				current.ty = ty
+				named = true
+			}
+		case TOKEN_STAR, TOKEN_LBRACK:
+			ty, err := parser.parseType()
+			if err != nil {
+				return nil, err
+			}
+			current = entry{tok: token, ty: ty}
+		default:
+			return nil, errorAt(token, "syntax error: unexpected %s, expected )", token.String())
+		}
+		entries = append(entries, current)
+		if parser.peek().Kind == TOKEN_RPAREN {
+			break
+		}
+		if err := parser.consumeString(","); err != nil {
 			return nil, err
 		}
-		parameter := &Variable{tok: parameterToken, Name: parameterToken.Value, Ty: ty}
-		name := parameterToken.Value
-		if parser.localScope.ExistsExpr(name) {
-			return nil, fmt.Errorf("%s: %s redeclared in this block", parameterToken.pos.toString(), name)
+	}
+	rparen, err := parser.expectString(")")
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := make([]*Variable, len(entries))
+	if !named {
+		for i, entry := range entries {
+			ty := entry.ty
+			if entry.name != nil {
+				ty = parser.typeNamed(entry.name)
+			}
+			parameters[i] = &Variable{tok: entry.tok, Ty: ty}
+		}
+		return parameters, nil
+	}
+	// A name without a type has the type of the next parameter in the group.
+	var ty *Type
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].name == nil {
+			return nil, errorAt(rparen, "syntax error: mixed named and unnamed parameters")
+		}
+		if entries[i].ty != nil {
+			ty = entries[i].ty
+		} else if ty == nil {
+			return nil, errorAt(rparen, "syntax error: mixed named and unnamed parameters")
 		}
-		parser.localScope.InsertExpr(name, parameter)
-		return parameter, nil
+		parameters[i] = &Variable{tok: entries[i].name, Name: entries[i].name.Value, Ty: ty}
 	}
-	return nil, fmt.Errorf("%s: unexpected %s, expected )", parameterToken.pos.toString(), parameterToken.Value)
+	return parameters, nil
 }
 
 func (parser *parser) parseType() (*Type, error) {
@@ -212,11 +619,177 @@ func (parser *parser) parseType() (*Type, error) {
 		return nil, nil
 	case TOKEN_IDENTIFIER:
 		parser.skip()
-		// Assume all types are defined so far.
-		ty, _ := parser.globalScope.GetType(token.Value)
+		if spec := parser.importNamed(token.Value); spec != nil && parser.peek().Kind == TOKEN_DOT {
+			return parser.qualifiedType(spec)
+		}
+		return parser.typeNamed(token), nil
+	case TOKEN_STRUCT:
+		return parser.structType()
+	case TOKEN_STAR:
+		parser.skip()
+		elem, err := parser.elementType()
+		if err != nil {
+			return nil, err
+		}
+		ty := newPointer(elem)
+		parser.literals = append(parser.literals, ty)
+		return ty, nil
+	case TOKEN_LBRACK:
+		ty, err := parser.arrayOrSliceType()
+		if err != nil {
+			return nil, err
+		}
+		if ty.isArray() && ty.Len < 0 {
+			return nil, errorAt(token, "invalid use of [...] array (outside a composite literal)")
+		}
+		return ty, nil
+	}
+	return nil, errorAt(token, "syntax error: unexpected %s, expecting type", token.String())
+}
+
+// elementType parses the type which a pointer, an array or a slice type is composed of.
+func (parser *parser) elementType() (*Type, error) {
+	elem, err := parser.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if elem == nil {
+		return nil, errorAt(parser.peek(), "syntax error: unexpected %s, expecting type", parser.peek().String())
+	}
+	return elem, nil
+}
+
+// arrayOrSliceType parses an array or a slice type. The length of an array is a constant expression, which is evaluated
+// in the resolution pass since it may refer to constants declared later. The length of `[...]T` is -1 until it is determined
+// by the composite literal, which is the only place it can be used.
+func (parser *parser) arrayOrSliceType() (*Type, error) {
+	if err := parser.consumeString("["); err != nil {
+		return nil, err
+	}
+	if parser.peek().Kind == TOKEN_RBRACK {
+		parser.skip()
+		elem, err := parser.elementType()
+		if err != nil {
+			return nil, err
+		}
+		ty := newSlice(elem)
+		parser.literals = append(parser.literals, ty)
 		return ty, nil
 	}
-	return nil, errors.New("expecting type")
+	var length Expr
+	if parser.peek().Kind == TOKEN_ELLIPSIS {
+		parser.skip()
+	} else {
+		inHeader := parser.inHeader
+		parser.inHeader = false
+		expr, err := parser.expr()
+		parser.inHeader = inHeader
+		if err != nil {
+			return nil, err
+		}
+		length = expr
+	}
+	if err := parser.consumeString("]"); err != nil {
+		return nil, err
+	}
+	elem, err := parser.elementType()
+	if err != nil {
+		return nil, err
+	}
+	if length == nil {
+		return &Type{Id: TypeIdArray, Name: "[...]" + elem.Name, Elem: elem, Len: -1}, nil
+	}
+	ty := &Type{Id: TypeIdArray, Name: "[" + exprString(length) + "]" + elem.Name, Elem: elem}
+	parser.lengths[ty] = &arrayLength{expr: length, scope: parser.currentScope()}
+	parser.literals = append(parser.literals, ty)
+	return ty, nil
+}
+
+// structType parses a struct type. Its layout is determined in the resolution pass, since the types of the fields may be declared later.
+func (parser *parser) structType() (*Type, error) {
+	if err := parser.consumeString("struct"); err != nil {
+		return nil, err
+	}
+	if err := parser.consumeString("{"); err != nil {
+		return nil, err
+	}
+	var fields []*Field
+	declared := map[string]*Field{}
+	for parser.peek().Kind != TOKEN_RBRACE {
+		names, err := parser.fieldNames()
+		if err != nil {
+			return nil, err
+		}
+		var ty *Type
+		if names != nil {
+			ty, err = parser.parseType()
+			if err != nil {
+				return nil, err
+			}
+			if ty == nil {
+				return nil, errorAt(parser.peek(), "syntax error: unexpected %s, expecting type", parser.peek().String())
+			}
+		}
+		for _, name := range names {
+			if other, ok := declared[name.Value]; ok {
+				parser.diagnostics.Add(errorAt(name, "%s redeclared\n\t%s: other declaration of %s", name.Value, location(other.tok), name.Value))
+				continue
+			}
+			field := &Field{tok: name, Name: name.Value, Ty: ty}
+			if name.Value != "_" {
+				declared[name.Value] = field
+			}
+			fields = append(fields, field)
+		}
+		if parser.peek().Kind != TOKEN_RBRACE {
+			if err := parser.consumeString(";"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	parser.skip()
+	ty := newStruct(fields)
+	parser.literals = append(parser.literals, ty)
+	return ty, nil
+}
+
+// fieldNames parses the names of the fields declared together in a struct type.
+// An embedded field is reported and skipped, for which no names are returned.
+func (parser *parser) fieldNames() ([]*Token, error) {
+	var names []*Token
+	for {
+		name := parser.peek()
+		if name.Kind != TOKEN_IDENTIFIER {
+			return nil, errorAt(name, "syntax error: unexpected %s, expecting field name", name.String())
+		}
+		parser.skip()
+		names = append(names, name)
+		if parser.peek().Kind != TOKEN_COMMA {
+			break
+		}
+		parser.skip()
+	}
+	if kind := parser.peek().Kind; len(names) == 1 && (kind == TOKEN_SEMICOLON || kind == TOKEN_RBRACE || kind == TOKEN_DOT) {
+		parser.diagnostics.Add(errorAt(names[0], "embedded field %s is not supported", names[0].Value))
+		if kind == TOKEN_DOT {
+			parser.skip()
+			parser.skip()
+		}
+		return nil, nil
+	}
+	return names, nil
+}
+
+// typeNamed returns the type named by `token`. A name which has not been declared is registered as a type declared later,
+// and `resolveTypes` reports it if it is not.
+func (parser *parser) typeNamed(token *Token) *Type {
+	if ty, ok := parser.globalScope.GetType(token.Value); ok {
+		return ty
+	}
+	ty := &Type{Id: TypeIdUnresolved, Name: token.Value}
+	parser.globalScope.InsertType(token.Value, ty)
+	parser.forwardTypes[token.Value] = token
+	return ty
 }
 
 func (parser *parser) block() (*Block, error) {
@@ -226,112 +799,1231 @@ func (parser *parser) block() (*Block, error) {
 	}
 
 	var body []Expr
+	var rbraceToken *Token
 	for {
 		if parser.peek().Kind == TOKEN_RBRACE {
+			rbraceToken = parser.peek()
 			parser.skip()
 			break
 		}
 		if parser.peek().Kind == TOKEN_EOF {
-			return nil, fmt.Errorf("%s: unexpected EOF, expecting }", parser.peek().pos.toString())
+			return nil, errorAt(parser.peek(), "syntax error: unexpected EOF, expecting }")
 		}
 
 		node, err := parser.stmt()
 		if err != nil {
-			return nil, err
+			parser.diagnostics.Add(err)
+			parser.synchronize()
+			continue
 		}
 		body = append(body, node)
-		// TODO: Semicolon can be omitted after } for one-line function definition.
+		// Semicolon can be omitted before a closing }.
+		if parser.peek().Kind == TOKEN_RBRACE {
+			continue
+		}
 		if err := parser.consumeString(";"); err != nil {
-			return nil, err
+			parser.diagnostics.Add(err)
+			parser.synchronize()
 		}
 	}
 
-	return &Block{tok: lbraceToken, Body: body}, nil
+	return &Block{tok: lbraceToken, Body: body, Scope: parser.localScope, rbrace: rbraceToken}, nil
 }
 
-func (parser *parser) shortVarDecl(lhs Expr) (Expr, error) {
-	if _, ok := lhs.(*Identifier); !ok {
-		err := fmt.Errorf("%s: unexpected %s, expecting variable", lhs.token().pos.toString(), lhs.token().Value)
+// innerBlock parses a block which introduces a new scope nested in the current one.
+func (parser *parser) innerBlock() (*Block, error) {
+	outer := parser.localScope
+	parser.localScope = NewScope(outer)
+	defer func() { parser.localScope = outer }()
+	return parser.block()
+}
+
+func (parser *parser) ifStmt() (*If, error) {
+	tokenIf, err := parser.expectString("if")
+	if err != nil {
 		return nil, err
 	}
 
-	lhsVar := &Variable{tok: lhs.token(), Name: lhs.token().Value, Ty: &TypeUnresolved}
-	if parser.localScope.ExistsExpr(lhsVar.Name) {
-		return nil, errors.New("no new variables on left side of :=")
+	parser.inHeader = true
+	cond, err := parser.expr()
+	parser.inHeader = false
+	if err != nil {
+		return nil, err
 	}
-	parser.localScope.InsertExpr(lhsVar.Name, lhsVar)
 
-	parser.consumeString(":=")
-	rhs, err := parser.addOp()
+	then, err := parser.innerBlock()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Assign{tok: &Token{Kind: TOKEN_COLONEQUAL, Value: ":="}, Lhs: lhsVar, Rhs: rhs}, nil
-}
+	if parser.peek().Kind != TOKEN_ELSE {
+		return &If{tok: tokenIf, Cond: cond, Then: then, Else: nil}, nil
+	}
+	parser.skip()
 
-func (parser *parser) addOp() (Expr, error) {
-	lhs, err := parser.primaryExpr()
+	var els Expr
+	switch token := parser.peek(); token.Kind {
+	case TOKEN_IF:
+		els, err = parser.ifStmt()
+	case TOKEN_LBRACE:
+		els, err = parser.innerBlock()
+	default:
+		return nil, errorAt(token, "else must be followed by if or statement block")
+	}
 	if err != nil {
 		return nil, err
 	}
+	return &If{tok: tokenIf, Cond: cond, Then: then, Else: els}, nil
+}
 
-	token := parser.peek()
-	switch token.Kind {
-	case TOKEN_PLUS:
-		parser.skip()
-		rhs, err := parser.addOp()
-		if err != nil {
+func (parser *parser) labeledStmt(label *Token) (Expr, error) {
+	if err := parser.consumeString(":"); err != nil {
+		return nil, err
+	}
+	// Labels are only meaningful for break and continue until goto is supported.
+	if parser.peek().Kind != TOKEN_FOR {
+		return nil, errorAt(label, "label %s defined and not used", label.Value)
+	}
+	return parser.forStmt(label)
+}
+
+// forStmt parses a for statement, labeled with `label` if it is not nil.
+func (parser *parser) forStmt(label *Token) (*For, error) {
+	tokenFor, err := parser.expectString("for")
+	if err != nil {
+		return nil, err
+	}
+
+	outer := parser.localScope
+	parser.localScope = NewScope(outer)
+	defer func() { parser.localScope = outer }()
+
+	loop := &For{tok: tokenFor, Scope: parser.localScope}
+	if label != nil {
+		loop.Label = label.Value
+	}
+
+	if parser.peek().Kind != TOKEN_LBRACE {
+		parser.inHeader = true
+		defer func() { parser.inHeader = false }()
+		if err := parser.forHeader(loop); err != nil {
+			return nil, err
+		}
+	}
+
+	parser.inHeader = false
+	parser.loops = append(parser.loops, loop)
+	body, err := parser.innerBlock()
+	parser.loops = parser.loops[:len(parser.loops)-1]
+	if err != nil {
+		return nil, err
+	}
+	loop.Body = body
+
+	if label != nil && !loop.labelUsed {
+		return nil, errorAt(label, "label %s defined and not used", label.Value)
+	}
+	return loop, nil
+}
+
+// forHeader parses the header of `loop`, which is a condition, a for clause or a range clause.
+func (parser *parser) forHeader(loop *For) error {
+	if parser.peek().Kind == TOKEN_RANGE {
+		return parser.rangeClause(loop, nil)
+	}
+	var init Expr
+	if parser.peek().Kind != TOKEN_SEMICOLON {
+		lhs, err := parser.exprList()
+		if err != nil {
+			return err
+		}
+		kind := parser.peek().Kind
+		switch {
+		case (kind == TOKEN_COLONEQUAL || kind == TOKEN_ASSIGN) && parser.peekNext().Kind == TOKEN_RANGE:
+			return parser.rangeClause(loop, lhs)
+		case len(lhs) == 1:
+			init, err = parser.simpleStmt(lhs[0])
+		case kind == TOKEN_COLONEQUAL:
+			init, err = parser.shortVarDecl(lhs)
+		default:
+			init, err = parser.assignment(lhs)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if parser.peek().Kind == TOKEN_LBRACE {
+		switch init.(type) {
+		case *Assign, *AssignStmt, *IncDec:
+			return errorAt(parser.peek(), "syntax error: expected for loop condition")
+		}
+		loop.Cond = init
+		return nil
+	}
+	loop.Init = init
+	if err := parser.consumeString(";"); err != nil {
+		return err
+	}
+	if parser.peek().Kind != TOKEN_SEMICOLON {
+		var err error
+		if loop.Cond, err = parser.expr(); err != nil {
+			return err
+		}
+	}
+	if err := parser.consumeString(";"); err != nil {
+		return err
+	}
+	if parser.peek().Kind != TOKEN_LBRACE {
+		lhs, err := parser.expr()
+		if err != nil {
+			return err
+		}
+		if parser.peek().Kind == TOKEN_COLONEQUAL {
+			return errorAt(parser.peek(), "syntax error: cannot declare in post statement of for loop")
+		}
+		if loop.Post, err = parser.simpleStmt(lhs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeClause parses the range clause of `loop` from `:=`, `=` or `range`, after the iteration variables `lhs` if any.
+// The variables are declared in the scope of the loop with `:=`.
+func (parser *parser) rangeClause(loop *For, lhs []Expr) error {
+	if len(lhs) > 2 {
+		return errorAt(lhs[2].token(), "range clause permits at most two iteration variables")
+	}
+	if len(lhs) > 0 {
+		if parser.peek().Kind == TOKEN_COLONEQUAL {
+			// gc reports a range clause declaring nothing new at the for statement.
+			declared, err := parser.declareVariables(lhs, loop.tok)
+			if err != nil {
+				return err
+			}
+			lhs, loop.Define = declared, true
+		}
+		parser.skip()
+		loop.Key = lhs[0]
+		if len(lhs) == 2 {
+			loop.Value = lhs[1]
+		}
+	}
+	if err := parser.consumeString("range"); err != nil {
+		return err
+	}
+	var err error
+	loop.Range, err = parser.expr()
+	return err
+}
+
+// branchStmt parses a break or continue statement and resolves the loop it refers to.
+func (parser *parser) branchStmt() (Expr, error) {
+	token := parser.peek()
+	parser.skip()
+
+	var label *Token
+	if parser.peek().Kind == TOKEN_IDENTIFIER {
+		label = parser.peek()
+		parser.skip()
+	}
+
+	var loop *For
+	if label == nil {
+		if len(parser.loops) == 0 {
+			if token.Kind == TOKEN_BREAK {
+				return nil, errorAt(token, "break is not in a loop, switch, or select")
+			}
+			return nil, errorAt(token, "continue is not in a loop")
+		}
+		loop = parser.loops[len(parser.loops)-1]
+	} else {
+		for i := len(parser.loops) - 1; i >= 0; i-- {
+			if parser.loops[i].Label == label.Value {
+				loop = parser.loops[i]
+				break
+			}
+		}
+		if loop == nil {
+			return nil, errorAt(label, "invalid %s label %s", token.Value, label.Value)
+		}
+		loop.labelUsed = true
+	}
+
+	if token.Kind == TOKEN_BREAK {
+		loop.hasBreak = true
+		return &Break{tok: token, Label: labelName(label), loop: loop}, nil
+	}
+	return &Continue{tok: token, Label: labelName(label), loop: loop}, nil
+}
+
+func labelName(label *Token) string {
+	if label == nil {
+		return ""
+	}
+	return label.Value
+}
+
+// constDecl parses a const declaration, which is either a single spec or a group of specs in parentheses.
+func (parser *parser) constDecl() (*ConstDecl, error) {
+	tokenConst, err := parser.expectString("const")
+	if err != nil {
+		return nil, err
+	}
+	decl := &ConstDecl{tok: tokenConst}
+	// Index of the tokens of the type and values in the last spec which has them, which a spec without them repeats.
+	repeated := -1
+	if parser.peek().Kind != TOKEN_LPAREN {
+		spec, err := parser.constSpec(0, &repeated)
+		if err != nil {
+			return nil, err
+		}
+		decl.Specs = append(decl.Specs, spec)
+		return decl, nil
+	}
+
+	parser.skip()
+	for parser.peek().Kind != TOKEN_RPAREN {
+		if parser.peek().Kind == TOKEN_EOF {
+			return nil, errorAt(parser.peek(), "syntax error: unexpected EOF, expecting )")
+		}
+		spec, err := parser.constSpec(len(decl.Specs), &repeated)
+		if err == nil {
+			decl.Specs = append(decl.Specs, spec)
+			if parser.peek().Kind != TOKEN_RPAREN {
+				err = parser.consumeString(";")
+			}
+		}
+		if err != nil {
+			parser.diagnostics.Add(err)
+			parser.synchronizeSpec()
+		}
+	}
+	parser.skip()
+	return decl, nil
+}
+
+// constSpec parses a const spec whose `iota` is `iota`.
+// `repeated` holds the index of the tokens of the last type and values in the group, which are parsed again if this spec omits them.
+func (parser *parser) constSpec(iota int, repeated *int) (*ConstSpec, error) {
+	spec := &ConstSpec{tok: parser.peek(), Iota: iota, Scope: parser.currentScope()}
+	for {
+		token := parser.peek()
+		if token.Kind != TOKEN_IDENTIFIER {
+			return nil, errorAt(token, "syntax error: unexpected %s, expecting name", token.String())
+		}
+		parser.skip()
+		spec.Names = append(spec.Names, &Constant{tok: token, Name: token.Value, Ty: &TypeUnresolved, Spec: spec})
+		if parser.peek().Kind != TOKEN_COMMA {
+			break
+		}
+		parser.skip()
+	}
+
+	switch kind := parser.peek().Kind; {
+	case kind == TOKEN_SEMICOLON || kind == TOKEN_RPAREN:
+		if *repeated >= 0 {
+			// The tokens are parsed again, so that `iota` in them has the value of this spec.
+			end := parser.tokenStream.index
+			parser.tokenStream.index = *repeated
+			err := parser.constSpecValues(spec)
+			parser.tokenStream.index = end
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, errorAt(spec.Names[0].token(), "missing init expr for const declaration")
+		}
+	default:
+		*repeated = parser.tokenStream.index
+		if err := parser.constSpecValues(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, constant := range spec.Names {
+		parser.declare(constant.token(), constant)
+	}
+	return spec, nil
+}
+
+// declare inserts `expr` named `name.Value` into the current scope, unless it is the blank identifier.
+// Functions named init are not declared, since there can be many of them and they cannot be referred to.
+func (parser *parser) declare(name *Token, expr Expr) {
+	if name.Value == "_" {
+		return
+	}
+	scope := parser.currentScope()
+	if parser.redeclared(scope, name) {
+		return
+	}
+	if name.Value == "init" && scope == parser.globalScope {
+		if function, ok := expr.(*FunctionDecl); !ok {
+			parser.diagnostics.Add(errorAt(name, "cannot declare init - must be func"))
+		} else if len(function.Parameters) > 0 || function.ReturnType != nil {
+			parser.diagnostics.Add(errorAt(name, "func init must have no arguments and no return values"))
+		}
+		return
+	}
+	scope.InsertExpr(name.Value, expr)
+}
+
+// redeclared reports an error if `name` has already been declared in `scope`.
+// Types share the names with the other declarations, but only types declared in the package count, not predeclared ones.
+func (parser *parser) redeclared(scope *Scope, name *Token) bool {
+	ty, isType := scope.types[name.Value]
+	if scope.ExistsExprInCurrentScope(name.Value) || isType && ty.isDefined() {
+		parser.diagnostics.Add(errorAt(name, "%s redeclared in this block", name.Value))
+		return true
+	}
+	return false
+}
+
+// typeDecl parses a type declaration, which is either a single spec or a group of specs in parentheses.
+func (parser *parser) typeDecl() (*TypeDecl, error) {
+	tokenType, err := parser.expectString("type")
+	if err != nil {
+		return nil, err
+	}
+	decl := &TypeDecl{tok: tokenType}
+	if parser.peek().Kind != TOKEN_LPAREN {
+		spec, err := parser.typeSpec()
+		if err != nil {
 			return nil, err
 		}
-		return &AddOp{tok: token, Lhs: lhs, Rhs: rhs}, nil
+		decl.Specs = append(decl.Specs, spec)
+		return decl, nil
+	}
+
+	parser.skip()
+	for parser.peek().Kind != TOKEN_RPAREN {
+		if parser.peek().Kind == TOKEN_EOF {
+			return nil, errorAt(parser.peek(), "syntax error: unexpected EOF, expecting )")
+		}
+		spec, err := parser.typeSpec()
+		if err == nil {
+			// The spec is kept even if the separator after it is missing, since its names are already declared.
+			decl.Specs = append(decl.Specs, spec)
+			if parser.peek().Kind != TOKEN_RPAREN {
+				err = parser.consumeString(";")
+			}
+		}
+		if err != nil {
+			parser.diagnostics.Add(err)
+			parser.synchronizeSpec()
+		}
+	}
+	parser.skip()
+	return decl, nil
+}
+
+// typeSpec parses a type spec, which defines a new type with the underlying type of the type following the name.
+func (parser *parser) typeSpec() (*TypeSpec, error) {
+	name := parser.peek()
+	if name.Kind != TOKEN_IDENTIFIER {
+		return nil, errorAt(name, "syntax error: unexpected %s, expecting name", name.String())
+	}
+	parser.skip()
+	ty, err := parser.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if ty == nil {
+		return nil, errorAt(parser.peek(), "syntax error: unexpected %s, expecting type", parser.peek().String())
+	}
+	spec := &TypeSpec{tok: name, Name: name.Value, Ty: parser.declareType(name)}
+	spec.Ty.Underlying = ty
+	return spec, nil
+}
+
+// declareType declares the type named `name` in the package, and returns the type to be defined.
+// If the name has been referred to before, the type registered then is declared.
+func (parser *parser) declareType(name *Token) *Type {
+	if _, ok := parser.forwardTypes[name.Value]; ok {
+		delete(parser.forwardTypes, name.Value)
+		return parser.globalScope.types[name.Value]
+	}
+	ty := &Type{Id: TypeIdUnresolved, Name: name.Value}
+	if name.Value != "_" && !parser.redeclared(parser.globalScope, name) {
+		parser.globalScope.InsertType(name.Value, ty)
+	}
+	return ty
+}
+
+// resolveTypes is the resolution pass following parsing. It reports the type names which have never been declared,
+// and resolves the underlying type of every defined type, reporting invalid recursive types.
+func (parser *parser) resolveTypes(ast *Ast) {
+	for name, token := range parser.forwardTypes {
+		if parser.globalScope.ExistsExpr(name) {
+			parser.diagnostics.Add(errorAt(token, "%s is not a type", name))
+		} else {
+			parser.diagnostics.Add(errorAt(token, "undefined: %s", name))
+		}
+	}
+	specs := map[*Type]*TypeSpec{}
+	for _, decl := range ast.types {
+		for _, spec := range decl.Specs {
+			specs[spec.Ty] = spec
+		}
+	}
+	for _, decl := range ast.types {
+		for _, spec := range decl.Specs {
+			parser.resolveUnderlying(spec.Ty, nil, specs)
+		}
+	}
+	for _, ty := range parser.literals {
+		parser.resolveUnderlying(ty, nil, specs)
+	}
+	for _, ty := range parser.literals {
+		ty.Name = literalName(ty)
+	}
+}
+
+// importPackage resolves the package imported by `spec`, and makes it available by its name in the current file.
+func (parser *parser) importPackage(spec *ImportSpec) {
+	if parser.importer == nil {
+		parser.diagnostics.Add(errorAt(spec.token(), "could not import %s (package not found)", strconv.Quote(spec.Path)))
+	} else if imported, err := parser.importer(spec); err != nil {
+		parser.diagnostics.Add(err)
+	} else {
+		spec.Package = imported
+	}
+	name := spec.name()
+	if name == "_" {
+		return
+	}
+	if _, ok := parser.imports[name]; ok {
+		parser.diagnostics.Add(errorAt(spec.token(), "%s redeclared in this block", name))
+		return
+	}
+	parser.imports[name] = spec
+}
+
+// importNamed returns the import of the package named `name` in the current file, unless a local declaration hides it.
+func (parser *parser) importNamed(name string) *ImportSpec {
+	for scope := parser.localScope; scope != nil && scope != parser.globalScope; scope = scope.outer {
+		if scope.ExistsExprInCurrentScope(name) {
+			return nil
+		}
+	}
+	return parser.imports[name]
+}
+
+// qualifiedIdentifier parses the dot and the name following the package name of a qualified identifier, and returns the name.
+func (parser *parser) qualifiedIdentifier() (*Token, error) {
+	if err := parser.consumeString("."); err != nil {
+		return nil, err
+	}
+	name := parser.peek()
+	if name.Kind != TOKEN_IDENTIFIER {
+		return nil, errorAt(name, "syntax error: unexpected %s, expecting name", name.String())
+	}
+	parser.skip()
+	return name, nil
+}
+
+// qualifiedType parses the rest of a type name qualified with the package imported by `spec`.
+func (parser *parser) qualifiedType(spec *ImportSpec) (*Type, error) {
+	name, err := parser.qualifiedIdentifier()
+	if err != nil {
+		return nil, err
+	}
+	return parser.importedType(spec, name)
+}
+
+// importedType returns the type `name` in the package imported by `spec`.
+func (parser *parser) importedType(spec *ImportSpec, name *Token) (*Type, error) {
+	if spec.Package == nil {
+		return &TypeInvalid, nil
+	}
+	_, ty, err := lookupImported(spec, name)
+	if err != nil {
+		return nil, err
+	}
+	if ty == nil {
+		return nil, errorAt(name, "%s is not a type", qualifiedName(spec, name.Value))
+	}
+	return ty, nil
+}
+
+// resolveUnderlying determines the underlying type of defined type `ty`, following the types in the declarations.
+// A struct is laid out after the types of its fields, and an array after its length and the type of its elements, since they contain them.
+// A pointer and a slice do not contain the types they point to, which can be the type being resolved as in `type Node struct{ next *Node }`.
+// `path` is the defined types being resolved which depend on `ty`, and reaching one of them again is a cycle.
+// The types in a cycle and the ones depending on them are invalid.
+func (parser *parser) resolveUnderlying(ty *Type, path []*Type, specs map[*Type]*TypeSpec) {
+	if ty.isStruct() && !ty.isDefined() && !parser.laidOut[ty] {
+		parser.laidOut[ty] = true
+		for _, field := range ty.Fields {
+			parser.resolveUnderlying(field.Ty, path, specs)
+		}
+		ty.layOut()
+		return
+	}
+	if ty.isArray() && !ty.isDefined() && !parser.laidOut[ty] {
+		parser.laidOut[ty] = true
+		if length, ok := parser.lengths[ty]; ok {
+			parser.evaluateLength(ty, length)
+		}
+		parser.resolveUnderlying(ty.Elem, path, specs)
+		ty.layOutArray()
+		return
+	}
+	if !ty.isDefined() || !ty.isUnresolved() {
+		return
+	}
+	for i, other := range path {
+		if other == ty {
+			parser.reportCycle(path[i:], specs)
+			for _, member := range path[i:] {
+				member.Id, member.Underlying = TypeIdInvalid, &TypeInvalid
+			}
+			return
+		}
+	}
+	parser.resolveUnderlying(ty.Underlying, append(path, ty), specs)
+	if !ty.isUnresolved() {
+		// It has been made invalid as a part of a cycle.
+		return
+	}
+	underlying := ty.Underlying
+	if underlying.isDefined() {
+		underlying = underlying.Underlying
+	}
+	if underlying.isUnresolved() {
+		// The type is undefined, which has been reported.
+		underlying = &TypeInvalid
+	}
+	ty.Id, ty.Size, ty.Fields, ty.Elem, ty.Len, ty.Underlying = underlying.Id, underlying.Size, underlying.Fields, underlying.Elem, underlying.Len, underlying
+}
+
+// arrayLength is the length of an array type in the source, which is evaluated in the scope where the type appears.
+type arrayLength struct {
+	expr  Expr
+	scope *Scope
+}
+
+// evaluateLength evaluates the length of array `ty`, which has to be a constant representable by int and not negative.
+// The array is invalid if it is not.
+func (parser *parser) evaluateLength(ty *Type, length *arrayLength) {
+	if identifier, ok := length.expr.(*Identifier); ok && identifier.Import == nil && !isDeclaredBefore(identifier, length.scope) {
+		parser.diagnostics.Add(errorAt(identifier.token(), "undefined array length %s or missing type constraint", identifier.Name))
+		ty.Id = TypeIdInvalid
+		return
+	}
+	if refersToVariable(length.expr, length.scope) {
+		// The variable is not checked yet, and the length is not constant anyway.
+		parser.diagnostics.Add(errorAt(length.expr.token(), "invalid array length %s", exprString(length.expr)))
+		ty.Id = TypeIdInvalid
+		return
+	}
+	resolveLocalConstants(length.expr, length.scope, &parser.diagnostics, map[*Constant]bool{})
+	lengthType := InferTypeForNode(length.expr, length.scope, &parser.diagnostics)
+	value := constantOf(length.expr)
+	switch {
+	case lengthType.isInvalid():
+	case value == nil:
+		parser.diagnostics.Add(errorAt(length.expr.token(), "invalid array length %s", exprString(length.expr)))
+	case value.Int == nil:
+		parser.diagnostics.Add(errorAt(length.expr.token(), "array length %s must be integer", describeOperand(length.expr, lengthType)))
+	case value.Int.Sign() < 0 || !TypeInt.representable(value.Int):
+		parser.diagnostics.Add(errorAt(length.expr.token(), "invalid array length %s", describeOperand(length.expr, lengthType)))
 	default:
-		return lhs, nil
+		ty.Len = int(value.Int.Int64())
+		return
 	}
+	ty.Id = TypeIdInvalid
 }
 
+// resolveLocalConstants evaluates the local constants which `expr` refers to, and the ones which their values refer to in turn.
+// The type checker evaluates a local constant only when it reaches the declaration, which is too late for the length of an array.
+// `visited` stops a constant referring to itself, which is an outer one of the same name.
+func resolveLocalConstants(expr Expr, scope *Scope, diagnostics *Diagnostics, visited map[*Constant]bool) {
+	walk(expr, func(node Expr) {
+		identifier, ok := node.(*Identifier)
+		if !ok || identifier.Import != nil {
+			return
+		}
+		declared, _ := scope.GetExpr(identifier.Name)
+		constant, ok := declared.(*Constant)
+		if !ok || visited[constant] || !constant.Ty.isUnresolved() || constant.Spec.Scope.outer == nil ||
+			!constant.token().pos.isBefore(identifier.token().pos) {
+			return
+		}
+		visited[constant] = true
+		for _, value := range constant.Spec.Values {
+			resolveLocalConstants(value, constant.Spec.Scope, diagnostics, visited)
+		}
+		inferConstant(constant, diagnostics)
+	})
+}
+
+// isDeclaredBefore reports whether `identifier` refers to a declaration in `scope`, which precedes it if it is local.
+func isDeclaredBefore(identifier *Identifier, scope *Scope) bool {
+	for ; scope != nil; scope = scope.outer {
+		if declared, ok := scope.exprs[identifier.Name]; ok {
+			if scope.outer == nil || declared.token() == nil || declared.token().pos.isBefore(identifier.token().pos) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// refersToVariable reports whether `expr` refers to a variable in `scope`.
+func refersToVariable(expr Expr, scope *Scope) bool {
+	refers := false
+	walk(expr, func(node Expr) {
+		if identifier, ok := node.(*Identifier); ok && identifier.Import == nil {
+			declared, _ := scope.GetExpr(identifier.Name)
+			_, isVariable := declared.(*Variable)
+			refers = refers || isVariable
+		}
+	})
+	return refers
+}
+
+// reportCycle reports the types in `cycle`, each of which is defined with the next one, and the last with the first.
+// The error is reported at the earliest declaration among them in the same way as gc.
+func (parser *parser) reportCycle(cycle []*Type, specs map[*Type]*TypeSpec) {
+	first := 0
+	for i, ty := range cycle {
+		if specs[ty].tok.pos.isBefore(specs[cycle[first]].tok.pos) {
+			first = i
+		}
+	}
+	cycle = append(cycle[first:len(cycle):len(cycle)], cycle[:first]...)
+	start := specs[cycle[0]].tok
+	if len(cycle) == 1 {
+		parser.diagnostics.Add(errorAt(start, "invalid recursive type: %s refers to itself", start.Value))
+		return
+	}
+	message := "invalid recursive type " + start.Value
+	for i, ty := range cycle {
+		next := cycle[(i+1)%len(cycle)]
+		message += fmt.Sprintf("\n\t%s: %s refers to %s", location(specs[ty].tok), ty.Name, next.Name)
+	}
+	parser.diagnostics.Add(errorAt(start, "%s", message))
+}
+
+// constSpecValues parses the optional type and the values of a const spec following its names.
+func (parser *parser) constSpecValues(spec *ConstSpec) error {
+	if parser.peek().Kind != TOKEN_ASSIGN {
+		ty, err := parser.parseType()
+		if err != nil {
+			return err
+		}
+		spec.Type = ty
+	}
+	if err := parser.consumeString("="); err != nil {
+		return err
+	}
+
+	outer := parser.iota
+	parser.iota = spec.Iota
+	defer func() { parser.iota = outer }()
+	spec.Values = []Expr{}
+	for {
+		value, err := parser.expr()
+		if err != nil {
+			return err
+		}
+		spec.Values = append(spec.Values, value)
+		if parser.peek().Kind != TOKEN_COMMA {
+			return nil
+		}
+		parser.skip()
+	}
+}
+
+// varDecl parses a var declaration, which is either a single spec or a group of specs in parentheses.
+func (parser *parser) varDecl() (*VarDecl, error) {
+	tokenVar, err := parser.expectString("var")
+	if err != nil {
+		return nil, err
+	}
+	decl := &VarDecl{tok: tokenVar}
+	if parser.peek().Kind != TOKEN_LPAREN {
+		spec, err := parser.varSpec()
+		if err != nil {
+			return nil, err
+		}
+		decl.Specs = append(decl.Specs, spec)
+		return decl, nil
+	}
+
+	parser.skip()
+	for parser.peek().Kind != TOKEN_RPAREN {
+		if parser.peek().Kind == TOKEN_EOF {
+			return nil, errorAt(parser.peek(), "syntax error: unexpected EOF, expecting )")
+		}
+		spec, err := parser.varSpec()
+		if err == nil {
+			decl.Specs = append(decl.Specs, spec)
+			if parser.peek().Kind != TOKEN_RPAREN {
+				err = parser.consumeString(";")
+			}
+		}
+		if err != nil {
+			parser.diagnostics.Add(err)
+			parser.synchronizeSpec()
+		}
+	}
+	parser.skip()
+	return decl, nil
+}
+
+// varSpec parses a var spec. The variables are declared after the values, which cannot refer to them.
+func (parser *parser) varSpec() (*VarSpec, error) {
+	spec := &VarSpec{tok: parser.peek(), Scope: parser.currentScope()}
+	for {
+		token := parser.peek()
+		if token.Kind != TOKEN_IDENTIFIER {
+			return nil, errorAt(token, "syntax error: unexpected %s, expecting name", token.String())
+		}
+		parser.skip()
+		variable := &Variable{tok: token, Name: token.Value, Ty: &TypeUnresolved, Spec: spec, Global: parser.localScope == nil}
+		spec.Names = append(spec.Names, variable)
+		if parser.peek().Kind != TOKEN_COMMA {
+			break
+		}
+		parser.skip()
+	}
+
+	if parser.peek().Kind != TOKEN_ASSIGN {
+		ty, err := parser.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if ty == nil {
+			return nil, errorAt(parser.peek(), "syntax error: unexpected %s, expecting type", parser.peek().String())
+		}
+		spec.Type = ty
+	}
+	if parser.peek().Kind == TOKEN_ASSIGN {
+		parser.skip()
+		for {
+			value, err := parser.expr()
+			if err != nil {
+				return nil, err
+			}
+			spec.Values = append(spec.Values, value)
+			if parser.peek().Kind != TOKEN_COMMA {
+				break
+			}
+			parser.skip()
+		}
+	}
+
+	for _, variable := range spec.Names {
+		parser.declare(variable.token(), variable)
+	}
+	return spec, nil
+}
+
+// synchronizeSpec skips the rest of a const or var spec where a syntax error is found, stopping at the `)` closing the group.
+func (parser *parser) synchronizeSpec() {
+	for {
+		switch parser.peek().Kind {
+		case TOKEN_EOF, TOKEN_RPAREN:
+			return
+		case TOKEN_SEMICOLON:
+			parser.skip()
+			return
+		}
+		parser.skip()
+	}
+}
+
+// shortVarDecl parses the rest of a short variable declaration whose operands on the left `lhs` have already been parsed.
+// It declares the names on the left which are new in the current scope. The others are only assigned, but at least one of them must be new.
+func (parser *parser) shortVarDecl(lhs []Expr) (Expr, error) {
+	tokenDefine := parser.peek()
+	declared, err := parser.declareVariables(lhs, tokenDefine)
+	if err != nil {
+		return nil, err
+	}
+
+	parser.skip()
+	rhs, err := parser.exprList()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Assign{tok: tokenDefine, Lhs: declared, Rhs: rhs}, nil
+}
+
+// declareVariables declares the new names in `lhs` on the left of `:=`, and returns the `*Variable`s declared in place of them.
+// It is an error at `position` if none of them is new.
+func (parser *parser) declareVariables(lhs []Expr, position *Token) ([]Expr, error) {
+	for _, expr := range lhs {
+		if _, ok := expr.(*Identifier); !ok {
+			err := errorAt(expr.token(), "syntax error: unexpected %s, expecting variable", expr.token().String())
+			return nil, err
+		}
+	}
+
+	declared := make([]Expr, len(lhs))
+	names := map[string]bool{}
+	hasNew := false
+	for i, expr := range lhs {
+		name := expr.(*Identifier).Name
+		declared[i] = expr
+		if name != "_" && names[name] {
+			parser.diagnostics.Add(errorAt(expr.token(), "%s repeated on left side of :=", name))
+			continue
+		}
+		names[name] = true
+		if name == "_" || parser.localScope.ExistsExprInCurrentScope(name) {
+			continue
+		}
+		variable := &Variable{tok: expr.token(), Name: name, Ty: &TypeUnresolved}
+		parser.localScope.InsertExpr(name, variable)
+		declared[i] = variable
+		hasNew = true
+	}
+	if !hasNew {
+		parser.diagnostics.Add(errorAt(position, "no new variables on left side of :="))
+	}
+	return declared, nil
+}
+
+func (parser *parser) expr() (Expr, error) {
+	return parser.binaryExpr(1)
+}
+
+// binaryPrecedence returns the precedence of a binary operator, or 0 if `kind` is not a binary operator.
+// Refer to this page for the rule: https://go.dev/ref/spec#Operator_precedence
+func binaryPrecedence(kind TokenKind) int {
+	switch kind {
+	case TOKEN_STAR, TOKEN_SLASH, TOKEN_PERCENT, TOKEN_SHL, TOKEN_SHR, TOKEN_AMP, TOKEN_AMPCARET:
+		return 5
+	case TOKEN_PLUS, TOKEN_MINUS, TOKEN_PIPE, TOKEN_CARET:
+		return 4
+	case TOKEN_EQ, TOKEN_NE, TOKEN_LT, TOKEN_LE, TOKEN_GT, TOKEN_GE:
+		return 3
+	case TOKEN_ANDAND:
+		return 2
+	case TOKEN_OROR:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// binaryExpr parses a binary expression whose operators have precedence `precedence` or higher.
+// Operators of the same precedence associate to the left.
+func (parser *parser) binaryExpr(precedence int) (Expr, error) {
+	lhs, err := parser.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token := parser.peek()
+		opPrecedence := binaryPrecedence(token.Kind)
+		if opPrecedence < precedence {
+			return lhs, nil
+		}
+		parser.skip()
+		rhs, err := parser.binaryExpr(opPrecedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryOp{tok: token, Op: token.Kind, Lhs: lhs, Rhs: rhs}
+	}
+}
+
+func (parser *parser) unaryExpr() (Expr, error) {
+	token := parser.peek()
+	switch token.Kind {
+	case TOKEN_PLUS, TOKEN_MINUS, TOKEN_NOT, TOKEN_CARET, TOKEN_AMP, TOKEN_STAR:
+		parser.skip()
+		operand, err := parser.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryOp{tok: token, Op: token.Kind, Operand: operand}, nil
+	default:
+		return parser.primaryExpr()
+	}
+}
+
+// primaryExpr parses an operand followed by selectors of fields, indices and slicing.
 func (parser *parser) primaryExpr() (Expr, error) {
+	operand, err := parser.operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch parser.peek().Kind {
+		case TOKEN_DOT:
+			parser.skip()
+			name := parser.peek()
+			if name.Kind != TOKEN_IDENTIFIER {
+				return nil, errorAt(name, "syntax error: unexpected %s, expecting name", name.String())
+			}
+			parser.skip()
+			operand = &Selector{tok: operand.token(), X: operand, Sel: name}
+		case TOKEN_LBRACK:
+			if operand, err = parser.indexOrSlice(operand); err != nil {
+				return nil, err
+			}
+		default:
+			return operand, nil
+		}
+	}
+}
+
+// indexOrSlice parses an index `[i]` or slicing `[low:high:max]` of `x`. The indices of slicing are optional, except that
+// a 3-index slice requires the last two.
+func (parser *parser) indexOrSlice(x Expr) (Expr, error) {
+	lbrack, err := parser.expectString("[")
+	if err != nil {
+		return nil, err
+	}
+	inHeader := parser.inHeader
+	parser.inHeader = false
+	defer func() { parser.inHeader = inHeader }()
+	var indices [3]Expr
+	if parser.peek().Kind != TOKEN_COLON {
+		if indices[0], err = parser.expr(); err != nil {
+			return nil, err
+		}
+		if parser.peek().Kind != TOKEN_COLON {
+			if err := parser.consumeString("]"); err != nil {
+				return nil, err
+			}
+			return &Index{tok: x.token(), X: x, Index: indices[0], lbrack: lbrack}, nil
+		}
+	}
+	colons := 0
+	for parser.peek().Kind == TOKEN_COLON && colons < 2 {
+		colon := parser.peek()
+		parser.skip()
+		colons++
+		if colons == 2 && indices[1] == nil {
+			parser.diagnostics.Add(errorAt(colon, "middle index required in 3-index slice"))
+		}
+		if kind := parser.peek().Kind; kind != TOKEN_COLON && kind != TOKEN_RBRACK {
+			if indices[colons], err = parser.expr(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if colons == 2 && indices[2] == nil {
+		parser.diagnostics.Add(errorAt(parser.peek(), "final index required in 3-index slice"))
+	}
+	if err := parser.consumeString("]"); err != nil {
+		return nil, err
+	}
+	return &SliceExpr{tok: x.token(), X: x, Low: indices[0], High: indices[1], Max: indices[2], lbrack: lbrack}, nil
+}
+
+func (parser *parser) operand() (Expr, error) {
 	token := parser.peek()
 	switch token.Kind {
+	case TOKEN_LPAREN:
+		parser.skip()
+		inHeader := parser.inHeader
+		parser.inHeader = false
+		node, err := parser.expr()
+		parser.inHeader = inHeader
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.consumeString(")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case TOKEN_STRUCT:
+		ty, err := parser.structType()
+		if err != nil {
+			return nil, err
+		}
+		if parser.peek().Kind != TOKEN_LBRACE {
+			return nil, errorAt(parser.peek(), "syntax error: unexpected %s, expecting {", parser.peek().String())
+		}
+		return parser.compositeLiteral(token, ty)
+	case TOKEN_LBRACK:
+		// The length of an array literal can be `...`, which is the number of the elements.
+		ty, err := parser.arrayOrSliceType()
+		if err != nil {
+			return nil, err
+		}
+		if parser.peek().Kind != TOKEN_LBRACE {
+			if ty.isArray() && ty.Len < 0 {
+				return nil, errorAt(token, "invalid use of [...] array (outside a composite literal)")
+			}
+			return nil, errorAt(parser.peek(), "conversion to %s is not supported", ty.Name)
+		}
+		literal, err := parser.compositeLiteral(token, ty)
+		if err != nil {
+			return nil, err
+		}
+		literal.(*CompositeLit).ellipsis = ty.Len < 0
+		return literal, nil
 	case TOKEN_INT:
 		parser.skip()
 		return &IntLiteral{tok: token, Value: token.Value}, nil
+	case TOKEN_STRING:
+		parser.skip()
+		// The literal is valid, which the tokenizer ensures.
+		value, _ := strconv.Unquote(token.Value)
+		return &StringLiteral{tok: token, Value: value}, nil
 	case TOKEN_IDENTIFIER:
 		parser.skip()
 		if token.Value == "true" {
 			return &BoolLiteral{tok: token, Value: true}, nil
 		} else if token.Value == "false" {
 			return &BoolLiteral{tok: token, Value: false}, nil
+		} else if token.Value == "nil" {
+			return &NilLiteral{tok: token}, nil
 		}
 
+		if spec := parser.importNamed(token.Value); spec != nil && parser.peek().Kind == TOKEN_DOT {
+			name, err := parser.qualifiedIdentifier()
+			if err != nil {
+				return nil, err
+			}
+			if parser.peek().Kind == TOKEN_LPAREN {
+				call, err := parser.functionCall(name)
+				if err != nil {
+					return nil, err
+				}
+				call.(*FunctionCall).Import = spec
+				return call, nil
+			}
+			if parser.peek().Kind == TOKEN_LBRACE && !parser.inHeader {
+				ty, err := parser.importedType(spec, name)
+				if err != nil {
+					return nil, err
+				}
+				return parser.compositeLiteral(token, ty)
+			}
+			return &Identifier{tok: name, Name: name.Value, Import: spec}, nil
+		}
 		if parser.peek().Kind == TOKEN_LPAREN {
 			return parser.functionCall(token)
 		}
+		if parser.peek().Kind == TOKEN_LBRACE && !parser.inHeader {
+			return parser.compositeLiteral(token, parser.typeNamed(token))
+		}
+		if token.Value == "iota" && parser.iota >= 0 && !parser.currentScope().ExistsExpr("iota") {
+			return &Iota{tok: token, Value: parser.iota}, nil
+		}
 
 		return &Identifier{tok: token, Name: token.Value}, nil
 	}
-	return nil, fmt.Errorf("%s: unexpected %s, expecting primary expression", token.pos.toString(), token.Value)
+	return nil, errorAt(token, "syntax error: unexpected %s, expecting primary expression", token.String())
 }
 
+// compositeLiteral parses the elements of a composite literal of `ty`, which begins with `token`.
+func (parser *parser) compositeLiteral(token *Token, ty *Type) (Expr, error) {
+	lbrace, err := parser.expectString("{")
+	if err != nil {
+		return nil, err
+	}
+	inHeader := parser.inHeader
+	parser.inHeader = false
+	defer func() { parser.inHeader = inHeader }()
+	literal := &CompositeLit{tok: token, Type: ty, lbrace: lbrace}
+	for parser.peek().Kind != TOKEN_RBRACE {
+		value, err := parser.elementValue()
+		if err != nil {
+			return nil, err
+		}
+		element := &Element{Value: value}
+		if parser.peek().Kind == TOKEN_COLON {
+			parser.skip()
+			element.Key = value
+			if element.Value, err = parser.elementValue(); err != nil {
+				return nil, err
+			}
+		}
+		literal.Elements = append(literal.Elements, element)
+		if parser.peek().Kind == TOKEN_RBRACE {
+			break
+		}
+		if parser.peek().Kind != TOKEN_COMMA {
+			return nil, errorAt(parser.peek(), "syntax error: unexpected %s in composite literal; possibly missing comma or }", parser.peek().String())
+		}
+		parser.skip()
+	}
+	literal.rbrace = parser.peek()
+	parser.skip()
+	return literal, nil
+}
+
+// elementValue parses an element of a composite literal, which can be a composite literal without the type as in `[][]int{{1}}`.
+// The type checker gives it the element type.
+func (parser *parser) elementValue() (Expr, error) {
+	if token := parser.peek(); token.Kind == TOKEN_LBRACE {
+		literal, err := parser.compositeLiteral(token, nil)
+		if err != nil {
+			return nil, err
+		}
+		literal.(*CompositeLit).elided = true
+		return literal, nil
+	}
+	return parser.expr()
+}
+
+// functionCall parses the arguments of a call of the function named `token`.
+// The builtins new and make take a type as their first argument, unless a declaration hides them.
+// The last argument can be followed by `...`, which passes a slice to append.
 func (parser *parser) functionCall(token *Token) (Expr, error) {
-	if err := parser.consumeString("("); err != nil {
+	lparen, err := parser.expectString("(")
+	if err != nil {
 		return nil, err
 	}
+	inHeader := parser.inHeader
+	parser.inHeader = false
+	defer func() { parser.inHeader = inHeader }()
+	call := &FunctionCall{tok: token, lparen: lparen}
 	arguments := []Expr{}
-	if parser.peek().Kind != TOKEN_RPAREN {
-		if argument, err := parser.addOp(); err != nil {
+	declared, _ := parser.currentScope().GetExpr(token.Value)
+	if _, ok := declared.(*Builtin); ok && (token.Value == "new" || token.Value == "make") && parser.peek().Kind != TOKEN_RPAREN {
+		call.typeTok = parser.peek()
+		ty, err := parser.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if ty == nil {
+			return nil, errorAt(parser.peek(), "syntax error: unexpected %s, expecting type", parser.peek().String())
+		}
+		call.TypeArgument = ty
+		for parser.peek().Kind == TOKEN_COMMA {
+			parser.skip()
+			argument, err := parser.expr()
+			if err != nil {
+				return nil, err
+			}
+			arguments = append(arguments, argument)
+		}
+	} else if parser.peek().Kind != TOKEN_RPAREN {
+		if argument, err := parser.expr(); err != nil {
 			return nil, err
 		} else {
 			arguments = append(arguments, argument)
 		}
 		for {
+			if parser.peek().Kind == TOKEN_ELLIPSIS {
+				parser.skip()
+				call.Ellipsis = true
+				if parser.peek().Kind == TOKEN_COMMA {
+					parser.skip()
+				}
+				break
+			}
 			if parser.peek().Kind == TOKEN_RPAREN {
 				break
 			}
 			if err := parser.consumeString(","); err != nil {
 				return nil, err
 			}
-			if argument, err := parser.addOp(); err != nil {
+			if argument, err := parser.expr(); err != nil {
 				return nil, err
 			} else {
 				arguments = append(arguments, argument)
@@ -341,5 +2033,6 @@ func (parser *parser) functionCall(token *Token) (Expr, error) {
 	if err := parser.consumeString(")"); err != nil {
 		return nil, err
 	}
-	return &FunctionCall{tok: token, Arguments: arguments}, nil
+	call.Arguments = arguments
+	return call, nil
 }
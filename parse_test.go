@@ -1,6 +1,7 @@
 package main
 
 import (
+	"sort"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -12,18 +13,38 @@ var opts = []cmp.Option{
 	cmpopts.IgnoreUnexported(Token{}),
 	cmpopts.IgnoreUnexported(FunctionDecl{}),
 	cmpopts.IgnoreUnexported(Block{}),
+	cmpopts.IgnoreFields(Block{}, "Scope"),
 	cmpopts.IgnoreUnexported(Return{}),
+	cmpopts.IgnoreUnexported(If{}),
+	cmpopts.IgnoreUnexported(For{}),
+	cmpopts.IgnoreFields(For{}, "Scope"),
+	cmpopts.IgnoreUnexported(Break{}),
+	cmpopts.IgnoreUnexported(Continue{}),
 	cmpopts.IgnoreUnexported(Assign{}),
-	cmpopts.IgnoreUnexported(AddOp{}),
+	cmpopts.IgnoreUnexported(AssignStmt{}),
+	cmpopts.IgnoreUnexported(IncDec{}),
+	cmpopts.IgnoreUnexported(BinaryOp{}),
+	cmpopts.IgnoreUnexported(UnaryOp{}),
 	cmpopts.IgnoreUnexported(Variable{}),
 	cmpopts.IgnoreUnexported(Identifier{}),
 	cmpopts.IgnoreUnexported(IntLiteral{}),
 	cmpopts.IgnoreUnexported(BoolLiteral{}),
+	cmpopts.IgnoreUnexported(StringLiteral{}),
 	cmpopts.IgnoreUnexported(FunctionCall{}),
+	cmpopts.IgnoreUnexported(ConstDecl{}),
+	cmpopts.IgnoreUnexported(ConstSpec{}),
+	cmpopts.IgnoreFields(ConstSpec{}, "Scope"),
+	cmpopts.IgnoreUnexported(Constant{}),
+	cmpopts.IgnoreFields(Constant{}, "Spec"),
+	cmpopts.IgnoreUnexported(Iota{}),
+	cmpopts.IgnoreUnexported(VarDecl{}),
+	cmpopts.IgnoreUnexported(VarSpec{}),
+	cmpopts.IgnoreFields(VarSpec{}, "Scope"),
+	cmpopts.IgnoreFields(Variable{}, "Spec"),
 }
 
 func TestFuncDef(t *testing.T) {
-	stream := NewByteStream("func main(){\nabc := 3\nreturn abc\n}\n")
+	stream := NewByteStream("package main\nfunc main(){\nabc := 3\nreturn abc\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -32,10 +53,10 @@ func TestFuncDef(t *testing.T) {
 		&Block{
 			Body: []Expr{
 				&Assign{
-					Lhs: &Variable{Name: "abc", Offset: 0, Ty: &TypeUnresolved},
-					Rhs: &IntLiteral{Value: "3"},
+					Lhs: []Expr{&Variable{Name: "abc", Offset: 0, Ty: &TypeUnresolved}},
+					Rhs: []Expr{&IntLiteral{Value: "3"}},
 				},
-				&Return{Node: &Identifier{Name: "abc", Variable: nil}},
+				&Return{Values: []Expr{&Identifier{Name: "abc", Variable: nil}}},
 			},
 		},
 		ast.funcs[0].Body,
@@ -47,7 +68,7 @@ func TestFuncDef(t *testing.T) {
 }
 
 func TestCallFunctionWithoutArgument(t *testing.T) {
-	stream := NewByteStream("func main() int{\n x := f()\nreturn x\n}\nfunc f() int {\nreturn 3\n}\n")
+	stream := NewByteStream("package main\nfunc main() int{\n x := f()\nreturn x\n}\nfunc f() int {\nreturn 3\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -56,10 +77,10 @@ func TestCallFunctionWithoutArgument(t *testing.T) {
 		&Block{
 			Body: []Expr{
 				&Assign{
-					Lhs: &Variable{Name: "x", Offset: 0, Ty: &TypeUnresolved},
-					Rhs: &FunctionCall{Arguments: []Expr{}},
+					Lhs: []Expr{&Variable{Name: "x", Offset: 0, Ty: &TypeUnresolved}},
+					Rhs: []Expr{&FunctionCall{Arguments: []Expr{}}},
 				},
-				&Return{Node: &Identifier{Name: "x"}},
+				&Return{Values: []Expr{&Identifier{Name: "x"}}},
 			},
 		},
 		ast.funcs[0].Body,
@@ -73,7 +94,7 @@ func TestCallFunctionWithoutArgument(t *testing.T) {
 	d = cmp.Diff(
 		&Block{
 			Body: []Expr{
-				&Return{Node: &IntLiteral{Value: "3"}},
+				&Return{Values: []Expr{&IntLiteral{Value: "3"}}},
 			},
 		},
 		ast.funcs[1].Body,
@@ -85,7 +106,7 @@ func TestCallFunctionWithoutArgument(t *testing.T) {
 }
 
 func TestFuncReturnType(t *testing.T) {
-	stream := NewByteStream("func f() int {\nreturn 3\n}\n")
+	stream := NewByteStream("package main\nfunc f() int {\nreturn 3\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -93,7 +114,7 @@ func TestFuncReturnType(t *testing.T) {
 	if d := cmp.Diff(
 		&Block{
 			Body: []Expr{
-				&Return{Node: &IntLiteral{Value: "3"}},
+				&Return{Values: []Expr{&IntLiteral{Value: "3"}}},
 			},
 		},
 		ast.funcs[0].Body,
@@ -104,7 +125,7 @@ func TestFuncReturnType(t *testing.T) {
 }
 
 func TestFunctionWithOneArgument(t *testing.T) {
-	stream := NewByteStream("func f(a int) int {\nreturn a\n}\n")
+	stream := NewByteStream("package main\nfunc f(a int) int {\nreturn a\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -122,7 +143,7 @@ func TestFunctionWithOneArgument(t *testing.T) {
 	if d := cmp.Diff(
 		&Block{
 			Body: []Expr{
-				&Return{Node: &Identifier{Name: "a"}},
+				&Return{Values: []Expr{&Identifier{Name: "a"}}},
 			},
 		},
 		ast.funcs[0].Body,
@@ -133,7 +154,7 @@ func TestFunctionWithOneArgument(t *testing.T) {
 }
 
 func TestFunctionWithArguments(t *testing.T) {
-	stream := NewByteStream("func f(a int, b int) int {\nreturn a + b\n}\n")
+	stream := NewByteStream("package main\nfunc f(a int, b int) int {\nreturn a + b\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -153,10 +174,11 @@ func TestFunctionWithArguments(t *testing.T) {
 		&Block{
 			Body: []Expr{
 				&Return{
-					Node: &AddOp{
+					Values: []Expr{&BinaryOp{
+						Op:  TOKEN_PLUS,
 						Lhs: &Identifier{Name: "a"},
 						Rhs: &Identifier{Name: "b"},
-					},
+					}},
 				},
 			},
 		},
@@ -168,7 +190,7 @@ func TestFunctionWithArguments(t *testing.T) {
 }
 
 func TestCallFunctionWithArgument(t *testing.T) {
-	stream := NewByteStream("func main() {\nx := f(1)\nreturn x\n}\nfunc f(a int) int {\nreturn a\n}\n")
+	stream := NewByteStream("package main\nfunc main() {\nx := f(1)\nreturn x\n}\nfunc f(a int) int {\nreturn a\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -176,14 +198,14 @@ func TestCallFunctionWithArgument(t *testing.T) {
 		&Block{
 			Body: []Expr{
 				&Assign{
-					Lhs: &Variable{Name: "x", Offset: 0, Ty: &TypeUnresolved},
-					Rhs: &FunctionCall{
+					Lhs: []Expr{&Variable{Name: "x", Offset: 0, Ty: &TypeUnresolved}},
+					Rhs: []Expr{&FunctionCall{
 						Arguments: []Expr{
 							&IntLiteral{Value: "1"},
 						},
-					},
+					}},
 				},
-				&Return{Node: &Identifier{Name: "x"}},
+				&Return{Values: []Expr{&Identifier{Name: "x"}}},
 			},
 		},
 		ast.funcs[0].Body,
@@ -194,7 +216,7 @@ func TestCallFunctionWithArgument(t *testing.T) {
 }
 
 func TestCallFunctionWithArguments(t *testing.T) {
-	stream := NewByteStream("func main() {\nx := 1\ny := f(x, 2 + 3)\nreturn y\n}\nfunc f(a int, b int) int {\nreturn a + b\n}\n")
+	stream := NewByteStream("package main\nfunc main() {\nx := 1\ny := f(x, 2 + 3)\nreturn y\n}\nfunc f(a int, b int) int {\nreturn a + b\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -202,23 +224,24 @@ func TestCallFunctionWithArguments(t *testing.T) {
 		&Block{
 			Body: []Expr{
 				&Assign{
-					Lhs: &Variable{Name: "x", Offset: 0, Ty: &TypeUnresolved},
-					Rhs: &IntLiteral{Value: "1"},
+					Lhs: []Expr{&Variable{Name: "x", Offset: 0, Ty: &TypeUnresolved}},
+					Rhs: []Expr{&IntLiteral{Value: "1"}},
 				},
 				&Assign{
-					Lhs: &Variable{Name: "y", Offset: 0, Ty: &TypeUnresolved},
-					Rhs: &FunctionCall{
+					Lhs: []Expr{&Variable{Name: "y", Offset: 0, Ty: &TypeUnresolved}},
+					Rhs: []Expr{&FunctionCall{
 						Arguments: []Expr{
 							&Identifier{Name: "x"},
-							&AddOp{
+							&BinaryOp{
+								Op:  TOKEN_PLUS,
 								Lhs: &IntLiteral{Value: "2"},
 								Rhs: &IntLiteral{Value: "3"},
 							},
 						},
-					},
+					}},
 				},
 				&Return{
-					Node: &Identifier{Name: "y"},
+					Values: []Expr{&Identifier{Name: "y"}},
 				},
 			},
 		},
@@ -230,7 +253,7 @@ func TestCallFunctionWithArguments(t *testing.T) {
 }
 
 func TestBool(t *testing.T) {
-	stream := NewByteStream("func main(){\nreturn true\n}\n")
+	stream := NewByteStream("package main\nfunc main(){\nreturn true\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -238,7 +261,7 @@ func TestBool(t *testing.T) {
 		&Block{
 			Body: []Expr{
 				&Return{
-					Node: &BoolLiteral{Value: true},
+					Values: []Expr{&BoolLiteral{Value: true}},
 				},
 			},
 		},
@@ -250,7 +273,7 @@ func TestBool(t *testing.T) {
 }
 
 func TestShortVarDeclAndAdd(t *testing.T) {
-	stream := NewByteStream("func main(){\nxy := 1 + 2 + 3\nreturn xy\n}\n")
+	stream := NewByteStream("package main\nfunc main(){\nxy := 1 + 2 + 3\nreturn xy\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -259,16 +282,18 @@ func TestShortVarDeclAndAdd(t *testing.T) {
 		&Block{
 			Body: []Expr{
 				&Assign{
-					Lhs: &Variable{Name: "xy", Offset: 0, Ty: &TypeUnresolved},
-					Rhs: &AddOp{
-						Lhs: &IntLiteral{Value: "1"},
-						Rhs: &AddOp{
-							Lhs: &IntLiteral{Value: "2"},
-							Rhs: &IntLiteral{Value: "3"},
+					Lhs: []Expr{&Variable{Name: "xy", Offset: 0, Ty: &TypeUnresolved}},
+					Rhs: []Expr{&BinaryOp{
+						Op: TOKEN_PLUS,
+						Lhs: &BinaryOp{
+							Op:  TOKEN_PLUS,
+							Lhs: &IntLiteral{Value: "1"},
+							Rhs: &IntLiteral{Value: "2"},
 						},
-					},
+						Rhs: &IntLiteral{Value: "3"},
+					}},
 				},
-				&Return{Node: &Identifier{Name: "xy"}},
+				&Return{Values: []Expr{&Identifier{Name: "xy"}}},
 			},
 		},
 		ast.funcs[0].Body,
@@ -279,15 +304,671 @@ func TestShortVarDeclAndAdd(t *testing.T) {
 }
 
 func TestLhsOfShortVarDeclIsNotIdentifier(t *testing.T) {
-	stream := NewByteStream("func main(){\n1 := 2\n}\n")
+	stream := NewByteStream("package main\nfunc main(){\n1 := 2\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	_, err := Parse(tokenStream)
 	assert.Error(t, err)
 }
 
 func TestNoNewVariableOnRhsOfShortVarDecl(t *testing.T) {
-	stream := NewByteStream("func main(){\nx := 1\nx := 2\n}\n")
+	stream := NewByteStream("package main\nfunc main(){\nx := 1\nx := 2\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, "4:3: no new variables on left side of :=")
+}
+
+func TestIfElse(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() int {\nif true {\nreturn 1\n} else if false {\nreturn 2\n} else {\nreturn 3\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	if d := cmp.Diff(
+		&Block{
+			Body: []Expr{
+				&If{
+					Cond: &BoolLiteral{Value: true},
+					Then: &Block{Body: []Expr{&Return{Values: []Expr{&IntLiteral{Value: "1"}}}}},
+					Else: &If{
+						Cond: &BoolLiteral{Value: false},
+						Then: &Block{Body: []Expr{&Return{Values: []Expr{&IntLiteral{Value: "2"}}}}},
+						Else: &Block{Body: []Expr{&Return{Values: []Expr{&IntLiteral{Value: "3"}}}}},
+					},
+				},
+			},
+		},
+		ast.funcs[0].Body,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestIfWithoutElseOnOneLine(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nif true { return }\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	if d := cmp.Diff(
+		&Block{
+			Body: []Expr{
+				&If{
+					Cond: &BoolLiteral{Value: true},
+					Then: &Block{Body: []Expr{&Return{}}},
+				},
+			},
+		},
+		ast.funcs[0].Body,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestElseFollowedByNonBlock(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nif true {\n} else return\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, "4:8: else must be followed by if or statement block")
+}
+
+func TestForClause(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nfor i := 0; true; f() {\ncontinue\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	if d := cmp.Diff(
+		&Block{
+			Body: []Expr{
+				&For{
+					Init: &Assign{
+						Lhs: []Expr{&Variable{Name: "i", Ty: &TypeUnresolved}},
+						Rhs: []Expr{&IntLiteral{Value: "0"}},
+					},
+					Cond: &BoolLiteral{Value: true},
+					Post: &FunctionCall{Arguments: []Expr{}},
+					Body: &Block{Body: []Expr{&Continue{}}},
+				},
+			},
+		},
+		ast.funcs[0].Body,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+	_, ok := ast.funcs[0].Body.Body[0].(*For).Scope.GetExpr("i")
+	assert.True(t, ok)
+	assert.False(t, ast.funcs[0].Scope.ExistsExpr("i"))
+}
+
+func TestForCondAndInfinite(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nfor true {\n}\nfor {\nbreak\n}\nfor ; ; {\nbreak\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	if d := cmp.Diff(
+		&Block{
+			Body: []Expr{
+				&For{Cond: &BoolLiteral{Value: true}, Body: &Block{}},
+				&For{Body: &Block{Body: []Expr{&Break{}}}},
+				&For{Body: &Block{Body: []Expr{&Break{}}}},
+			},
+		},
+		ast.funcs[0].Body,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestLabeledBreak(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nouter:\nfor {\nfor {\nbreak outer\n}\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	outer := ast.funcs[0].Body.Body[0].(*For)
+	assert.Equal(t, "outer", outer.Label)
+	inner := outer.Body.Body[0].(*For)
+	brk := inner.Body.Body[0].(*Break)
+	assert.Equal(t, "outer", brk.Label)
+	assert.Same(t, outer, brk.loop)
+	assert.True(t, outer.hasBreak)
+	assert.False(t, inner.hasBreak)
+}
+
+func TestBreakOutsideLoop(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nbreak\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, "3:1: break is not in a loop, switch, or select")
+}
+
+func TestInvalidContinueLabel(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nfor {\ncontinue outer\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, "4:10: invalid continue label outer")
+}
+
+func TestUnusedLabel(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nL:\nfor {\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, "3:1: label L defined and not used")
+}
+
+func TestDeclareInPostStatement(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nfor ; ; x := 1 {\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, "3:11: syntax error: cannot declare in post statement of for loop")
+}
+
+func TestBinaryOperatorPrecedence(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\n1 - 2 - 3 * 4 == 5 || a && !b\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	if d := cmp.Diff(
+		&Block{
+			Body: []Expr{
+				&BinaryOp{
+					Op: TOKEN_OROR,
+					Lhs: &BinaryOp{
+						Op: TOKEN_EQ,
+						Lhs: &BinaryOp{
+							Op: TOKEN_MINUS,
+							Lhs: &BinaryOp{
+								Op:  TOKEN_MINUS,
+								Lhs: &IntLiteral{Value: "1"},
+								Rhs: &IntLiteral{Value: "2"},
+							},
+							Rhs: &BinaryOp{
+								Op:  TOKEN_STAR,
+								Lhs: &IntLiteral{Value: "3"},
+								Rhs: &IntLiteral{Value: "4"},
+							},
+						},
+						Rhs: &IntLiteral{Value: "5"},
+					},
+					Rhs: &BinaryOp{
+						Op:  TOKEN_ANDAND,
+						Lhs: &Identifier{Name: "a"},
+						Rhs: &UnaryOp{Op: TOKEN_NOT, Operand: &Identifier{Name: "b"}},
+					},
+				},
+			},
+		},
+		ast.funcs[0].Body,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestParenthesizedAndUnary(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\n-(1 + 2) << ^3\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	if d := cmp.Diff(
+		&Block{
+			Body: []Expr{
+				&BinaryOp{
+					Op: TOKEN_SHL,
+					Lhs: &UnaryOp{
+						Op: TOKEN_MINUS,
+						Operand: &BinaryOp{
+							Op:  TOKEN_PLUS,
+							Lhs: &IntLiteral{Value: "1"},
+							Rhs: &IntLiteral{Value: "2"},
+						},
+					},
+					Rhs: &UnaryOp{Op: TOKEN_CARET, Operand: &IntLiteral{Value: "3"}},
+				},
+			},
+		},
+		ast.funcs[0].Body,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestRecoverFromSyntaxErrors(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nx := )\ny := 1\nif y {\nz := (\n}\nbreak\n}\nfunc f( {\n}\nfunc g() {\nreturn +\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `3:6: syntax error: unexpected ), expecting primary expression
+7:1: syntax error: unexpected }, expecting primary expression
+8:1: break is not in a loop, switch, or select
+10:9: syntax error: unexpected {, expected )
+14:1: syntax error: unexpected }, expecting primary expression`)
+}
+
+func TestConstDecl(t *testing.T) {
+	stream := NewByteStream("package main\nconst (\na = 1 << iota\nb\n_\nc, d int8 = iota, -iota\ne, f\n)\nconst g = \"g\"\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	shift := func(iota int) []Expr {
+		return []Expr{&BinaryOp{Op: TOKEN_SHL, Lhs: &IntLiteral{Value: "1"}, Rhs: &Iota{Value: iota}}}
+	}
+	pair := func(iota int) []Expr {
+		return []Expr{&Iota{Value: iota}, &UnaryOp{Op: TOKEN_MINUS, Operand: &Iota{Value: iota}}}
+	}
+	constants := func(names ...string) []*Constant {
+		var constants []*Constant
+		for _, name := range names {
+			constants = append(constants, &Constant{Name: name, Ty: &TypeUnresolved})
+		}
+		return constants
+	}
+	if d := cmp.Diff(
+		[]*ConstDecl{
+			{
+				Specs: []*ConstSpec{
+					{Names: constants("a"), Values: shift(0), Iota: 0},
+					{Names: constants("b"), Values: shift(1), Iota: 1},
+					{Names: constants("_"), Values: shift(2), Iota: 2},
+					{Names: constants("c", "d"), Type: &TypeInt8, Values: pair(3), Iota: 3},
+					{Names: constants("e", "f"), Type: &TypeInt8, Values: pair(4), Iota: 4},
+				},
+			},
+			{
+				Specs: []*ConstSpec{
+					{Names: constants("g"), Values: []Expr{&StringLiteral{Value: "g"}}},
+				},
+			},
+		},
+		ast.consts,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestInvalidConstDecl(t *testing.T) {
+	stream := NewByteStream("package main\nconst (\na\nb = 1\n)\nconst c\nfunc main() {\nconst b = 2\nconst b = 3\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `3:1: missing init expr for const declaration
+6:7: missing init expr for const declaration
+9:7: b redeclared in this block`)
+}
+
+func TestVarDecl(t *testing.T) {
+	stream := NewByteStream("package main\nvar (\na int\nb, c = 1, \"c\"\n)\nfunc main() {\nvar d uint8 = 2\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	global := func(name string) *Variable {
+		return &Variable{Name: name, Ty: &TypeUnresolved, Global: true}
+	}
+	if d := cmp.Diff(
+		[]*VarDecl{
+			{
+				Specs: []*VarSpec{
+					{Names: []*Variable{global("a")}, Type: &TypeInt},
+					{Names: []*Variable{global("b"), global("c")}, Values: []Expr{&IntLiteral{Value: "1"}, &StringLiteral{Value: "c"}}},
+				},
+			},
+		},
+		ast.vars,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+	if d := cmp.Diff(
+		&Block{
+			Body: []Expr{
+				&VarDecl{
+					Specs: []*VarSpec{
+						{Names: []*Variable{{Name: "d", Ty: &TypeUnresolved}}, Type: &TypeUint8, Values: []Expr{&IntLiteral{Value: "2"}}},
+					},
+				},
+			},
+		},
+		ast.funcs[0].Body,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestInvalidVarDecl(t *testing.T) {
+	stream := NewByteStream("package main\nvar a\nvar init = 1\nfunc main() {\nvar b, b int\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `2:1: syntax error: unexpected ;, expecting type
+3:5: cannot declare init - must be func
+5:8: b redeclared in this block`)
+}
+
+func TestInvalidInitFunctions(t *testing.T) {
+	stream := NewByteStream("package main\nfunc init(x int) {\n}\nfunc init() int {\nreturn 1\n}\nfunc init() {\n}\nfunc init() {\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `2:6: func init must have no arguments and no return values
+4:6: func init must have no arguments and no return values`)
+}
+
+func TestAssignStmt(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nx := 1\ny := 2\nx, y = y, x\nx += 3\ny <<= x\nx++\ny--\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	x, y := &Identifier{Name: "x"}, &Identifier{Name: "y"}
+	if d := cmp.Diff(
+		[]Expr{
+			&AssignStmt{Lhs: []Expr{x, y}, Rhs: []Expr{y, x}},
+			&AssignStmt{Op: TOKEN_PLUS, Lhs: []Expr{x}, Rhs: []Expr{&BinaryOp{Op: TOKEN_PLUS, Lhs: x, Rhs: &IntLiteral{Value: "3"}}}},
+			&AssignStmt{Op: TOKEN_SHL, Lhs: []Expr{y}, Rhs: []Expr{&BinaryOp{Op: TOKEN_SHL, Lhs: y, Rhs: x}}},
+			&IncDec{Op: TOKEN_PLUSPLUS, Operand: x},
+			&IncDec{Op: TOKEN_MINUSMINUS, Operand: y},
+		},
+		ast.funcs[0].Body.Body[2:],
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestInvalidAssignStmt(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nx := 1\nx, = 2\nfor x = 0 {\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `4:4: syntax error: unexpected =, expecting primary expression
+5:11: syntax error: expected for loop condition`)
+}
+
+func TestFuncResults(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f() (int, string) {\nreturn 1, \"s\"\n}\nfunc g() (q, r int, ok bool) {\nreturn\n}\nfunc main() {\na, b := f()\n_, b = f()\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	if d := cmp.Diff(
+		[]*Variable{{Ty: &TypeInt}, {Ty: &TypeString}},
+		ast.funcs[0].Results,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+	assert.Equal(t, "(int, string)", ast.funcs[0].ReturnType.Name)
+	if d := cmp.Diff(
+		[]*Variable{{Name: "q", Ty: &TypeInt}, {Name: "r", Ty: &TypeInt}, {Name: "ok", Ty: &TypeBool}},
+		ast.funcs[1].Results,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+	if d := cmp.Diff(
+		&Block{
+			Body: []Expr{
+				&Assign{
+					Lhs: []Expr{&Variable{Name: "a", Ty: &TypeUnresolved}, &Variable{Name: "b", Ty: &TypeUnresolved}},
+					Rhs: []Expr{&FunctionCall{Arguments: []Expr{}}},
+				},
+				&AssignStmt{
+					Lhs: []Expr{&Identifier{Name: "_"}, &Identifier{Name: "b"}},
+					Rhs: []Expr{&FunctionCall{Arguments: []Expr{}}},
+				},
+			},
+		},
+		ast.funcs[2].Body,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestInvalidShortVarDecl(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f() (a int, string) {\n}\nfunc main() {\na, a := 1, 2\nb := 3\nb, _ := 4, 5\nb, c := 6, 7\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `2:24: syntax error: mixed named and unnamed parameters
+5:4: a repeated on left side of :=
+7:6: no new variables on left side of :=`)
+}
+
+func TestGroupedParameters(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f(a, b int, s string, c, d bool) {\n}\nfunc g(int, string) {\n}\nfunc h(_, _ int) {\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	if d := cmp.Diff(
+		[]*Variable{
+			{Name: "a", Ty: &TypeInt},
+			{Name: "b", Ty: &TypeInt},
+			{Name: "s", Ty: &TypeString},
+			{Name: "c", Ty: &TypeBool},
+			{Name: "d", Ty: &TypeBool},
+		},
+		ast.funcs[0].Parameters,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+	if d := cmp.Diff(
+		[]*Variable{{Ty: &TypeInt}, {Ty: &TypeString}},
+		ast.funcs[1].Parameters,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+	if d := cmp.Diff(
+		[]*Variable{{Name: "_", Ty: &TypeInt}, {Name: "_", Ty: &TypeInt}},
+		ast.funcs[2].Parameters,
+		opts...,
+	); len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestInvalidParameters(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f(a, b int, c) {\n}\nfunc g(a int, a string) {\n}\nfunc h(x int) (x int) {\nreturn 1\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `2:19: syntax error: mixed named and unnamed parameters
+4:15: a redeclared in this block
+6:16: x redeclared in this block`)
+}
+
+func TestTypeDecl(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f(c Celsius) Weekday {\nreturn 0\n}\ntype (\nCelsius Temperature\nWeekday uint8\n)\ntype Temperature int\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+
+	celsius := ast.types[0].Specs[0].Ty
+	assert.Same(t, celsius, ast.funcs[0].Parameters[0].Ty)
+	assert.Same(t, ast.types[0].Specs[1].Ty, ast.funcs[0].ReturnType)
+	assert.Equal(t, "Celsius", celsius.Name)
+	assert.Equal(t, TypeID(TypeIdInt), celsius.Id)
+	assert.Equal(t, 8, celsius.Size)
+	assert.Same(t, &TypeInt, celsius.Underlying)
+	assert.Same(t, &TypeUint8, ast.types[0].Specs[1].Ty.Underlying)
+	assert.False(t, isSameType(celsius, ast.types[1].Specs[0].Ty))
+	assert.False(t, isSameType(celsius, &TypeInt))
+}
+
+func TestInvalidTypeDecl(t *testing.T) {
+	stream := NewByteStream("package main\ntype A B\ntype B C\ntype C A\ntype T T\ntype X Y\ntype U A\nvar v int\nfunc f(a v) {\n}\nfunc f() {\n}\ntype f int\nvar X = 1\nfunc init() {\n}\nfunc init() {\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `2:6: invalid recursive type A
+	2:6: A refers to B
+	3:6: B refers to C
+	4:6: C refers to A
+5:6: invalid recursive type: T refers to itself
+6:8: undefined: Y
+9:10: v is not a type
+11:6: f redeclared in this block
+13:6: f redeclared in this block
+14:5: X redeclared in this block`)
+}
+
+func TestInvalidRecursiveTypeStartsAtEarliest(t *testing.T) {
+	stream := NewByteStream("package main\ntype X B\ntype A B\ntype B A\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `3:6: invalid recursive type A
+	3:6: A refers to B
+	4:6: B refers to A`)
+}
+
+func tokenizeFiles(t *testing.T, sources map[string]string) []*TokenStream {
+	var names []string
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var tokenStreams []*TokenStream
+	for _, name := range names {
+		tokenStream, err := Tokenize(NewFileByteStream(&SourceFile{Name: name, Source: sources[name]}))
+		assert.NoError(t, err)
+		tokenStreams = append(tokenStreams, tokenStream)
+	}
+	return tokenStreams
+}
+
+// A recursive type is still reported when the declaration is followed by a syntax error.
+func TestInvalidRecursiveTypeFollowedBySyntaxError(t *testing.T) {
+	stream := NewByteStream("package main\n\ntype A B\n\ntype B A )\n\nfunc main() int {\n\treturn 0\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `3:6: invalid recursive type A
+	3:6: A refers to B
+	5:6: B refers to A
+5:10: syntax error: unexpected ), expecting ;`)
+}
+
+func TestParseFiles(t *testing.T) {
+	ast, err := ParseFiles(tokenizeFiles(t, map[string]string{
+		"a.go": "package main\nfunc main() {\nf(x)\n}\n",
+		"b.go": "package main\n\nvar x T\ntype T int\nfunc f(t T) {\n}\n",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "main", ast.packageName)
+	assert.Len(t, ast.files, 2)
+	assert.Len(t, ast.funcs, 2)
+	assert.Same(t, ast.types[0].Specs[0].Ty, ast.vars[0].Specs[0].Type)
+	err = ast.InferType()
+	assert.NoError(t, err)
+}
+
+func TestInvalidFiles(t *testing.T) {
+	_, err := ParseFiles(tokenizeFiles(t, map[string]string{
+		"a.go": "package main\nimport \"fmt\"\nimport (\nstrings \"strings\"\n1\n)\nfunc f() {\n}\nimport \"os\"\n",
+		"b.go": "package other\nfunc f() {\n}\n",
+		"c.go": "func g() {\n}\n",
+		"d.go": "package _\n",
+	}))
+	assert.EqualError(t, err, `a.go:2:8: could not import "fmt" (package not found)
+a.go:4:9: could not import "strings" (package not found)
+a.go:5:1: syntax error: missing import path; require quoted string
+a.go:9:1: syntax error: imports must appear before other declarations
+b.go:1:9: package other; expected package main
+b.go:2:6: f redeclared in this block
+c.go:1:1: syntax error: package statement must be first
+d.go:1:9: invalid package name _`)
+}
+
+// The last line of a file may end without a newline.
+func TestFilesWithoutTrailingNewline(t *testing.T) {
+	_, err := ParseFiles(tokenizeFiles(t, map[string]string{
+		"a.go": "package main\nfunc main() {\n}",
+		"b.go": "package main\nconst c = 1",
+	}))
+	assert.NoError(t, err)
+	_, err = ParseFiles(tokenizeFiles(t, map[string]string{
+		"c.go": "package main\nvar x =",
+	}))
+	assert.EqualError(t, err, "c.go:2:8: syntax error: unexpected EOF, expecting primary expression")
+}
+
+func TestStructTypes(t *testing.T) {
+	stream := NewByteStream("package main\ntype P struct {\na int8\nb, c int64\n_ bool\nd struct{ e int8 }\nf int8\n}\nvar q struct{}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+
+	p := ast.types[0].Specs[0].Ty
+	assert.Equal(t, TypeID(TypeIdStruct), p.Id)
+	var names []string
+	var offsets []int
+	for _, field := range p.Fields {
+		names = append(names, field.Name)
+		offsets = append(offsets, field.Offset)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "_", "d", "f"}, names)
+	assert.Equal(t, []int{0, 8, 16, 24, 25, 26}, offsets)
+	assert.Equal(t, 32, p.Size)
+	assert.Equal(t, "struct{e int8}", p.Fields[4].Ty.Name)
+	assert.Same(t, p.Fields[1], p.field("b"))
+	assert.Nil(t, p.field("_"))
+	assert.Equal(t, 0, ast.vars[0].Specs[0].Type.Size)
+}
+
+func TestInvalidStructTypes(t *testing.T) {
+	stream := NewByteStream("package main\ntype P struct {\nx int\nx string\nQ\n}\ntype Q struct {\nnext Q\n}\ntype R struct {\ns S\n}\ntype S struct {\nr R\n}\ntype T struct {\n1\n}\nvar t int\n")
+	tokenStream, _ := Tokenize(stream)
+	_, err := Parse(tokenStream)
+	assert.EqualError(t, err, `4:1: x redeclared
+	3:1: other declaration of x
+5:1: embedded field Q is not supported
+7:6: invalid recursive type: Q refers to itself
+10:6: invalid recursive type R
+	10:6: R refers to S
+	13:6: S refers to R
+17:1: syntax error: unexpected 1, expecting field name`)
+}
+
+func TestPointerTypes(t *testing.T) {
+	stream := NewByteStream("package main\ntype N struct {\nv int8\nnext *N\n}\nvar p **int\nfunc f(*int, *N) *N {\nreturn nil\n}\nfunc g(a, b *N) {}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+
+	n := ast.types[0].Specs[0].Ty
+	assert.Equal(t, TypeID(TypeIdPointer), n.Fields[1].Ty.Id)
+	assert.Same(t, n, n.Fields[1].Ty.Elem)
+	assert.Equal(t, 16, n.Size)
+	p := ast.vars[0].Specs[0].Type
+	assert.Equal(t, "**int", p.Name)
+	assert.Equal(t, "*int", p.Elem.Name)
+	assert.Equal(t, []string{"*int", "*N"}, []string{ast.funcs[0].Parameters[0].Ty.Name, ast.funcs[0].Parameters[1].Ty.Name})
+	assert.Equal(t, []string{"a", "b"}, []string{ast.funcs[1].Parameters[0].Name, ast.funcs[1].Parameters[1].Name})
+	assert.Same(t, n, ast.funcs[1].Parameters[1].Ty.Elem)
+}
+
+func TestArrayAndSliceTypes(t *testing.T) {
+	stream := NewByteStream("package main\ntype L struct {\nnext []L\n}\nconst n = 2\ntype M [n * 2][]*int\nvar z [3][2]int8\nfunc f([]int, []L) [2]bool {\nreturn [2]bool{}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+
+	l := ast.types[0].Specs[0].Ty
+	assert.Equal(t, TypeID(TypeIdSlice), l.Fields[0].Ty.Id)
+	assert.Same(t, l, l.Fields[0].Ty.Elem)
+	assert.Equal(t, 24, l.Size)
+	m := ast.types[1].Specs[0].Ty
+	assert.Equal(t, TypeID(TypeIdArray), m.Id)
+	assert.Equal(t, 4, m.Len)
+	assert.Equal(t, "[]*int", m.Elem.Name)
+	assert.Equal(t, 96, m.Size)
+	z := ast.vars[0].Specs[0].Type
+	assert.Equal(t, "[3][2]int8", z.Name)
+	assert.Equal(t, 6, z.Size)
+	assert.Equal(t, []string{"[]int", "[]L"}, []string{ast.funcs[0].Parameters[0].Ty.Name, ast.funcs[0].Parameters[1].Ty.Name})
+	assert.Equal(t, "[2]bool", ast.funcs[0].Results[0].Ty.Name)
+}
+
+func TestInvalidArrayTypes(t *testing.T) {
+	stream := NewByteStream("package main\ntype A [3]A\ntype B [\"a\"]int\nvar c [-1]int\nvar z [...]int\n")
 	tokenStream, _ := Tokenize(stream)
 	_, err := Parse(tokenStream)
-	assert.EqualError(t, err, "no new variables on left side of :=")
+	assert.EqualError(t, err, `2:6: invalid recursive type: A refers to itself
+3:9: array length "a" (untyped string constant) must be integer
+4:8: invalid array length -1 (untyped int constant)
+5:7: invalid use of [...] array (outside a composite literal)`)
 }
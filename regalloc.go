@@ -0,0 +1,240 @@
+package main
+
+import "sort"
+
+// RegisterSet is the physical registers which the register allocator may assign to virtual registers.
+// Registers used as scratch or for passing arguments by the code generator must not be included.
+type RegisterSet struct {
+	// Registers preserved across calls. A value live across a call can only be in one of them.
+	CalleeSaved []string
+	// Registers which a call may clobber.
+	CallerSaved []string
+}
+
+// Allocation is the location of each virtual register of a function: either a physical register or a stack slot.
+type Allocation struct {
+	Registers map[*IrReg]string
+	Slots     map[*IrReg]int
+	// Callee-saved registers assigned to any virtual register, which the function has to restore before returning.
+	UsedCalleeSaved []string
+	// Number of the stack slots of 8 bytes for spilled virtual registers.
+	NumSlots int
+}
+
+// liveInterval is the range of instruction positions where a virtual register is live.
+// It does not have holes, which is conservative but keeps linear scan simple.
+type liveInterval struct {
+	reg        *IrReg
+	start      int
+	end        int
+	acrossCall bool
+}
+
+// AllocateRegisters assigns physical registers in `registers` to the virtual registers of `function` by linear scan.
+// When registers run out, the interval which ends last is spilled to a stack slot for its whole lifetime.
+func AllocateRegisters(function *IrFunction, registers *RegisterSet) *Allocation {
+	allocation := &Allocation{
+		Registers: map[*IrReg]string{},
+		Slots:     map[*IrReg]int{},
+	}
+	spill := func(reg *IrReg) {
+		allocation.Slots[reg] = allocation.NumSlots
+		allocation.NumSlots++
+	}
+
+	free := map[string]bool{}
+	for _, register := range registers.CalleeSaved {
+		free[register] = true
+	}
+	for _, register := range registers.CallerSaved {
+		free[register] = true
+	}
+
+	var active []*liveInterval
+	for _, current := range buildIntervals(function) {
+		// Release the registers of the intervals which have ended.
+		var remaining []*liveInterval
+		for _, interval := range active {
+			if interval.end < current.start {
+				free[allocation.Registers[interval.reg]] = true
+			} else {
+				remaining = append(remaining, interval)
+			}
+		}
+		active = remaining
+
+		// Prefer caller-saved registers, which need not be saved in the prologue.
+		candidates := registers.CalleeSaved
+		if !current.acrossCall {
+			candidates = append(append([]string{}, registers.CallerSaved...), registers.CalleeSaved...)
+		}
+
+		if register, ok := pickFreeRegister(candidates, free); ok {
+			free[register] = false
+			allocation.Registers[current.reg] = register
+			active = append(active, current)
+			continue
+		}
+
+		var victim *liveInterval
+		for _, interval := range active {
+			if contains(candidates, allocation.Registers[interval.reg]) && (victim == nil || interval.end > victim.end) {
+				victim = interval
+			}
+		}
+		if victim == nil || victim.end <= current.end {
+			spill(current.reg)
+			continue
+		}
+		allocation.Registers[current.reg] = allocation.Registers[victim.reg]
+		delete(allocation.Registers, victim.reg)
+		spill(victim.reg)
+		for i, interval := range active {
+			if interval == victim {
+				active[i] = current
+			}
+		}
+	}
+
+	for _, register := range registers.CalleeSaved {
+		for _, assigned := range allocation.Registers {
+			if assigned == register {
+				allocation.UsedCalleeSaved = append(allocation.UsedCalleeSaved, register)
+				break
+			}
+		}
+	}
+	return allocation
+}
+
+func pickFreeRegister(candidates []string, free map[string]bool) (string, bool) {
+	for _, register := range candidates {
+		if free[register] {
+			return register, true
+		}
+	}
+	return "", false
+}
+
+func contains(registers []string, register string) bool {
+	for _, r := range registers {
+		if r == register {
+			return true
+		}
+	}
+	return false
+}
+
+// buildIntervals returns the live intervals of the virtual registers in `function` sorted by their start.
+// Instructions are numbered from 1 in the layout order, and parameters are defined at 0.
+func buildIntervals(function *IrFunction) []*liveInterval {
+	liveIn, liveOut := liveness(function)
+	intervals := map[*IrReg]*liveInterval{}
+	extend := func(reg *IrReg, position int) {
+		if interval, ok := intervals[reg]; ok {
+			if position < interval.start {
+				interval.start = position
+			}
+			if position > interval.end {
+				interval.end = position
+			}
+		} else {
+			intervals[reg] = &liveInterval{reg: reg, start: position, end: position}
+		}
+	}
+
+	for _, param := range function.Params {
+		extend(param, 0)
+	}
+	var calls []int
+	position := 1
+	for _, block := range function.Blocks {
+		for reg := range liveIn[block] {
+			extend(reg, position)
+		}
+		for _, instr := range block.Instrs {
+			for _, arg := range instr.Args {
+				extend(arg, position)
+			}
+			for _, def := range instr.Defs() {
+				extend(def, position)
+			}
+			if instr.Op == IrCall {
+				calls = append(calls, position)
+			}
+			position++
+		}
+		for reg := range liveOut[block] {
+			extend(reg, position-1)
+		}
+	}
+
+	var sorted []*liveInterval
+	for _, interval := range intervals {
+		for _, call := range calls {
+			if interval.start < call && call < interval.end {
+				interval.acrossCall = true
+			}
+		}
+		sorted = append(sorted, interval)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].start != sorted[j].start {
+			return sorted[i].start < sorted[j].start
+		}
+		return sorted[i].reg.Id < sorted[j].reg.Id
+	})
+	return sorted
+}
+
+// liveness computes the virtual registers live at the entry and the exit of each block by backward dataflow analysis.
+func liveness(function *IrFunction) (map[*IrBlock]map[*IrReg]bool, map[*IrBlock]map[*IrReg]bool) {
+	uses := map[*IrBlock]map[*IrReg]bool{}
+	defs := map[*IrBlock]map[*IrReg]bool{}
+	liveIn := map[*IrBlock]map[*IrReg]bool{}
+	liveOut := map[*IrBlock]map[*IrReg]bool{}
+	for _, block := range function.Blocks {
+		uses[block] = map[*IrReg]bool{}
+		defs[block] = map[*IrReg]bool{}
+		liveIn[block] = map[*IrReg]bool{}
+		liveOut[block] = map[*IrReg]bool{}
+		for _, instr := range block.Instrs {
+			for _, arg := range instr.Args {
+				if !defs[block][arg] {
+					uses[block][arg] = true
+				}
+			}
+			for _, def := range instr.Defs() {
+				defs[block][def] = true
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := len(function.Blocks) - 1; i >= 0; i-- {
+			block := function.Blocks[i]
+			for _, succ := range block.Succs {
+				for reg := range liveIn[succ] {
+					if !liveOut[block][reg] {
+						liveOut[block][reg] = true
+						changed = true
+					}
+				}
+			}
+			for reg := range uses[block] {
+				if !liveIn[block][reg] {
+					liveIn[block][reg] = true
+					changed = true
+				}
+			}
+			for reg := range liveOut[block] {
+				if !defs[block][reg] && !liveIn[block][reg] {
+					liveIn[block][reg] = true
+					changed = true
+				}
+			}
+		}
+	}
+	return liveIn, liveOut
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllocateRegistersAcrossCall(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc main() int {\nx := 1\nreturn f(x, 2) + x\n}\nfunc f(a int, b int) int {\nreturn a * b\n}\n")
+	function := program.Functions[0]
+	allocation := AllocateRegisters(function, &RegisterSet{CalleeSaved: []string{"s0"}, CallerSaved: []string{"t0", "t1"}})
+	regs := function.Regs
+	// %x.1 is live across the call, so it must be in the callee-saved register.
+	assert.Equal(t, map[*IrReg]string{regs[0]: "t0", regs[1]: "s0", regs[2]: "t0", regs[3]: "t1", regs[4]: "t0"}, allocation.Registers)
+	assert.Equal(t, []string{"s0"}, allocation.UsedCalleeSaved)
+	assert.Equal(t, 0, allocation.NumSlots)
+}
+
+func TestAllocateRegistersSpill(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc f() int {\na := 1\nb := 2\nc := 3\nreturn a + b + c\n}\n")
+	function := program.Functions[0]
+	allocation := AllocateRegisters(function, &RegisterSet{CallerSaved: []string{"t0", "t1"}})
+	regs := function.Regs
+	assert.Equal(t, map[*IrReg]string{regs[0]: "t0", regs[1]: "t1", regs[2]: "t0", regs[4]: "t0", regs[6]: "t0", regs[7]: "t1"}, allocation.Registers)
+	assert.Equal(t, map[*IrReg]int{regs[3]: 0, regs[5]: 1}, allocation.Slots)
+	assert.Empty(t, allocation.UsedCalleeSaved)
+	assert.Equal(t, 2, allocation.NumSlots)
+}
+
+func TestAllocateRegistersInLoop(t *testing.T) {
+	program := buildIrFromSource(t, "package main\nfunc f(b bool) int {\nx := 7\nfor b {\ny := 1\nz := y + 2\nif b {\nbreak\n}\n}\nreturn x\n}\n")
+	function := program.Functions[0]
+	allocation := AllocateRegisters(function, &RegisterSet{CallerSaved: []string{"t0", "t1", "t2", "t3", "t4"}})
+	// %x and %b are live throughout the loop, so they must not share a register with the values defined in it.
+	var x *IrReg
+	for _, reg := range function.Regs {
+		if reg.Name == "x" {
+			x = reg
+		}
+	}
+	b := function.Params[0]
+	for _, reg := range function.Regs[x.Id+1:] {
+		assert.NotEqual(t, allocation.Registers[x], allocation.Registers[reg], reg.String())
+		assert.NotEqual(t, allocation.Registers[b], allocation.Registers[reg], reg.String())
+	}
+	assert.Equal(t, 0, allocation.NumSlots)
+}
@@ -6,28 +6,44 @@ color_failed="\033[31;1m"
 color_off="\033[m"
 
 tmp_dir=/tmp/tmpfs/out
-asm_dir=$tmp_dir/asm
 bin_dir=$tmp_dir/bin
-mkdir -p $tmp_dir $asm_dir $bin_dir
+mkdir -p $tmp_dir $bin_dir
+
+# The compiler targets the architecture of the host by default, so the output runs natively.
+# It assembles and links the packages with $CC.
+failed=0
 
 function run_unit_test {
     test_name=$1
-    src_file=tests/$test_name/main.go
-    asm_file=$asm_dir/$test_name.s
+    # Each test is a package in its own directory, which may consist of several files.
+    src_dir=tests/$test_name
     bin_file=$bin_dir/$test_name
 
-    ./output/indigo tests/$test_name/main.go > $asm_file
-    clang -o $bin_file $asm_file
+    # A binary left by an earlier run must not be executed if the compilation fails.
+    rm -f $bin_file
+    if ! ./output/indigo -o $bin_file $src_dir; then
+        printf "${color_failed}[failed]${color_off} ${test_name}, compilation failed\n"
+        failed=1
+        return
+    fi
 
     expected_file=tests/$test_name/expected.txt
     actual_file=$tmp_dir/actual.txt
-    $bin_file
+    # The standard output is compared only for the tests which have the expected one.
+    expected_stdout_file=tests/$test_name/stdout.txt
+    actual_stdout_file=$tmp_dir/stdout.txt
+    $bin_file > $actual_stdout_file
     echo $? > $actual_file
 
-    if cmp -s $actual_file $expected_file; then
-        echo "${color_ok}[ok]${color_off}     ${test_name}"
+    if [ -f $expected_stdout_file ] && ! cmp -s $actual_stdout_file $expected_stdout_file; then
+        printf "${color_failed}[failed]${color_off} ${test_name}, stdout differs\n"
+        diff $expected_stdout_file $actual_stdout_file
+        failed=1
+    elif cmp -s $actual_file $expected_file; then
+        printf "${color_ok}[ok]${color_off}     ${test_name}\n"
     else
-        echo "${color_failed}[failed]${color_off} ${test_name}, got" $(cat $actual_file)
+        printf "${color_failed}[failed]${color_off} ${test_name}, got $(cat $actual_file)\n"
+        failed=1
     fi
 }
 
@@ -39,3 +55,4 @@ function run_all_test {
 }
 
 run_all_test
+exit $failed
@@ -1,19 +1,56 @@
 package main
 
+import "sort"
+
 type Scope struct {
-	exprs map[string]Expr  // key: name, value: corresponding `Expr` in the AST
-	types map[string]*Type // key: name, value: defined type
-	outer *Scope
+	exprs  map[string]Expr  // key: name, value: corresponding `Expr` in the AST
+	types  map[string]*Type // key: name, value: defined type
+	outer  *Scope
+	inners []*Scope
+	// Function whose body this scope belongs to. Set only for the outermost scope of a function.
+	function *FunctionDecl
+	// Qualifier of the symbols of the declarations in a package scope, such as "main".
+	qualifier string
 }
 
 func NewScope(outer *Scope) *Scope {
-	return &Scope{exprs: map[string]Expr{}, types: map[string]*Type{}, outer: outer}
+	scope := &Scope{exprs: map[string]Expr{}, types: map[string]*Type{}, outer: outer}
+	if outer != nil {
+		outer.inners = append(outer.inners, scope)
+	}
+	return scope
 }
 
 func NewGlobalScope() *Scope {
 	return &Scope{
-		exprs: map[string]Expr{},
-		types: map[string]*Type{"int": &TypeInt, "bool": &TypeBool},
+		exprs: map[string]Expr{
+			"append":  &Builtin{Name: "append"},
+			"cap":     &Builtin{Name: "cap"},
+			"copy":    &Builtin{Name: "copy"},
+			"len":     &Builtin{Name: "len"},
+			"make":    &Builtin{Name: "make"},
+			"new":     &Builtin{Name: "new"},
+			"print":   &Builtin{Name: "print"},
+			"println": &Builtin{Name: "println"},
+		},
+		types: map[string]*Type{
+			"int":     &TypeInt,
+			"int8":    &TypeInt8,
+			"int16":   &TypeInt16,
+			"int32":   &TypeInt32,
+			"int64":   &TypeInt64,
+			"uint":    &TypeUint,
+			"uint8":   &TypeUint8,
+			"uint16":  &TypeUint16,
+			"uint32":  &TypeUint32,
+			"uint64":  &TypeUint64,
+			"uintptr": &TypeUintptr,
+			// Aliases, which are identical to the types they denote.
+			"byte":   &TypeUint8,
+			"rune":   &TypeInt32,
+			"bool":   &TypeBool,
+			"string": &TypeString,
+		},
 		outer: nil,
 	}
 }
@@ -23,6 +60,12 @@ func (scope *Scope) ExistsExpr(name string) bool {
 	return exists
 }
 
+// ExistsExprInCurrentScope reports whether `name` is declared in this scope, ignoring outer scopes.
+func (scope *Scope) ExistsExprInCurrentScope(name string) bool {
+	_, exists := scope.exprs[name]
+	return exists
+}
+
 func (scope *Scope) InsertExpr(name string, expr Expr) {
 	scope.exprs[name] = expr
 }
@@ -38,6 +81,54 @@ func (scope *Scope) GetExpr(name string) (Expr, bool) {
 	return nil, false
 }
 
+// GetDeclaredExpr is like `GetExpr`, but skips local variables and constants whose declaration has not been type-checked yet.
+// Because statements are checked in source order, this resolves a name to the innermost declaration preceding it.
+// Declarations at the package level are not skipped, since they can be used before their declarations.
+func (scope *Scope) GetDeclaredExpr(name string) (Expr, bool) {
+	expr, ok := scope.exprs[name]
+	if ok {
+		switch declared := expr.(type) {
+		case *Variable:
+			ok = scope.outer == nil || !declared.Ty.isUnresolved()
+		case *Constant:
+			ok = scope.outer == nil || !declared.Ty.isUnresolved()
+		}
+		if ok {
+			return expr, ok
+		}
+	}
+	if scope.outer != nil {
+		return scope.outer.GetDeclaredExpr(name)
+	}
+	return nil, false
+}
+
+// Variables returns all variables declared in this scope and its inner scopes.
+func (scope *Scope) Variables() []*Variable {
+	var variables []*Variable
+	names := make([]string, 0, len(scope.exprs))
+	for name := range scope.exprs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if variable, ok := scope.exprs[name].(*Variable); ok {
+			variables = append(variables, variable)
+		}
+	}
+	for _, inner := range scope.inners {
+		variables = append(variables, inner.Variables()...)
+	}
+	return variables
+}
+
+func (scope *Scope) enclosingFunction() *FunctionDecl {
+	if scope.function != nil || scope.outer == nil {
+		return scope.function
+	}
+	return scope.outer.enclosingFunction()
+}
+
 func (scope *Scope) ExistsType(name string) bool {
 	_, exists := scope.types[name]
 	return exists
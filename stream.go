@@ -1,16 +1,41 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+// SourceFile is a source code named `Name`, which is used to show where an error is.
+type SourceFile struct {
+	Name   string
+	Source string
+}
+
+// Line returns the `line`th line of the source without the newline, or an empty string if it does not exist.
+func (file *SourceFile) Line(line int) string {
+	lines := strings.Split(file.Source, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return lines[line-1]
+}
 
 type ByteStream struct {
+	file            *SourceFile
 	source          string
 	currentIndex    int
 	CurrentPosition Position // Position of most recently emitted byte.
 }
 
+// NewByteStream returns a stream of `source` which does not come from any file.
 func NewByteStream(source string) *ByteStream {
+	return NewFileByteStream(&SourceFile{Source: source})
+}
+
+func NewFileByteStream(file *SourceFile) *ByteStream {
 	return &ByteStream{
-		source:          source,
+		file:            file,
+		source:          file.Source,
 		currentIndex:    0,
 		CurrentPosition: NewPosition(),
 	}
@@ -31,6 +56,14 @@ func (stream *ByteStream) get() (byte, bool) {
 	return b, true
 }
 
+// peek returns the upcoming byte without consuming it, and whether it exists or not.
+func (stream *ByteStream) peek() (byte, bool) {
+	if stream.currentIndex >= len(stream.source) {
+		return byte(0), false
+	}
+	return stream.source[stream.currentIndex], true
+}
+
 func (stream *ByteStream) unget() bool {
 	if stream.currentIndex == 0 {
 		return false
@@ -82,6 +115,11 @@ func (position Position) previousLine() Position {
 	}
 }
 
+// isBefore reports whether `position` comes before `other` in the same file.
+func (position Position) isBefore(other Position) bool {
+	return position.Line < other.Line || position.Line == other.Line && position.Column < other.Column
+}
+
 func (position Position) toString() string {
 	return fmt.Sprintf("%d:%d", position.Line, position.Column)
 }
@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+
+// Target abstracts an instruction set architecture and its calling convention for the code generator.
+type Target interface {
+	// Header and Footer output directives at the beginning and the end of the assembly.
+	Header()
+	Footer()
+	CommentPrefix() string
+	OS() *OS
+
+	// Function outputs the assembly of `function`.
+	Function(function *IrFunction)
+	// Runtime outputs the functions which the generated code calls for builtins, such as `runtime.printstring`.
+	Runtime()
+}
+
+// NewTarget returns the `Target` for the architecture named as GOARCH running on `os`.
+func NewTarget(arch string, os *OS) (Target, error) {
+	switch arch {
+	case "arm64":
+		return &Arm64{os: os}, nil
+	case "amd64":
+		return &Amd64{os: os}, nil
+	default:
+		return nil, fmt.Errorf("unsupported target: %s", arch)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+type Point struct {
+	X, Y int
+}
+
+type Grid [3][3]int8
+
+var primes = [...]int{2, 3, 5, 7, 11}
+
+func sum(a [5]int) int {
+	total := 0
+	for _, v := range a {
+		total += v
+	}
+	return total
+}
+
+func double(a *[5]int) {
+	for i := range a {
+		a[i] *= 2
+	}
+}
+
+func corners() [2]Point {
+	return [2]Point{{1, 2}, {X: 3}}
+}
+
+func main() int {
+	var a [5]int
+	for i := 0; i < len(a); i++ {
+		a[i] = i * i
+	}
+	println(a[4], len(a), cap(a), sum(a))
+
+	b := a
+	b[0] = 100
+	println(a[0], b[0], a == b, a != b)
+	b[0] = 0
+	println(a == b)
+
+	double(&a)
+	println(a[1], a[2], a[3], sum(primes))
+
+	var g Grid
+	for i := range g {
+		for j := range g[i] {
+			g[i][j] = int8(i*3 + j)
+		}
+	}
+	row := g[2]
+	row[0] = -1
+	println(g[1][2], g[2][0], row[0], row[2])
+
+	ps := corners()
+	ps[1].Y = ps[0].X + 5
+	println(ps[0].Y, ps[1].X, ps[1].Y)
+
+	sparse := [...]string{3: "d", 1: "b", "c"}
+	for i, s := range sparse {
+		println(i, s, len(s))
+	}
+
+	i := 2
+	p := &primes[i]
+	*p = 13
+	println(primes[2], primes[i+1])
+	return primes[2] + len(sparse)
+}
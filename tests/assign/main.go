@@ -0,0 +1,67 @@
+package main
+
+var counter int
+
+var label = "n"
+
+func bump() int {
+	counter++
+	return counter
+}
+
+func fib(n int) int {
+	a := 0
+	b := 1
+	for i := 0; i < n; i++ {
+		a, b = b, a+b
+	}
+	return a
+}
+
+func main() int {
+	x := 3
+	y := 4
+	x, y = y, x
+	println(x, y)
+
+	var small int8 = 100
+	small += 100
+	println(small)
+	var flags uint8 = 0xf0
+	flags &^= 0x30
+	flags |= 0x01
+	flags ^= 0xff
+	flags <<= 1
+	println(flags)
+
+	n := 100
+	n -= 1
+	n *= 3
+	n /= 2
+	n %= 100
+	n >>= 1
+	println(n)
+
+	for i := 0; i < 5; i = i + 1 {
+		bump()
+	}
+	counter--
+	_ = bump()
+	label += "!"
+	println(label, counter)
+
+	s := ""
+	for i := 3; i > 0; i-- {
+		s += "ab"
+	}
+	println(s)
+
+	total := 0
+	for i := 0; i < 10; i++ {
+		if i%2 == 0 {
+			continue
+		}
+		total += i
+	}
+	return fib(10) - total
+}
@@ -1,3 +1,5 @@
+package main
+
 func main() bool {
 	return true
 }
@@ -0,0 +1,15 @@
+package main
+
+func at(s []int, i int) int {
+	return s[i]
+}
+
+func main() int {
+	s := make([]int, 3)
+	for i := range s {
+		s[i] = i + 1
+		println(at(s, i))
+	}
+	// Indexing past the length panics, which exits with status 2 and prints the message to the standard error.
+	return at(s, 5)
+}
@@ -0,0 +1,10 @@
+// Comments are ignored, but a general comment spanning lines acts like a newline.
+package main
+
+func main() int {
+	x := 10 // the first operand
+	y := 3 /* the second operand */
+	z := x /* still
+	the same statement ends here */
+	return x*y + z/2 // 35
+}
@@ -0,0 +1,47 @@
+package main
+
+const (
+	Sunday = iota
+	Monday
+	Tuesday
+	_
+	Thursday
+)
+
+const (
+	KB = 1 << (10 * (iota + 1))
+	MB
+	GB
+)
+
+const (
+	flagA, maskA uint8 = 1 << iota, 1<<iota - 1
+	flagB, maskB
+	flagC, maskC
+)
+
+// Untyped constants keep arbitrary precision until they are used.
+const huge = 1 << 100
+const reduced = huge >> 95
+const greeting = "hello, " + name
+const name = "indigo"
+const ready = len(greeting) > 10 && !false
+
+func scale(x int) int {
+	const factor = 3
+	return x*factor + Thursday
+}
+
+func main() int {
+	println(Sunday, Monday, Tuesday, Thursday)
+	println(KB, MB, GB)
+	println(flagA, maskA, flagB, maskB, flagC, maskC)
+	println(reduced, huge/(huge>>10), -huge/huge, 7/-2, -7%3)
+	println(greeting, len(greeting), ready)
+	const limit int8 = 127
+	small := int8(100)
+	println(limit-small, small/-3, uint16(GB>>16))
+	n := uint(3)
+	println(1<<n, ^0, ^uint8(1), uint32(1<<32-1))
+	return scale(Thursday) + int(flagC)
+}
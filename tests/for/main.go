@@ -0,0 +1,41 @@
+package main
+
+func main() int {
+	for i := 5; yes(); i + 1 {
+		for {
+			if yes() {
+				break
+			}
+		}
+		if yes() {
+			break
+		}
+	}
+
+outer:
+	for {
+		for no() {
+			return 1
+		}
+		for {
+			break outer
+		}
+	}
+
+	for skip := no(); skip; {
+		return 2
+	}
+
+	for {
+		x := 40
+		return x + 2
+	}
+}
+
+func yes() bool {
+	return true
+}
+
+func no() bool {
+	return false
+}
@@ -1,3 +1,5 @@
+package main
+
 func main() int {
 	x := 2
 	y := f(1, 1+2)
@@ -0,0 +1,24 @@
+package main
+
+func main() int {
+	x := f(false)
+	if x {
+		return 1
+	} else if g() {
+		y := 10
+		return y
+	} else {
+		return 2
+	}
+}
+
+func f(b bool) bool {
+	if b {
+		return false
+	}
+	return true
+}
+
+func g() bool {
+	return false
+}
@@ -0,0 +1,25 @@
+package main
+
+var total int
+var base = compute()
+
+func compute() int {
+	println("initializing base")
+	return 10
+}
+
+// The functions named init run after the package-level variables are initialized, in the order of the source.
+func init() {
+	println("first init", total, base)
+	total = base
+}
+
+func init() {
+	println("second init", total)
+	total *= 2
+}
+
+func main() int {
+	println("main", total)
+	return total + extra
+}
@@ -0,0 +1,9 @@
+package main
+
+var extra int
+
+// The init functions of a later file run after the ones of an earlier file.
+func init() {
+	println("init in more.go", total)
+	extra = 3
+}
@@ -0,0 +1,27 @@
+package main
+
+func main() int {
+	a := int8(127)
+	println(a + int8(1), a*int8(2))
+	c := uint8(200)
+	c2 := c + uint8(100)
+	println(c2)
+	x := int8(-128)
+	y := int8(-1)
+	println(x/y, x%y, -x)
+	d := uint64(18446744073709551615)
+	println(d, d/uint64(10), d%uint64(10), d > uint64(1), int64(d))
+	e := int16(0x7fff)
+	println(e+int16(1), int32(e)+int32(1))
+	f := uint32(0xffff_ffff)
+	one := uint32(1)
+	println(f+one, -one == f, ^f)
+	println(0x7fffffffffffffff, 0o17, 017, 0b1010, 1_000_000, 0X_Ab_Cd)
+	println(0x123456789abcdef0, -0x123456789abcdef0, 65536, -65536, 4294967296)
+	g := uint16(1) << 15
+	println(g<<1, g>>15, uint8(255)>>3, int8(-128)>>3, ^uint8(0))
+	h := int16(300)
+	println(rune(0x4e16), byte(65), uint8(h), int8(c), uintptr(4096))
+	println(x < y, c < uint8(1), uint64(1)<<63 > uint64(1))
+	return int(c2)
+}
@@ -0,0 +1,14 @@
+package main
+
+// The slices are larger than an arena of the heap, so the runtime maps more memory for them.
+func main() int {
+	var s []int
+	for i := 0; i < 5000000; i++ {
+		s = append(s, i)
+	}
+	m := make([]int, 20000000)
+	m[len(m)-1] = 3
+	empty := make([]int, 0)
+	println(len(s), s[len(s)-1], cap(s), m[len(m)-1], empty == nil)
+	return m[len(m)-1] + len(empty)
+}
@@ -0,0 +1,31 @@
+package main
+
+type table struct {
+	count int
+	cells [200000]int
+}
+
+// The variables are larger than the stack of the thread, so they are allocated on the heap.
+func main() int {
+	var big [1100000]int
+	for i := 0; i < len(big); i++ {
+		big[i] = i
+	}
+	println(big[0], big[len(big)-1])
+
+	// Constant indices do not need the address of the array, which still lives in memory.
+	var constant [1100000]int
+	constant[1] = 5
+	println(constant[0], constant[1])
+
+	total := 0
+	for i := 0; i < 3; i++ {
+		// Each iteration has a new variable starting with zeros.
+		var t table
+		t.count += i
+		t.cells[i] = i + 1
+		total += t.count + t.cells[0] + t.cells[1] + t.cells[2]
+	}
+	println(total)
+	return constant[1] + total
+}
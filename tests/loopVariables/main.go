@@ -0,0 +1,37 @@
+package main
+
+// Each iteration of a loop has its own variables declared by the clauses, even if their addresses outlive it.
+func main() int {
+	var ps []*int
+	for i := 0; i < 3; i++ {
+		ps = append(ps, &i)
+	}
+	println(*ps[0], *ps[1], *ps[2])
+
+	var qs []*int
+	for _, v := range []int{4, 5, 6} {
+		qs = append(qs, &v)
+	}
+	println(*qs[0], *qs[1], *qs[2])
+
+	// The next iteration starts with the value of the variable at the end of the current one.
+	sum := 0
+	for i := 0; i < 10; i++ {
+		p := &i
+		*p += 2
+		sum += *p
+	}
+	println(sum)
+
+	// The variable of an earlier iteration keeps the value it had at the end of that iteration.
+	var last *int
+	count := 0
+	for i := 0; i < 3; i++ {
+		if last != nil && *last == i-1 && last != &i {
+			count++
+		}
+		last = &i
+	}
+	println(count)
+	return *ps[2] + *qs[0] + sum + count
+}
@@ -0,0 +1,92 @@
+package main
+
+func zero() int {
+	return 0
+}
+
+func one(a int) int {
+	return a
+}
+
+func two(a, b int) int {
+	return a*10 + b
+}
+
+func three(a, b, c int) int {
+	return two(a, b)*10 + c
+}
+
+func four(a, b, c, d int) int {
+	return three(a, b, c)*10 + d
+}
+
+func five(a, b, c, d, e int) int {
+	return four(a, b, c, d)*10 + e
+}
+
+func six(a, b, c, d, e, f int) int {
+	return five(a, b, c, d, e)*10 + f
+}
+
+func seven(a, b, c, d, e, f, g int) int {
+	return six(a, b, c, d, e, f)*10 + g
+}
+
+func eight(a, b, c, d, e, f, g, h int) int {
+	return seven(a, b, c, d, e, f, g)*10 + h
+}
+
+func nine(a, b, c, d, e, f, g, h, i int) int {
+	return eight(a, b, c, d, e, f, g, h)*10 + i
+}
+
+func ten(a, b, c, d, e, f, g, h, i, j int) int {
+	return nine(a, b, c, d, e, f, g, h, i)*10 + j
+}
+
+func eleven(a, b, c, d, e, f, g, h, i, j, k int) int {
+	return ten(a, b, c, d, e, f, g, h, i, j)*10 + k
+}
+
+func twelve(a, b, c, d, e, f, g, h, i, j, k, l int) int {
+	return eleven(a, b, c, d, e, f, g, h, i, j, k)*10 + l
+}
+
+// Narrow and unsigned values on the stack keep their signs and bits.
+func mixed(a, b, c, d, e, f, g, h int, i int8, j uint16, k bool, l int32, m uint8) int {
+	println(a, b, c, d, e, f, g, h, i, j, k, l, m)
+	if k {
+		return int(i) + int(j) + int(l) + int(m)
+	}
+	return 0
+}
+
+// Strings take two words, so some of them are passed on the stack.
+func join(a, b, c, d, e string, sep string) string {
+	return a + sep + b + sep + c + sep + d + sep + e
+}
+
+func unnamed(int, string, bool) int {
+	return 42
+}
+
+func _(x, _ int) {
+}
+
+// Results which do not fit in the registers are returned on the stack.
+func results(s string) (string, string, string, string, string, int8) {
+	return s, s + s, "c", "d", "e", -8
+}
+
+func main() int {
+	println(zero(), one(1), two(1, 2), three(1, 2, 3), four(1, 2, 3, 4), five(1, 2, 3, 4, 5))
+	println(six(1, 2, 3, 4, 5, 6), seven(1, 2, 3, 4, 5, 6, 7), eight(1, 2, 3, 4, 5, 6, 7, 8))
+	println(nine(1, 2, 3, 4, 5, 6, 7, 8, 9), ten(1, 2, 3, 4, 5, 6, 7, 8, 9, 0))
+	println(eleven(1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1), twelve(1, 2, 3, 4, 5, 6, 7, 8, 9, 0, 1, 2))
+	println(mixed(1, 2, 3, 4, 5, 6, 7, 8, -9, 65535, true, -100000, 200))
+	println(join("a", "b", "c", "d", "e", ", "))
+	println(unnamed(1, "", false))
+	a, b, c, d, e, f := results("ab")
+	println(a, b, c, d, e, f)
+	return twelve(0, 0, 0, 0, 0, 0, 0, 0, 0, 0, two(1, 2), 3) % 256
+}
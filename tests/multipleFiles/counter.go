@@ -0,0 +1,8 @@
+package main
+
+var count = 3
+
+func counter() int {
+	count++
+	return count
+}
@@ -0,0 +1,7 @@
+package main
+
+func main() int {
+	var t Temperature = boiling
+	println(describe(t), describe(freezing), total)
+	return int(t) + counter()
+}
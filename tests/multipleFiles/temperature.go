@@ -0,0 +1,19 @@
+package main
+
+// The declarations in this file are used in main.go, and they refer to the ones there in turn.
+
+type Temperature int
+
+const (
+	freezing Temperature = 0
+	boiling  Temperature = 100
+)
+
+var total = count + int(boiling)
+
+func describe(t Temperature) string {
+	if t >= boiling {
+		return "boiling"
+	}
+	return "not boiling"
+}
@@ -0,0 +1,67 @@
+package main
+
+var quotient, remainder = divmod(47, 5)
+
+func divmod(a int, b int) (int, int) {
+	return a / b, a % b
+}
+
+func swap(s string, n int8) (int8, string) {
+	return n, s
+}
+
+func minmax(a int, b int) (min int, max int) {
+	if a < b {
+		min, max = a, b
+		return
+	}
+	return b, a
+}
+
+func count(limit int) (even int, odd int) {
+	for i := 0; i < limit; i++ {
+		if i%2 == 0 {
+			even++
+		} else {
+			odd++
+		}
+	}
+	return
+}
+
+func many() (int, bool, string, uint8, int16) {
+	return 1, true, "many", 255, -300
+}
+
+func forward() (int, int) {
+	return divmod(100, 7)
+}
+
+func sum(a int, b int) int {
+	return a + b
+}
+
+func main() int {
+	q, r := divmod(17, 5)
+	println(q, r)
+	n, s := swap("x", -3)
+	println(n, s)
+	lo, hi := minmax(9, 4)
+	println(lo, hi)
+	lo, hi = minmax(2, 8)
+	println(lo, hi)
+	even, odd := count(7)
+	println(even, odd)
+	a, b, c, d, e := many()
+	println(a, b, c, d, e)
+	_, r = forward()
+	q, _ = forward()
+	println(q, r)
+	q, extra := divmod(r, 2)
+	println(q, extra)
+	var x, y = divmod(9, 4)
+	println(x, y, quotient, remainder)
+	lo, hi = minmax(divmod(47, 5))
+	println(lo, hi, sum(minmax(30, 4)))
+	return q + r
+}
@@ -0,0 +1,50 @@
+package main
+
+var order = trace(1) + trace(2)*trace(3)
+
+func add(a int, b int) int {
+	return a + b
+}
+
+func sub(a int, b int) int {
+	return a - b
+}
+
+func trace(n int) int {
+	println("trace", n)
+	return n
+}
+
+func digits(a int, b int, c int) int {
+	return a*100 + b*10 + c
+}
+
+func divmod(a int, b int) (int, int) {
+	return a / b, a % b
+}
+
+func swap(a int, b int) int {
+	return sub(b, a)
+}
+
+func label(s string, n int) string {
+	println(s, n)
+	return s
+}
+
+func sum9(a int, b int, c int, d int, e int, f int, g int, h int, i int) int {
+	return a + b + c + d + e + f + g + h + i
+}
+
+func main() int {
+	println(add(1, add(2, 3)))
+	println(sub(add(10, 2), sub(5, add(1, 1))))
+	println(digits(trace(4), trace(5), trace(6)))
+	println(digits(sub(9, 8), digits(0, 0, 2), add(1, add(1, 1))))
+	println(swap(3, 10), swap(swap(1, 2), swap(3, 4)))
+	q, r := divmod(add(40, 7), sub(7, 2))
+	println(q, r, order)
+	println(label(label("inner", 1), len(label("first", 2))))
+	println(sum9(trace(1), 2, 3, 4, 5, 6, 7, sum9(1, 1, 1, 1, 1, 1, 1, 1, trace(9)), trace(10)))
+	return sub(add(20, trace(5)), digits(0, trace(1), trace(2)))
+}
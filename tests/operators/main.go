@@ -0,0 +1,39 @@
+package main
+
+func main() int {
+	result := 0
+	// The most negative value divided by -1 overflows back to itself.
+	minInt, minusOne := -9223372036854775807-1, -1
+	if 10-3-2 == 5 && 2+3*4 == 14 && (2+3)*4 == 20 {
+		result := 1
+		if 17/5 == 3 && 17%5 == 2 && -17/5 == -3 && -17%5 == -2 && minInt/minusOne == minInt && minInt%minusOne == 0 {
+			result := result + 2
+			if 12&10 == 8 && 12|10 == 14 && 12^10 == 6 && 12&^10 == 4 && ^5 == -6 {
+				result := result + 4
+				one := 1
+				if 1<<4 == 16 && one<<64 == 0 && -16>>2 == -4 && -1>>100 == -1 && +3 == 3 {
+					result := result + 8
+					if 1 < 2 && 2 <= 2 && 3 > 2 && 3 >= 3 && 1 != 2 && !(1 > 2) && true != false {
+						result := result + 16
+						if !(true && false) && (false || true) && (true || boom()) {
+							return result + 32 + sideEffectFree()
+						}
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+func boom() bool {
+	zero := 0
+	return 1/zero == 0
+}
+
+func sideEffectFree() int {
+	if false && boom() || true || boom() {
+		return 0
+	}
+	return 100
+}
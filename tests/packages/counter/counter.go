@@ -0,0 +1,14 @@
+package counter
+
+// Count is initialized before the packages importing this one.
+var Count = start()
+
+func start() int {
+	println("counter init")
+	return 10
+}
+
+func Next() int {
+	Count++
+	return Count
+}
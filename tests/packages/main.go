@@ -0,0 +1,23 @@
+package main
+
+import (
+	c "example.com/packages/counter"
+	"example.com/packages/util"
+)
+
+var first = setup()
+
+func setup() int {
+	println("main init", util.Greeting, c.Count)
+	return c.Next()
+}
+
+func Next() int {
+	return 1
+}
+
+func main() int {
+	var t util.Celsius = util.Boiling
+	println(util.Max(3, 7), util.Next(), c.Count, first, Next())
+	return int(t-util.Celsius(60)) + util.Max(c.Count, 2)
+}
@@ -0,0 +1,28 @@
+package util
+
+import "example.com/packages/counter"
+
+type Celsius int
+
+const Boiling Celsius = 100
+
+var Greeting = greet("util")
+
+func greet(name string) string {
+	println("util init", counter.Count)
+	return "hello, " + name
+}
+
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Next is a function of the same name as the one in counter, which is a different symbol.
+func Next() int {
+	return counter.Next() + offset
+}
+
+var offset = 1000
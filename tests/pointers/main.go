@@ -0,0 +1,107 @@
+package main
+
+type Node struct {
+	Value int
+	Next  *Node
+}
+
+type Pair struct {
+	Key   string
+	Count *int
+}
+
+var head *Node
+
+var counter = new(int)
+
+func main() int {
+	x, y := 1, 2
+	swap(&x, &y)
+	println(x, y)
+
+	p := &x
+	*p += 10
+	(*p)++
+	println(x, *p, p == &x, p != &y)
+
+	var none *Node
+	println(none == nil, none)
+
+	for i := 1; i <= 4; i++ {
+		push(i * i)
+	}
+	println(sum(head), length(head))
+
+	n := Node{Value: 5}
+	q := &n
+	q.Value *= 3
+	q.Next = &Node{Value: 1}
+	println(n.Value, n.Next.Value, q.Next.Next == nil)
+
+	v := &n.Value
+	*v = 7
+	println(n.Value)
+
+	*counter = 3
+	incr(counter)
+	c := count()
+	println(*counter, *c)
+
+	first, second := fresh(), fresh()
+	*first = 9
+	println(*first, *second, first != second)
+
+	pair := Pair{Key: "k", Count: new(int)}
+	*pair.Count = 4
+	copied := pair
+	*copied.Count++
+	println(pair.Key, *pair.Count, pair == copied)
+
+	r := named()
+	return *r + x
+}
+
+func swap(a, b *int) {
+	*a, *b = *b, *a
+}
+
+func push(value int) {
+	head = &Node{Value: value, Next: head}
+}
+
+func sum(node *Node) int {
+	total := 0
+	for ; node != nil; node = node.Next {
+		total += node.Value
+	}
+	return total
+}
+
+func length(node *Node) int {
+	if node == nil {
+		return 0
+	}
+	return 1 + length(node.Next)
+}
+
+func incr(p *int) {
+	*p = *p + 1
+}
+
+func count() *int {
+	n := 0
+	for i := 0; i < 5; i++ {
+		n++
+	}
+	return &n
+}
+
+func fresh() *int {
+	return new(int)
+}
+
+func named() (r *int) {
+	value := 6
+	r = &value
+	return
+}
@@ -0,0 +1,27 @@
+package main
+
+func main() int {
+	a := 1
+	b := 2
+	c := 3
+	d := 4
+	e := 5
+	f := 6
+	g := 7
+	h := 8
+	i := 9
+	j := 10
+	k := 11
+	l := 12
+	m := 13
+	n := 14
+	o := 15
+	p := 16
+	t := id(100)
+	u := ((a*b+c*d)-(e*f-g*h))+((i*j-k*l)+(m*n-o*p))+id(a+p)
+	return a + b + c + d + e + f + g + h + i + j + k + l + m + n + o + p + t + u
+}
+
+func id(x int) int {
+	return x
+}
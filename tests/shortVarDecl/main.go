@@ -1,3 +1,5 @@
+package main
+
 func main() int {
 	x := 1
 	y := 2
@@ -0,0 +1,104 @@
+package main
+
+type Item struct {
+	Name  string
+	Count int
+}
+
+var log []string
+
+func record(s string) {
+	log = append(log, s)
+}
+
+func sum(s []int) int {
+	total := 0
+	for _, v := range s {
+		total += v
+	}
+	return total
+}
+
+func reverse(s []int) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+func grow(n int) []int {
+	s := make([]int, 0, 1)
+	for i := 0; i < n; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+func main() int {
+	s := []int{1, 2, 3, 4, 5}
+	println(len(s), cap(s), sum(s))
+	reverse(s)
+	println(s[0], s[4])
+
+	t := s[1:3]
+	println(len(t), cap(t), t[0], t[1])
+	t = t[:cap(t)]
+	println(len(t), t[3])
+	u := s[1:2:3]
+	u = append(u, 10)
+	println(s[2], len(u), cap(u))
+	u = append(u, 20)
+	u[0] = 0
+	println(s[1], s[3], len(u), cap(u))
+
+	var none []int
+	println(none == nil, len(none), cap(none), sum(none))
+	none = s[:0]
+	println(none == nil)
+
+	caps := []int{}
+	g := grow(0)
+	for i := 0; i < 2000; i++ {
+		g = append(g, i)
+		if len(caps) == 0 || caps[len(caps)-1] != cap(g) {
+			caps = append(caps, cap(g))
+		}
+	}
+	for _, c := range caps {
+		print(c, " ")
+	}
+	println()
+
+	m := make([]int, 3, 10)
+	n := copy(m, g[5:])
+	println(n, m[0], m[2], len(m), cap(m))
+	n = copy(g, g[1:4])
+	println(n, g[0], g[2], g[3])
+
+	items := make([]Item, 0, 2)
+	items = append(items, Item{"apple", 3}, Item{Name: "pear"})
+	items = append(items, items...)
+	items[3].Count = 7
+	for i, item := range items {
+		println(i, item.Name, item.Count)
+	}
+
+	grid := make([][]bool, 3)
+	for i := range grid {
+		grid[i] = make([]bool, i+1)
+		grid[i][i] = true
+	}
+	println(len(grid[2]), grid[2][2], grid[2][1])
+
+	record("a")
+	record("b")
+	record("c")
+	words := append([]string{"x"}, log[1:]...)
+	for _, w := range words {
+		print(w)
+	}
+	println()
+
+	str := "hello, world"
+	println(str[7:], str[:5], str[1], len(str[3:8]))
+	return sum(m) + len(items)
+}
@@ -0,0 +1,17 @@
+package main
+
+func greet(name string) string {
+	return "Hello, " + name + "!"
+}
+
+func main() int {
+	s := greet("indigo")
+	println(s)
+	println("len:", len(s), len(""))
+	print("tab\tquote\" raw:", `\n`, "\n")
+	println(1+2, -42, true, false)
+	println("abc" == "abc", "abc" != "abd", "ab" < "abc", "b" > "abc", "" <= "a", "a" >= "b")
+	x := "héllo, 世界"
+	println(len(x))
+	return len(s)
+}
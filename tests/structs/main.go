@@ -0,0 +1,63 @@
+package main
+
+type Point struct {
+	X, Y int
+}
+
+type Rect struct {
+	Min, Max Point
+	Label    string
+}
+
+type Flags struct {
+	a int8
+	b int64
+	c bool
+	_ int
+}
+
+var origin Point
+
+var unit = Rect{Max: Point{1, 1}, Label: "unit"}
+
+func main() int {
+	p := Point{X: 3}
+	p.Y = p.X * 2
+	q := Point{4, 5}
+	println(p.X, p.Y, q.X, q.Y)
+
+	r := Rect{Min: p, Max: add(p, q), Label: "r"}
+	r.Max.X++
+	r.Min.Y += 10
+	println(r.Min.X, r.Min.Y, r.Max.X, r.Max.Y, r.Label, area(r))
+
+	origin.X = 7
+	unit.Max.Y = 3
+	unit.Label += "!"
+	println(origin.X, origin.Y, unit.Max.X, unit.Max.Y, unit.Label, area(unit))
+
+	println(p == Point{3, 6}, p != q, r.Min == p, unit == Rect{Max: Point{1, 3}, Label: "unit!"})
+	f := Flags{a: 1, b: 2, c: true}
+	g := f
+	g.b = 3
+	println(f == g, f.b, g.b, g.c)
+
+	anonymous := struct{ X, Y int }{1, 2}
+	var converted Point = anonymous
+	println(converted.X+converted.Y, Point(anonymous) == Point{1, 2})
+
+	a, b := swap(p, q)
+	return a.X + b.Y + origin.X
+}
+
+func add(p, q Point) Point {
+	return Point{p.X + q.X, p.Y + q.Y}
+}
+
+func area(r Rect) int {
+	return (r.Max.X - r.Min.X) * (r.Max.Y - r.Min.Y)
+}
+
+func swap(p, q Point) (Point, Point) {
+	return q, p
+}
@@ -0,0 +1,53 @@
+package main
+
+func main() int {
+	var c Celsius = 25
+	f := toFahrenheit(c)
+	println(c, f, describe(c))
+	var w Weekday = Saturday
+	println(w, isWeekend(w), isWeekend(Monday))
+	var n Number = Number(counter)
+	n += 3
+	println(n, int(n)+int(f))
+	return int(f) - int(c)
+}
+
+const (
+	Sunday Weekday = iota
+	Monday
+	Saturday Weekday = 6
+)
+
+var counter = limit / 2
+
+const limit Small = 40
+
+func toFahrenheit(c Celsius) Fahrenheit {
+	return Fahrenheit(c*9/5 + 32)
+}
+
+func describe(c Celsius) Label {
+	if c > 20 {
+		return "warm"
+	}
+	return "cold"
+}
+
+func isWeekend(day Weekday) bool {
+	return day == Sunday || day == Saturday
+}
+
+type (
+	Celsius    Temperature
+	Fahrenheit Temperature
+)
+
+type Temperature int
+
+type Weekday uint8
+
+type Label string
+
+type Number Small
+
+type Small int8
@@ -0,0 +1,42 @@
+package main
+
+var total = trace("total", sum(3)+offset)
+
+var offset = trace("offset", base*2)
+
+var base = trace("base", 4)
+
+var (
+	greeting        = "hello"
+	limit    uint8  = 200
+	small    int8   = -5
+	enabled         = true
+	name     string
+	count, step     = trace("count", 1), trace("step", 2)
+	_               = trace("blank", 0)
+	zero     uint32
+)
+
+func trace(label string, value int) int {
+	println("init", label, value)
+	return value
+}
+
+func sum(n int) int {
+	if n == 0 {
+		return base
+	}
+	return n + sum(n-1)
+}
+
+func main() int {
+	println(total, offset, base)
+	println(greeting, limit, small, enabled, len(name), name == "", zero)
+	println(count, step)
+	var x int
+	var s string
+	var b bool
+	var u, v uint16 = 65535, 1
+	println(x, len(s), b, u+v)
+	return total
+}
@@ -1,24 +1,77 @@
 package main
 
-import "fmt"
+import "unicode"
 
 type TokenKind int
 
 const (
 	TOKEN_INT = iota
+	TOKEN_STRING
 	TOKEN_IDENTIFIER
 	// Symbols
 	TOKEN_LPAREN
 	TOKEN_RPAREN
 	TOKEN_LBRACE
 	TOKEN_RBRACE
-	TOKEN_PLUS
+	TOKEN_LBRACK
+	TOKEN_RBRACK
 	TOKEN_SEMICOLON
 	TOKEN_COLONEQUAL
+	TOKEN_ASSIGN
+	TOKEN_COLON
 	TOKEN_COMMA
+	TOKEN_DOT
+	TOKEN_ELLIPSIS
+	// Operators
+	TOKEN_PLUS
+	TOKEN_MINUS
+	TOKEN_STAR
+	TOKEN_SLASH
+	TOKEN_PERCENT
+	TOKEN_AMP
+	TOKEN_PIPE
+	TOKEN_CARET
+	TOKEN_AMPCARET
+	TOKEN_SHL
+	TOKEN_SHR
+	TOKEN_ANDAND
+	TOKEN_OROR
+	TOKEN_NOT
+	TOKEN_EQ
+	TOKEN_NE
+	TOKEN_LT
+	TOKEN_LE
+	TOKEN_GT
+	TOKEN_GE
+	// Assignment operators
+	TOKEN_PLUSEQUAL
+	TOKEN_MINUSEQUAL
+	TOKEN_STAREQUAL
+	TOKEN_SLASHEQUAL
+	TOKEN_PERCENTEQUAL
+	TOKEN_AMPEQUAL
+	TOKEN_PIPEEQUAL
+	TOKEN_CARETEQUAL
+	TOKEN_AMPCARETEQUAL
+	TOKEN_SHLEQUAL
+	TOKEN_SHREQUAL
+	TOKEN_PLUSPLUS
+	TOKEN_MINUSMINUS
 	// Keywords
 	TOKEN_FUNC
 	TOKEN_RETURN
+	TOKEN_IF
+	TOKEN_ELSE
+	TOKEN_FOR
+	TOKEN_BREAK
+	TOKEN_CONTINUE
+	TOKEN_CONST
+	TOKEN_VAR
+	TOKEN_TYPE
+	TOKEN_STRUCT
+	TOKEN_PACKAGE
+	TOKEN_IMPORT
+	TOKEN_RANGE
 	TOKEN_EOF
 )
 
@@ -26,6 +79,7 @@ type Token struct {
 	Kind  TokenKind
 	Value string
 	pos   Position
+	file  *SourceFile
 }
 
 type TokenStream struct {
@@ -33,6 +87,14 @@ type TokenStream struct {
 	index  int
 }
 
+// String returns the token as written in the source, or `EOF` for the end of the file, to be shown in syntax errors.
+func (token *Token) String() string {
+	if token.Kind == TOKEN_EOF {
+		return "EOF"
+	}
+	return token.Value
+}
+
 func (stream *TokenStream) IsEnd() bool {
 	token := stream.tokens[stream.index]
 	return token.Kind == TOKEN_EOF
@@ -42,15 +104,86 @@ func (stream *TokenStream) IsEnd() bool {
 
 func initKeywordMap() map[string]TokenKind {
 	return map[string]TokenKind{
-		"func":   TOKEN_FUNC,
-		"return": TOKEN_RETURN,
+		"func":     TOKEN_FUNC,
+		"return":   TOKEN_RETURN,
+		"if":       TOKEN_IF,
+		"else":     TOKEN_ELSE,
+		"for":      TOKEN_FOR,
+		"break":    TOKEN_BREAK,
+		"continue": TOKEN_CONTINUE,
+		"const":    TOKEN_CONST,
+		"var":      TOKEN_VAR,
+		"type":     TOKEN_TYPE,
+		"struct":   TOKEN_STRUCT,
+		"package":  TOKEN_PACKAGE,
+		"import":   TOKEN_IMPORT,
+		"range":    TOKEN_RANGE,
+	}
+}
+
+// Longest length of the keys of the map returned by `initPunctuationMap`.
+const maxPunctuationLength = 3
+
+func initPunctuationMap() map[string]TokenKind {
+	return map[string]TokenKind{
+		"(":   TOKEN_LPAREN,
+		")":   TOKEN_RPAREN,
+		"{":   TOKEN_LBRACE,
+		"}":   TOKEN_RBRACE,
+		"[":   TOKEN_LBRACK,
+		"]":   TOKEN_RBRACK,
+		";":   TOKEN_SEMICOLON,
+		":=":  TOKEN_COLONEQUAL,
+		"=":   TOKEN_ASSIGN,
+		":":   TOKEN_COLON,
+		",":   TOKEN_COMMA,
+		".":   TOKEN_DOT,
+		"...": TOKEN_ELLIPSIS,
+		"+":   TOKEN_PLUS,
+		"-":   TOKEN_MINUS,
+		"*":   TOKEN_STAR,
+		"/":   TOKEN_SLASH,
+		"%":   TOKEN_PERCENT,
+		"&":   TOKEN_AMP,
+		"|":   TOKEN_PIPE,
+		"^":   TOKEN_CARET,
+		"&^":  TOKEN_AMPCARET,
+		"<<":  TOKEN_SHL,
+		">>":  TOKEN_SHR,
+		"&&":  TOKEN_ANDAND,
+		"||":  TOKEN_OROR,
+		"!":   TOKEN_NOT,
+		"==":  TOKEN_EQ,
+		"!=":  TOKEN_NE,
+		"<":   TOKEN_LT,
+		"<=":  TOKEN_LE,
+		">":   TOKEN_GT,
+		">=":  TOKEN_GE,
+		// Assignment operators
+		"+=":  TOKEN_PLUSEQUAL,
+		"-=":  TOKEN_MINUSEQUAL,
+		"*=":  TOKEN_STAREQUAL,
+		"/=":  TOKEN_SLASHEQUAL,
+		"%=":  TOKEN_PERCENTEQUAL,
+		"&=":  TOKEN_AMPEQUAL,
+		"|=":  TOKEN_PIPEEQUAL,
+		"^=":  TOKEN_CARETEQUAL,
+		"&^=": TOKEN_AMPCARETEQUAL,
+		"<<=": TOKEN_SHLEQUAL,
+		">>=": TOKEN_SHREQUAL,
+		"++":  TOKEN_PLUSPLUS,
+		"--":  TOKEN_MINUSMINUS,
 	}
 }
 
+// Tokenize splits the source into tokens. Unknown characters are skipped after recording errors, which are returned together.
 func Tokenize(stream *ByteStream) (*TokenStream, error) {
 	keywordMap := initKeywordMap()
+	punctuationMap := initPunctuationMap()
+	var diagnostics Diagnostics
 	var tokens []Token
 	for {
+		previousPosition := stream.CurrentPosition
 		currentByte, ok := stream.get()
 		if !ok {
 			break
@@ -61,69 +194,49 @@ func Tokenize(stream *ByteStream) (*TokenStream, error) {
 			continue
 		} else if currentByte == '\n' {
 			if shouldInsertSemicolon(tokens) {
-				tokens = append(tokens, Token{Kind: TOKEN_SEMICOLON, Value: ";"})
-			}
-		} else if currentByte == '(' {
-			token := Token{
-				Kind:  TOKEN_LPAREN,
-				Value: string(currentByte),
-				pos:   pos,
-			}
-			tokens = append(tokens, token)
-		} else if currentByte == ')' {
-			token := Token{
-				Kind:  TOKEN_RPAREN,
-				Value: string(currentByte),
-				pos:   pos,
+				// The inserted semicolon is placed at the newline.
+				tokens = append(tokens, Token{Kind: TOKEN_SEMICOLON, Value: ";", pos: previousPosition.step(), file: stream.file})
 			}
-			tokens = append(tokens, token)
-		} else if currentByte == '{' {
-			token := Token{
-				Kind:  TOKEN_LBRACE,
-				Value: string(currentByte),
-				pos:   pos,
+		} else if next, _ := stream.peek(); currentByte == '/' && (next == '/' || next == '*') {
+			hasNewline, terminated := stream.skipComment()
+			if !terminated {
+				token := Token{Value: "/*", pos: pos, file: stream.file}
+				diagnostics.Add(errorAt(&token, "comment not terminated"))
 			}
-			tokens = append(tokens, token)
-		} else if currentByte == '}' {
-			token := Token{
-				Kind:  TOKEN_RBRACE,
-				Value: string(currentByte),
-				pos:   pos,
+			// A general comment containing newlines acts like a newline.
+			if hasNewline && shouldInsertSemicolon(tokens) {
+				tokens = append(tokens, Token{Kind: TOKEN_SEMICOLON, Value: ";", pos: pos, file: stream.file})
 			}
-			tokens = append(tokens, token)
-		} else if currentByte == '+' {
+		} else if value, kind, ok := stream.readPunctuation(punctuationMap); ok {
 			token := Token{
-				Kind:  TOKEN_PLUS,
-				Value: string(currentByte),
+				Kind:  kind,
+				Value: value,
 				pos:   pos,
+				file:  stream.file,
 			}
 			tokens = append(tokens, token)
-		} else if currentByte == ':' {
-			c, ok := stream.get()
-			if ok && c == '=' {
-				token := Token{
-					Kind:  TOKEN_COLONEQUAL,
-					Value: ":=",
-					pos:   pos,
-				}
-				tokens = append(tokens, token)
-			} else {
-				err := fmt.Errorf("unknown character: %c", currentByte)
-				return nil, err
+		} else if currentByte == '"' || currentByte == '`' {
+			literal, err := stream.readString(currentByte, pos)
+			if err != nil {
+				diagnostics.Add(err)
 			}
-		} else if currentByte == ',' {
 			token := Token{
-				Kind:  TOKEN_COMMA,
-				Value: string(currentByte),
+				Kind:  TOKEN_STRING,
+				Value: literal,
 				pos:   pos,
+				file:  stream.file,
 			}
 			tokens = append(tokens, token)
 		} else if isDigit(currentByte) {
-			digits := stream.readDigit(currentByte)
+			literal, err := stream.readNumber(currentByte, pos)
+			if err != nil {
+				diagnostics.Add(err)
+			}
 			token := Token{
 				Kind:  TOKEN_INT,
-				Value: digits,
+				Value: literal,
 				pos:   pos,
+				file:  stream.file,
 			}
 			tokens = append(tokens, token)
 		} else if isLetter(currentByte) {
@@ -138,16 +251,25 @@ func Tokenize(stream *ByteStream) (*TokenStream, error) {
 				Kind:  kind,
 				Value: identifier,
 				pos:   pos,
+				file:  stream.file,
 			}
 			tokens = append(tokens, token)
 		} else {
-			err := fmt.Errorf("unknown character: %c", currentByte)
-			return nil, err
+			token := Token{Value: string(currentByte), pos: pos, file: stream.file}
+			diagnostics.Add(errorAt(&token, "invalid character %#U", rune(currentByte)))
 		}
 	}
 
-	tokens = append(tokens, Token{Kind: TOKEN_EOF})
+	// The end of the file ends the last line as a newline does, even if the file does not end with one.
+	eof := stream.CurrentPosition.step()
+	if shouldInsertSemicolon(tokens) {
+		tokens = append(tokens, Token{Kind: TOKEN_SEMICOLON, Value: ";", pos: eof, file: stream.file})
+	}
+	tokens = append(tokens, Token{Kind: TOKEN_EOF, pos: eof, file: stream.file})
 
+	if err := diagnostics.Err(); err != nil {
+		return nil, err
+	}
 	return &TokenStream{tokens: tokens, index: 0}, nil
 }
 
@@ -182,29 +304,233 @@ func shouldInsertSemicolon(tokens []Token) bool {
 	}
 
 	switch tokens[len(tokens)-1].Kind {
-	case TOKEN_IDENTIFIER, TOKEN_INT, TOKEN_RPAREN, TOKEN_RBRACE:
+	case TOKEN_IDENTIFIER, TOKEN_INT, TOKEN_STRING, TOKEN_RPAREN, TOKEN_RBRACK, TOKEN_RBRACE, TOKEN_RETURN, TOKEN_BREAK, TOKEN_CONTINUE, TOKEN_PLUSPLUS, TOKEN_MINUSMINUS:
 		return true
 	default:
 		return false
 	}
 }
 
-func (stream *ByteStream) readDigit(c0 byte) string {
-	digits := []byte{c0}
+// readNumber reads an integer literal starting with `c0` at `pos`, and returns it as written in the source.
+// Besides decimal ones, it accepts hexadecimal, octal and binary literals with a prefix, and `_` between digits.
+// Refer to this page for the rule: https://go.dev/ref/spec#Integer_literals
+func (stream *ByteStream) readNumber(c0 byte, pos Position) (string, error) {
+	literal := []byte{c0}
+	base, name := 10, "decimal"
+	prefixed := false
+	if c0 == '0' {
+		// A literal starting with 0 is octal even without the prefix 0o.
+		base, name = 8, "octal"
+		if c, ok := stream.get(); ok {
+			prefixed = true
+			switch c {
+			case 'x', 'X':
+				base, name = 16, "hexadecimal"
+			case 'o', 'O':
+			case 'b', 'B':
+				base, name = 2, "binary"
+			default:
+				prefixed = false
+				stream.unget()
+			}
+			if prefixed {
+				literal = append(literal, c)
+			}
+		}
+	}
+
+	var err error
+	errorAtLiteral := func(format string, a ...any) {
+		if err == nil {
+			token := Token{Value: string(literal), pos: pos, file: stream.file}
+			err = errorAt(&token, format, a...)
+		}
+	}
+	// Whether the last character is a digit or the base prefix, which `_` must follow.
+	afterDigit := true
+	numDigits := 0
 	for {
 		c, ok := stream.get()
 		if !ok {
 			break
 		}
-
-		if !isDigit(c) {
+		if c == '_' {
+			if !afterDigit {
+				errorAtLiteral("'_' must separate successive digits")
+			}
+			afterDigit = false
+		} else if value := digitValue(c); value < 10 || base == 16 && value < 16 {
+			// Decimal digits beyond the base are read as part of the literal to report them.
+			if value >= uint64(base) {
+				errorAtLiteral("invalid digit %q in %s literal", c, name)
+			}
+			afterDigit = true
+			numDigits++
+		} else {
 			stream.unget()
 			break
 		}
+		literal = append(literal, c)
+	}
+	if prefixed && numDigits == 0 {
+		errorAtLiteral("%s literal has no digits", name)
+	} else if !afterDigit {
+		errorAtLiteral("'_' must separate successive digits")
+	}
+	return string(literal), err
+}
 
-		digits = append(digits, c)
+// readString reads a string literal whose opening `quote` at `pos` has been read, and returns it as written in the source.
+// Escape sequences are only validated here. The literal is decoded by `strconv.Unquote` when parsed.
+func (stream *ByteStream) readString(quote byte, pos Position) (string, error) {
+	literal := []byte{quote}
+	var err error
+	for {
+		c, ok := stream.get()
+		if !ok || (c == '\n' && quote == '"') {
+			if ok {
+				stream.unget()
+			}
+			opening := Token{Value: string(quote), pos: pos, file: stream.file}
+			if quote == '`' {
+				return string(literal), errorAt(&opening, "raw string literal not terminated")
+			}
+			if !ok {
+				return string(literal), errorAt(&opening, "string literal not terminated")
+			}
+			return string(literal), errorAt(&opening, "newline in string")
+		}
+		literal = append(literal, c)
+		if c == quote {
+			return string(literal), err
+		}
+		if c == '\\' && quote == '"' {
+			escapePos := stream.CurrentPosition
+			escape, escapeErr := stream.readEscape()
+			literal = append(literal, escape...)
+			if escapeErr != "" && err == nil {
+				token := Token{Value: "\\" + escape, pos: escapePos, file: stream.file}
+				err = errorAt(&token, "%s", escapeErr)
+			}
+		}
+	}
+}
+
+// readEscape reads an escape sequence in an interpreted string literal following a backslash.
+// Returns the bytes read and the reason why it is invalid, or an empty string if it is valid.
+// Refer to this page for the rule: https://go.dev/ref/spec#Rune_literals
+func (stream *ByteStream) readEscape() (string, string) {
+	c, ok := stream.get()
+	if !ok {
+		return "", "escape sequence not terminated"
+	}
+	var digits int
+	var base, max uint64
+	switch c {
+	case 'a', 'b', 'f', 'n', 'r', 't', 'v', '\\', '"':
+		return string(c), ""
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		stream.unget()
+		digits, base, max = 3, 8, 255
+	case 'x':
+		digits, base, max = 2, 16, 255
+	case 'u':
+		digits, base, max = 4, 16, unicode.MaxRune
+	case 'U':
+		digits, base, max = 8, 16, unicode.MaxRune
+	default:
+		if c == '\n' {
+			stream.unget()
+			return "", "unknown escape sequence"
+		}
+		return string(c), "unknown escape sequence"
+	}
+
+	escape := []byte{}
+	if base == 16 {
+		escape = append(escape, c)
+	}
+	var value uint64
+	for i := 0; i < digits; i++ {
+		d, ok := stream.get()
+		if !ok || digitValue(d) >= base {
+			if ok {
+				stream.unget()
+			}
+			return string(escape), "invalid character in escape sequence"
+		}
+		escape = append(escape, d)
+		value = value*base + digitValue(d)
+	}
+	if value > max || (0xD800 <= value && value < 0xE000 && max == unicode.MaxRune) {
+		return string(escape), "escape sequence is invalid Unicode code point"
+	}
+	return string(escape), ""
+}
+
+// digitValue returns the value of a hexadecimal digit `c`, or 16 if it is not a digit.
+func digitValue(c byte) uint64 {
+	switch {
+	case '0' <= c && c <= '9':
+		return uint64(c - '0')
+	case 'a' <= c && c <= 'f':
+		return uint64(c - 'a' + 10)
+	case 'A' <= c && c <= 'F':
+		return uint64(c - 'A' + 10)
+	default:
+		return 16
+	}
+}
+
+// skipComment skips a line comment or a general comment whose leading `/` has been read.
+// The newline ending a line comment is left to be read as a newline.
+// Returns whether the comment contains newlines and whether it is terminated.
+func (stream *ByteStream) skipComment() (bool, bool) {
+	if c, _ := stream.get(); c == '/' {
+		for {
+			c, ok := stream.get()
+			if !ok {
+				return false, true
+			}
+			if c == '\n' {
+				stream.unget()
+				return false, true
+			}
+		}
+	}
+
+	hasNewline := false
+	for {
+		c, ok := stream.get()
+		if !ok {
+			return hasNewline, false
+		}
+		if c == '\n' {
+			hasNewline = true
+		}
+		if next, _ := stream.peek(); c == '*' && next == '/' {
+			stream.get()
+			return hasNewline, true
+		}
+	}
+}
+
+// readPunctuation reads the longest operator or punctuation beginning with the byte just read.
+func (stream *ByteStream) readPunctuation(punctuationMap map[string]TokenKind) (string, TokenKind, bool) {
+	start := stream.currentIndex - 1
+	for length := maxPunctuationLength; length >= 1; length-- {
+		if start+length > len(stream.source) {
+			continue
+		}
+		candidate := stream.source[start : start+length]
+		if kind, ok := punctuationMap[candidate]; ok {
+			for i := 1; i < length; i++ {
+				stream.get()
+			}
+			return candidate, kind, true
+		}
 	}
-	return string(digits)
+	return "", 0, false
 }
 
 func (stream *ByteStream) readIdentifier(c0 byte) string {
@@ -16,6 +16,7 @@ func TestTokenizeMultipleLine(t *testing.T) {
 			{Kind: TOKEN_INT, Value: "42"},
 			{Kind: TOKEN_SEMICOLON, Value: ";"},
 			{Kind: TOKEN_INT, Value: "43"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
 			{Kind: TOKEN_EOF, Value: ""},
 		},
 		tokenStream.tokens,
@@ -35,6 +36,7 @@ func TestTokenizeShortVarDecl(t *testing.T) {
 			{Kind: TOKEN_IDENTIFIER, Value: "xy"},
 			{Kind: TOKEN_COLONEQUAL, Value: ":="},
 			{Kind: TOKEN_INT, Value: "42"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
 			{Kind: TOKEN_EOF, Value: ""},
 		},
 		tokenStream.tokens,
@@ -52,6 +54,7 @@ func TestTokenizeInt(t *testing.T) {
 	d := cmp.Diff(
 		[]Token{
 			{Kind: TOKEN_INT, Value: "42"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
 			{Kind: TOKEN_EOF, Value: ""},
 		},
 		tokenStream.tokens,
@@ -107,3 +110,172 @@ func TestTokenizeIdentifier(t *testing.T) {
 		t.Errorf("(-got +want)\n%s", d)
 	}
 }
+
+func TestTokenizeForClause(t *testing.T) {
+	stream := NewByteStream("L: for ; ; {")
+	tokenStream, err := Tokenize(stream)
+	assert.NoError(t, err)
+	d := cmp.Diff(
+		[]Token{
+			{Kind: TOKEN_IDENTIFIER, Value: "L"},
+			{Kind: TOKEN_COLON, Value: ":"},
+			{Kind: TOKEN_FOR, Value: "for"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_LBRACE, Value: "{"},
+			{Kind: TOKEN_EOF, Value: ""},
+		},
+		tokenStream.tokens,
+		opts...,
+	)
+	if len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestTokenizeOperators(t *testing.T) {
+	stream := NewByteStream("a&^b<<c<=d&&!e")
+	tokenStream, err := Tokenize(stream)
+	assert.NoError(t, err)
+	d := cmp.Diff(
+		[]Token{
+			{Kind: TOKEN_IDENTIFIER, Value: "a"},
+			{Kind: TOKEN_AMPCARET, Value: "&^"},
+			{Kind: TOKEN_IDENTIFIER, Value: "b"},
+			{Kind: TOKEN_SHL, Value: "<<"},
+			{Kind: TOKEN_IDENTIFIER, Value: "c"},
+			{Kind: TOKEN_LE, Value: "<="},
+			{Kind: TOKEN_IDENTIFIER, Value: "d"},
+			{Kind: TOKEN_ANDAND, Value: "&&"},
+			{Kind: TOKEN_NOT, Value: "!"},
+			{Kind: TOKEN_IDENTIFIER, Value: "e"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_EOF, Value: ""},
+		},
+		tokenStream.tokens,
+		opts...,
+	)
+	if len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestTokenizeInvalidCharacters(t *testing.T) {
+	stream := NewByteStream("x := 1 @ 2\ny := $")
+	_, err := Tokenize(stream)
+	assert.EqualError(t, err, "1:8: invalid character U+0040 '@'\n2:6: invalid character U+0024 '$'")
+}
+
+func TestTokenizeComments(t *testing.T) {
+	stream := NewByteStream("a // comment\nb /* one line */ / c /* multi\nline */ d /**/\ne")
+	tokenStream, err := Tokenize(stream)
+	assert.NoError(t, err)
+	d := cmp.Diff(
+		[]Token{
+			{Kind: TOKEN_IDENTIFIER, Value: "a"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_IDENTIFIER, Value: "b"},
+			{Kind: TOKEN_SLASH, Value: "/"},
+			{Kind: TOKEN_IDENTIFIER, Value: "c"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_IDENTIFIER, Value: "d"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_IDENTIFIER, Value: "e"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_EOF, Value: ""},
+		},
+		tokenStream.tokens,
+		opts...,
+	)
+	if len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+// The end of the file inserts a semicolon as a newline does, even after a comment.
+func TestTokenizeSemicolonAtEOF(t *testing.T) {
+	stream := NewByteStream("}\nreturn // comment")
+	tokenStream, err := Tokenize(stream)
+	assert.NoError(t, err)
+	d := cmp.Diff(
+		[]Token{
+			{Kind: TOKEN_RBRACE, Value: "}"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_RETURN, Value: "return"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_EOF, Value: ""},
+		},
+		tokenStream.tokens,
+		opts...,
+	)
+	if len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestTokenizeUnterminatedComment(t *testing.T) {
+	stream := NewByteStream("a\n  /* comment\n")
+	_, err := Tokenize(stream)
+	assert.EqualError(t, err, "2:3: comment not terminated")
+}
+
+func TestTokenizeStrings(t *testing.T) {
+	stream := NewByteStream("\"a\\tb\\x41\\u00e9\\\"\" `raw\\n`")
+	tokenStream, err := Tokenize(stream)
+	assert.NoError(t, err)
+	d := cmp.Diff(
+		[]Token{
+			{Kind: TOKEN_STRING, Value: "\"a\\tb\\x41\\u00e9\\\"\""},
+			{Kind: TOKEN_STRING, Value: "`raw\\n`"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_EOF, Value: ""},
+		},
+		tokenStream.tokens,
+		opts...,
+	)
+	if len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestTokenizeInvalidStrings(t *testing.T) {
+	stream := NewByteStream("\"a\\q\"\n\"open\n`raw")
+	_, err := Tokenize(stream)
+	assert.EqualError(t, err, `1:3: unknown escape sequence
+2:1: newline in string
+3:1: raw string literal not terminated`)
+}
+
+func TestTokenizeIntLiterals(t *testing.T) {
+	stream := NewByteStream("0x1F 0o17 017 0b1010 1_000 0 0X_ff")
+	tokenStream, err := Tokenize(stream)
+	assert.NoError(t, err)
+	d := cmp.Diff(
+		[]Token{
+			{Kind: TOKEN_INT, Value: "0x1F"},
+			{Kind: TOKEN_INT, Value: "0o17"},
+			{Kind: TOKEN_INT, Value: "017"},
+			{Kind: TOKEN_INT, Value: "0b1010"},
+			{Kind: TOKEN_INT, Value: "1_000"},
+			{Kind: TOKEN_INT, Value: "0"},
+			{Kind: TOKEN_INT, Value: "0X_ff"},
+			{Kind: TOKEN_SEMICOLON, Value: ";"},
+			{Kind: TOKEN_EOF, Value: ""},
+		},
+		tokenStream.tokens,
+		opts...,
+	)
+	if len(d) != 0 {
+		t.Errorf("(-got +want)\n%s", d)
+	}
+}
+
+func TestTokenizeInvalidIntLiterals(t *testing.T) {
+	stream := NewByteStream("0b102\n089\n0x\n1__0\n10_\n")
+	_, err := Tokenize(stream)
+	assert.EqualError(t, err, `1:1: invalid digit '2' in binary literal
+2:1: invalid digit '8' in octal literal
+3:1: hexadecimal literal has no digits
+4:1: '_' must separate successive digits
+5:1: '_' must separate successive digits`)
+}
@@ -2,21 +2,70 @@ package main
 
 import (
 	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type TypeID int
 
 const (
 	TypeIdUnresolved = iota
+	// Type of an expression with an error.
+	TypeIdInvalid
 	// TypeFunction
+	// Integer types from TypeIdInt to TypeIdUintptr. Unsigned ones start from TypeIdUint.
 	TypeIdInt
+	TypeIdInt8
+	TypeIdInt16
+	TypeIdInt32
+	TypeIdInt64
+	TypeIdUint
+	TypeIdUint8
+	TypeIdUint16
+	TypeIdUint32
+	TypeIdUint64
+	TypeIdUintptr
 	TypeIdBool
+	TypeIdString
+	// Types of untyped constants, which take a type from the context where they are used.
+	TypeIdUntypedInt
+	TypeIdUntypedBool
+	TypeIdUntypedString
+	// Type of a call of a function with multiple results, which can only be assigned or returned as a whole.
+	TypeIdTuple
+	TypeIdStruct
+	TypeIdPointer
+	TypeIdArray
+	TypeIdSlice
+	// Type of nil, which can be assigned to and compared with pointers and slices.
+	TypeIdUntypedNil
 )
 
 type Type struct {
 	Id   TypeID
 	Size int // Size on a memory in bytes.
 	Name string
+	// Types of the results in a tuple.
+	Elements []*Type
+	// Fields of a struct in the order of their declarations.
+	Fields []*Field
+	// Type which a pointer points to, or the type of the elements of an array or a slice.
+	Elem *Type
+	// Number of the elements of an array.
+	Len int
+	// Set only for a defined type. It is the type in the declaration until the declarations are resolved, and then its underlying type,
+	// whose Id, Size, Fields, Elem and Len the defined type takes.
+	Underlying *Type
+}
+
+// Field is a field of a struct, which is placed at `Offset` bytes from the beginning of the struct.
+type Field struct {
+	tok    *Token
+	Name   string
+	Ty     *Type
+	Offset int
 }
 
 func (ty *Type) GetSize() int {
@@ -27,118 +76,1996 @@ func isSameType(ty *Type, other *Type) bool {
 	if ty == nil || other == nil {
 		return false
 	}
+	// A defined type is different from any other type, even with the same underlying type.
+	if ty.isDefined() || other.isDefined() {
+		return ty == other
+	}
+	if ty.isStruct() && other.isStruct() {
+		return hasSameFields(ty, other)
+	}
+	if ty.isPointer() && other.isPointer() || ty.isSlice() && other.isSlice() {
+		return isSameType(ty.Elem, other.Elem)
+	}
+	if ty.isArray() && other.isArray() {
+		return ty.Len == other.Len && isSameType(ty.Elem, other.Elem)
+	}
 	return ty.Id == other.Id
 }
 
+// hasSameFields reports whether structs `ty` and `other` have the fields of the same names and the same types in the same order.
+func hasSameFields(ty *Type, other *Type) bool {
+	if len(ty.Fields) != len(other.Fields) {
+		return false
+	}
+	for i, field := range ty.Fields {
+		if field.Name != other.Fields[i].Name || !isSameType(field.Ty, other.Fields[i].Ty) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAssignable reports whether a value of type `ty` can be assigned to a variable of type `target`.
+// Besides the same type, a struct can be assigned to a struct type with the same fields, and a pointer, an array or a slice
+// to a type of the same kind with the same elements, if either of them is not a defined type. nil can be assigned to any pointer and slice.
+// Refer to this page for the rule: https://go.dev/ref/spec#Assignability
+func isAssignable(ty *Type, target *Type) bool {
+	if isSameType(ty, target) {
+		return true
+	}
+	if ty.isNil() && (target.isPointer() || target.isSlice()) {
+		return true
+	}
+	if ty == nil || target == nil || ty.isDefined() && target.isDefined() {
+		return false
+	}
+	if ty.isPointer() && target.isPointer() || ty.isSlice() && target.isSlice() {
+		return isSameType(ty.Elem, target.Elem)
+	}
+	if ty.isArray() && target.isArray() {
+		return ty.Len == target.Len && isSameType(ty.Elem, target.Elem)
+	}
+	return ty.isStruct() && target.isStruct() && hasSameFields(ty, target)
+}
+
+// newStruct returns the struct of `fields`, which is named like "struct{x int; y string}".
+// Its layout is determined by `layOut` once the types of the fields are resolved.
+func newStruct(fields []*Field) *Type {
+	ty := &Type{Id: TypeIdStruct, Fields: fields}
+	ty.Name = literalName(ty)
+	return ty
+}
+
+// literalName returns the name of type literal `ty` spelled out from the names of the types it consists of.
+// The parser names the literals again once the lengths of the arrays in them are evaluated.
+func literalName(ty *Type) string {
+	switch ty.Id {
+	case TypeIdStruct:
+		names := make([]string, len(ty.Fields))
+		for i, field := range ty.Fields {
+			names[i] = field.Name + " " + field.Ty.Name
+		}
+		return "struct{" + strings.Join(names, "; ") + "}"
+	case TypeIdPointer:
+		return "*" + ty.Elem.Name
+	case TypeIdArray:
+		return fmt.Sprintf("[%d]%s", ty.Len, ty.Elem.Name)
+	case TypeIdSlice:
+		return "[]" + ty.Elem.Name
+	}
+	return ty.Name
+}
+
+// layOut places the fields of struct `ty` in order, each aligned to its alignment, and determines the size of the struct,
+// which is a multiple of its alignment so that the fields of the elements in a sequence are aligned as well.
+func (ty *Type) layOut() {
+	offset := 0
+	for _, field := range ty.Fields {
+		field.Offset = alignTo(offset, field.Ty.align())
+		offset = field.Offset + field.Ty.Size
+	}
+	ty.Size = alignTo(offset, ty.align())
+}
+
+// align returns the alignment of `ty` in memory in bytes. A struct is aligned as its most aligned field, an array as its elements,
+// and a string and a slice as their pointers.
+func (ty *Type) align() int {
+	switch {
+	case ty.isArray():
+		return ty.Elem.align()
+	case ty.isStruct():
+		align := 1
+		for _, field := range ty.Fields {
+			if fieldAlign := field.Ty.align(); fieldAlign > align {
+				align = fieldAlign
+			}
+		}
+		return align
+	case ty.isString(), ty.isSlice():
+		return 8
+	case ty.Size == 0:
+		return 1
+	}
+	return ty.Size
+}
+
+func (ty *Type) isStruct() bool {
+	return ty != nil && ty.Id == TypeIdStruct
+}
+
+// newPointer returns the pointer to `elem`, which is named like "*int".
+func newPointer(elem *Type) *Type {
+	return &Type{Id: TypeIdPointer, Size: 8, Name: "*" + elem.Name, Elem: elem}
+}
+
+// newArray returns the array of `n` elements of `elem`, which is named like "[3]int".
+// Its size is determined by `layOutArray` once the element type is resolved.
+func newArray(elem *Type, n int) *Type {
+	ty := &Type{Id: TypeIdArray, Elem: elem, Len: n}
+	ty.Name = literalName(ty)
+	ty.layOutArray()
+	return ty
+}
+
+// layOutArray determines the size of array `ty`, whose elements follow each other without padding since the size of the element type is aligned.
+func (ty *Type) layOutArray() {
+	ty.Size = ty.Len * ty.Elem.Size
+}
+
+func (ty *Type) isArray() bool {
+	return ty != nil && ty.Id == TypeIdArray
+}
+
+// newSlice returns the slice of `elem`, which is named like "[]int".
+// A slice is a header of the pointer to its underlying array, its length and its capacity.
+func newSlice(elem *Type) *Type {
+	return &Type{Id: TypeIdSlice, Size: 24, Name: "[]" + elem.Name, Elem: elem}
+}
+
+func (ty *Type) isSlice() bool {
+	return ty != nil && ty.Id == TypeIdSlice
+}
+
+// isIndexable reports whether the elements of a value of `ty` can be indexed, which is true for strings, arrays, pointers to arrays and slices.
+func (ty *Type) isIndexable() bool {
+	return ty.isString() || ty.isArray() || ty.isSlice() || ty.isPointer() && ty.Elem.isArray()
+}
+
+// indexedType returns the type of the elements of indexable `ty`. The elements of a string are bytes.
+func indexedType(ty *Type) *Type {
+	switch {
+	case ty.isString():
+		return &TypeUint8
+	case ty.isPointer():
+		return ty.Elem.Elem
+	}
+	return ty.Elem
+}
+
+func (ty *Type) isPointer() bool {
+	return ty != nil && ty.Id == TypeIdPointer
+}
+
+func (ty *Type) isNil() bool {
+	return ty != nil && ty.Id == TypeIdUntypedNil
+}
+
+// hasPointers reports whether a value of `ty` holds any pointer, which a string does to its bytes and a slice to its underlying array.
+// The escape analysis tracks only the values holding pointers.
+func (ty *Type) hasPointers() bool {
+	if ty.isArray() {
+		return ty.Elem.hasPointers()
+	}
+	if ty.isStruct() {
+		for _, field := range ty.Fields {
+			if field.Ty.hasPointers() {
+				return true
+			}
+		}
+		return false
+	}
+	return ty.isPointer() || ty.isString() || ty.isSlice()
+}
+
+// field returns the field of struct `ty` named `name`, or nil if there is none. Blank fields cannot be referred to.
+func (ty *Type) field(name string) *Field {
+	if name == "_" {
+		return nil
+	}
+	for _, field := range ty.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// isComparable reports whether values of `ty` can be compared with == and !=. A struct is comparable if all its fields are,
+// and an array if its elements are. Pointers are equal if they point to the same variable. Slices can only be compared with nil.
+func (ty *Type) isComparable() bool {
+	if ty.isArray() {
+		return ty.Elem.isComparable()
+	}
+	if ty.isStruct() {
+		for _, field := range ty.Fields {
+			if !field.Ty.isComparable() {
+				return false
+			}
+		}
+		return true
+	}
+	return ty.isInteger() || ty.isBoolean() || ty.isString() || ty.isPointer()
+}
+
+// newTuple returns the tuple of `types`, which is named like "(int, string)".
+func newTuple(types []*Type) *Type {
+	names := make([]string, len(types))
+	for i, ty := range types {
+		names[i] = ty.Name
+	}
+	return &Type{Id: TypeIdTuple, Name: "(" + strings.Join(names, ", ") + ")", Elements: types}
+}
+
+func (ty *Type) isTuple() bool {
+	return ty != nil && ty.Id == TypeIdTuple
+}
+
+// elements returns the types of the values of `ty`: none for nil, the elements of a tuple, or `ty` itself.
+func (ty *Type) elements() []*Type {
+	switch {
+	case ty == nil:
+		return nil
+	case ty.isTuple():
+		return ty.Elements
+	}
+	return []*Type{ty}
+}
+
+// isDefined reports whether `ty` is declared by a type declaration.
+func (ty *Type) isDefined() bool {
+	return ty != nil && ty.Underlying != nil
+}
+
 func (ty *Type) isUnresolved() bool {
 	return ty.Id == TypeIdUnresolved
 }
 
+func (ty *Type) isInvalid() bool {
+	return ty != nil && ty.Id == TypeIdInvalid
+}
+
+// isInteger reports whether `ty` is an integer type or untyped int.
+func (ty *Type) isInteger() bool {
+	return ty != nil && (TypeIdInt <= ty.Id && ty.Id <= TypeIdUintptr || ty.Id == TypeIdUntypedInt)
+}
+
+func (ty *Type) isBoolean() bool {
+	return ty != nil && (ty.Id == TypeIdBool || ty.Id == TypeIdUntypedBool)
+}
+
+func (ty *Type) isString() bool {
+	return ty != nil && (ty.Id == TypeIdString || ty.Id == TypeIdUntypedString)
+}
+
+func (ty *Type) isUntyped() bool {
+	return ty != nil && TypeIdUntypedInt <= ty.Id && ty.Id <= TypeIdUntypedString
+}
+
+// defaultType returns the type which an untyped constant of `ty` takes where no type is expected, such as in `x := 1`.
+func defaultType(ty *Type) *Type {
+	if ty == nil {
+		return nil
+	}
+	switch ty.Id {
+	case TypeIdUntypedInt:
+		return &TypeInt
+	case TypeIdUntypedBool:
+		return &TypeBool
+	case TypeIdUntypedString:
+		return &TypeString
+	default:
+		return ty
+	}
+}
+
+// hasSameKind reports whether `ty` and `other` are both integers, booleans or strings, regardless of their sizes and whether typed.
+func hasSameKind(ty *Type, other *Type) bool {
+	return ty.isInteger() && other.isInteger() || ty.isBoolean() && other.isBoolean() || ty.isString() && other.isString()
+}
+
+func (ty *Type) isUnsigned() bool {
+	return ty != nil && TypeIdUint <= ty.Id && ty.Id <= TypeIdUintptr
+}
+
+// minValue and maxValue return the range of the values of integer type `ty`.
+func (ty *Type) minValue() *big.Int {
+	if ty.isUnsigned() {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), uint(ty.Size*8-1)))
+}
+
+func (ty *Type) maxValue() *big.Int {
+	bits := ty.Size * 8
+	if !ty.isUnsigned() {
+		bits--
+	}
+	max := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	return max.Sub(max, big.NewInt(1))
+}
+
+// representable reports whether integer type `ty` can hold `value`.
+func (ty *Type) representable(value *big.Int) bool {
+	return ty.minValue().Cmp(value) <= 0 && value.Cmp(ty.maxValue()) <= 0
+}
+
 var TypeUnresolved = Type{Id: TypeIdUnresolved, Size: 0}
-var TypeBool = Type{Id: TypeIdInt, Size: 16, Name: "bool"}
-var TypeInt = Type{Id: TypeIdBool, Size: 16, Name: "int"}
+var TypeInvalid = Type{Id: TypeIdInvalid, Size: 0, Name: "invalid type"}
+var TypeBool = Type{Id: TypeIdBool, Size: 1, Name: "bool"}
+var TypeInt = Type{Id: TypeIdInt, Size: 8, Name: "int"}
+var TypeInt8 = Type{Id: TypeIdInt8, Size: 1, Name: "int8"}
+var TypeInt16 = Type{Id: TypeIdInt16, Size: 2, Name: "int16"}
+var TypeInt32 = Type{Id: TypeIdInt32, Size: 4, Name: "int32"}
+var TypeInt64 = Type{Id: TypeIdInt64, Size: 8, Name: "int64"}
+var TypeUint = Type{Id: TypeIdUint, Size: 8, Name: "uint"}
+var TypeUint8 = Type{Id: TypeIdUint8, Size: 1, Name: "uint8"}
+var TypeUint16 = Type{Id: TypeIdUint16, Size: 2, Name: "uint16"}
+var TypeUint32 = Type{Id: TypeIdUint32, Size: 4, Name: "uint32"}
+var TypeUint64 = Type{Id: TypeIdUint64, Size: 8, Name: "uint64"}
+var TypeUintptr = Type{Id: TypeIdUintptr, Size: 8, Name: "uintptr"}
+
+// A string is a header of the pointer to its bytes and its length.
+var TypeString = Type{Id: TypeIdString, Size: 16, Name: "string"}
 
+var TypeUntypedInt = Type{Id: TypeIdUntypedInt, Name: "untyped int"}
+var TypeUntypedBool = Type{Id: TypeIdUntypedBool, Name: "untyped bool"}
+var TypeUntypedString = Type{Id: TypeIdUntypedString, Name: "untyped string"}
+var TypeUntypedNil = Type{Id: TypeIdUntypedNil, Name: "untyped nil"}
+
+// InferType checks types of all declarations. Errors do not stop the checking, and all of them are returned together.
 func (ast *Ast) InferType() error {
+	var diagnostics Diagnostics
+	for _, decl := range ast.consts {
+		InferTypeForNode(decl, ast.scope, &diagnostics)
+	}
+	for _, decl := range ast.vars {
+		InferTypeForNode(decl, ast.scope, &diagnostics)
+	}
 	for _, f := range ast.funcs {
-		if _, err := InferTypeForNode(f, f.Scope); err != nil {
-			return err
-		}
+		InferTypeForNode(f, f.Scope, &diagnostics)
 	}
-	return nil
+	ast.initOrder = ast.initializationOrder(&diagnostics)
+	return diagnostics.Err()
 }
 
 // Traverse AST and determine a type for defined variables.
-// Returns pointer to a determined `Type`.
-func InferTypeForNode(expr Expr, scope *Scope) (*Type, error) {
+// Returns pointer to a determined `Type`, which is `TypeInvalid` if `expr` has an error recorded to `diagnostics`.
+// Errors are not reported on an operand of `TypeInvalid` so that one mistake does not cascade.
+// A call of a function with multiple results is an error here, since `expr` is used as a single value.
+func InferTypeForNode(expr Expr, scope *Scope, diagnostics *Diagnostics) *Type {
+	ty := inferTuple(expr, scope, diagnostics)
+	if ty.isTuple() {
+		diagnostics.Add(errorAt(expr.token(), "multiple-value %s (value of type %s) in single-value context", exprString(expr), ty.Name))
+		return &TypeInvalid
+	}
+	return ty
+}
+
+// inferTuple is like `InferTypeForNode`, but `expr` may also be a call of a function with multiple results, whose type is a tuple.
+// Statements are checked with it, since an expression statement discards all the results.
+func inferTuple(expr Expr, scope *Scope, diagnostics *Diagnostics) *Type {
 	switch expr := expr.(type) {
 	case *FunctionDecl:
-		returnType, err := InferTypeForNode(expr.Body, scope)
-		if err != nil {
-			return nil, err
+		InferTypeForNode(expr.Body, scope, diagnostics)
+		if expr.ReturnType != nil && !isTerminating(expr.Body) {
+			diagnostics.Add(errorAt(expr.Body.rbrace, "missing return"))
 		}
-		actualType := expr.ReturnType
-		if returnType == nil && actualType != nil {
-			return nil, fmt.Errorf("%s: not enough return values\n\thave: ()\n\twant: (%s)", expr.token().pos.toString(), actualType.Name)
+	case *Block:
+		for _, node := range expr.Body {
+			inferTuple(node, expr.Scope, diagnostics)
 		}
-		if returnType != nil && actualType == nil {
-			return nil, fmt.Errorf("%s: too many return values\n\thave: (%s)\n\twant: ()", expr.token().pos.toString(), returnType.Name)
+	case *Return:
+		function := scope.enclosingFunction()
+		want := function.ReturnType.elements()
+		if len(expr.Values) == 0 {
+			// A bare return returns the named results.
+			if len(want) > 0 && function.Results[0].Name == "" {
+				diagnostics.Add(errorAt(function.token(), "not enough return values\n\thave: ()\n\twant: %s", formatTypes(want)))
+			}
+			return nil
 		}
-		if returnType != actualType {
-			return nil, fmt.Errorf("%s: cannot use %s as %s in return statement", expr.token().pos.toString(), returnType.Name, actualType.Name)
+		types, expanded := inferValues(expr.Values, scope, diagnostics)
+		for _, ty := range types {
+			if ty.isInvalid() {
+				return &TypeInvalid
+			}
 		}
-	case *Block:
-		var returnType *Type
-		for _, node := range expr.Body {
-			if ty, err := InferTypeForNode(node, scope); err != nil {
-				return nil, err
-			} else if _, ok := node.(*Return); ok {
-				returnType = ty
+		if len(types) == 1 && types[0] == nil {
+			// A call of a function without results.
+			types = nil
+		}
+		if len(types) < len(want) {
+			diagnostics.Add(errorAt(function.token(), "not enough return values\n\thave: %s\n\twant: %s", formatTypes(types), formatTypes(want)))
+			return nil
+		} else if len(types) > len(want) {
+			diagnostics.Add(errorAt(function.token(), "too many return values\n\thave: %s\n\twant: %s", formatTypes(types), formatTypes(want)))
+			return nil
+		}
+		for i, returnType := range types {
+			value := valueAt(expr.Values, i, expanded)
+			if returnType.isUntyped() {
+				if !hasSameKind(returnType, want[i]) {
+					returnType = defaultType(returnType)
+				} else if !convertUntyped(value, want[i], "return statement", diagnostics) {
+					continue
+				} else {
+					returnType = want[i]
+				}
+			}
+			if !isAssignable(returnType, want[i]) {
+				diagnostics.Add(errorAt(function.token(), "cannot use %s as %s in return statement", returnType.Name, want[i].Name))
+			} else if literal, ok := value.(*NilLiteral); ok {
+				literal.Ty = want[i]
 			}
 		}
-		return returnType, nil
-	case *Return:
-		if node, ok := expr.Node.(*Identifier); ok {
-			if variable, ok := scope.GetExpr(node.Name); !ok {
-				return nil, fmt.Errorf("%s: undefined: %s", node.token().pos.toString(), node.Name)
-			} else if variable := variable.(*Variable); variable.Ty.isUnresolved() {
-				return nil, fmt.Errorf("%s: undefined: %s", node.token().pos.toString(), node.Name)
+	case *If:
+		condType := InferTypeForNode(expr.Cond, scope, diagnostics)
+		if !condType.isInvalid() && !condType.isBoolean() {
+			diagnostics.Add(errorAt(expr.Cond.token(), "non-boolean condition in if statement"))
+		} else {
+			convertUntyped(expr.Cond, &TypeBool, "if statement", diagnostics)
+		}
+		InferTypeForNode(expr.Then, scope, diagnostics)
+		if expr.Else != nil {
+			InferTypeForNode(expr.Else, scope, diagnostics)
+		}
+	case *For:
+		if expr.Range != nil {
+			inferRange(expr, diagnostics)
+		}
+		if expr.Init != nil {
+			inferTuple(expr.Init, expr.Scope, diagnostics)
+		}
+		if expr.Cond != nil {
+			condType := InferTypeForNode(expr.Cond, expr.Scope, diagnostics)
+			if !condType.isInvalid() && !condType.isBoolean() {
+				diagnostics.Add(errorAt(expr.Cond.token(), "non-boolean condition in for statement"))
+			} else {
+				convertUntyped(expr.Cond, &TypeBool, "for statement", diagnostics)
 			}
 		}
-		return InferTypeForNode(expr.Node, scope)
+		if expr.Post != nil {
+			inferTuple(expr.Post, expr.Scope, diagnostics)
+		}
+		InferTypeForNode(expr.Body, expr.Scope, diagnostics)
 	case *Assign:
-		rhsType, err := InferTypeForNode(expr.Rhs, scope)
-		if err != nil {
-			return nil, err
+		inferAssignment(expr.Lhs, expr.Rhs, scope, diagnostics)
+	case *AssignStmt:
+		if expr.Op != 0 {
+			// The operation `x op y` of `x op= y` is checked as a binary operation, whose result is assigned to `x`.
+			if ty := InferTypeForNode(expr.Rhs[0], scope, diagnostics); !ty.isInvalid() {
+				checkAddressable(expr.Lhs[0], diagnostics)
+			}
+			return nil
 		}
-		variable, ok := expr.Lhs.(*Variable)
-		if !ok {
-			return nil, fmt.Errorf("%s: non-name on left side of :=", expr.Lhs.token().pos.toString())
+		inferAssignment(expr.Lhs, expr.Rhs, scope, diagnostics)
+	case *IncDec:
+		operandType := InferTypeForNode(expr.Operand, scope, diagnostics)
+		if operandType.isInvalid() {
+			return nil
 		}
-		if variable, ok := scope.GetExpr(variable.Name); ok {
-			if variable := variable.(*Variable); variable.Ty.isUnresolved() {
-				variable.Ty = rhsType
-				return rhsType, nil
-			} else {
-				return nil, fmt.Errorf("%s: no new variables on left side of :=", expr.Lhs.token().pos.toString())
+		if operandType == nil || !operandType.isInteger() {
+			diagnostics.Add(errorAt(expr.Operand.token(), "invalid operation: %s%s (non-numeric type %s)", exprString(expr.Operand), expr.token().Value, typeName(defaultType(operandType))))
+			return nil
+		}
+		checkAddressable(expr.Operand, diagnostics)
+	case *VarDecl:
+		for _, spec := range expr.Specs {
+			// A spec at the package level may have been checked where it is used.
+			if spec.Names[0].Ty.isUnresolved() {
+				inferVarSpec(spec, diagnostics)
+			}
+		}
+	case *ConstDecl:
+		for _, spec := range expr.Specs {
+			for _, constant := range spec.Names {
+				if constant.Ty.isUnresolved() {
+					inferConstant(constant, diagnostics)
+				}
+			}
+			if len(spec.Values) > len(spec.Names) {
+				diagnostics.Add(errorAt(spec.Values[len(spec.Names)].token(), "extra init expr"))
+			}
+		}
+	case *BinaryOp:
+		lhsType := InferTypeForNode(expr.Lhs, scope, diagnostics)
+		rhsType := InferTypeForNode(expr.Rhs, scope, diagnostics)
+		if lhsType.isInvalid() || rhsType.isInvalid() {
+			return &TypeInvalid
+		}
+		if expr.Op == TOKEN_SHL || expr.Op == TOKEN_SHR {
+			return inferShift(expr, lhsType, rhsType, diagnostics)
+		}
+		// An untyped operand takes the type of the other operand.
+		if lhsType.isUntyped() && rhsType != nil && !rhsType.isUntyped() && hasSameKind(lhsType, rhsType) {
+			if !convertOperand(expr.Lhs, rhsType, diagnostics) {
+				return &TypeInvalid
 			}
+			lhsType = rhsType
+		} else if rhsType.isUntyped() && lhsType != nil && !lhsType.isUntyped() && hasSameKind(lhsType, rhsType) {
+			if !convertOperand(expr.Rhs, lhsType, diagnostics) {
+				return &TypeInvalid
+			}
+			rhsType = lhsType
+		}
+		// nil takes the type of the pointer or the slice it is compared with. A slice can only be compared with nil.
+		withNil := false
+		if lhsType.isNil() && (rhsType.isPointer() || rhsType.isSlice()) {
+			lhsType, withNil = rhsType, true
+		} else if rhsType.isNil() && (lhsType.isPointer() || lhsType.isSlice()) {
+			rhsType, withNil = lhsType, true
 		}
-	case *AddOp:
-		lhsType, err := InferTypeForNode(expr.Lhs, scope)
-		if err != nil {
-			return nil, err
+		// Operands of types which differ only in the names of the same structs can be compared, as either is assignable to the other.
+		if !isSameType(lhsType, rhsType) && !(isComparisonOperator(expr.Op) && (isAssignable(lhsType, rhsType) || isAssignable(rhsType, lhsType))) {
+			diagnostics.Add(errorAt(expr.token(), "invalid operation: %s different types", operatorVerb(expr.Op)))
+			return &TypeInvalid
 		}
-		rhsType, err := InferTypeForNode(expr.Rhs, scope)
-		if err != nil {
-			return nil, err
+		expr.OperandType = lhsType
+		equality := expr.Op == TOKEN_EQ || expr.Op == TOKEN_NE
+		if lhsType.isSlice() && equality && !withNil {
+			diagnostics.Add(errorAt(expr.Lhs.token(), "invalid operation: %s (slice can only be compared to nil)", exprString(expr)))
+			return &TypeInvalid
 		}
-		if !isSameType(lhsType, rhsType) {
-			return nil, fmt.Errorf("%s: invalid operation: adding different types", expr.token().pos.toString())
+		if !isOperandTypeAllowed(expr.Op, lhsType) && !(withNil && equality) {
+			diagnostics.Add(errorAt(expr.token(), "invalid operation: operator %s not defined on %s", expr.token().Value, typeName(defaultType(lhsType))))
+			return &TypeInvalid
 		}
-		return lhsType, nil
+		lhs, rhs := constantOf(expr.Lhs), constantOf(expr.Rhs)
+		if (expr.Op == TOKEN_SLASH || expr.Op == TOKEN_PERCENT) && rhs != nil && rhs.isZero() {
+			diagnostics.Add(errorAt(expr.Rhs.token(), "invalid operation: division by zero"))
+			return &TypeInvalid
+		}
+		if lhs != nil && rhs != nil {
+			return foldConstant(expr, foldBinary(expr.Op, lhs, rhs), diagnostics)
+		}
+		if isComparisonOperator(expr.Op) {
+			return &TypeBool
+		}
+		return lhsType
+	case *UnaryOp:
+		switch expr.Op {
+		case TOKEN_AMP:
+			return inferAddress(expr, scope, diagnostics)
+		case TOKEN_STAR:
+			return inferIndirection(expr, scope, diagnostics)
+		}
+		operandType := InferTypeForNode(expr.Operand, scope, diagnostics)
+		if operandType.isInvalid() {
+			return &TypeInvalid
+		}
+		// Unlike binary +, unary + is not defined on strings.
+		if operandType == nil || !isOperandTypeAllowed(expr.Op, operandType) || operandType.isString() {
+			diagnostics.Add(errorAt(expr.token(), "invalid operation: operator %s not defined on %s", expr.token().Value, typeName(defaultType(operandType))))
+			return &TypeInvalid
+		}
+		if operand := constantOf(expr.Operand); operand != nil {
+			return foldConstant(expr, foldUnary(expr.Op, operand), diagnostics)
+		}
+		return operandType
 	case *Identifier:
-		variable, ok := scope.GetExpr(expr.Name)
-		if !ok {
-			return nil, fmt.Errorf("%s: undefined: %s", variable.token().pos.toString(), expr.Name)
+		if isBlank(expr) {
+			diagnostics.Add(errorAt(expr.token(), "cannot use _ as value or type"))
+			return &TypeInvalid
 		}
-		if variable, ok := variable.(*Variable); ok {
-			expr.Variable = variable
-			return variable.Ty, nil
+		var declared Expr
+		if expr.Import != nil {
+			if expr.Import.Package == nil {
+				return &TypeInvalid
+			}
+			imported, ty, err := lookupImported(expr.Import, expr.token())
+			if err == nil && ty != nil {
+				err = errorAt(expr.token(), "%s (type) is not an expression", exprString(expr))
+			}
+			if err != nil {
+				diagnostics.Add(err)
+				return &TypeInvalid
+			}
+			declared = imported
+		} else if local, ok := scope.GetDeclaredExpr(expr.Name); ok {
+			declared = local
+		} else {
+			if expr.Name == "iota" {
+				diagnostics.Add(errorAt(expr.token(), "cannot use iota outside constant declaration"))
+			} else {
+				diagnostics.Add(errorAt(expr.token(), "undefined: %s", expr.Name))
+			}
+			return &TypeInvalid
+		}
+		switch declared := declared.(type) {
+		case *Variable:
+			expr.Variable = declared
+			// A package-level variable can be used before its declaration, and is checked on its first use.
+			if declared.Ty.isUnresolved() {
+				if declared.Spec.checking {
+					// The dependency on itself is reported as an initialization cycle after all the declarations are checked.
+					return &TypeInvalid
+				}
+				inferVarSpec(declared.Spec, diagnostics)
+			}
+			return declared.Ty
+		case *Constant:
+			// A constant at the package level can be used before its declaration, and is evaluated on its first use.
+			if declared.checking {
+				diagnostics.Add(errorAt(declared.token(), "invalid cycle in declaration of %s", declared.Name))
+				declared.Ty = &TypeInvalid
+			} else if declared.Ty.isUnresolved() {
+				inferConstant(declared, diagnostics)
+			}
+			if declared.Ty.isInvalid() {
+				return &TypeInvalid
+			}
+			expr.Constant = declared.Value
+			return declared.Ty
 		}
-		return nil, fmt.Errorf("%s: unexpected %s, expecting variable", variable.token().pos.toString(), expr.Name)
+		diagnostics.Add(errorAt(expr.token(), "syntax error: unexpected %s, expecting variable", expr.Name))
+		return &TypeInvalid
+	case *Iota:
+		expr.Constant = &ConstantValue{Ty: &TypeUntypedInt, Int: big.NewInt(int64(expr.Value))}
+		return expr.Constant.Ty
 	case *IntLiteral:
-		return &TypeInt, nil
+		expr.Constant = &ConstantValue{Ty: &TypeUntypedInt, Int: expr.value()}
+		return expr.Constant.Ty
 	case *BoolLiteral:
-		return &TypeBool, nil
+		expr.Constant = &ConstantValue{Ty: &TypeUntypedBool, Bool: expr.Value}
+		return expr.Constant.Ty
+	case *StringLiteral:
+		expr.Constant = &ConstantValue{Ty: &TypeUntypedString, String: expr.Value}
+		return expr.Constant.Ty
+	case *NilLiteral:
+		return &TypeUntypedNil
+	case *Selector:
+		ty := InferTypeForNode(expr.X, scope, diagnostics)
+		if ty.isInvalid() {
+			return &TypeInvalid
+		}
+		// A field of the struct which a pointer points to is selected through the pointer.
+		if ty.isPointer() && ty.Elem.isStruct() {
+			expr.Field, expr.Struct, expr.Indirect = ty.Elem.field(expr.Sel.Value), ty.Elem, true
+		} else if ty.isStruct() {
+			expr.Field, expr.Struct = ty.field(expr.Sel.Value), ty
+		}
+		if expr.Field == nil {
+			diagnostics.Add(errorAt(expr.Sel, "%s undefined (type %s has no field or method %s)", exprString(expr), typeName(ty), expr.Sel.Value))
+			return &TypeInvalid
+		}
+		return expr.Field.Ty
+	case *Index:
+		return inferIndex(expr, scope, diagnostics)
+	case *SliceExpr:
+		return inferSliceExpr(expr, scope, diagnostics)
+	case *CompositeLit:
+		return inferCompositeLit(expr, scope, diagnostics)
 	case *FunctionCall:
+		if expr.Import != nil {
+			return inferQualifiedCall(expr, scope, diagnostics)
+		}
+		if ty, ok := scope.GetType(expr.Name()); ok && !scope.ExistsExpr(expr.Name()) {
+			expr.Conversion = ty
+			return inferConversion(expr, scope, diagnostics)
+		}
 		maybeFunctionDecl, ok := scope.GetExpr(expr.Name())
-		if !ok {
-			return nil, fmt.Errorf("%s: undefined: %s", expr.token().pos.toString(), expr.Name())
+		if _, isBuiltin := maybeFunctionDecl.(*Builtin); expr.Ellipsis && !isBuiltin {
+			diagnostics.Add(errorAt(expr.token(), "cannot use ... in call to non-variadic %s", expr.Name()))
+			return &TypeInvalid
 		}
 		if function, ok := maybeFunctionDecl.(*FunctionDecl); ok {
 			expr.Function = function
-			return function.ReturnType, nil
+			inferArguments(expr, scope, diagnostics)
+			return function.ReturnType
+		}
+		var argumentTypes []*Type
+		for _, argument := range expr.Arguments {
+			argumentTypes = append(argumentTypes, InferTypeForNode(argument, scope, diagnostics))
+		}
+		if !ok {
+			diagnostics.Add(errorAt(expr.token(), "undefined: %s", expr.Name()))
+			return &TypeInvalid
+		}
+		if builtin, ok := maybeFunctionDecl.(*Builtin); ok {
+			expr.Builtin = builtin
+			return inferBuiltinCall(expr, argumentTypes, diagnostics)
+		}
+		diagnostics.Add(errorAt(expr.token(), "invalid operation: cannot call non-function %s", expr.Name()))
+		return &TypeInvalid
+	}
+	return nil
+}
+
+// inferAddress checks `&x`, whose operand has to be addressable or a composite literal, and returns the pointer to its type.
+// The variable whose address is taken is marked, since it has to live in memory.
+func inferAddress(expr *UnaryOp, scope *Scope, diagnostics *Diagnostics) *Type {
+	operandType := InferTypeForNode(expr.Operand, scope, diagnostics)
+	if operandType.isInvalid() {
+		return &TypeInvalid
+	}
+	if _, ok := expr.Operand.(*CompositeLit); !ok && !isAddressable(expr.Operand) {
+		diagnostics.Add(errorAt(expr.Operand.token(), "invalid operation: cannot take address of %s", describeOperand(expr.Operand, operandType)))
+		return &TypeInvalid
+	}
+	markAddressed(expr.Operand)
+	expr.OperandType = operandType
+	return newPointer(operandType)
+}
+
+// markAddressed marks the variable which addressable `expr` is a part of as its address is taken, unless `expr` is reached through a pointer.
+func markAddressed(expr Expr) {
+	switch expr := expr.(type) {
+	case *Identifier:
+		expr.Variable.Addressed = true
+	case *Selector:
+		if !expr.Indirect {
+			markAddressed(expr.X)
+		}
+	case *Index:
+		if expr.OperandType.isArray() {
+			markAddressed(expr.X)
+		}
+	}
+}
+
+// inferIndirection checks `*p`, whose operand has to be a pointer, and returns the type it points to.
+func inferIndirection(expr *UnaryOp, scope *Scope, diagnostics *Diagnostics) *Type {
+	operandType := InferTypeForNode(expr.Operand, scope, diagnostics)
+	switch {
+	case operandType.isInvalid():
+		return &TypeInvalid
+	case operandType.isNil():
+		diagnostics.Add(errorAt(expr.Operand.token(), "invalid operation: cannot indirect nil"))
+		return &TypeInvalid
+	case !operandType.isPointer():
+		diagnostics.Add(errorAt(expr.Operand.token(), "invalid operation: cannot indirect %s", describeOperand(expr.Operand, operandType)))
+		return &TypeInvalid
+	}
+	expr.OperandType = operandType
+	return operandType.Elem
+}
+
+// inferIndex checks `x[i]`, whose operand has to be a string, an array, a pointer to an array or a slice, and returns the type of the element.
+// An element of a string is a byte. A constant index has to be in the range of an array or a constant string.
+func inferIndex(expr *Index, scope *Scope, diagnostics *Diagnostics) *Type {
+	ty := InferTypeForNode(expr.X, scope, diagnostics)
+	if ty.isInvalid() {
+		return &TypeInvalid
+	}
+	if ty == nil || !ty.isIndexable() {
+		diagnostics.Add(errorAt(expr.lbrack, "cannot index %s", describeValue(expr.X, ty)))
+		return &TypeInvalid
+	}
+	if ty.isUntyped() {
+		convertUntyped(expr.X, &TypeString, "index expression", diagnostics)
+		ty = &TypeString
+	}
+	indexType := InferTypeForNode(expr.Index, scope, diagnostics)
+	if !checkIndex(expr.Index, indexType, lengthOf(expr.X, ty), diagnostics) {
+		return &TypeInvalid
+	}
+	expr.OperandType = ty
+	// An array variable indexed with a variable lives in memory, where the element is located at run time.
+	if ty.isArray() && constantOf(expr.Index) == nil && isAddressable(expr.X) {
+		markAddressed(expr.X)
+	}
+	return indexedType(ty)
+}
+
+// inferSliceExpr checks `x[low:high:max]`, whose operand has to be a string, an addressable array, a pointer to an array or a slice.
+// Slicing a string results in a string, and slicing the others results in a slice of their elements.
+// The constant indices have to be in order, and in the range of an array or a constant string, which can be sliced up to its length.
+func inferSliceExpr(expr *SliceExpr, scope *Scope, diagnostics *Diagnostics) *Type {
+	ty := InferTypeForNode(expr.X, scope, diagnostics)
+	if ty.isInvalid() {
+		return &TypeInvalid
+	}
+	var result *Type
+	switch {
+	case ty.isString():
+		if expr.Max != nil {
+			diagnostics.Add(errorAt(expr.Max.token(), "invalid operation: 3-index slice of string"))
+			return &TypeInvalid
+		}
+		if ty.isUntyped() {
+			convertUntyped(expr.X, &TypeString, "slice expression", diagnostics)
+			ty = &TypeString
+		}
+		result = ty
+	case ty.isArray():
+		if !isAddressable(expr.X) {
+			diagnostics.Add(errorAt(expr.X.token(), "cannot slice unaddressable value %s", describeOperand(expr.X, ty)))
+			return &TypeInvalid
+		}
+		// The slice refers to the array, which has to live in memory.
+		markAddressed(expr.X)
+		result = newSlice(ty.Elem)
+	case ty.isPointer() && ty.Elem.isArray():
+		result = newSlice(ty.Elem.Elem)
+	case ty.isSlice():
+		result = ty
+	default:
+		diagnostics.Add(errorAt(expr.X.token(), "cannot slice %s", describeValue(expr.X, ty)))
+		return &TypeInvalid
+	}
+
+	bound := lengthOf(expr.X, ty)
+	if bound >= 0 {
+		bound++
+	}
+	var previous *ConstantValue
+	for _, index := range []Expr{expr.Low, expr.High, expr.Max} {
+		if index == nil {
+			continue
+		}
+		if !checkIndex(index, InferTypeForNode(index, scope, diagnostics), bound, diagnostics) {
+			return &TypeInvalid
+		}
+		value := constantOf(index)
+		if value == nil {
+			continue
+		}
+		if previous != nil && value.Int.Cmp(previous.Int) < 0 {
+			diagnostics.Add(errorAt(index.token(), "invalid slice indices: %s < %s", value.Int, previous.Int))
+			return &TypeInvalid
+		}
+		previous = value
+	}
+	expr.OperandType = ty
+	return result
+}
+
+// lengthOf returns the length of `x` of type `ty` if it is known at compile time, which is the case for an array, a pointer to an array
+// and a constant string, or -1 otherwise.
+func lengthOf(x Expr, ty *Type) int {
+	switch {
+	case ty.isArray():
+		return ty.Len
+	case ty.isPointer() && ty.Elem.isArray():
+		return ty.Elem.Len
+	}
+	if value := constantOf(x); value != nil && ty.isString() {
+		return len(value.String)
+	}
+	return -1
+}
+
+// checkIndex checks `index` of type `ty` used as an index or a length, which has to be an integer, and not negative if it is constant.
+// An untyped constant index becomes an int. A constant index also has to be less than `bound` unless `bound` is negative.
+func checkIndex(index Expr, ty *Type, bound int, diagnostics *Diagnostics) bool {
+	if ty.isInvalid() {
+		return false
+	}
+	value := constantOf(index)
+	if value != nil && value.Ty.isUntyped() {
+		if value.Int == nil {
+			diagnostics.Add(errorAt(index.token(), "cannot convert %s to type int", describeOperand(index, ty)))
+			return false
+		}
+		if !convertOperand(index, &TypeInt, diagnostics) {
+			return false
+		}
+		value, ty = constantOf(index), &TypeInt
+	}
+	if ty == nil || !ty.isInteger() {
+		diagnostics.Add(errorAt(index.token(), "invalid argument: index %s must be integer", describeValue(index, ty)))
+		return false
+	}
+	if value == nil {
+		return true
+	}
+	if value.Int.Sign() < 0 {
+		diagnostics.Add(errorAt(index.token(), "invalid argument: index %s must not be negative", describeOperand(index, ty)))
+		return false
+	}
+	if bound >= 0 && value.Int.Cmp(big.NewInt(int64(bound))) >= 0 {
+		diagnostics.Add(errorAt(index.token(), "invalid argument: index %s out of bounds [0:%d]", value.Int, bound))
+		return false
+	}
+	return true
+}
+
+// describeValue is `describeOperand` which also accepts a call of a function without results, whose type is nil.
+func describeValue(expr Expr, ty *Type) string {
+	if ty == nil {
+		return exprString(expr) + " (no value)"
+	}
+	return describeOperand(expr, ty)
+}
+
+// inferRange checks the range clause of `loop`, which ranges over an array, a pointer to an array or a slice.
+// The iteration variables declared by the clause take the types of the indices and the elements, and the operands assigned them
+// have to be assignable from them.
+func inferRange(loop *For, diagnostics *Diagnostics) {
+	ty := InferTypeForNode(loop.Range, loop.Scope, diagnostics)
+	var elem *Type
+	switch {
+	case ty.isInvalid():
+	case ty.isArray(), ty.isSlice():
+		elem = ty.Elem
+	case ty.isPointer() && ty.Elem.isArray():
+		elem = ty.Elem.Elem
+	case ty.isString():
+		diagnostics.Add(errorAt(loop.Range.token(), "range over %s is not supported", describeOperand(loop.Range, ty)))
+	default:
+		diagnostics.Add(errorAt(loop.Range.token(), "cannot range over %s", describeValue(loop.Range, ty)))
+	}
+	loop.RangeType = ty
+	types := []*Type{&TypeInt, elem}
+	for i, operand := range []Expr{loop.Key, loop.Value} {
+		if variable, ok := operand.(*Variable); ok {
+			variable.Ty = types[i]
+			if elem == nil {
+				variable.Ty = &TypeInvalid
+			}
+			continue
+		}
+		if operand == nil || isBlank(operand) || elem == nil {
+			continue
+		}
+		target := InferTypeForNode(operand, loop.Scope, diagnostics)
+		if target.isInvalid() || !checkAddressable(operand, diagnostics) {
+			continue
+		}
+		if !isAssignable(types[i], target) {
+			diagnostics.Add(errorAt(operand.token(), "cannot use %s (value of type %s) as %s value in assignment", exprString(operand), types[i].Name, target.Name))
+		}
+	}
+}
+
+// inferCompositeLit checks the elements of composite literal `literal` against its type, which is a struct, an array or a slice.
+// The literal has the type even if its elements are wrong.
+func inferCompositeLit(literal *CompositeLit, scope *Scope, diagnostics *Diagnostics) *Type {
+	ty := literal.Type
+	switch {
+	case ty.isInvalid():
+		return &TypeInvalid
+	case ty.isStruct():
+		inferStructLit(literal, scope, diagnostics)
+	case ty.isArray(), ty.isSlice():
+		inferArrayLit(literal, scope, diagnostics)
+	default:
+		diagnostics.Add(errorAt(literal.token(), "invalid composite literal type %s", ty.Name))
+		return &TypeInvalid
+	}
+	return literal.Type
+}
+
+// inferStructLit checks the elements of struct literal `literal` against the fields of its type.
+func inferStructLit(literal *CompositeLit, scope *Scope, diagnostics *Diagnostics) {
+	ty := literal.Type
+	if len(literal.Elements) == 0 {
+		return
+	}
+	context := "struct literal"
+	keyed := literal.Elements[0].Key != nil
+	assigned := map[*Field]bool{}
+	for i, element := range literal.Elements {
+		if (element.Key != nil) != keyed {
+			diagnostics.Add(errorAt(element.Value.token(), "mixture of field:value and value elements in struct literal"))
+			return
 		}
-		return nil, fmt.Errorf("%s: invalid operation: cannot call non-function %s", expr.token().pos.toString(), expr.Name())
+		if keyed {
+			key, ok := element.Key.(*Identifier)
+			if !ok || key.Import != nil {
+				diagnostics.Add(errorAt(element.Key.token(), "invalid field name %s in struct literal", exprString(element.Key)))
+				continue
+			}
+			element.Field = ty.field(key.Name)
+			if element.Field == nil {
+				diagnostics.Add(errorAt(key.token(), "unknown field %s in struct literal of type %s", key.Name, ty.Name))
+				continue
+			}
+			if assigned[element.Field] {
+				diagnostics.Add(errorAt(key.token(), "duplicate field name %s in struct literal", key.Name))
+				continue
+			}
+			assigned[element.Field] = true
+		} else {
+			if i >= len(ty.Fields) {
+				diagnostics.Add(errorAt(element.Value.token(), "too many values in struct literal of type %s", ty.Name))
+				return
+			}
+			element.Field = ty.Fields[i]
+		}
+		if value, ok := element.Value.(*CompositeLit); ok && value.elided {
+			diagnostics.Add(errorAt(value.token(), "missing type in composite literal"))
+			continue
+		}
+		valueType := InferTypeForNode(element.Value, scope, diagnostics)
+		if !valueType.isInvalid() {
+			assignedType(element.Value, valueType, element.Field.Ty, context, diagnostics)
+		}
+	}
+	if !keyed && len(literal.Elements) < len(ty.Fields) {
+		diagnostics.Add(errorAt(literal.rbrace, "too few values in struct literal of type %s", ty.Name))
+	}
+}
+
+// inferArrayLit checks the elements of array or slice literal `literal`, and determines their indices.
+// An element is keyed with a constant index, or follows the previous one. The length of `[...]T` is the largest index plus one.
+func inferArrayLit(literal *CompositeLit, scope *Scope, diagnostics *Diagnostics) {
+	ty := literal.Type
+	length := -1
+	if ty.isArray() {
+		length = ty.Len
+	}
+	context := "array or slice literal"
+	index, count := 0, 0
+	indices := map[int]bool{}
+	for _, element := range literal.Elements {
+		position := element.Value
+		if element.Key != nil {
+			position = element.Key
+			keyType := InferTypeForNode(element.Key, scope, diagnostics)
+			if keyType.isInvalid() {
+				continue
+			}
+			if value := constantOf(element.Key); value == nil || value.Int == nil {
+				diagnostics.Add(errorAt(element.Key.token(), "index %s must be integer constant", exprString(element.Key)))
+				continue
+			}
+			if !checkIndex(element.Key, keyType, length, diagnostics) {
+				continue
+			}
+			index = int(constantOf(element.Key).Int.Int64())
+		} else if length >= 0 && index >= length {
+			diagnostics.Add(errorAt(element.Value.token(), "index %d is out of bounds (>= %d)", index, length))
+			continue
+		}
+		if indices[index] {
+			diagnostics.Add(errorAt(position.token(), "duplicate index %d in array or slice literal", index))
+		}
+		indices[index] = true
+		element.Index = index
+		index++
+		if index > count {
+			count = index
+		}
+
+		elem := ty.Elem
+		if value, ok := element.Value.(*CompositeLit); ok && value.elided {
+			// `&T` is elided from the element of type `*T`.
+			if elem.isPointer() {
+				value.Type = elem.Elem
+				element.Value = &UnaryOp{tok: value.token(), Op: TOKEN_AMP, Operand: value}
+			} else {
+				value.Type = elem
+			}
+		}
+		valueType := InferTypeForNode(element.Value, scope, diagnostics)
+		if !valueType.isInvalid() {
+			assignedType(element.Value, valueType, elem, context, diagnostics)
+		}
+	}
+	if ty.isArray() && ty.Len < 0 {
+		literal.Type = newArray(ty.Elem, count)
+	}
+	literal.Len = count
+}
+
+// inferQualifiedCall checks a call of a function, or a conversion to a type, qualified with an imported package.
+func inferQualifiedCall(call *FunctionCall, scope *Scope, diagnostics *Diagnostics) *Type {
+	if call.Import.Package == nil {
+		return &TypeInvalid
+	}
+	declared, ty, err := lookupImported(call.Import, call.token())
+	if err != nil {
+		diagnostics.Add(err)
+		return &TypeInvalid
+	}
+	if ty != nil {
+		call.Conversion = ty
+		return inferConversion(call, scope, diagnostics)
+	}
+	function, ok := declared.(*FunctionDecl)
+	if !ok {
+		diagnostics.Add(errorAt(call.token(), "invalid operation: cannot call non-function %s", qualifiedName(call.Import, call.Name())))
+		return &TypeInvalid
+	}
+	call.Function = function
+	inferArguments(call, scope, diagnostics)
+	return function.ReturnType
+}
+
+// lookupImported returns the package-level declaration `name` in the package imported by `spec`, which is either an `Expr` or a `*Type`.
+// It returns an error unless the declaration exists and is exported.
+func lookupImported(spec *ImportSpec, name *Token) (Expr, *Type, error) {
+	scope := spec.Package.Ast.scope
+	declared, isExpr := scope.exprs[name.Value]
+	if _, ok := declared.(*Builtin); ok {
+		isExpr = false
+	}
+	ty, isType := scope.types[name.Value]
+	isType = isType && ty.isDefined()
+	switch {
+	case !isExpr && !isType:
+		return nil, nil, errorAt(name, "undefined: %s", qualifiedName(spec, name.Value))
+	case !isExported(name.Value):
+		return nil, nil, errorAt(name, "name %s not exported by package %s", name.Value, spec.Package.Name)
+	case isType:
+		return nil, ty, nil
+	}
+	return declared, nil, nil
+}
+
+// isExported reports whether `name` can be referred to from other packages, which is true if it begins with an upper case letter.
+func isExported(name string) bool {
+	first, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(first)
+}
+
+// inferArguments checks the number and the types of the arguments of `call` against the parameters of the called function.
+// The only argument can be a call of a function with multiple results, which are passed as the arguments, as in `f(g())`.
+func inferArguments(call *FunctionCall, scope *Scope, diagnostics *Diagnostics) {
+	function := call.Function
+	types, expanded := inferValues(call.Arguments, scope, diagnostics)
+	if len(call.Arguments) == 0 {
+		types = nil
+	}
+	invalid := false
+	for i, ty := range types {
+		if ty == nil {
+			diagnostics.Add(errorAt(call.Arguments[i].token(), "%s() (no value) used as value", call.Arguments[i].token().Value))
+			invalid = true
+		} else if ty.isInvalid() {
+			invalid = true
+		}
+	}
+	// The errors in the arguments have been reported, and checking them against the parameters would only add confusing ones.
+	if invalid {
+		return
+	}
+	want := make([]*Type, len(function.Parameters))
+	for i, parameter := range function.Parameters {
+		want[i] = parameter.Ty
+	}
+	name := qualifiedName(call.Import, function.Name)
+	if len(types) != len(want) {
+		position := call.token()
+		switch {
+		case expanded:
+			position = call.Arguments[0].token()
+		case len(types) > len(want):
+			position = call.Arguments[len(want)].token()
+		case len(types) > 0:
+			position = call.Arguments[len(types)-1].token()
+		}
+		problem := "not enough"
+		if len(types) > len(want) {
+			problem = "too many"
+		}
+		diagnostics.Add(errorAt(position, "%s arguments in call to %s\n\thave %s\n\twant %s", problem, name, formatTypes(types), formatTypes(want)))
+		return
+	}
+	context := "argument to " + name
+	for i, ty := range types {
+		if !expanded {
+			assignedType(call.Arguments[i], ty, want[i], context, diagnostics)
+		} else if !isAssignable(ty, want[i]) {
+			diagnostics.Add(errorAt(call.Arguments[0].token(), "cannot use %s as %s value in %s", describeOperand(call.Arguments[0], ty), want[i].Name, context))
+		}
+	}
+}
+
+// inferConversion checks the conversion of the argument of `call` to type `call.Conversion`.
+// Only conversions between the same kinds of types are supported. A constant converted to an integer type is checked against its range.
+func inferConversion(call *FunctionCall, scope *Scope, diagnostics *Diagnostics) *Type {
+	ty := call.Conversion
+	if len(call.Arguments) != 1 {
+		if len(call.Arguments) == 0 {
+			diagnostics.Add(errorAt(call.token(), "missing argument in conversion to %s", ty.Name))
+		} else {
+			diagnostics.Add(errorAt(call.Arguments[1].token(), "too many arguments in conversion to %s", ty.Name))
+		}
+		return &TypeInvalid
+	}
+	argument := call.Arguments[0]
+	argumentType := InferTypeForNode(argument, scope, diagnostics)
+	if argumentType.isInvalid() {
+		return &TypeInvalid
+	}
+	// A struct can be converted to a struct type with the same fields, and a pointer to a pointer type to the same type.
+	convertible := hasSameKind(argumentType, ty) || argumentType.isStruct() && ty.isStruct() && hasSameFields(argumentType, ty) ||
+		argumentType.isPointer() && ty.isPointer() && isSameType(argumentType.Elem, ty.Elem) || argumentType.isNil() && ty.isPointer()
+	if argumentType == nil || !convertible {
+		diagnostics.Add(errorAt(argument.token(), "cannot convert %s to type %s", describeOperand(argument, argumentType), ty.Name))
+		return &TypeInvalid
+	}
+	if value := constantOf(argument); value != nil {
+		if value.Int != nil && !ty.representable(value.Int) {
+			diagnostics.Add(errorAt(argument.token(), "constant %s overflows %s", value.Int, ty.Name))
+			return &TypeInvalid
+		}
+		call.Constant = value.withType(ty)
+	}
+	return ty
+}
+
+// inferConstant evaluates the value of `constant` from the corresponding expression in its spec.
+func inferConstant(constant *Constant, diagnostics *Diagnostics) {
+	spec := constant.Spec
+	index := 0
+	for spec.Names[index] != constant {
+		index++
+	}
+	if index >= len(spec.Values) {
+		diagnostics.Add(errorAt(constant.token(), "missing init expr for const declaration"))
+		constant.Ty = &TypeInvalid
+		return
+	}
+
+	value := spec.Values[index]
+	constant.checking = true
+	ty := InferTypeForNode(value, spec.Scope, diagnostics)
+	constant.checking = false
+	if ty.isInvalid() || constant.Ty.isInvalid() {
+		constant.Ty = &TypeInvalid
+		return
+	}
+	if constantOf(value) == nil {
+		diagnostics.Add(errorAt(value.token(), "%s is not constant", describeOperand(value, ty)))
+		constant.Ty = &TypeInvalid
+		return
+	}
+	if spec.Type != nil {
+		if !ty.isUntyped() && !isSameType(ty, spec.Type) {
+			diagnostics.Add(errorAt(value.token(), "cannot use %s as %s value in constant declaration", describeOperand(value, ty), spec.Type.Name))
+			constant.Ty = &TypeInvalid
+			return
+		}
+		if !convertUntyped(value, spec.Type, "constant declaration", diagnostics) {
+			constant.Ty = &TypeInvalid
+			return
+		}
+	}
+	constant.Value = constantOf(value)
+	constant.Ty = constant.Value.Ty
+}
+
+// inferVarSpec checks the values of `spec` and determines the types of the variables it declares.
+func inferVarSpec(spec *VarSpec, diagnostics *Diagnostics) {
+	spec.checking = true
+	types, expanded := inferValues(spec.Values, spec.Scope, diagnostics)
+	spec.checking = false
+
+	names, values := len(spec.Names), len(types)
+	if values > names && !expanded {
+		extra := spec.Values[names]
+		diagnostics.Add(errorAt(extra.token(), "extra init expr %s", exprString(extra)))
+	} else if values > 0 && values != names {
+		reportAssignmentMismatch(names, spec.Values, types, expanded, diagnostics)
+	}
+	for i, variable := range spec.Names {
+		switch {
+		case values == names:
+			variable.Ty = assignedValue(spec.Values, i, expanded, types[i], spec.Type, "variable declaration", diagnostics)
+		case spec.Type != nil:
+			variable.Ty = spec.Type
+		default:
+			variable.Ty = &TypeInvalid
+		}
+	}
+}
+
+// assignedType checks that `value` of type `ty` can be assigned to a variable of type `target`, and returns the type of the variable.
+// If `target` is nil, the variable takes the type of the value, which is the default type for an untyped constant.
+// `context` describes the assignment in the error messages, such as "variable declaration".
+func assignedType(value Expr, ty *Type, target *Type, context string, diagnostics *Diagnostics) *Type {
+	if ty == nil {
+		diagnostics.Add(errorAt(value.token(), "%s() (no value) used as value", value.token().Value))
+		ty = &TypeInvalid
+	}
+	if target == nil && ty.isNil() {
+		diagnostics.Add(errorAt(value.token(), "use of untyped nil in %s", context))
+		return &TypeInvalid
+	}
+	if target == nil {
+		if !ty.isUntyped() {
+			return ty
+		}
+		if !convertUntyped(value, defaultType(ty), context, diagnostics) {
+			return &TypeInvalid
+		}
+		return defaultType(ty)
+	}
+	if ty.isUntyped() {
+		convertUntyped(value, target, context, diagnostics)
+	} else if !ty.isInvalid() && !isAssignable(ty, target) {
+		diagnostics.Add(errorAt(value.token(), "cannot use %s as %s value in %s", describeOperand(value, ty), target.Name, context))
+	} else if literal, ok := value.(*NilLiteral); ok {
+		// nil is the zero value of the type it is assigned to.
+		literal.Ty = target
+	}
+	return target
+}
+
+// inferAssignment checks the assignment of `values` to `lhs` respectively.
+// Each of `lhs` is an operand to assign to, or a `*Variable` declared by a short variable declaration, which takes the type of its value.
+func inferAssignment(lhs []Expr, values []Expr, scope *Scope, diagnostics *Diagnostics) {
+	targets := make([]*Type, len(lhs))
+	for i, operand := range lhs {
+		if _, ok := operand.(*Variable); ok || isBlank(operand) {
+			continue
+		}
+		if targets[i] = InferTypeForNode(operand, scope, diagnostics); !targets[i].isInvalid() && !checkAddressable(operand, diagnostics) {
+			targets[i] = &TypeInvalid
+		}
+	}
+	types, expanded := inferValues(values, scope, diagnostics)
+	if len(types) != len(lhs) {
+		reportAssignmentMismatch(len(lhs), values, types, expanded, diagnostics)
+		for _, operand := range lhs {
+			if variable, ok := operand.(*Variable); ok {
+				variable.Ty = &TypeInvalid
+			}
+		}
+		return
+	}
+	for i, operand := range lhs {
+		if variable, ok := operand.(*Variable); ok {
+			// gc calls the declaration an assignment only when it rejects an untyped nil.
+			context := "variable declaration"
+			if types[i] != nil && types[i].isNil() {
+				context = "assignment"
+			}
+			variable.Ty = assignedValue(values, i, expanded, types[i], nil, context, diagnostics)
+		} else if !targets[i].isInvalid() {
+			// A value assigned to the blank identifier takes its default type, as if it were assigned to a new variable.
+			assignedValue(values, i, expanded, types[i], targets[i], "assignment", diagnostics)
+		}
+	}
+}
+
+// inferValues infers the types of `values` assigned or returned together.
+// If the only value is a call of a function with multiple results, it is expanded to the types of the results, and `expanded` is true.
+func inferValues(values []Expr, scope *Scope, diagnostics *Diagnostics) (types []*Type, expanded bool) {
+	if len(values) == 1 {
+		ty := inferTuple(values[0], scope, diagnostics)
+		if ty.isTuple() {
+			return ty.Elements, true
+		}
+		return []*Type{ty}, false
+	}
+	types = make([]*Type, len(values))
+	for i, value := range values {
+		types[i] = InferTypeForNode(value, scope, diagnostics)
+	}
+	return types, false
+}
+
+// valueAt returns the expression of the `i`th value in `values`, which is the call itself for all the results if it has been expanded.
+func valueAt(values []Expr, i int, expanded bool) Expr {
+	if expanded {
+		return values[0]
+	}
+	return values[i]
+}
+
+// assignedValue is `assignedType` for the `i`th value in `values` of type `ty`.
+// If the values have been expanded from a call, it checks the `i`th result of the call.
+func assignedValue(values []Expr, i int, expanded bool, ty *Type, target *Type, context string, diagnostics *Diagnostics) *Type {
+	if !expanded {
+		return assignedType(values[i], ty, target, context, diagnostics)
+	}
+	if target == nil {
+		return ty
+	}
+	if !isSameType(ty, target) {
+		diagnostics.Add(errorAt(values[0].token(), "cannot use %s function result (value of type %s) as %s value in multiple assignment", ordinal(i+1), ty.Name, target.Name))
+	}
+	return target
+}
+
+// reportAssignmentMismatch reports that the number of `values` of `types` differs from `n` variables assigned them.
+func reportAssignmentMismatch(n int, values []Expr, types []*Type, expanded bool, diagnostics *Diagnostics) {
+	switch {
+	case len(values) == 1 && types[0].isInvalid():
+		// The error has been reported on the value.
+	case expanded:
+		name := values[0].(*FunctionCall).Name()
+		diagnostics.Add(errorAt(values[0].token(), "assignment mismatch: %s but %s returns %s", countOf(n, "variable"), name, countOf(len(types), "value")))
+	case len(values) == 1 && types[0] == nil:
+		diagnostics.Add(errorAt(values[0].token(), "%s() (no value) used as value", values[0].token().Value))
+	default:
+		diagnostics.Add(errorAt(values[0].token(), "assignment mismatch: %s but %s", countOf(n, "variable"), countOf(len(values), "value")))
+	}
+}
+
+// ordinal formats `n` as an ordinal number such as "1st" or "12th".
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// formatTypes formats `types` as a parenthesized list for error messages, such as "(int, string)".
+// An untyped numeric constant is shown as "number", and other untyped constants in their default types.
+func formatTypes(types []*Type) string {
+	names := make([]string, len(types))
+	for i, ty := range types {
+		if ty.Id == TypeIdUntypedInt {
+			names[i] = "number"
+		} else {
+			names[i] = typeName(defaultType(ty))
+		}
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+// isBlank reports whether `expr` is the blank identifier `_`.
+func isBlank(expr Expr) bool {
+	identifier, ok := expr.(*Identifier)
+	return ok && identifier.Name == "_"
+}
+
+// checkAddressable reports an error unless `expr` can be assigned to, which is true only for variables for now, including the ones pointed to.
+func checkAddressable(expr Expr, diagnostics *Diagnostics) bool {
+	if isAddressable(expr) {
+		return true
+	}
+	diagnostics.Add(errorAt(expr.token(), "cannot assign to %s (neither addressable nor a map index expression)", exprString(expr)))
+	return false
+}
+
+// isAddressable reports whether `expr` denotes a variable, which is a variable itself, the variable a pointer points to,
+// a field or an element of an array of a variable, or an element of a slice.
+func isAddressable(expr Expr) bool {
+	switch expr := expr.(type) {
+	case *Identifier:
+		return expr.Variable != nil
+	case *Selector:
+		return expr.Indirect || isAddressable(expr.X)
+	case *Index:
+		if expr.OperandType.isArray() {
+			return isAddressable(expr.X)
+		}
+		return expr.OperandType.isPointer() || expr.OperandType.isSlice()
+	case *UnaryOp:
+		return expr.Op == TOKEN_STAR
+	}
+	return false
+}
+
+// countOf formats `n` of `noun` for error messages, such as "1 value" or "2 values".
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// initializationOrder determines the order to initialize the package-level variables, in which every variable comes after the ones its value refers to.
+// Among the variables ready for initialization, the earliest in declaration order is initialized first.
+// A variable refers to another when its value uses it, or calls a function which refers to it.
+// Refer to this page for the rule: https://go.dev/ref/spec#Package_initialization
+func (ast *Ast) initializationOrder(diagnostics *Diagnostics) []*Variable {
+	references := map[Expr][]Expr{}
+	var variables []*Variable
+	for _, decl := range ast.vars {
+		for _, spec := range decl.Specs {
+			for _, variable := range spec.Names {
+				variables = append(variables, variable)
+				references[variable] = globalReferences(spec.value(variable))
+			}
+		}
+	}
+	for _, function := range ast.funcs {
+		references[function] = globalReferences(function.Body)
+	}
+
+	initialized := map[*Variable]bool{}
+	// The variables of imported packages have been initialized before the package.
+	for _, reference := range references {
+		for _, expr := range reference {
+			if variable, ok := expr.(*Variable); ok && variable.Spec.Scope != ast.scope {
+				initialized[variable] = true
+			}
+		}
+	}
+	// isReady reports whether all the variables which `expr` refers to are initialized, following the references through functions.
+	var isReady func(expr Expr, visited map[Expr]bool) bool
+	isReady = func(expr Expr, visited map[Expr]bool) bool {
+		for _, reference := range references[expr] {
+			if visited[reference] {
+				continue
+			}
+			visited[reference] = true
+			if variable, ok := reference.(*Variable); ok {
+				if !initialized[variable] {
+					return false
+				}
+			} else if !isReady(reference, visited) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var order []*Variable
+	for len(order) < len(variables) {
+		var next *Variable
+		for _, variable := range variables {
+			if !initialized[variable] && isReady(variable, map[Expr]bool{}) {
+				next = variable
+				break
+			}
+		}
+		if next != nil {
+			initialized[next] = true
+			order = append(order, next)
+			continue
+		}
+
+		// Every remaining variable depends on a cycle. Report the first one, and regard the variables in it as initialized to find more.
+		var cycle []Expr
+		// findCycle returns the path of references from `expr` back to `start` through the remaining variables, beginning with `expr`.
+		var findCycle func(start Expr, expr Expr, visited map[Expr]bool) []Expr
+		findCycle = func(start Expr, expr Expr, visited map[Expr]bool) []Expr {
+			visited[expr] = true
+			for _, reference := range references[expr] {
+				if reference == start {
+					return []Expr{expr}
+				}
+				if variable, ok := reference.(*Variable); visited[reference] || ok && initialized[variable] {
+					continue
+				}
+				if path := findCycle(start, reference, visited); path != nil {
+					return append([]Expr{expr}, path...)
+				}
+			}
+			return nil
+		}
+		for _, variable := range variables {
+			if !initialized[variable] {
+				if cycle = findCycle(variable, variable, map[Expr]bool{}); cycle != nil {
+					break
+				}
+			}
+		}
+		if cycle == nil {
+			break
+		}
+		reportInitializationCycle(cycle, diagnostics)
+		for _, expr := range cycle {
+			if variable, ok := expr.(*Variable); ok {
+				initialized[variable] = true
+				order = append(order, variable)
+			}
+		}
+	}
+	return order
+}
+
+func reportInitializationCycle(cycle []Expr, diagnostics *Diagnostics) {
+	if len(cycle) == 1 {
+		diagnostics.Add(errorAt(cycle[0].token(), "initialization cycle: %s refers to itself", declarationName(cycle[0])))
+		return
+	}
+	message := fmt.Sprintf("initialization cycle for %s", declarationName(cycle[0]))
+	for i, expr := range cycle {
+		message += fmt.Sprintf("\n\t%s refers to %s", declarationName(expr), declarationName(cycle[(i+1)%len(cycle)]))
+	}
+	diagnostics.Add(errorAt(cycle[0].token(), "%s", message))
+}
+
+func declarationName(expr Expr) string {
+	switch expr := expr.(type) {
+	case *Variable:
+		return expr.Name
+	case *FunctionDecl:
+		return expr.Name
+	}
+	return expr.token().Value
+}
+
+// globalReferences returns the package-level variables and the functions used in `expr`, without duplicates.
+func globalReferences(expr Expr) []Expr {
+	var references []Expr
+	found := map[Expr]bool{}
+	walk(expr, func(node Expr) {
+		var reference Expr
+		switch node := node.(type) {
+		case *Identifier:
+			if node.Variable != nil && node.Variable.Global {
+				reference = node.Variable
+			}
+		case *FunctionCall:
+			if node.Function != nil {
+				reference = node.Function
+			}
+		}
+		if reference != nil && !found[reference] {
+			found[reference] = true
+			references = append(references, reference)
+		}
+	})
+	return references
+}
+
+// inferShift checks a shift operation, whose count can be of any integer type unlike the operands of the other operators.
+func inferShift(expr *BinaryOp, lhsType *Type, rhsType *Type, diagnostics *Diagnostics) *Type {
+	if rhsType == nil || !rhsType.isInteger() {
+		diagnostics.Add(errorAt(expr.Rhs.token(), "invalid operation: shift count type %s, must be integer", typeName(defaultType(rhsType))))
+		return &TypeInvalid
+	}
+	count := constantOf(expr.Rhs)
+	if count != nil && count.Int.Sign() < 0 {
+		diagnostics.Add(errorAt(expr.Rhs.token(), "invalid operation: negative shift count %s", describeOperand(expr.Rhs, rhsType)))
+		return &TypeInvalid
+	}
+	if rhsType.isUntyped() {
+		setConstant(expr.Rhs, count.withType(&TypeUint))
+	}
+	if !isOperandTypeAllowed(expr.Op, lhsType) {
+		diagnostics.Add(errorAt(expr.token(), "invalid operation: operator %s not defined on %s", expr.token().Value, typeName(defaultType(lhsType))))
+		return &TypeInvalid
+	}
+
+	if lhs := constantOf(expr.Lhs); lhs != nil && count != nil {
+		if count.Int.Cmp(big.NewInt(maxShiftCount)) > 0 {
+			diagnostics.Add(errorAt(expr.Rhs.token(), "invalid shift count %s", describeOperand(expr.Rhs, rhsType)))
+			return &TypeInvalid
+		}
+		return foldConstant(expr, foldBinary(expr.Op, lhs, count), diagnostics)
+	}
+	// The shifted value is not constant, so an untyped constant has to become a value of int.
+	if lhsType.isUntyped() {
+		if !convertOperand(expr.Lhs, &TypeInt, diagnostics) {
+			return &TypeInvalid
+		}
+		return &TypeInt
+	}
+	return lhsType
+}
+
+// foldConstant records `value` evaluated from the operands of constant expression `expr`, and returns its type.
+// A typed constant has to be in the range of its type.
+func foldConstant(expr Expr, value *ConstantValue, diagnostics *Diagnostics) *Type {
+	setConstant(expr, value)
+	if value.Int != nil && !value.Ty.isUntyped() && !value.Ty.representable(value.Int) {
+		diagnostics.Add(errorAt(expr.token(), "%s overflows %s", describeOperand(expr, value.Ty), value.Ty.Name))
+		return &TypeInvalid
+	}
+	return value.Ty
+}
+
+// convertUntyped gives type `target` to `expr` if it is an untyped constant, as it is used where a value of `target` is expected.
+// `context` describes the use in the error message, such as "assignment". Returns false after reporting an error if it cannot be converted.
+func convertUntyped(expr Expr, target *Type, context string, diagnostics *Diagnostics) bool {
+	value := constantOf(expr)
+	if value == nil || !value.Ty.isUntyped() || target.isUntyped() {
+		return true
+	}
+	if !hasSameKind(value.Ty, target) {
+		diagnostics.Add(errorAt(expr.token(), "cannot use %s as %s value in %s", describeOperand(expr, value.Ty), target.Name, context))
+		return false
+	}
+	if value.Int != nil && !target.representable(value.Int) {
+		diagnostics.Add(errorAt(expr.token(), "cannot use %s as %s value in %s (overflows)", describeOperand(expr, value.Ty), target.Name, context))
+		return false
+	}
+	setConstant(expr, value.withType(target))
+	return true
+}
+
+// convertOperand gives type `target` to untyped constant `expr`, which is an operand of an operation with a typed operand.
+func convertOperand(expr Expr, target *Type, diagnostics *Diagnostics) bool {
+	value := constantOf(expr)
+	if value.Int != nil && !target.representable(value.Int) {
+		diagnostics.Add(errorAt(expr.token(), "%s overflows %s", describeOperand(expr, value.Ty), target.Name))
+		return false
+	}
+	setConstant(expr, value.withType(target))
+	return true
+}
+
+// describeOperand formats `expr` of type `ty` for error messages in the same way as gc, such as `300 (untyped int constant)` or `x (variable of type int)`.
+// The value of a constant is shown unless it is the same as the expression.
+func describeOperand(expr Expr, ty *Type) string {
+	text := exprString(expr)
+	if ty.isNil() {
+		return text
+	}
+	if value := constantOf(expr); value != nil {
+		formatted := ""
+		if value.format() != text {
+			formatted = " " + value.format()
+		}
+		if value.Ty.isUntyped() {
+			return fmt.Sprintf("%s (%s constant%s)", text, value.Ty.Name, formatted)
+		}
+		return fmt.Sprintf("%s (constant%s of %s)", text, formatted, describeType(value.Ty))
+	}
+	if isAddressable(expr) {
+		return fmt.Sprintf("%s (variable of %s)", text, describeType(ty))
+	}
+	return fmt.Sprintf("%s (value of %s)", text, describeType(ty))
+}
+
+// describeType formats `ty` in the description of an operand, such as `type int`.
+// A defined type is shown with its underlying type, such as `int type Celsius`.
+func describeType(ty *Type) string {
+	if ty.isDefined() && !ty.isInvalid() {
+		kind := ty.Underlying.Name
+		switch {
+		case ty.isStruct():
+			kind = "struct"
+		case ty.isPointer():
+			kind = "pointer"
+		case ty.isArray():
+			kind = "array"
+		case ty.isSlice():
+			kind = "slice"
+		}
+		return fmt.Sprintf("%s type %s", kind, ty.Name)
+	}
+	return "type " + typeName(ty)
+}
+
+// inferBuiltinCall checks the arguments of a call of a builtin function, whose types are `argumentTypes`.
+func inferBuiltinCall(call *FunctionCall, argumentTypes []*Type, diagnostics *Diagnostics) *Type {
+	// print reports the problems in each argument, while the others are checked only if all their arguments are valid.
+	for _, ty := range argumentTypes {
+		if ty.isInvalid() && call.Builtin.Name != "print" && call.Builtin.Name != "println" {
+			return &TypeInvalid
+		}
+	}
+	if call.Ellipsis && call.Builtin.Name != "append" {
+		diagnostics.Add(errorAt(call.token(), "invalid operation: invalid use of ... with built-in %s", call.Builtin.Name))
+		return &TypeInvalid
+	}
+	switch call.Builtin.Name {
+	case "len", "cap":
+		if !checkArgumentCount(call, 1, diagnostics) {
+			return &TypeInvalid
+		}
+		argument, ty := call.Arguments[0], argumentTypes[0]
+		length := ty != nil && (ty.isArray() || ty.isSlice() || ty.isPointer() && ty.Elem.isArray())
+		if call.Builtin.Name == "len" {
+			length = length || ty.isString()
+		}
+		if !length {
+			diagnostics.Add(errorAt(argument.token(), "invalid argument: %s for built-in %s", describeValue(argument, ty), call.Builtin.Name))
+			return &TypeInvalid
+		}
+		if ty.isUntyped() {
+			convertUntyped(argument, &TypeString, "argument to built-in len", diagnostics)
+			ty = &TypeString
+		}
+		call.OperandType = ty
+		// The length of a constant string is a constant, and so is the length of an array unless evaluating it calls a function.
+		if value := constantOf(argument); value != nil {
+			call.Constant = &ConstantValue{Ty: &TypeInt, Int: big.NewInt(int64(len(value.String)))}
+		} else if n := lengthOf(argument, ty); n >= 0 && !callsFunction(argument) {
+			call.Constant = &ConstantValue{Ty: &TypeInt, Int: big.NewInt(int64(n))}
+		}
+		return &TypeInt
+	case "make":
+		if call.TypeArgument == nil {
+			diagnostics.Add(errorAt(call.token(), "invalid operation: not enough arguments for %s (expected 1, found 0)", exprString(call)))
+			return &TypeInvalid
+		}
+		ty := call.TypeArgument
+		if ty.isInvalid() {
+			return &TypeInvalid
+		}
+		if !ty.isSlice() {
+			diagnostics.Add(errorAt(call.typeTok, "invalid argument: cannot make %s: type must be slice, map, or channel", ty.Name))
+			return &TypeInvalid
+		}
+		if n := len(call.Arguments); n < 1 || n > 2 {
+			diagnostics.Add(errorAt(call.token(), "invalid operation: %s expects 2 or 3 arguments; found %d", exprString(call), n+1))
+			return &TypeInvalid
+		}
+		for i, argument := range call.Arguments {
+			if !checkIndex(argument, argumentTypes[i], -1, diagnostics) {
+				return &TypeInvalid
+			}
+		}
+		if len(call.Arguments) == 2 {
+			length, capacity := constantOf(call.Arguments[0]), constantOf(call.Arguments[1])
+			if length != nil && capacity != nil && length.Int.Cmp(capacity.Int) > 0 {
+				diagnostics.Add(errorAt(call.Arguments[0].token(), "invalid argument: length and capacity swapped"))
+				return &TypeInvalid
+			}
+		}
+		return ty
+	case "append":
+		if len(call.Arguments) == 0 {
+			diagnostics.Add(errorAt(call.token(), "invalid operation: not enough arguments for %s (expected 1, found 0)", exprString(call)))
+			return &TypeInvalid
+		}
+		slice, ty := call.Arguments[0], argumentTypes[0]
+		if !ty.isSlice() {
+			diagnostics.Add(errorAt(slice.token(), "invalid append: argument must be a slice; have %s", describeBuiltinArgument(slice, ty)))
+			return &TypeInvalid
+		}
+		call.OperandType = ty
+		context := "argument to append"
+		if call.Ellipsis {
+			if len(call.Arguments) != 2 {
+				diagnostics.Add(errorAt(call.token(), "can only use ... with final argument in list"))
+				return &TypeInvalid
+			}
+			// A string can be appended to a slice of bytes as its bytes.
+			if elements := argumentTypes[1]; !(elements.isString() && ty.Elem.Id == TypeIdUint8) {
+				assignedType(call.Arguments[1], elements, newSlice(ty.Elem), context, diagnostics)
+			} else if elements.isUntyped() {
+				convertUntyped(call.Arguments[1], &TypeString, context, diagnostics)
+			}
+			return ty
+		}
+		for i, argument := range call.Arguments[1:] {
+			assignedType(argument, argumentTypes[i+1], ty.Elem, context, diagnostics)
+		}
+		return ty
+	case "copy":
+		if !checkArgumentCount(call, 2, diagnostics) {
+			return &TypeInvalid
+		}
+		for i, argument := range call.Arguments {
+			// A string can be copied to a slice of bytes as its bytes.
+			if ty := argumentTypes[i]; !ty.isSlice() && !(i == 1 && ty.isString()) {
+				diagnostics.Add(errorAt(argument.token(), "invalid copy: argument must be a slice; have %s", describeBuiltinArgument(argument, ty)))
+				return &TypeInvalid
+			}
+		}
+		dst, src := argumentTypes[0], argumentTypes[1]
+		srcElem, srcElemName := src.Elem, ""
+		if src.isString() {
+			// gc calls the elements of a string bytes.
+			srcElem, srcElemName = &TypeUint8, "byte"
+			convertUntyped(call.Arguments[1], &TypeString, "argument to copy", diagnostics)
+		} else {
+			srcElemName = srcElem.Name
+		}
+		if !isSameType(dst.Elem, srcElem) {
+			diagnostics.Add(errorAt(call.Arguments[0].token(), "invalid copy: arguments %s and %s have different element types %s and %s",
+				describeOperand(call.Arguments[0], dst), describeOperand(call.Arguments[1], src), dst.Elem.Name, srcElemName))
+			return &TypeInvalid
+		}
+		call.OperandType = dst
+		return &TypeInt
+	case "new":
+		if call.TypeArgument == nil || len(call.Arguments) > 0 {
+			problem, found := "not enough", 0
+			if call.TypeArgument != nil {
+				problem, found = "too many", len(call.Arguments)+1
+			}
+			diagnostics.Add(errorAt(call.token(), "invalid operation: %s arguments for %s (expected 1, found %d)", problem, exprString(call), found))
+			return &TypeInvalid
+		}
+		if call.TypeArgument.isInvalid() {
+			return &TypeInvalid
+		}
+		return newPointer(call.TypeArgument)
+	case "print", "println":
+		for i, ty := range argumentTypes {
+			if ty == nil {
+				diagnostics.Add(errorAt(call.Arguments[i].token(), "%s() (no value) used as value", call.Arguments[i].token().Value))
+			} else if ty.isNil() {
+				diagnostics.Add(errorAt(call.Arguments[i].token(), "use of untyped nil in argument to built-in %s", call.Builtin.Name))
+			} else if ty.isUntyped() {
+				convertUntyped(call.Arguments[i], defaultType(ty), "argument to built-in "+call.Builtin.Name, diagnostics)
+			} else if ty.isStruct() || ty.isArray() {
+				diagnostics.Add(errorAt(call.Arguments[i].token(), "illegal types for operand: %s\n\t%s", call.Builtin.Name, ty.Name))
+			}
+		}
+	}
+	return nil
+}
+
+// checkArgumentCount reports an error unless builtin `call` has `n` arguments.
+func checkArgumentCount(call *FunctionCall, n int, diagnostics *Diagnostics) bool {
+	if len(call.Arguments) == n {
+		return true
+	}
+	problem := "not enough"
+	if len(call.Arguments) > n {
+		problem = "too many"
+	}
+	diagnostics.Add(errorAt(call.token(), "invalid operation: %s arguments for %s (expected %d, found %d)", problem, exprString(call), n, len(call.Arguments)))
+	return false
+}
+
+// describeBuiltinArgument is `describeValue` which describes nil by its type as gc does for the arguments of the builtins.
+func describeBuiltinArgument(expr Expr, ty *Type) string {
+	if ty.isNil() {
+		return ty.Name
+	}
+	return describeValue(expr, ty)
+}
+
+// callsFunction reports whether evaluating `expr` calls a function, which makes the length of an array in it not constant.
+func callsFunction(expr Expr) bool {
+	calls := false
+	walk(expr, func(node Expr) {
+		if call, ok := node.(*FunctionCall); ok && call.Function != nil {
+			calls = true
+		}
+	})
+	return calls
+}
+
+// isTerminating reports whether `stmt` is a terminating statement, after which control never reaches.
+// Refer to this page for the rule: https://go.dev/ref/spec#Terminating_statements
+func isTerminating(stmt Expr) bool {
+	switch stmt := stmt.(type) {
+	case *Return:
+		return true
+	case *Block:
+		if len(stmt.Body) == 0 {
+			return false
+		}
+		return isTerminating(stmt.Body[len(stmt.Body)-1])
+	case *If:
+		return stmt.Else != nil && isTerminating(stmt.Then) && isTerminating(stmt.Else)
+	case *For:
+		return stmt.Cond == nil && !stmt.hasBreak
+	}
+	return false
+}
+
+func isComparisonOperator(op TokenKind) bool {
+	switch op {
+	case TOKEN_EQ, TOKEN_NE, TOKEN_LT, TOKEN_LE, TOKEN_GT, TOKEN_GE:
+		return true
+	default:
+		return false
+	}
+}
+
+// isOperandTypeAllowed reports whether an operand of type `ty` can be applied to the unary or binary operator `op`.
+func isOperandTypeAllowed(op TokenKind, ty *Type) bool {
+	switch op {
+	case TOKEN_EQ, TOKEN_NE:
+		return ty.isComparable()
+	case TOKEN_PLUS, TOKEN_LT, TOKEN_LE, TOKEN_GT, TOKEN_GE:
+		return ty.isInteger() || ty.isString()
+	case TOKEN_ANDAND, TOKEN_OROR, TOKEN_NOT:
+		return ty.isBoolean()
+	default:
+		return ty.isInteger()
+	}
+}
+
+// operatorVerb describes what a binary operator does to its operands in error messages.
+func operatorVerb(op TokenKind) string {
+	switch op {
+	case TOKEN_PLUS:
+		return "adding"
+	case TOKEN_MINUS:
+		return "subtracting"
+	case TOKEN_STAR:
+		return "multiplying"
+	case TOKEN_SLASH, TOKEN_PERCENT:
+		return "dividing"
+	case TOKEN_SHL, TOKEN_SHR:
+		return "shifting"
+	case TOKEN_EQ, TOKEN_NE, TOKEN_LT, TOKEN_LE, TOKEN_GT, TOKEN_GE:
+		return "comparing"
+	default:
+		return "combining"
+	}
+}
+
+func typeName(ty *Type) string {
+	if ty == nil {
+		return "()"
 	}
-	return nil, nil
+	return ty.Name
 }
@@ -7,7 +7,7 @@ import (
 )
 
 func TestTypeResolveVariable(t *testing.T) {
-	stream := NewByteStream("func main() int {\nx := 1\nreturn x\n}\n")
+	stream := NewByteStream("package main\nfunc main() int {\nx := 1\nreturn x\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -15,13 +15,13 @@ func TestTypeResolveVariable(t *testing.T) {
 	assert.NoError(t, err)
 
 	assign := ast.funcs[0].Body.Body[0].(*Assign)
-	assert.Equal(t, &TypeInt, assign.Lhs.(*Variable).Ty)
+	assert.Equal(t, &TypeInt, assign.Lhs[0].(*Variable).Ty)
 	ret := ast.funcs[0].Body.Body[1].(*Return)
-	assert.Equal(t, &TypeInt, ret.Node.(*Identifier).Variable.Ty)
+	assert.Equal(t, &TypeInt, ret.Values[0].(*Identifier).Variable.Ty)
 }
 
 func TestTypeResolveAdd(t *testing.T) {
-	stream := NewByteStream("func main() int {\nx := 1 \nreturn x\n}\n")
+	stream := NewByteStream("package main\nfunc main() int {\nx := 1 \nreturn x\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -29,11 +29,11 @@ func TestTypeResolveAdd(t *testing.T) {
 	assert.NoError(t, err)
 
 	assign := ast.funcs[0].Body.Body[0].(*Assign)
-	assert.Equal(t, &TypeInt, assign.Lhs.(*Variable).Ty)
+	assert.Equal(t, &TypeInt, assign.Lhs[0].(*Variable).Ty)
 }
 
 func TestTypeCallFunctionWithoutArgument(t *testing.T) {
-	stream := NewByteStream("func main() int {\nx := f() + 1 \nreturn x\n}\n func f() int {\nreturn 2\n}\n")
+	stream := NewByteStream("package main\nfunc main() int {\nx := f() + 1 \nreturn x\n}\n func f() int {\nreturn 2\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -41,8 +41,8 @@ func TestTypeCallFunctionWithoutArgument(t *testing.T) {
 	assert.NoError(t, err)
 
 	assign := ast.funcs[0].Body.Body[0].(*Assign)
-	assert.Equal(t, &TypeInt, assign.Lhs.(*Variable).Ty)
-	fuctionCall := assign.Rhs.(*AddOp).Lhs.(*FunctionCall)
+	assert.Equal(t, &TypeInt, assign.Lhs[0].(*Variable).Ty)
+	fuctionCall := assign.Rhs[0].(*BinaryOp).Lhs.(*FunctionCall)
 	assert.Equal(t, &TypeInt, fuctionCall.Function.ReturnType)
 
 	x, ok := ast.funcs[0].Scope.GetExpr("x")
@@ -51,7 +51,7 @@ func TestTypeCallFunctionWithoutArgument(t *testing.T) {
 }
 
 func TestTypeCallFunctionWithArgument(t *testing.T) {
-	stream := NewByteStream("func main() int {\nx := f(1)\nreturn x\n}\nfunc f(a int) int {\nreturn a\n}\n")
+	stream := NewByteStream("package main\nfunc main() int {\nx := f(1)\nreturn x\n}\nfunc f(a int) int {\nreturn a\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
@@ -64,56 +64,670 @@ func TestTypeCallFunctionWithArgument(t *testing.T) {
 }
 
 func TestReturnUndefinedVariable(t *testing.T) {
-	stream := NewByteStream("func main() int {\nreturn abc\n}\n")
+	stream := NewByteStream("package main\nfunc main() int {\nreturn abc\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
 	err = ast.InferType()
-	assert.EqualError(t, err, "2:8: undefined: abc")
+	assert.EqualError(t, err, "3:8: undefined: abc")
 }
 
 func TestNotEnoughReturnType(t *testing.T) {
-	stream := NewByteStream("func f() bool {}\n")
+	stream := NewByteStream("package main\nfunc f() bool {}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
 	err = ast.InferType()
-	assert.EqualError(t, err, "1:1: not enough return values\n\thave: ()\n\twant: (bool)")
+	assert.EqualError(t, err, "2:16: missing return")
 }
 
 func TestTooManyReturnType(t *testing.T) {
-	stream := NewByteStream("func f() {\nx := 1\nreturn x\n}\n")
+	stream := NewByteStream("package main\nfunc f() {\nx := 1\nreturn x\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
 	err = ast.InferType()
-	assert.EqualError(t, err, "1:1: too many return values\n\thave: (int)\n\twant: ()")
+	assert.EqualError(t, err, "2:1: too many return values\n\thave: (int)\n\twant: ()")
 }
 
 func TestDiffentReturnType(t *testing.T) {
-	stream := NewByteStream("func f() bool {\nx := 1\nreturn x\n}\n")
+	stream := NewByteStream("package main\nfunc f() bool {\nx := 1\nreturn x\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
 	err = ast.InferType()
-	assert.EqualError(t, err, "1:1: cannot use int as bool in return statement")
+	assert.EqualError(t, err, "2:1: cannot use int as bool in return statement")
 }
 
 func TestDifferentTypeAdd(t *testing.T) {
-	stream := NewByteStream("func main() int {\nreturn 1 + true\n}\n")
+	stream := NewByteStream("package main\nfunc main() int {\nreturn 1 + true\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
 	err = ast.InferType()
-	assert.EqualError(t, err, "2:10: invalid operation: adding different types")
+	assert.EqualError(t, err, "3:10: invalid operation: adding different types")
 }
 
 func TestAddingNil(t *testing.T) {
 	// `returnType` node of `f` is nil because of its declaration.
-	stream := NewByteStream("func main() int {\nreturn 1 + f(1, 2)\n}\nfunc f(x int, y int) {\nz := x + y\nreturn z\n}\n")
+	stream := NewByteStream("package main\nfunc main() int {\nreturn 1 + f(1, 2)\n}\nfunc f(x int, y int) {\nz := x + y\nreturn z\n}\n")
 	tokenStream, _ := Tokenize(stream)
 	ast, err := Parse(tokenStream)
 	assert.NoError(t, err)
 	err = ast.InferType()
-	assert.EqualError(t, err, "2:10: invalid operation: adding different types")
+	assert.EqualError(t, err, "3:10: invalid operation: adding different types\n5:1: too many return values\n\thave: (int)\n\twant: ()")
+}
+
+func TestIfElseBothArmsReturn(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f(b bool) int {\nif b {\nreturn 1\n} else {\nreturn 2\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+}
+
+func TestIfWithoutElseIsNotTerminating(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f(b bool) int {\nif b {\nreturn 1\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, "6:1: missing return")
+}
+
+func TestElseIfChainWithoutElseIsNotTerminating(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f(n int) int {\nif n < 0 {\nreturn -1\n} else if n > 0 {\nreturn 1\n}\n}\nfunc g() (int, int) {\nreturn 1\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, "8:1: missing return\n9:1: not enough return values\n\thave: (number)\n\twant: (int, int)")
+}
+
+func TestReturnTypeInIfArm(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f(b bool) int {\nif b {\nreturn true\n}\nreturn 1\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, "2:1: cannot use bool as int in return statement")
+}
+
+func TestNonBooleanCondition(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f() {\nif 1 {\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, "3:4: non-boolean condition in if statement")
+}
+
+func TestShadowingInIfBlock(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f() int {\nx := 1\nif true {\ny := x\nx := true\nreturn y\n}\nreturn x\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+}
+
+func TestInfiniteForIsTerminating(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f() int {\nfor {\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+}
+
+func TestForWithBreakIsNotTerminating(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f() int {\nfor {\nbreak\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, "6:1: missing return")
+}
+
+func TestNonBooleanForCondition(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f() {\nfor i := 1; i; {\n}\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, "3:13: non-boolean condition in for statement")
+}
+
+func TestComparisonYieldsBool(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nx := 1 < 2\ny := true == false\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+
+	x := ast.funcs[0].Body.Body[0].(*Assign)
+	assert.Equal(t, &TypeBool, x.Lhs[0].(*Variable).Ty)
+	y := ast.funcs[0].Body.Body[1].(*Assign)
+	assert.Equal(t, &TypeBool, y.Lhs[0].(*Variable).Ty)
+}
+
+func TestLogicalOperatorRequiresBool(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nx := 1 && 2\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, "3:8: invalid operation: operator && not defined on int")
+}
+
+func TestOrderedComparisonOnBool(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nx := true < false\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, "3:11: invalid operation: operator < not defined on bool")
+}
+
+func TestUnaryNotOnInt(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nx := !1\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, "3:6: invalid operation: operator ! not defined on int")
+}
+
+func TestReportAllTypeErrors(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() int {\nx := y + 1\nz := x + true\nif 1 {\n}\nreturn false\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	// `x` and `z` have invalid types because of the errors, which are not reported again where they are used.
+	assert.EqualError(t, err, `2:1: cannot use bool as int in return statement
+3:6: undefined: y
+5:4: non-boolean condition in if statement`)
+}
+
+func TestStringOperators(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nx := \"a\" + \"b\"\ny := x < \"c\" && len(x) == 2\nz := -x\nprintln(x, y, len(1))\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `5:6: invalid operation: operator - not defined on string
+6:19: invalid argument: 1 (untyped int constant) for built-in len`)
+}
+
+func TestBuiltinWithoutValue(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nx := println(1)\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, "3:6: println() (no value) used as value")
+}
+
+func TestIntegerConversions(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\na := int8(127)\nb := uint64(18446744073709551615)\nc := byte(a) + uint8(1)\nd := rune(c) << b\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+}
+
+func TestConstantOverflow(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\na := 9223372036854775808\nb := int8(128)\nc := uint8(-1)\nd := int8(-128)\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `3:6: cannot use 9223372036854775808 (untyped int constant) as int value in variable declaration (overflows)
+4:11: constant 128 overflows int8
+5:12: constant -1 overflows uint8`)
+}
+
+func TestInvalidConversions(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\na := int8(true)\nb := int16()\nc := int32(1, 2)\nd := int8(1) + int16(1)\ne := 1 << true\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `3:11: cannot convert true (untyped bool constant) to type int8
+4:6: missing argument in conversion to int16
+5:15: too many arguments in conversion to int32
+6:14: invalid operation: adding different types
+7:11: invalid operation: shift count type bool, must be integer`)
+}
+
+func TestConstantDeclarations(t *testing.T) {
+	stream := NewByteStream("package main\nconst (\nKB = 1 << (10 * (iota + 1))\nMB\nGB\n)\nconst huge = 1 << 100\nconst small = huge >> 98\nfunc main() {\nconst x int8 = 100\nconst y = -x\na := huge / (1 << 90) + small\nb := y\nc := len(\"abc\") == 3\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+
+	for i, want := range []int64{1 << 10, 1 << 20, 1 << 30} {
+		constant := ast.consts[0].Specs[i].Names[0]
+		assert.Equal(t, &TypeUntypedInt, constant.Ty)
+		assert.Equal(t, want, constant.Value.Int.Int64())
+	}
+	body := ast.funcs[0].Body.Body
+	y := body[1].(*ConstDecl).Specs[0].Names[0]
+	assert.Equal(t, &TypeInt8, y.Ty)
+	assert.Equal(t, "-100", y.Value.format())
+	a := body[2].(*Assign)
+	assert.Equal(t, &TypeInt, a.Lhs[0].(*Variable).Ty)
+	assert.Equal(t, "1028", constantOf(a.Rhs[0]).format())
+	assert.Equal(t, &TypeInt8, body[3].(*Assign).Lhs[0].(*Variable).Ty)
+	c := body[4].(*Assign)
+	assert.Equal(t, &TypeBool, c.Lhs[0].(*Variable).Ty)
+	assert.Equal(t, "true", constantOf(c.Rhs[0]).format())
+}
+
+func TestInvalidConstants(t *testing.T) {
+	stream := NewByteStream("package main\nconst a int8 = 200\nconst b = 1 / 0\nconst c, d = 1\nconst e = f()\nconst g = h\nconst h = g\nfunc f() int {\nreturn 1\n}\nfunc main() {\nconst x int8 = 100\ny := x * 2\nz := iota\nw := 1 << 64\nv := 1 << -1\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `2:16: cannot use 200 (untyped int constant) as int8 value in constant declaration (overflows)
+3:15: invalid operation: division by zero
+4:10: missing init expr for const declaration
+5:11: f() (value of type int) is not constant
+6:7: invalid cycle in declaration of g
+13:8: x * 2 (constant 200 of type int8) overflows int8
+14:6: cannot use iota outside constant declaration
+15:8: cannot use 1 << 64 (untyped int constant 18446744073709551616) as int value in variable declaration (overflows)
+16:11: invalid operation: negative shift count -1 (untyped int constant)`)
+}
+
+func TestVarDeclarations(t *testing.T) {
+	stream := NewByteStream("package main\nvar a = b + 1\nvar b = f()\nvar c, d uint8 = 1, 2\nvar e string\nfunc f() int {\nreturn c0\n}\nconst c0 = 3\nfunc main() {\nvar x int8 = 1\nvar y = x\nvar z, w = \"z\", true\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+
+	var names []string
+	for _, variable := range ast.initOrder {
+		names = append(names, variable.Name)
+	}
+	assert.Equal(t, []string{"b", "a", "c", "d", "e"}, names)
+	assert.Equal(t, &TypeInt, ast.vars[0].Specs[0].Names[0].Ty)
+	assert.Equal(t, &TypeUint8, ast.vars[2].Specs[0].Names[1].Ty)
+	assert.Equal(t, &TypeString, ast.vars[3].Specs[0].Names[0].Ty)
+	body := ast.funcs[1].Body.Body
+	assert.Equal(t, &TypeInt8, body[1].(*VarDecl).Specs[0].Names[0].Ty)
+	z := body[2].(*VarDecl).Specs[0].Names
+	assert.Equal(t, &TypeString, z[0].Ty)
+	assert.Equal(t, &TypeBool, z[1].Ty)
+}
+
+func TestInvalidVarDeclarations(t *testing.T) {
+	stream := NewByteStream("package main\nvar a, b = 1\nvar c = 1, 2\nvar d int = \"d\"\nvar e = g()\nvar x = f()\nvar y = x\nvar z int8 = z\nfunc f() int {\nreturn y\n}\nfunc g() {\n}\nfunc main() {\nvar p int8 = 300\nvar q int16 = p\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `2:12: assignment mismatch: 2 variables but 1 value
+3:12: extra init expr 2
+4:13: cannot use "d" (untyped string constant) as int value in variable declaration
+5:9: g() (no value) used as value
+6:5: initialization cycle for x
+	x refers to f
+	f refers to y
+	y refers to x
+8:5: initialization cycle: z refers to itself
+15:14: cannot use 300 (untyped int constant) as int8 value in variable declaration (overflows)
+16:15: cannot use p (variable of type int8) as int16 value in variable declaration`)
+}
+
+func TestAssignments(t *testing.T) {
+	stream := NewByteStream("package main\nvar g int8\nfunc main() {\nvar s string\nx := 1\ng = 100\ng += 27\ns += \"s\"\nx, _ = 2, \"blank\"\nx++\n_ = g\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+
+	body := ast.funcs[0].Body.Body
+	assert.Equal(t, &TypeInt8, constantOf(body[2].(*AssignStmt).Rhs[0]).Ty)
+	assert.Equal(t, &TypeInt8, constantOf(body[3].(*AssignStmt).Rhs[0].(*BinaryOp).Rhs).Ty)
+	assert.Equal(t, &TypeString, constantOf(body[5].(*AssignStmt).Rhs[1]).Ty)
+}
+
+func TestInvalidAssignments(t *testing.T) {
+	stream := NewByteStream("package main\nconst c = 1\nfunc f() int {\nreturn 1\n}\nfunc main() {\nvar i8 int8\nvar s string\nx := 1\nx, s = 1\nc = 2\nf() = 3\nx = \"x\"\ni8 += 200\ns++\n_++\ny = 1\ni8 = x\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `10:8: assignment mismatch: 2 variables but 1 value
+11:1: cannot assign to c (neither addressable nor a map index expression)
+12:1: cannot assign to f() (neither addressable nor a map index expression)
+13:5: cannot use "x" (untyped string constant) as int value in assignment
+14:7: 200 (untyped int constant) overflows int8
+15:1: invalid operation: s++ (non-numeric type string)
+16:1: cannot use _ as value or type
+17:1: undefined: y
+18:6: cannot use x (variable of type int) as int8 value in assignment`)
+}
+
+func TestMultipleResults(t *testing.T) {
+	stream := NewByteStream("package main\nvar q, r = divmod(7, 2)\nfunc divmod(a int, b int) (int, int) {\nreturn a / b, a % b\n}\nfunc named() (x int8, s string) {\nx = 1\nreturn\n}\nfunc forward() (int, int) {\nreturn divmod(1, 2)\n}\nfunc main() {\na, b := named()\na, c := 2, true\n_, d := divmod(1, 2)\nprintln(a, b, c, d)\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "(int, int)", ast.funcs[0].ReturnType.Name)
+	assert.Equal(t, &TypeInt, ast.vars[0].Specs[0].Names[1].Ty)
+	body := ast.funcs[3].Body.Body
+	ab := body[0].(*Assign).Lhs
+	assert.Equal(t, &TypeInt8, ab[0].(*Variable).Ty)
+	assert.Equal(t, &TypeString, ab[1].(*Variable).Ty)
+	ac := body[1].(*Assign).Lhs
+	assert.Equal(t, &TypeInt8, ac[0].(*Identifier).Variable.Ty)
+	assert.Equal(t, &TypeBool, ac[1].(*Variable).Ty)
+	assert.Equal(t, &TypeInt, body[2].(*Assign).Lhs[1].(*Variable).Ty)
+}
+
+func TestInvalidMultipleResults(t *testing.T) {
+	stream := NewByteStream("package main\nvar p, q = g()\nfunc divmod(a int, b int) (int, int) {\nreturn a / b, a % b\n}\nfunc g() {\n}\nfunc f() (int, int) {\nreturn 1\n}\nfunc h() (string, int) {\nreturn divmod(1, 2)\n}\nfunc k() (int, int) {\nreturn\n}\nfunc main() {\nx := divmod(1, 2)\na, b, c := divmod(1, 2)\nprintln(divmod(1, 2) + 1)\nvar s string\ns, x = divmod(3, 4)\nvar t, u string = divmod(1, 2)\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `2:12: g() (no value) used as value
+8:1: not enough return values
+	have: (number)
+	want: (int, int)
+11:1: cannot use int as string in return statement
+14:1: not enough return values
+	have: ()
+	want: (int, int)
+18:6: assignment mismatch: 1 variable but divmod returns 2 values
+19:12: assignment mismatch: 3 variables but divmod returns 2 values
+20:9: multiple-value divmod(1, 2) (value of type (int, int)) in single-value context
+22:8: cannot use 1st function result (value of type int) as string value in multiple assignment
+23:19: cannot use 1st function result (value of type int) as string value in multiple assignment
+23:19: cannot use 2nd function result (value of type int) as string value in multiple assignment`)
+}
+
+func TestCallArguments(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f(a int8, s string) int8 {\nreturn a\n}\nfunc g() (int8, string) {\nreturn 1, \"a\"\n}\nfunc main() {\nvar x int8\nprintln(f(x, \"b\"), f(g()), f(1, \"c\"))\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+
+	call := ast.funcs[2].Body.Body[1].(*FunctionCall).Arguments[2].(*FunctionCall)
+	assert.Equal(t, &TypeInt8, call.Arguments[0].(*IntLiteral).Constant.Ty)
+}
+
+func TestInvalidCallArguments(t *testing.T) {
+	stream := NewByteStream("package main\nfunc f(a int) {\n}\nfunc f2(a int, s string) {\n}\nfunc g() (int, int) {\nreturn 1, 2\n}\nfunc h() {\n}\nfunc main() {\nf(true)\nf(1, 2, 3)\nf2(1)\nf2()\nf2(g())\nf(g())\nf2(1, 2)\nvar x string\nf(x)\nf(h())\nf(300000000000000000000)\nf(y)\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `12:3: cannot use true (untyped bool constant) as int value in argument to f
+13:6: too many arguments in call to f
+	have (number, number, number)
+	want (int)
+14:4: not enough arguments in call to f2
+	have (number)
+	want (int, string)
+15:1: not enough arguments in call to f2
+	have ()
+	want (int, string)
+16:4: cannot use g() (value of type int) as string value in argument to f2
+17:3: too many arguments in call to f
+	have (int, int)
+	want (int)
+18:7: cannot use 2 (untyped int constant) as string value in argument to f2
+20:3: cannot use x (variable of type string) as int value in argument to f
+21:3: h() (no value) used as value
+22:3: cannot use 300000000000000000000 (untyped int constant) as int value in argument to f (overflows)
+23:3: undefined: y`)
+}
+
+func TestDefinedTypes(t *testing.T) {
+	stream := NewByteStream("package main\nfunc main() {\nvar c Celsius = 1\nvar i int = c\nvar n Name = \"x\"\nvar s string = n\nvar b int8 = Celsius(1)\nprintln(c+Celsius(i), s, b, int(c))\n}\ntype Celsius int\ntype Name string\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `4:13: cannot use c (variable of int type Celsius) as int value in variable declaration
+6:16: cannot use n (variable of string type Name) as string value in variable declaration
+7:14: cannot use Celsius(1) (constant 1 of int type Celsius) as int8 value in variable declaration`)
+}
+
+func TestStructs(t *testing.T) {
+	stream := NewByteStream("package main\ntype P struct {\nx, y int\n}\nfunc main() {\np := P{y: 1}\np.x = p.y + 1\nvar a struct{ x, y int } = p\nq := P(a)\nprintln(p == q, a == p, p != P{1, 2})\n}\n")
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+
+	p := ast.types[0].Specs[0].Ty
+	literal := ast.funcs[0].Body.Body[0].(*Assign).Rhs[0].(*CompositeLit)
+	assert.Same(t, p.Fields[1], literal.Elements[0].Field)
+	selector := ast.funcs[0].Body.Body[1].(*AssignStmt).Lhs[0].(*Selector)
+	assert.Same(t, p.Fields[0], selector.Field)
+	assert.Same(t, p, selector.Struct)
+}
+
+func TestInvalidStructs(t *testing.T) {
+	stream := NewByteStream(`package main
+type P struct {
+	x, y int
+	s    string
+}
+type Q struct {
+	x, y int
+	s    string
+}
+func f() P {
+	return P{}
+}
+func main() {
+	p := P{1, 2}
+	q := P{x: 1, 2}
+	r := P{z: 1}
+	t := P{x: 1, x: 2}
+	u := P{1, 2, "a", 3}
+	var v Q = p
+	p.z = 1
+	f().x = 1
+	var w int = p
+	println(p.x.y, p == Q{}, p)
+	c := int{1}
+	_, _, _, _, _, _, _ = q, r, t, u, v, w, c
+}
+`)
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `14:13: too few values in struct literal of type P
+15:15: mixture of field:value and value elements in struct literal
+16:9: unknown field z in struct literal of type P
+17:15: duplicate field name x in struct literal
+18:20: too many values in struct literal of type P
+19:12: cannot use p (variable of struct type P) as Q value in variable declaration
+20:4: p.z undefined (type P has no field or method z)
+21:2: cannot assign to f().x (neither addressable nor a map index expression)
+22:14: cannot use p (variable of struct type P) as int value in variable declaration
+23:14: p.x.y undefined (type int has no field or method y)
+23:19: invalid operation: comparing different types
+23:27: illegal types for operand: println
+	P
+24:7: invalid composite literal type int`)
+}
+
+func TestPointers(t *testing.T) {
+	stream := NewByteStream(`package main
+type P struct {
+	x int
+}
+func main() {
+	a := 1
+	b := 2
+	p := &a
+	*p = b
+	q := &P{}
+	q.x = *p
+	r := new(P)
+	var s *P = nil
+	println(p == nil, q != r, s == nil, &q.x)
+}
+`)
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+
+	body := ast.funcs[0].Body.Body
+	assert.True(t, body[0].(*Assign).Lhs[0].(*Variable).Addressed)
+	assert.False(t, body[1].(*Assign).Lhs[0].(*Variable).Addressed)
+	assert.Equal(t, "*int", body[2].(*Assign).Lhs[0].(*Variable).Ty.Name)
+	selector := body[5].(*AssignStmt).Lhs[0].(*Selector)
+	assert.True(t, selector.Indirect)
+	assert.Same(t, ast.types[0].Specs[0].Ty, selector.Struct)
+	assert.Equal(t, "*P", body[6].(*Assign).Lhs[0].(*Variable).Ty.Name)
+	// The address of a field reached through a pointer does not make the pointer itself addressed.
+	assert.False(t, body[4].(*Assign).Lhs[0].(*Variable).Addressed)
+}
+
+func TestInvalidPointers(t *testing.T) {
+	stream := NewByteStream(`package main
+func f() int {
+	return 1
+}
+func main() {
+	x := 1
+	s := "s"
+	a := &1
+	b := *x
+	c := *nil
+	d := nil
+	var e = nil
+	g := new()
+	h := new(int, 1)
+	var i *int = &s
+	p := &x
+	j := p.x
+	println(nil)
+	k := &f()
+	_, _, _, _, _, _, _, _, _, _ = a, b, c, d, e, g, h, i, j, k
+}
+`)
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `8:8: invalid operation: cannot take address of 1 (untyped int constant)
+9:8: invalid operation: cannot indirect x (variable of type int)
+10:8: invalid operation: cannot indirect nil
+11:7: use of untyped nil in assignment
+12:10: use of untyped nil in variable declaration
+13:7: invalid operation: not enough arguments for new() (expected 1, found 0)
+14:7: invalid operation: too many arguments for new(int, 1) (expected 1, found 2)
+15:15: cannot use &s (value of type *string) as *int value in variable declaration
+17:9: p.x undefined (type *int has no field or method x)
+18:10: use of untyped nil in argument to built-in println
+19:8: invalid operation: cannot take address of f() (value of type int)`)
+}
+
+func TestArraysAndSlices(t *testing.T) {
+	stream := NewByteStream(`package main
+func main() {
+	a := [...]int{2: 1, 4}
+	s := []int{5: 1}
+	var p *[4]int
+	s = append(s[1:], a[:]...)
+	n := copy(s, a[2:])
+	for i, v := range p {
+		println(i, v, a[i], len(s), cap(a), n)
+	}
+	s = nil
+	println(s == nil, a == [4]int{}, "ab"[0])
+}
+`)
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.NoError(t, err)
+
+	body := ast.funcs[0].Body.Body
+	assert.Equal(t, "[4]int", body[0].(*Assign).Lhs[0].(*Variable).Ty.Name)
+	assert.Equal(t, 6, body[1].(*Assign).Rhs[0].(*CompositeLit).Len)
+	call := body[3].(*AssignStmt).Rhs[0].(*FunctionCall)
+	assert.Equal(t, "[]int", call.OperandType.Name)
+	assert.Equal(t, "[4]int", call.Arguments[1].(*SliceExpr).OperandType.Name)
+	loop := body[5].(*For)
+	assert.Equal(t, "*[4]int", loop.RangeType.Name)
+	assert.Equal(t, "int", loop.Value.(*Variable).Ty.Name)
+	assert.Equal(t, "[]int", body[6].(*AssignStmt).Rhs[0].(*NilLiteral).Ty.Name)
+}
+
+func TestInvalidArraysAndSlices(t *testing.T) {
+	stream := NewByteStream(`package main
+func main() {
+	var a [3]int
+	s := []int{1, 2}
+	x := a[5]
+	y := s["a"]
+	z := a[-1]
+	w := len(1, 2)
+	u := append(a, 1)
+	v := append(s, "a")
+	k := copy(s, a)
+	m := make(int)
+	o := make([]int)
+	q := make([]int, -1)
+	r := make([]int, 3, 2)
+	i := 1
+	g := i[0]
+	h := a[1:5]
+	f := s[2:1]
+	e := "ab"[1:2:2]
+	for x := range 1 {
+	}
+	_, _, _, _, _, _, _, _, _, _, _, _, _, _, _ = x, y, z, w, u, v, k, m, o, q, r, g, h, f, e
+}
+`)
+	tokenStream, _ := Tokenize(stream)
+	ast, err := Parse(tokenStream)
+	assert.NoError(t, err)
+	err = ast.InferType()
+	assert.EqualError(t, err, `5:9: invalid argument: index 5 out of bounds [0:3]
+6:9: cannot convert "a" (untyped string constant) to type int
+7:9: invalid argument: index -1 (constant of type int) must not be negative
+8:7: invalid operation: too many arguments for len(1, 2) (expected 1, found 2)
+9:14: invalid append: argument must be a slice; have a (variable of type [3]int)
+10:17: cannot use "a" (untyped string constant) as int value in argument to append
+11:15: invalid copy: argument must be a slice; have a (variable of type [3]int)
+12:12: invalid argument: cannot make int: type must be slice, map, or channel
+13:7: invalid operation: make([]int) expects 2 or 3 arguments; found 1
+14:19: invalid argument: index -1 (constant of type int) must not be negative
+15:19: invalid argument: length and capacity swapped
+17:8: cannot index i (variable of type int)
+18:11: invalid argument: index 5 out of bounds [0:4]
+19:11: invalid slice indices: 1 < 2
+20:16: invalid operation: 3-index slice of string
+21:17: cannot range over 1 (untyped int constant)`)
 }